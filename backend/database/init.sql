@@ -30,6 +30,7 @@ CREATE TABLE public.service_request_event (
     service_request_id character varying NOT NULL,
     step_name character varying NOT NULL,
     step_type character varying NOT NULL,
+    execution_id character varying DEFAULT '' NOT NULL,
     created_by character varying,
     created_at timestamp without time zone DEFAULT now()
 );
@@ -132,6 +133,202 @@ ALTER TABLE ONLY public.membership
     ADD CONSTRAINT membership_user_fkey FOREIGN KEY (user_id) REFERENCES public.user (user_id),
     ADD CONSTRAINT membership_org_fkey FOREIGN KEY (org_id) REFERENCES public.organization (org_id);
 
+CREATE TABLE public.job_queue (
+    job_id integer NOT NULL,
+    name character varying NOT NULL,
+    payload jsonb NOT NULL,
+    status character varying DEFAULT 'pending' NOT NULL,
+    attempts integer DEFAULT 0 NOT NULL,
+    run_at timestamp without time zone DEFAULT now() NOT NULL,
+    locked_until timestamp without time zone,
+    last_error character varying,
+    created_at timestamp without time zone DEFAULT now()
+);
+
+ALTER TABLE public.job_queue OWNER TO postgres;
+
+CREATE SEQUENCE public.job_queue_job_id_seq
+    AS integer
+    START WITH 1
+    INCREMENT BY 1
+    NO MINVALUE
+    NO MAXVALUE
+    CACHE 1;
+
+ALTER SEQUENCE public.job_queue_job_id_seq OWNER TO postgres;
+
+ALTER SEQUENCE public.job_queue_job_id_seq OWNED BY public.job_queue.job_id;
+
+ALTER TABLE ONLY public.job_queue ALTER COLUMN job_id SET DEFAULT nextval('public.job_queue_job_id_seq'::regclass);
+
+ALTER TABLE ONLY public.job_queue
+    ADD CONSTRAINT job_queue_pkey PRIMARY KEY (job_id);
+
+CREATE INDEX job_queue_status_run_at_idx ON public.job_queue USING btree (status, run_at);
+
+CREATE TABLE public.pipeline_schedule (
+    schedule_id integer NOT NULL,
+    pipeline_id character varying NOT NULL,
+    org_id integer NOT NULL,
+    user_id character varying NOT NULL,
+    cron_expression character varying NOT NULL,
+    time_zone character varying NOT NULL,
+    form_data jsonb DEFAULT '{}'::jsonb NOT NULL,
+    environment character varying DEFAULT '' NOT NULL,
+    missed_run_policy character varying DEFAULT 'skip' NOT NULL,
+    enabled boolean DEFAULT true NOT NULL,
+    next_run_at timestamp with time zone NOT NULL,
+    last_run_at timestamp with time zone,
+    last_service_request_id character varying DEFAULT '' NOT NULL,
+    created_on timestamp without time zone DEFAULT now(),
+    last_updated timestamp without time zone DEFAULT now()
+);
+
+ALTER TABLE public.pipeline_schedule OWNER TO postgres;
+
+CREATE SEQUENCE public.pipeline_schedule_schedule_id_seq
+    AS integer
+    START WITH 1
+    INCREMENT BY 1
+    NO MINVALUE
+    NO MAXVALUE
+    CACHE 1;
+
+ALTER SEQUENCE public.pipeline_schedule_schedule_id_seq OWNER TO postgres;
+
+ALTER SEQUENCE public.pipeline_schedule_schedule_id_seq OWNED BY public.pipeline_schedule.schedule_id;
+
+ALTER TABLE ONLY public.pipeline_schedule ALTER COLUMN schedule_id SET DEFAULT nextval('public.pipeline_schedule_schedule_id_seq'::regclass);
+
+ALTER TABLE ONLY public.pipeline_schedule
+    ADD CONSTRAINT pipeline_schedule_pkey PRIMARY KEY (schedule_id),
+    ADD CONSTRAINT pipeline_schedule_user_fkey FOREIGN KEY (user_id) REFERENCES public.user (user_id),
+    ADD CONSTRAINT pipeline_schedule_org_fkey FOREIGN KEY (org_id) REFERENCES public.organization (org_id);
+
+CREATE INDEX pipeline_schedule_enabled_next_run_at_idx ON public.pipeline_schedule USING btree (enabled, next_run_at);
+
+CREATE TABLE public.organization_secret (
+    org_id integer NOT NULL,
+    name character varying NOT NULL,
+    value bytea NOT NULL,
+    created_by character varying NOT NULL,
+    created_on timestamp without time zone DEFAULT now(),
+    last_updated timestamp without time zone DEFAULT now()
+);
+
+ALTER TABLE public.organization_secret OWNER TO postgres;
+
+ALTER TABLE ONLY public.organization_secret
+    ADD CONSTRAINT organization_secret_pkey PRIMARY KEY (org_id, name),
+    ADD CONSTRAINT organization_secret_org_fkey FOREIGN KEY (org_id) REFERENCES public.organization (org_id),
+    ADD CONSTRAINT organization_secret_user_fkey FOREIGN KEY (created_by) REFERENCES public.user (user_id);
+
+CREATE TABLE public.approval_event (
+    event_id integer NOT NULL,
+    event_type character varying NOT NULL,
+    service_request_id character varying NOT NULL,
+    step_name character varying NOT NULL,
+    execution_id character varying,
+    created_by character varying,
+    reason character varying,
+    created_at timestamp without time zone DEFAULT now()
+);
+
+ALTER TABLE public.approval_event OWNER TO postgres;
+
+CREATE SEQUENCE public.approval_event_event_id_seq
+    AS integer
+    START WITH 1
+    INCREMENT BY 1
+    NO MINVALUE
+    NO MAXVALUE
+    CACHE 1;
+
+ALTER SEQUENCE public.approval_event_event_id_seq OWNER TO postgres;
+
+ALTER SEQUENCE public.approval_event_event_id_seq OWNED BY public.approval_event.event_id;
+
+ALTER TABLE ONLY public.approval_event ALTER COLUMN event_id SET DEFAULT nextval('public.approval_event_event_id_seq'::regclass);
+
+ALTER TABLE ONLY public.approval_event
+    ADD CONSTRAINT approval_event_pkey PRIMARY KEY (event_id),
+    ADD CONSTRAINT approval_event_user_fkey FOREIGN KEY (created_by) REFERENCES public.user (user_id);
+
+CREATE INDEX approval_event_service_request_id_step_name_execution_id_idx ON public.approval_event USING btree (service_request_id, step_name, execution_id);
+
+CREATE TABLE public.agent (
+    agent_id integer NOT NULL,
+    org_id integer NOT NULL,
+    name character varying NOT NULL,
+    token_hash character varying NOT NULL,
+    created_by character varying NOT NULL,
+    created_on timestamp without time zone DEFAULT now(),
+    last_seen_on timestamp without time zone
+);
+
+ALTER TABLE public.agent OWNER TO postgres;
+
+CREATE SEQUENCE public.agent_agent_id_seq
+    AS integer
+    START WITH 1
+    INCREMENT BY 1
+    NO MINVALUE
+    NO MAXVALUE
+    CACHE 1;
+
+ALTER SEQUENCE public.agent_agent_id_seq OWNER TO postgres;
+
+ALTER SEQUENCE public.agent_agent_id_seq OWNED BY public.agent.agent_id;
+
+ALTER TABLE ONLY public.agent ALTER COLUMN agent_id SET DEFAULT nextval('public.agent_agent_id_seq'::regclass);
+
+ALTER TABLE ONLY public.agent
+    ADD CONSTRAINT agent_pkey PRIMARY KEY (agent_id),
+    ADD CONSTRAINT agent_token_hash_key UNIQUE (token_hash),
+    ADD CONSTRAINT agent_org_fkey FOREIGN KEY (org_id) REFERENCES public.organization (org_id),
+    ADD CONSTRAINT agent_user_fkey FOREIGN KEY (created_by) REFERENCES public.user (user_id);
+
+CREATE TABLE public.agent_task (
+    task_id integer NOT NULL,
+    org_id integer NOT NULL,
+    service_request_id character varying NOT NULL,
+    step_name character varying NOT NULL,
+    step_type character varying NOT NULL,
+    labels character varying[] DEFAULT '{}'::character varying[] NOT NULL,
+    status character varying DEFAULT 'queued'::character varying NOT NULL,
+    agent_id integer,
+    created_at timestamp without time zone DEFAULT now(),
+    claimed_at timestamp without time zone,
+    finished_at timestamp without time zone,
+    lease_expires_at timestamp without time zone,
+    execution_id character varying
+);
+
+ALTER TABLE public.agent_task OWNER TO postgres;
+
+CREATE SEQUENCE public.agent_task_task_id_seq
+    AS integer
+    START WITH 1
+    INCREMENT BY 1
+    NO MINVALUE
+    NO MAXVALUE
+    CACHE 1;
+
+ALTER SEQUENCE public.agent_task_task_id_seq OWNER TO postgres;
+
+ALTER SEQUENCE public.agent_task_task_id_seq OWNED BY public.agent_task.task_id;
+
+ALTER TABLE ONLY public.agent_task ALTER COLUMN task_id SET DEFAULT nextval('public.agent_task_task_id_seq'::regclass);
+
+ALTER TABLE ONLY public.agent_task
+    ADD CONSTRAINT agent_task_pkey PRIMARY KEY (task_id),
+    ADD CONSTRAINT agent_task_org_fkey FOREIGN KEY (org_id) REFERENCES public.organization (org_id),
+    ADD CONSTRAINT agent_task_agent_fkey FOREIGN KEY (agent_id) REFERENCES public.agent (agent_id) ON DELETE SET NULL;
+
+CREATE INDEX agent_task_org_id_status_idx ON public.agent_task USING btree (org_id, status);
+
+CREATE INDEX agent_task_service_request_id_step_name_idx ON public.agent_task USING btree (service_request_id, step_name);
+
 --
 -- PostgreSQL database dump complete
 --
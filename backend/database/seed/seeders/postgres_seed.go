@@ -6,8 +6,8 @@ import (
 
 	"github.com/joshtyf/flowforge/src/database"
 	"github.com/joshtyf/flowforge/src/database/client"
-	"github.com/joshtyf/flowforge/src/helper"
 	"github.com/joshtyf/flowforge/src/logger"
+	"github.com/joshtyf/flowforge/src/util"
 )
 
 func SeedPostgres() {
@@ -25,7 +25,7 @@ func SeedPostgres() {
 	createUsers := os.Getenv("CREATE_USERS")
 	if createUsers == "true" {
 		logger.Info("Creating users in Auth0")
-		helper.CreateUsersInAuth0(users, passwords)
+		util.CreateUsersInAuth0(users, passwords)
 	}
 	// Auth0 automatically concatenates the identity provider and user ID with a pipe separator
 	for _, user := range users {
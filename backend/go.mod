@@ -4,7 +4,6 @@ go 1.21.6
 
 require (
 	github.com/auth0/go-jwt-middleware/v2 v2.2.1
-	github.com/gookit/event v1.1.1
 	github.com/gorilla/handlers v1.5.2
 	github.com/gorilla/mux v1.8.1
 	github.com/lib/pq v1.10.9
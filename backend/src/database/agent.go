@@ -0,0 +1,63 @@
+package database
+
+import (
+	"database/sql"
+
+	"github.com/joshtyf/flowforge/src/database/models"
+)
+
+type Agent struct {
+	c *sql.DB
+}
+
+func NewAgent(c *sql.DB) *Agent {
+	return &Agent{c: c}
+}
+
+func (a *Agent) Create(am *models.AgentModel) (*models.AgentModel, error) {
+	if err := a.c.QueryRow(CreateAgentStatement, am.OrganizationId, am.Name, am.TokenHash, am.CreatedBy).Scan(&am.AgentId, &am.CreatedOn); err != nil {
+		return nil, err
+	}
+	return am, nil
+}
+
+func (a *Agent) GetAllByOrgId(orgId int) ([]*models.AgentModel, error) {
+	rows, err := a.c.Query(SelectAgentsByOrgIdStatement, orgId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ams := []*models.AgentModel{}
+	for rows.Next() {
+		am := &models.AgentModel{}
+		if err := rows.Scan(&am.AgentId, &am.OrganizationId, &am.Name, &am.TokenHash, &am.CreatedBy, &am.CreatedOn, &am.LastSeenOn); err != nil {
+			return nil, err
+		}
+		ams = append(ams, am)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return ams, nil
+}
+
+// Returns the agent which authenticates with the token of the hash. Returns sql.ErrNoRows if there is no such agent.
+func (a *Agent) GetByTokenHash(tokenHash string) (*models.AgentModel, error) {
+	am := &models.AgentModel{}
+	err := a.c.QueryRow(SelectAgentByTokenHashStatement, tokenHash).Scan(&am.AgentId, &am.OrganizationId, &am.Name, &am.TokenHash, &am.CreatedBy, &am.CreatedOn, &am.LastSeenOn)
+	if err != nil {
+		return nil, err
+	}
+	return am, nil
+}
+
+func (a *Agent) UpdateLastSeenOn(agentId int) error {
+	_, err := a.c.Exec(UpdateAgentLastSeenOnStatement, agentId)
+	return err
+}
+
+// Deletes the agent, which revokes its token. The tasks claimed by the agent are queued again.
+func (a *Agent) Delete(orgId int, agentId int) (sql.Result, error) {
+	return a.c.Exec(DeleteAgentStatement, orgId, agentId)
+}
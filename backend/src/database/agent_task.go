@@ -0,0 +1,127 @@
+package database
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/joshtyf/flowforge/src/database/models"
+	"github.com/lib/pq"
+)
+
+// Duration for which a claimed task is leased to its agent. The lease is renewed whenever the agent appends to the logs
+// of the task, and the task is queued again once the lease expires.
+const agentTaskLease = 5 * time.Minute
+
+type AgentTask struct {
+	c *sql.DB
+}
+
+func NewAgentTask(c *sql.DB) *AgentTask {
+	return &AgentTask{c: c}
+}
+
+func (at *AgentTask) Create(atm *models.AgentTaskModel) (*models.AgentTaskModel, error) {
+	if atm.Labels == nil {
+		atm.Labels = []string{}
+	}
+	err := at.c.QueryRow(CreateAgentTaskStatement, atm.OrganizationId, atm.ServiceRequestId, atm.StepName, atm.StepType, pq.Array(atm.Labels), atm.ExecutionId).
+		Scan(&atm.TaskId, &atm.Status, &atm.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return atm, nil
+}
+
+func (at *AgentTask) GetById(taskId int) (*models.AgentTaskModel, error) {
+	return scanAgentTask(at.c.QueryRow(SelectAgentTaskByIdStatement, taskId))
+}
+
+// Returns the task of the step which is queued or claimed. Returns sql.ErrNoRows if there is no such task.
+func (at *AgentTask) GetActiveByStep(serviceRequestId, stepName string) (*models.AgentTaskModel, error) {
+	return scanAgentTask(at.c.QueryRow(SelectActiveAgentTaskByStepStatement, serviceRequestId, stepName))
+}
+
+// Claims the oldest queued task of the organization which the agent can run, which is a task of one of the step types
+// whose labels are all among the labels of the agent. Returns sql.ErrNoRows if there is no task to claim.
+func (at *AgentTask) Claim(orgId int, agentId int, stepTypes []models.PipelineStepType, labels []string) (*models.AgentTaskModel, error) {
+	types := make([]string, len(stepTypes))
+	for i, stepType := range stepTypes {
+		types[i] = string(stepType)
+	}
+	if labels == nil {
+		labels = []string{}
+	}
+	return scanAgentTask(at.c.QueryRow(ClaimAgentTaskStatement, orgId, agentId, pq.Array(types), pq.Array(labels), agentTaskLease.Seconds()))
+}
+
+// Sets the execution of the step which the task is run for, e.g. when the step is re-driven after a server restart and
+// keeps its task
+func (at *AgentTask) UpdateExecutionId(taskId int, executionId string) error {
+	_, err := at.c.Exec(UpdateAgentTaskExecutionIdStatement, taskId, executionId)
+	return err
+}
+
+// Extends the lease of the task claimed by the agent. Returns false if the task is not claimed by the agent.
+func (at *AgentTask) RenewLease(taskId int, agentId int) (bool, error) {
+	res, err := at.c.Exec(RenewAgentTaskLeaseStatement, taskId, agentId, agentTaskLease.Seconds())
+	if err != nil {
+		return false, err
+	}
+	renewed, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return renewed > 0, nil
+}
+
+// Queues the claimed tasks whose lease has expired again, and returns them
+func (at *AgentTask) RequeueExpired() ([]*models.AgentTaskModel, error) {
+	rows, err := at.c.Query(RequeueExpiredAgentTasksStatement)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	atms := []*models.AgentTaskModel{}
+	for rows.Next() {
+		atm, err := scanAgentTask(rows)
+		if err != nil {
+			return nil, err
+		}
+		atms = append(atms, atm)
+	}
+	return atms, rows.Err()
+}
+
+// Records that the agent finished the task with the status. Returns false if the task is not claimed by the agent,
+// e.g. when the agent already reported on the task.
+func (at *AgentTask) Finish(taskId int, agentId int, status models.AgentTaskStatus) (bool, error) {
+	res, err := at.c.Exec(FinishAgentTaskStatement, taskId, agentId, status)
+	if err != nil {
+		return false, err
+	}
+	finished, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return finished > 0, nil
+}
+
+// Cancels the task if it has not finished, so that it is not claimed by agents
+func (at *AgentTask) Cancel(taskId int) error {
+	_, err := at.c.Exec(CancelAgentTaskStatement, taskId)
+	return err
+}
+
+func scanAgentTask(row interface{ Scan(dest ...any) error }) (*models.AgentTaskModel, error) {
+	atm := &models.AgentTaskModel{}
+	var labels pq.StringArray
+	// Tasks queued before tasks had execution IDs have none
+	var executionId sql.NullString
+	err := row.Scan(&atm.TaskId, &atm.OrganizationId, &atm.ServiceRequestId, &atm.StepName, &atm.StepType, &labels, &atm.Status, &atm.AgentId, &atm.CreatedAt, &atm.ClaimedAt, &atm.FinishedAt, &atm.LeaseExpiresAt, &executionId)
+	if err != nil {
+		return nil, err
+	}
+	atm.Labels = []string(labels)
+	atm.ExecutionId = executionId.String
+	return atm, nil
+}
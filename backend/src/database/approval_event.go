@@ -0,0 +1,55 @@
+package database
+
+import (
+	"database/sql"
+
+	"github.com/joshtyf/flowforge/src/database/models"
+)
+
+type ApprovalEvent struct {
+	c *sql.DB
+}
+
+func NewApprovalEvent(c *sql.DB) *ApprovalEvent {
+	return &ApprovalEvent{c: c}
+}
+
+func (ae *ApprovalEvent) Create(aem *models.ApprovalEventModel) (*models.ApprovalEventModel, error) {
+	err := ae.c.QueryRow(CreateApprovalEventStatement, aem.EventType, aem.ServiceRequestId, aem.StepName, aem.ExecutionId, aem.CreatedBy, aem.Reason).Scan(&aem.EventId, &aem.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return aem, nil
+}
+
+// Returns the approval events of all the steps of the service request, including those of previous attempts of the steps
+func (ae *ApprovalEvent) GetAllByServiceRequestId(serviceRequestId string) ([]*models.ApprovalEventModel, error) {
+	return ae.query(SelectApprovalEventsByServiceRequestIdStatement, serviceRequestId)
+}
+
+// Returns the approval events of an attempt of the step, given its execution ID. Attempts which started before steps
+// had execution IDs have the approval events which were recorded without one.
+func (ae *ApprovalEvent) GetAllByExecutionId(serviceRequestId, stepName, executionId string) ([]*models.ApprovalEventModel, error) {
+	return ae.query(SelectStepApprovalEventsByExecutionIdStatement, serviceRequestId, stepName, executionId)
+}
+
+func (ae *ApprovalEvent) query(statement string, args ...any) ([]*models.ApprovalEventModel, error) {
+	rows, err := ae.c.Query(statement, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	aems := []*models.ApprovalEventModel{}
+	for rows.Next() {
+		aem := &models.ApprovalEventModel{}
+		if err := rows.Scan(&aem.EventId, &aem.EventType, &aem.ServiceRequestId, &aem.StepName, &aem.ExecutionId, &aem.CreatedBy, &aem.Reason, &aem.CreatedAt); err != nil {
+			return nil, err
+		}
+		aems = append(aems, aem)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return aems, nil
+}
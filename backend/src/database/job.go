@@ -0,0 +1,49 @@
+package database
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/joshtyf/flowforge/src/database/models"
+)
+
+type Job struct {
+	c *sql.DB
+}
+
+func NewJob(c *sql.DB) *Job {
+	return &Job{c: c}
+}
+
+func (j *Job) Create(name string, payload []byte) error {
+	_, err := j.c.Exec(CreateJobStatement, name, payload)
+	return err
+}
+
+// Claims the oldest pending job which is not claimed by another worker. The job is locked for the duration of the
+// lease, after which it can be claimed again if it was not deleted or retried. Returns sql.ErrNoRows if there is no
+// job to claim.
+func (j *Job) Claim(lease time.Duration) (*models.JobModel, error) {
+	jm := &models.JobModel{}
+	err := j.c.QueryRow(ClaimJobStatement, lease.Seconds()).Scan(&jm.JobId, &jm.Name, &jm.Payload, &jm.Status, &jm.Attempts, &jm.RunAt, &jm.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return jm, nil
+}
+
+func (j *Job) Delete(jobId int) error {
+	_, err := j.c.Exec(DeleteJobStatement, jobId)
+	return err
+}
+
+// Releases the job so that it can be claimed again after the delay
+func (j *Job) Retry(jobId int, delay time.Duration, lastError string) error {
+	_, err := j.c.Exec(RetryJobStatement, jobId, delay.Seconds(), lastError)
+	return err
+}
+
+func (j *Job) Fail(jobId int, lastError string) error {
+	_, err := j.c.Exec(FailJobStatement, jobId, lastError)
+	return err
+}
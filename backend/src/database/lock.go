@@ -0,0 +1,53 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+)
+
+// Postgres advisory locks shared by all backend instances using the same database
+type Lock struct {
+	c *sql.DB
+}
+
+func NewLock(c *sql.DB) *Lock {
+	return &Lock{c: c}
+}
+
+// Blocks until the lock on the key is acquired. The lock is held until the returned function is called.
+func (l *Lock) Acquire(key string) (func() error, error) {
+	tx, err := l.c.Begin()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec("SELECT pg_advisory_xact_lock(hashtext($1))", key); err != nil {
+		txnRollback(tx)
+		return nil, err
+	}
+	return tx.Commit, nil
+}
+
+// Acquires the lock on the key if it is not held. The lock is held until the returned function is called or
+// the connection to the database is lost, e.g. when the backend instance holding it stops.
+func (l *Lock) TryAcquire(key string) (func() error, bool, error) {
+	ctx := context.Background()
+	conn, err := l.c.Conn(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+	acquired := false
+	if err := conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock(hashtext($1))", key).Scan(&acquired); err != nil {
+		conn.Close()
+		return nil, false, err
+	}
+	if !acquired {
+		conn.Close()
+		return nil, false, nil
+	}
+	release := func() error {
+		defer conn.Close()
+		_, err := conn.ExecContext(ctx, "SELECT pg_advisory_unlock(hashtext($1))", key)
+		return err
+	}
+	return release, true, nil
+}
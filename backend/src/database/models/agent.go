@@ -0,0 +1,43 @@
+package models
+
+import "time"
+
+// A remote agent of an organization which runs the steps of the organization that must run inside private networks.
+// The agent authenticates with a token which is only returned when the agent is created, and only its hash is saved.
+type AgentModel struct {
+	AgentId        int        `json:"agent_id"`
+	OrganizationId int        `json:"org_id"`
+	Name           string     `json:"name"`
+	TokenHash      string     `json:"-"`
+	CreatedBy      string     `json:"created_by"`
+	CreatedOn      time.Time  `json:"created_on"`
+	LastSeenOn     *time.Time `json:"last_seen_on"` // the last time the agent polled for tasks or reported on them
+}
+
+type AgentTaskStatus string
+
+const (
+	AGENT_TASK_QUEUED    AgentTaskStatus = "queued"    // waiting to be claimed by an agent
+	AGENT_TASK_CLAIMED   AgentTaskStatus = "claimed"   // being run by an agent
+	AGENT_TASK_COMPLETED AgentTaskStatus = "completed" // the agent reported that the step completed
+	AGENT_TASK_FAILED    AgentTaskStatus = "failed"    // the agent reported that the step failed
+	AGENT_TASK_CANCELLED AgentTaskStatus = "cancelled" // the service request stopped before an agent claimed the task
+)
+
+// An attempt of a step which runs on an agent of the organization. The step is run by the first agent which polls for
+// the type of the step and has all the labels of the task.
+type AgentTaskModel struct {
+	TaskId           int              `json:"task_id"`
+	OrganizationId   int              `json:"org_id"`
+	ServiceRequestId string           `json:"service_request_id"`
+	StepName         string           `json:"step_name"`
+	StepType         PipelineStepType `json:"step_type"`
+	Labels           []string         `json:"labels"`
+	Status           AgentTaskStatus  `json:"status"`
+	AgentId          *int             `json:"agent_id"`
+	CreatedAt        time.Time        `json:"created_at"`
+	ClaimedAt        *time.Time       `json:"claimed_at"`
+	FinishedAt       *time.Time       `json:"finished_at"`
+	LeaseExpiresAt   *time.Time       `json:"lease_expires_at"` // the task is queued again if its agent does not report on it by then
+	ExecutionId      string           `json:"execution_id"`     // the execution of the step which the task is run for
+}
@@ -0,0 +1,239 @@
+package models
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/joshtyf/flowforge/src/helper"
+)
+
+var (
+	ErrInvalidApprovalQuorum     = errors.New("quorum must be a positive integer")
+	ErrInvalidApprovers          = errors.New("approvers must be a list of user ids")
+	ErrInvalidApproverRoles      = errors.New("approver_roles must be a list of roles")
+	ErrQuorumNotReachable        = errors.New("quorum is greater than the number of approvers")
+	ErrInvalidApprovalDeadline   = errors.New("deadline must be a positive duration")
+	ErrInvalidDeadlineAction     = errors.New("on_deadline must be one of reject, approve or escalate")
+	ErrMissingEscalationApprover = errors.New("escalation_approvers or escalation_approver_roles must be set to escalate")
+
+	ErrInvalidEscalationApprovers     = errors.New("escalation_approvers must be a list of user ids")
+	ErrInvalidEscalationApproverRoles = errors.New("escalation_approver_roles must be a list of roles")
+	ErrInvalidEscalationDeadline      = errors.New("escalation_deadline must be a positive duration")
+)
+
+type ApprovalEventType string
+
+const (
+	APPROVAL_APPROVED  ApprovalEventType = "Approved"  // a user approved the step
+	APPROVAL_TIMED_OUT ApprovalEventType = "Timed Out" // the deadline of the step was exceeded, and its deadline action was carried out
+)
+
+// Records the approval of a WAIT_FOR_APPROVAL step by a user, or the expiry of the deadline of the step
+type ApprovalEventModel struct {
+	EventId          int               `json:"event_id"`
+	EventType        ApprovalEventType `json:"event_type"`
+	ServiceRequestId string            `json:"service_request_id"`
+	StepName         string            `json:"step_name"`
+	ExecutionId      string            `json:"execution_id,omitempty"` // the attempt of the step which the event is of
+	CreatedBy        string            `json:"created_by"`             // the user who approved the step. Empty for timeouts.
+	Reason           string            `json:"reason,omitempty"`
+	CreatedAt        time.Time         `json:"created_at"`
+}
+
+// What happens to a WAIT_FOR_APPROVAL step when its deadline is exceeded before its quorum is reached
+type DeadlineAction string
+
+const (
+	RejectAtDeadline   DeadlineAction = "reject"   // fail the step
+	ApproveAtDeadline  DeadlineAction = "approve"  // complete the step
+	EscalateAtDeadline DeadlineAction = "escalate" // let the escalation approvers approve the step as well
+)
+
+// Who can approve a WAIT_FOR_APPROVAL step, how many of them must approve it and what happens if they do not approve it
+// before the deadline of the step, set by the parameters of the step
+type ApprovalPolicy struct {
+	Quorum        int
+	Approvers     []string // ids of the users who can approve the step
+	ApproverRoles []Role   // roles in the organization of the users who can approve the step
+
+	Deadline                time.Duration // duration from the start of the step until the deadline action is carried out. Zero if there is no deadline.
+	OnDeadline              DeadlineAction
+	EscalationApprovers     []string      // ids of the users who can also approve the step once it is escalated
+	EscalationApproverRoles []Role        // roles of the users who can also approve the step once it is escalated
+	EscalationDeadline      time.Duration // duration from the escalation until the step is rejected. Zero if there is no deadline.
+}
+
+// Steps without approvers or approver roles can be approved by the admins of the organization
+var defaultApproverRoles = []Role{Owner, Admin}
+
+// Returns the approval policy of a WAIT_FOR_APPROVAL step from its parameters. Steps without a quorum are completed by
+// a single approval.
+func GetApprovalPolicy(parameters map[string]any) (*ApprovalPolicy, error) {
+	policy := &ApprovalPolicy{Quorum: 1, OnDeadline: RejectAtDeadline}
+	if quorum, ok := parameters["quorum"]; ok {
+		q, err := parseQuorum(quorum)
+		if err != nil {
+			return nil, err
+		}
+		policy.Quorum = q
+	}
+	approvers, err := parseApprovers(parameters["approvers"], ErrInvalidApprovers)
+	if err != nil {
+		return nil, err
+	}
+	policy.Approvers = approvers
+	roles, err := parseApproverRoles(parameters["approver_roles"], ErrInvalidApproverRoles)
+	if err != nil {
+		return nil, err
+	}
+	policy.ApproverRoles = roles
+	// Only the named approvers can approve the step, so there must be enough of them to reach the quorum
+	if len(policy.Approvers) > 0 && len(policy.ApproverRoles) == 0 && policy.Quorum > len(policy.Approvers) {
+		return nil, ErrQuorumNotReachable
+	}
+
+	if deadline, ok := parameters["deadline"]; ok {
+		d, err := parseDeadline(deadline, ErrInvalidApprovalDeadline)
+		if err != nil {
+			return nil, err
+		}
+		policy.Deadline = d
+	}
+	if action, ok := parameters["on_deadline"]; ok {
+		s, _ := action.(string)
+		switch DeadlineAction(s) {
+		case RejectAtDeadline, ApproveAtDeadline, EscalateAtDeadline:
+			policy.OnDeadline = DeadlineAction(s)
+		default:
+			return nil, ErrInvalidDeadlineAction
+		}
+	}
+	if policy.EscalationApprovers, err = parseApprovers(parameters["escalation_approvers"], ErrInvalidEscalationApprovers); err != nil {
+		return nil, err
+	}
+	if policy.EscalationApproverRoles, err = parseApproverRoles(parameters["escalation_approver_roles"], ErrInvalidEscalationApproverRoles); err != nil {
+		return nil, err
+	}
+	if policy.OnDeadline == EscalateAtDeadline && len(policy.EscalationApprovers) == 0 && len(policy.EscalationApproverRoles) == 0 {
+		return nil, ErrMissingEscalationApprover
+	}
+	if deadline, ok := parameters["escalation_deadline"]; ok {
+		d, err := parseDeadline(deadline, ErrInvalidEscalationDeadline)
+		if err != nil {
+			return nil, err
+		}
+		policy.EscalationDeadline = d
+	}
+	return policy, nil
+}
+
+// Returns true if the user, who has the role in the organization of the service request, can approve the step. The
+// escalation approvers can approve the step once it has been escalated.
+func (p *ApprovalPolicy) IsEligible(userId string, role Role, escalated bool) bool {
+	approvers := p.Approvers
+	roles := p.ApproverRoles
+	if len(p.Approvers) == 0 && len(p.ApproverRoles) == 0 {
+		roles = defaultApproverRoles
+	}
+	if escalated {
+		approvers = append(append([]string{}, approvers...), p.EscalationApprovers...)
+		roles = append(append([]Role{}, roles...), p.EscalationApproverRoles...)
+	}
+	if helper.StringInSlice(userId, approvers) {
+		return true
+	}
+	for _, r := range roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+func parseApprovers(value any, invalidErr error) ([]string, error) {
+	approvers := []string{}
+	if value == nil {
+		return approvers, nil
+	}
+	elems, ok := helper.ToSlice(value)
+	if !ok {
+		return nil, invalidErr
+	}
+	for _, elem := range elems {
+		userId, ok := elem.(string)
+		if !ok || userId == "" {
+			return nil, invalidErr
+		}
+		if !helper.StringInSlice(userId, approvers) {
+			approvers = append(approvers, userId)
+		}
+	}
+	return approvers, nil
+}
+
+func parseApproverRoles(value any, invalidErr error) ([]Role, error) {
+	roles := []Role{}
+	if value == nil {
+		return roles, nil
+	}
+	elems, ok := helper.ToSlice(value)
+	if !ok {
+		return nil, invalidErr
+	}
+	for _, elem := range elems {
+		s, ok := elem.(string)
+		if !ok {
+			return nil, invalidErr
+		}
+		role, err := GetRoleFromString(s)
+		if err != nil {
+			return nil, invalidErr
+		}
+		roles = append(roles, role)
+	}
+	return roles, nil
+}
+
+func parseDeadline(deadline any, invalidErr error) (time.Duration, error) {
+	s, ok := deadline.(string)
+	if !ok {
+		return 0, invalidErr
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 {
+		return 0, invalidErr
+	}
+	return d, nil
+}
+
+// The quorum is a number, or a string which is written with placeholders, e.g. "${quorum}"
+func parseQuorum(quorum any) (int, error) {
+	var q int
+	switch v := quorum.(type) {
+	case string:
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return 0, ErrInvalidApprovalQuorum
+		}
+		q = n
+	case int:
+		q = v
+	case int32:
+		q = int(v)
+	case int64:
+		q = int(v)
+	case float64:
+		if v != math.Trunc(v) {
+			return 0, ErrInvalidApprovalQuorum
+		}
+		q = int(v)
+	default:
+		return 0, ErrInvalidApprovalQuorum
+	}
+	if q < 1 {
+		return 0, ErrInvalidApprovalQuorum
+	}
+	return q, nil
+}
@@ -0,0 +1,82 @@
+package models
+
+import (
+	"errors"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestGetApprovalPolicy(t *testing.T) {
+	testCases := []struct {
+		description    string
+		parameters     map[string]any
+		expectedQuorum int
+		expectedErr    error
+	}{
+		{"No parameters", map[string]any{}, 1, nil},
+		{"Quorum as string", map[string]any{"quorum": "2"}, 2, nil},
+		{"Quorum as number", map[string]any{"quorum": float64(3)}, 3, nil},
+		{"Quorum decoded from database", map[string]any{"quorum": int32(2)}, 2, nil},
+		{"Zero quorum", map[string]any{"quorum": "0"}, 0, ErrInvalidApprovalQuorum},
+		{"Fractional quorum", map[string]any{"quorum": 1.5}, 0, ErrInvalidApprovalQuorum},
+		{"Quorum is not a number", map[string]any{"quorum": "two"}, 0, ErrInvalidApprovalQuorum},
+		{"Approvers decoded from database", map[string]any{"quorum": "2", "approvers": primitive.A{"user1", "user2"}}, 2, nil},
+		{"Approvers are not strings", map[string]any{"approvers": []any{1}}, 0, ErrInvalidApprovers},
+		{"Approvers is not a list", map[string]any{"approvers": "user1"}, 0, ErrInvalidApprovers},
+		{"Invalid approver role", map[string]any{"approver_roles": []any{"Approver"}}, 0, ErrInvalidApproverRoles},
+		{"Quorum greater than approvers", map[string]any{"quorum": "3", "approvers": []any{"user1", "user2"}}, 0, ErrQuorumNotReachable},
+		{"Duplicate approvers are counted once", map[string]any{"quorum": "2", "approvers": []any{"user1", "user1"}}, 0, ErrQuorumNotReachable},
+		{"Deadline", map[string]any{"deadline": "24h", "on_deadline": "approve"}, 1, nil},
+		{"Invalid deadline", map[string]any{"deadline": "tomorrow"}, 0, ErrInvalidApprovalDeadline},
+		{"Negative deadline", map[string]any{"deadline": "-1h"}, 0, ErrInvalidApprovalDeadline},
+		{"Invalid deadline action", map[string]any{"deadline": "1h", "on_deadline": "ignore"}, 0, ErrInvalidDeadlineAction},
+		{"Escalation without escalation approvers", map[string]any{"deadline": "1h", "on_deadline": "escalate"}, 0, ErrMissingEscalationApprover},
+		{"Escalation", map[string]any{"deadline": "1h", "on_deadline": "escalate", "escalation_approver_roles": []any{"Owner"}, "escalation_deadline": "2h"}, 1, nil},
+		{"Quorum greater than approvers with roles", map[string]any{"quorum": "3", "approvers": []any{"user1"}, "approver_roles": []any{"Admin"}}, 3, nil},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			policy, err := GetApprovalPolicy(tc.parameters)
+			if !errors.Is(err, tc.expectedErr) {
+				t.Errorf("Expected error %v, got %v", tc.expectedErr, err)
+				return
+			}
+			if err == nil && policy.Quorum != tc.expectedQuorum {
+				t.Errorf("Expected quorum %d, got %d", tc.expectedQuorum, policy.Quorum)
+			}
+		})
+	}
+}
+
+func TestApprovalPolicyIsEligible(t *testing.T) {
+	testCases := []struct {
+		description string
+		policy      *ApprovalPolicy
+		userId      string
+		role        Role
+		escalated   bool
+		expected    bool
+	}{
+		{"Admin by default", &ApprovalPolicy{Quorum: 1}, "user1", Admin, false, true},
+		{"Owner by default", &ApprovalPolicy{Quorum: 1}, "user1", Owner, false, true},
+		{"Member by default", &ApprovalPolicy{Quorum: 1}, "user1", Member, false, false},
+		{"Named approver", &ApprovalPolicy{Quorum: 1, Approvers: []string{"user1"}}, "user1", Member, false, true},
+		{"Admin who is not a named approver", &ApprovalPolicy{Quorum: 1, Approvers: []string{"user1"}}, "user2", Admin, false, false},
+		{"Approver role", &ApprovalPolicy{Quorum: 1, ApproverRoles: []Role{Member}}, "user1", Member, false, true},
+		{"Role which cannot approve", &ApprovalPolicy{Quorum: 1, ApproverRoles: []Role{Owner}}, "user1", Admin, false, false},
+		{"Named approver or role", &ApprovalPolicy{Quorum: 1, Approvers: []string{"user1"}, ApproverRoles: []Role{Owner}}, "user2", Owner, false, true},
+		{"Escalation approver before escalation", &ApprovalPolicy{Quorum: 1, Approvers: []string{"user2"}, EscalationApproverRoles: []Role{Owner}}, "user1", Owner, false, false},
+		{"Escalation approver after escalation", &ApprovalPolicy{Quorum: 1, Approvers: []string{"user2"}, EscalationApproverRoles: []Role{Owner}}, "user1", Owner, true, true},
+		{"Approver after escalation", &ApprovalPolicy{Quorum: 1, Approvers: []string{"user1"}, EscalationApprovers: []string{"user2"}}, "user1", Member, true, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			if tc.policy.IsEligible(tc.userId, tc.role, tc.escalated) != tc.expected {
+				t.Errorf("Expected %v, got %v", tc.expected, !tc.expected)
+			}
+		})
+	}
+}
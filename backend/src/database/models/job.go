@@ -0,0 +1,21 @@
+package models
+
+import "time"
+
+type JobStatus string
+
+const (
+	JOB_PENDING JobStatus = "pending"
+	JOB_FAILED  JobStatus = "failed" // the job exceeded its maximum attempts and will not be retried
+)
+
+// A persisted event waiting to be handled by a queue worker
+type JobModel struct {
+	JobId     int       `json:"job_id"`
+	Name      string    `json:"name"`
+	Payload   []byte    `json:"payload"`
+	Status    JobStatus `json:"status"`
+	Attempts  int       `json:"attempts"`
+	RunAt     time.Time `json:"run_at"`
+	CreatedAt time.Time `json:"created_at"`
+}
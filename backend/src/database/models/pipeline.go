@@ -1,6 +1,11 @@
 package models
 
 import (
+	"errors"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -35,10 +40,16 @@ type PipelineStepType string
 const (
 	APIStep             PipelineStepType = "API"
 	WaitForApprovalStep PipelineStepType = "WAIT_FOR_APPROVAL"
+	BranchStep          PipelineStepType = "BRANCH"
+	ScriptStep          PipelineStepType = "SCRIPT"
+	WaitForCallbackStep PipelineStepType = "WAIT_FOR_CALLBACK"
+	PipelineStep        PipelineStepType = "PIPELINE"
 )
 
 var cancellableStepTypes = []PipelineStepType{
 	WaitForApprovalStep,
+	WaitForCallbackStep,
+	PipelineStep,
 }
 
 func IsCancellablePipelineStepType(stepType PipelineStepType) bool {
@@ -50,9 +61,32 @@ func IsCancellablePipelineStepType(stepType PipelineStepType) bool {
 	return false
 }
 
-var allPipelineStepTypes = []PipelineStepType{APIStep, WaitForApprovalStep}
+var builtInPipelineStepTypes = []PipelineStepType{APIStep, WaitForApprovalStep, BranchStep, ScriptStep, WaitForCallbackStep, PipelineStep}
+
+var (
+	allPipelineStepTypes   = slices.Clone(builtInPipelineStepTypes)
+	pipelineStepTypesMutex sync.RWMutex
+)
+
+// Adds a step type to the valid step types of pipelines, e.g. when the executor of a new step type is registered
+func RegisterPipelineStepType(stepType PipelineStepType) {
+	pipelineStepTypesMutex.Lock()
+	defer pipelineStepTypesMutex.Unlock()
+	if !slices.Contains(allPipelineStepTypes, stepType) {
+		allPipelineStepTypes = append(allPipelineStepTypes, stepType)
+	}
+}
+
+// Removes the registered step types, leaving the built-in step types, so that tests do not affect each other
+func resetPipelineStepTypes() {
+	pipelineStepTypesMutex.Lock()
+	defer pipelineStepTypesMutex.Unlock()
+	allPipelineStepTypes = slices.Clone(builtInPipelineStepTypes)
+}
 
 func IsValidPipelineStepType(stepType PipelineStepType) bool {
+	pipelineStepTypesMutex.RLock()
+	defer pipelineStepTypesMutex.RUnlock()
 	for _, validStepType := range allPipelineStepTypes {
 		if stepType == validStepType {
 			return true
@@ -61,13 +95,149 @@ func IsValidPipelineStepType(stepType PipelineStepType) bool {
 	return false
 }
 
+// Compensations must complete on their own, as they are run after the service request has failed or been cancelled
+var compensationStepTypes = []PipelineStepType{APIStep, ScriptStep}
+
+func IsValidCompensationStepType(stepType PipelineStepType) bool {
+	return slices.Contains(compensationStepTypes, stepType)
+}
+
+// Environment variables which are set for every SCRIPT step, or which change how the script is loaded or started
+var reservedScriptEnvNames = []string{"PATH", "HOME", "TMPDIR", "BASH_ENV", "ENV"}
+
+// Returns true if the environment variable cannot be set by the env of a SCRIPT step, e.g. PATH or LD_PRELOAD
+func IsReservedScriptEnvName(name string) bool {
+	return slices.Contains(reservedScriptEnvNames, name) || strings.HasPrefix(name, "LD_")
+}
+
+// A conditional edge of a BRANCH step. The first branch whose condition evaluates to true is followed.
+type PipelineStepBranch struct {
+	Condition    string `bson:"condition" json:"condition"`
+	NextStepName string `bson:"next_step_name" json:"next_step_name"`
+}
+
 type PipelineStepModel struct {
-	StepName       string           `bson:"step_name" json:"step_name"`
-	StepType       PipelineStepType `bson:"step_type" json:"step_type"`
-	NextStepName   string           `bson:"next_step_name" json:"next_step_name"`
-	PrevStepName   string           `bson:"prev_step_name" json:"prev_step_name"`
-	Parameters     map[string]any   `bson:"parameters" json:"parameters"`
-	IsTerminalStep bool             `bson:"is_terminal_step" json:"is_terminal_step"`
+	StepName       string                    `bson:"step_name" json:"step_name"`
+	StepType       PipelineStepType          `bson:"step_type" json:"step_type"`
+	NextStepName   string                    `bson:"next_step_name" json:"next_step_name"` // for BRANCH steps, the default step when no condition matches
+	PrevStepName   string                    `bson:"prev_step_name" json:"prev_step_name"`
+	Parameters     map[string]any            `bson:"parameters" json:"parameters"`
+	IsTerminalStep bool                      `bson:"is_terminal_step" json:"is_terminal_step"`
+	Branches       []PipelineStepBranch      `bson:"branches,omitempty" json:"branches,omitempty"`
+	NextStepNames  []string                  `bson:"next_step_names,omitempty" json:"next_step_names,omitempty"` // steps to run in parallel after this step, in addition to NextStepName
+	PrevStepNames  []string                  `bson:"prev_step_names,omitempty" json:"prev_step_names,omitempty"` // steps that must all complete before this step runs
+	Retry          *RetryPolicy              `bson:"retry,omitempty" json:"retry,omitempty"`
+	Timeout        string                    `bson:"timeout,omitempty" json:"timeout,omitempty"` // maximum duration of each attempt of the step, e.g. "30s"
+	Compensation   *PipelineStepCompensation `bson:"compensation,omitempty" json:"compensation,omitempty"`
+	OnFailure      *OnFailurePolicy          `bson:"on_failure,omitempty" json:"on_failure,omitempty"`
+	Agent          *PipelineStepAgent        `bson:"agent,omitempty" json:"agent,omitempty"` // runs the step on a remote agent instead of the backend
+}
+
+// Steps which complete within the backend, so they cannot run on remote agents
+var backendOnlyStepTypes = []PipelineStepType{WaitForApprovalStep, BranchStep, WaitForCallbackStep, PipelineStep}
+
+// Returns true if steps of the type can run on remote agents. Agents may run step types which the backend has no
+// executor for.
+func IsValidAgentStepType(stepType PipelineStepType) bool {
+	return stepType != "" && !slices.Contains(backendOnlyStepTypes, stepType)
+}
+
+// Selects the remote agents of the organization which can run a step. The step runs on an agent which has all of the
+// labels, e.g. the network it runs in.
+type PipelineStepAgent struct {
+	Labels []string `bson:"labels" json:"labels"`
+}
+
+type OnFailureAction string
+
+const (
+	FailOnFailure     OnFailureAction = "fail"     // fail the service request
+	ContinueOnFailure OnFailureAction = "continue" // run the next steps of the step as if it had completed
+	RouteOnFailure    OnFailureAction = "route"    // run an error handler step instead of the next steps of the step
+)
+
+// Determines what happens to the service request when a step fails
+type OnFailurePolicy struct {
+	Action   OnFailureAction `bson:"action" json:"action"`
+	StepName string          `bson:"step_name,omitempty" json:"step_name,omitempty"` // the error handler step of the route action
+}
+
+// Returns the action of the policy. Steps without a policy fail the service request.
+func (p *OnFailurePolicy) GetAction() OnFailureAction {
+	if p == nil || p.Action == "" {
+		return FailOnFailure
+	}
+	return p.Action
+}
+
+// Undoes the effects of a completed step when its service request fails or is cancelled, e.g. by deleting the resources
+// created by the step.
+type PipelineStepCompensation struct {
+	StepType   PipelineStepType `bson:"step_type" json:"step_type"`
+	Parameters map[string]any   `bson:"parameters" json:"parameters"`
+	Timeout    string           `bson:"timeout,omitempty" json:"timeout,omitempty"`
+}
+
+// Returns the names of all the steps that can directly follow this step.
+func (s *PipelineStepModel) GetNextStepNames() []string {
+	nextStepNames := make([]string, 0)
+	candidates := []string{s.NextStepName}
+	candidates = append(candidates, s.NextStepNames...)
+	for _, branch := range s.Branches {
+		candidates = append(candidates, branch.NextStepName)
+	}
+	for _, candidate := range candidates {
+		if candidate == "" || slices.Contains(nextStepNames, candidate) {
+			continue
+		}
+		nextStepNames = append(nextStepNames, candidate)
+	}
+	return nextStepNames
+}
+
+// Returns the names of the steps to run when this step fails, which are the next steps of the step for the continue
+// action and the error handler step for the route action. Branches are not followed as no branch was chosen.
+func (s *PipelineStepModel) GetFailureNextStepNames() []string {
+	nextStepNames := make([]string, 0)
+	switch s.OnFailure.GetAction() {
+	case ContinueOnFailure:
+		for _, candidate := range append([]string{s.NextStepName}, s.NextStepNames...) {
+			if candidate != "" && !slices.Contains(nextStepNames, candidate) {
+				nextStepNames = append(nextStepNames, candidate)
+			}
+		}
+	case RouteOnFailure:
+		nextStepNames = append(nextStepNames, s.OnFailure.StepName)
+	}
+	return nextStepNames
+}
+
+// Returns true if the step runs on a remote agent
+func (s *PipelineStepModel) IsRunByAgent() bool {
+	return s.Agent != nil
+}
+
+// Returns true if the step waits for multiple steps to complete before running.
+func (s *PipelineStepModel) IsJoinStep() bool {
+	return len(s.PrevStepNames) > 0
+}
+
+// Returns the timeout of each attempt of the step, or 0 if the step has no timeout.
+func (s *PipelineStepModel) GetTimeout() time.Duration {
+	return parseTimeout(s.Timeout)
+}
+
+// Returns the compensation of the step as a step with the same name, or nil if the step has no compensation.
+func (s *PipelineStepModel) GetCompensationStep() *PipelineStepModel {
+	if s.Compensation == nil {
+		return nil
+	}
+	return &PipelineStepModel{
+		StepName:   s.StepName,
+		StepType:   s.Compensation.StepType,
+		Parameters: maps.Clone(s.Compensation.Parameters),
+		Timeout:    s.Compensation.Timeout,
+	}
 }
 
 type PipelineModel struct {
@@ -81,6 +251,73 @@ type PipelineModel struct {
 	Steps          []PipelineStepModel `bson:"steps" json:"steps"`
 	CreatedOn      time.Time           `bson:"created_on" json:"created_on"`
 	Form           Form                `bson:"form" json:"form"`
+	Timeout        string              `bson:"timeout,omitempty" json:"timeout,omitempty"` // maximum duration of a service request from when it is started, e.g. "1h"
+	// Values which the parameters of the steps reference with ${vars.NAME} placeholders
+	Variables map[string]any `bson:"variables,omitempty" json:"variables,omitempty"`
+	// Named environments of the pipeline, e.g. "staging" and "prod", which override its variables
+	Environments map[string]PipelineEnvironment `bson:"environments,omitempty" json:"environments,omitempty"`
+	// The environment of service requests which do not choose one
+	DefaultEnvironment string `bson:"default_environment,omitempty" json:"default_environment,omitempty"`
+}
+
+var ErrInvalidEnvironment = errors.New("environment is not defined by the pipeline")
+
+// An environment which service requests of a pipeline run in. Its variables override those of the pipeline.
+type PipelineEnvironment struct {
+	Variables map[string]any `bson:"variables" json:"variables"`
+}
+
+// Returns the environment of a service request of the pipeline, which is the default environment of the pipeline if
+// the service request did not choose one
+func (p *PipelineModel) GetEnvironment(environment string) (string, error) {
+	if environment == "" {
+		return p.DefaultEnvironment, nil
+	}
+	if _, ok := p.Environments[environment]; !ok {
+		return "", ErrInvalidEnvironment
+	}
+	return environment, nil
+}
+
+// Returns the variables of the pipeline with the overrides of the environment. The variables of the pipeline are
+// returned if the environment is empty or not defined.
+func (p *PipelineModel) GetVariables(environment string) map[string]any {
+	variables := make(map[string]any, len(p.Variables))
+	for name, value := range p.Variables {
+		variables[name] = value
+	}
+	for name, value := range p.Environments[environment].Variables {
+		variables[name] = value
+	}
+	return variables
+}
+
+// Returns the timeout of service requests of the pipeline, or 0 if the pipeline has no timeout.
+func (p *PipelineModel) GetTimeout() time.Duration {
+	return parseTimeout(p.Timeout)
+}
+
+func parseTimeout(timeout string) time.Duration {
+	if timeout == "" {
+		return 0
+	}
+	d, err := time.ParseDuration(timeout)
+	if err != nil || d < 0 {
+		return 0
+	}
+	return d
+}
+
+// Returns the names of the steps which lead to the step, either when they complete or when they fail with the continue
+// or route action
+func (p *PipelineModel) GetPredecessorStepNames(name string) []string {
+	predecessors := make([]string, 0)
+	for _, step := range p.Steps {
+		if slices.Contains(step.GetNextStepNames(), name) || slices.Contains(step.GetFailureNextStepNames(), name) {
+			predecessors = append(predecessors, step.StepName)
+		}
+	}
+	return predecessors
 }
 
 func (p *PipelineModel) GetPipelineStep(name string) *PipelineStepModel {
@@ -1,6 +1,11 @@
 package models
 
-import "testing"
+import (
+	"errors"
+	"reflect"
+	"slices"
+	"testing"
+)
 
 func TestGetPipelineStep(t *testing.T) {
 	pipeline := PipelineModel{
@@ -23,3 +28,240 @@ func TestGetPipelineStep(t *testing.T) {
 		}
 	})
 }
+
+func TestGetNextStepNames(t *testing.T) {
+	testCases := []struct {
+		testDescription string
+		step            PipelineStepModel
+		expected        []string
+	}{
+		{"Terminal step", PipelineStepModel{StepName: "step1", IsTerminalStep: true}, []string{}},
+		{"Linear step", PipelineStepModel{StepName: "step1", NextStepName: "step2"}, []string{"step2"}},
+		{
+			"Branch step with default",
+			PipelineStepModel{StepName: "step1", StepType: BranchStep, NextStepName: "step2", Branches: []PipelineStepBranch{
+				{Condition: "a", NextStepName: "step3"},
+				{Condition: "b", NextStepName: "step4"},
+			}},
+			[]string{"step2", "step3", "step4"},
+		},
+		{
+			"Parallel step",
+			PipelineStepModel{StepName: "step1", NextStepName: "step2", NextStepNames: []string{"step3", "step2", "step4"}},
+			[]string{"step2", "step3", "step4"},
+		},
+		{
+			"Branch step with duplicate targets",
+			PipelineStepModel{StepName: "step1", StepType: BranchStep, Branches: []PipelineStepBranch{
+				{Condition: "a", NextStepName: "step2"},
+				{Condition: "b", NextStepName: "step2"},
+			}},
+			[]string{"step2"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.testDescription, func(t *testing.T) {
+			nextStepNames := tc.step.GetNextStepNames()
+			if !slices.Equal(nextStepNames, tc.expected) {
+				t.Errorf("Expected %v, got %v", tc.expected, nextStepNames)
+			}
+		})
+	}
+}
+
+func TestGetCompensationStep(t *testing.T) {
+	t.Run("Step without compensation", func(t *testing.T) {
+		step := PipelineStepModel{StepName: "step1", StepType: APIStep}
+		if compensationStep := step.GetCompensationStep(); compensationStep != nil {
+			t.Errorf("Expected nil result, got %v", compensationStep)
+		}
+	})
+
+	t.Run("Step with compensation", func(t *testing.T) {
+		step := PipelineStepModel{StepName: "step1", StepType: APIStep, Compensation: &PipelineStepCompensation{
+			StepType:   ScriptStep,
+			Parameters: map[string]any{"command": "echo"},
+			Timeout:    "30s",
+		}}
+		compensationStep := step.GetCompensationStep()
+		if compensationStep.StepName != "step1" || compensationStep.StepType != ScriptStep || compensationStep.Timeout != "30s" {
+			t.Errorf("Expected step1, %s and 30s, got %s, %s and %s", ScriptStep, compensationStep.StepName, compensationStep.StepType, compensationStep.Timeout)
+		}
+		// Rendering the parameters of the compensation must not modify those of the pipeline
+		compensationStep.Parameters["command"] = "ls"
+		if step.Compensation.Parameters["command"] != "echo" {
+			t.Errorf("Expected parameters of the compensation to be unchanged, got %v", step.Compensation.Parameters)
+		}
+	})
+}
+
+func TestGetFailureNextStepNames(t *testing.T) {
+	testCases := []struct {
+		testDescription string
+		step            PipelineStepModel
+		expected        []string
+	}{
+		{"Step without on_failure", PipelineStepModel{StepName: "step1", NextStepName: "step2"}, []string{}},
+		{"Fail action", PipelineStepModel{StepName: "step1", NextStepName: "step2", OnFailure: &OnFailurePolicy{Action: FailOnFailure}}, []string{}},
+		{
+			"Continue action",
+			PipelineStepModel{StepName: "step1", NextStepName: "step2", NextStepNames: []string{"step3"}, OnFailure: &OnFailurePolicy{Action: ContinueOnFailure}},
+			[]string{"step2", "step3"},
+		},
+		{
+			"Continue action of branch step",
+			PipelineStepModel{StepName: "step1", StepType: BranchStep, NextStepName: "step2", Branches: []PipelineStepBranch{
+				{Condition: "a", NextStepName: "step3"},
+			}, OnFailure: &OnFailurePolicy{Action: ContinueOnFailure}},
+			[]string{"step2"},
+		},
+		{"Continue action of terminal step", PipelineStepModel{StepName: "step1", IsTerminalStep: true, OnFailure: &OnFailurePolicy{Action: ContinueOnFailure}}, []string{}},
+		{
+			"Route action",
+			PipelineStepModel{StepName: "step1", NextStepName: "step2", OnFailure: &OnFailurePolicy{Action: RouteOnFailure, StepName: "handler"}},
+			[]string{"handler"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.testDescription, func(t *testing.T) {
+			nextStepNames := tc.step.GetFailureNextStepNames()
+			if !slices.Equal(nextStepNames, tc.expected) {
+				t.Errorf("Expected %v, got %v", tc.expected, nextStepNames)
+			}
+		})
+	}
+}
+
+func TestGetPredecessorStepNames(t *testing.T) {
+	pipeline := PipelineModel{
+		Steps: []PipelineStepModel{
+			{StepName: "start", StepType: BranchStep, NextStepName: "a", Branches: []PipelineStepBranch{{Condition: "x", NextStepName: "b"}}},
+			{StepName: "a", NextStepName: "join", OnFailure: &OnFailurePolicy{Action: RouteOnFailure, StepName: "handler"}},
+			{StepName: "b", NextStepName: "join"},
+			{StepName: "handler", IsTerminalStep: true},
+			{StepName: "join", IsTerminalStep: true},
+		},
+	}
+	testCases := []struct {
+		testDescription string
+		stepName        string
+		expected        []string
+	}{
+		{"First step", "start", []string{}},
+		{"Branch target", "b", []string{"start"}},
+		{"Join step", "join", []string{"a", "b"}},
+		{"Failure route", "handler", []string{"a"}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.testDescription, func(t *testing.T) {
+			predecessors := pipeline.GetPredecessorStepNames(tc.stepName)
+			if !slices.Equal(predecessors, tc.expected) {
+				t.Errorf("Expected %v, got %v", tc.expected, predecessors)
+			}
+		})
+	}
+}
+
+func TestRegisterPipelineStepType(t *testing.T) {
+	t.Cleanup(resetPipelineStepTypes)
+	stepType := PipelineStepType("TEST_REGISTERED")
+	if IsValidPipelineStepType(stepType) {
+		t.Errorf("Expected %s to be invalid before it is registered", stepType)
+	}
+	RegisterPipelineStepType(stepType)
+	RegisterPipelineStepType(stepType)
+	if !IsValidPipelineStepType(stepType) {
+		t.Errorf("Expected %s to be valid once it is registered", stepType)
+	}
+	if !IsValidPipelineStepType(APIStep) {
+		t.Errorf("Expected %s to remain valid", APIStep)
+	}
+	if IsValidCompensationStepType(stepType) {
+		t.Errorf("Expected %s to be invalid for compensations", stepType)
+	}
+	resetPipelineStepTypes()
+	if IsValidPipelineStepType(stepType) {
+		t.Errorf("Expected %s to be invalid once the step types are reset", stepType)
+	}
+	if !IsValidPipelineStepType(APIStep) {
+		t.Errorf("Expected %s to remain valid once the step types are reset", APIStep)
+	}
+}
+
+func TestIsValidAgentStepType(t *testing.T) {
+	testCases := []struct {
+		stepType PipelineStepType
+		expected bool
+	}{
+		{APIStep, true},
+		{ScriptStep, true},
+		{"TERRAFORM", true},
+		{WaitForApprovalStep, false},
+		{WaitForCallbackStep, false},
+		{BranchStep, false},
+		{PipelineStep, false},
+		{"", false},
+	}
+	for _, tc := range testCases {
+		t.Run(string(tc.stepType), func(t *testing.T) {
+			if valid := IsValidAgentStepType(tc.stepType); valid != tc.expected {
+				t.Errorf("Expected %v, got %v", tc.expected, valid)
+			}
+		})
+	}
+}
+
+func TestGetEnvironment(t *testing.T) {
+	pipeline := PipelineModel{
+		Environments:       map[string]PipelineEnvironment{"staging": {}, "prod": {}},
+		DefaultEnvironment: "staging",
+	}
+	testCases := []struct {
+		name        string
+		environment string
+		expected    string
+		expectedErr error
+	}{
+		{"Chosen environment", "prod", "prod", nil},
+		{"Default environment", "", "staging", nil},
+		{"Undefined environment", "dev", "", ErrInvalidEnvironment},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			environment, err := pipeline.GetEnvironment(tc.environment)
+			if !errors.Is(err, tc.expectedErr) {
+				t.Errorf("Expected error %v, got %v", tc.expectedErr, err)
+			}
+			if environment != tc.expected {
+				t.Errorf("Expected environment %q, got %q", tc.expected, environment)
+			}
+		})
+	}
+}
+
+func TestGetVariables(t *testing.T) {
+	pipeline := PipelineModel{
+		Variables: map[string]any{"base_url": "https://staging.example.com", "replicas": 1},
+		Environments: map[string]PipelineEnvironment{
+			"prod": {Variables: map[string]any{"base_url": "https://example.com"}},
+		},
+	}
+	testCases := []struct {
+		name        string
+		environment string
+		expected    map[string]any
+	}{
+		{"Environment overrides variables", "prod", map[string]any{"base_url": "https://example.com", "replicas": 1}},
+		{"No environment", "", map[string]any{"base_url": "https://staging.example.com", "replicas": 1}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if variables := pipeline.GetVariables(tc.environment); !reflect.DeepEqual(variables, tc.expected) {
+				t.Errorf("Expected %v, got %v", tc.expected, variables)
+			}
+		})
+	}
+	if pipeline.Variables["base_url"] != "https://staging.example.com" {
+		t.Errorf("Expected variables of the pipeline to be unchanged, got %v", pipeline.Variables)
+	}
+}
@@ -0,0 +1,82 @@
+package models
+
+import (
+	"slices"
+	"time"
+)
+
+// Errors which can be configured as retryable in addition to status codes
+const (
+	RetryableNetworkError = "network"   // the request could not be sent or the connection was lost
+	RetryableTimeoutError = "timeout"   // the request timed out
+	RetryableExitError    = "exit_code" // the script of a SCRIPT step exited with a non-zero exit code
+)
+
+var allRetryableErrors = []string{RetryableNetworkError, RetryableTimeoutError, RetryableExitError}
+
+func IsValidRetryableError(retryableError string) bool {
+	return slices.Contains(allRetryableErrors, retryableError)
+}
+
+const (
+	defaultInitialBackoff = time.Second
+	defaultMaxBackoff     = 30 * time.Second
+)
+
+// Determines how a failed step is retried. The backoff between attempts starts at the initial backoff and doubles
+// after every attempt, up to the max backoff.
+type RetryPolicy struct {
+	MaxAttempts          int      `bson:"max_attempts" json:"max_attempts"`                                         // includes the first attempt
+	InitialBackoff       string   `bson:"initial_backoff,omitempty" json:"initial_backoff,omitempty"`               // e.g. "500ms", defaults to 1s
+	MaxBackoff           string   `bson:"max_backoff,omitempty" json:"max_backoff,omitempty"`                       // e.g. "1m", defaults to 30s
+	RetryableStatusCodes []int    `bson:"retryable_status_codes,omitempty" json:"retryable_status_codes,omitempty"` // defaults to 429 and 5xx
+	RetryableErrors      []string `bson:"retryable_errors,omitempty" json:"retryable_errors,omitempty"`             // defaults to all retryable errors
+}
+
+// Returns the maximum number of attempts for the step. A step without a retry policy is attempted once.
+func (p *RetryPolicy) GetMaxAttempts() int {
+	if p == nil || p.MaxAttempts < 1 {
+		return 1
+	}
+	return p.MaxAttempts
+}
+
+// Returns the backoff before the next attempt, given the number of the attempt which failed.
+func (p *RetryPolicy) GetBackoff(attempt int) time.Duration {
+	initialBackoff, maxBackoff := defaultInitialBackoff, defaultMaxBackoff
+	if p != nil && p.InitialBackoff != "" {
+		if d, err := time.ParseDuration(p.InitialBackoff); err == nil {
+			initialBackoff = d
+		}
+	}
+	if p != nil && p.MaxBackoff != "" {
+		if d, err := time.ParseDuration(p.MaxBackoff); err == nil {
+			maxBackoff = d
+		}
+	}
+	backoff := initialBackoff
+	for i := 1; i < attempt && backoff < maxBackoff; i++ {
+		backoff *= 2
+	}
+	return min(backoff, maxBackoff)
+}
+
+func (p *RetryPolicy) IsRetryableStatusCode(statusCode int) bool {
+	if p == nil {
+		return false
+	}
+	if len(p.RetryableStatusCodes) == 0 {
+		return statusCode == 429 || statusCode >= 500
+	}
+	return slices.Contains(p.RetryableStatusCodes, statusCode)
+}
+
+func (p *RetryPolicy) IsRetryableError(retryableError string) bool {
+	if p == nil {
+		return false
+	}
+	if len(p.RetryableErrors) == 0 {
+		return true
+	}
+	return slices.Contains(p.RetryableErrors, retryableError)
+}
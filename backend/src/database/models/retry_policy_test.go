@@ -0,0 +1,54 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestGetBackoff(t *testing.T) {
+	testCases := []struct {
+		description string
+		policy      *RetryPolicy
+		attempt     int
+		expected    time.Duration
+	}{
+		{"No retry policy", nil, 1, time.Second},
+		{"Default backoff", &RetryPolicy{MaxAttempts: 3}, 2, 2 * time.Second},
+		{"First attempt", &RetryPolicy{InitialBackoff: "500ms", MaxBackoff: "10s"}, 1, 500 * time.Millisecond},
+		{"Third attempt", &RetryPolicy{InitialBackoff: "500ms", MaxBackoff: "10s"}, 3, 2 * time.Second},
+		{"Capped at max backoff", &RetryPolicy{InitialBackoff: "1s", MaxBackoff: "5s"}, 10, 5 * time.Second},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			backoff := tc.policy.GetBackoff(tc.attempt)
+			if backoff != tc.expected {
+				t.Errorf("Expected %v, got %v", tc.expected, backoff)
+			}
+		})
+	}
+}
+
+func TestIsRetryableStatusCode(t *testing.T) {
+	testCases := []struct {
+		description string
+		policy      *RetryPolicy
+		statusCode  int
+		expected    bool
+	}{
+		{"No retry policy", nil, 500, false},
+		{"Default server error", &RetryPolicy{MaxAttempts: 3}, 503, true},
+		{"Default too many requests", &RetryPolicy{MaxAttempts: 3}, 429, true},
+		{"Default client error", &RetryPolicy{MaxAttempts: 3}, 400, false},
+		{"Configured status code", &RetryPolicy{MaxAttempts: 3, RetryableStatusCodes: []int{409}}, 409, true},
+		{"Status code not configured", &RetryPolicy{MaxAttempts: 3, RetryableStatusCodes: []int{409}}, 500, false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			if tc.policy.IsRetryableStatusCode(tc.statusCode) != tc.expected {
+				t.Errorf("Expected %v, got %v", tc.expected, !tc.expected)
+			}
+		})
+	}
+}
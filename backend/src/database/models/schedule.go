@@ -0,0 +1,34 @@
+package models
+
+import "time"
+
+type MissedRunPolicy string
+
+const (
+	SkipMissedRuns    MissedRunPolicy = "skip"     // runs missed while the server was down are not started
+	RunOnceMissedRuns MissedRunPolicy = "run_once" // a single run is started for all the runs missed while the server was down
+)
+
+func IsValidMissedRunPolicy(policy MissedRunPolicy) bool {
+	return policy == SkipMissedRuns || policy == RunOnceMissedRuns
+}
+
+// Starts service requests of a pipeline with fixed form data on a cron schedule, on behalf of the user who owns it
+type ScheduleModel struct {
+	ScheduleId      int             `json:"schedule_id"`
+	PipelineId      string          `json:"pipeline_id"`
+	OrganizationId  int             `json:"org_id"`
+	UserId          string          `json:"user_id"` // the owner, who the service requests are created for
+	CronExpression  string          `json:"cron_expression"`
+	TimeZone        string          `json:"time_zone"` // IANA time zone in which the cron expression is evaluated, e.g. Asia/Singapore
+	FormData        FormData        `json:"form_data"`
+	Environment     string          `json:"environment"` // the environment of the pipeline which the service requests run in
+	MissedRunPolicy MissedRunPolicy `json:"missed_run_policy"`
+	Enabled         bool            `json:"enabled"`
+	NextRunAt       time.Time       `json:"next_run_at"`
+	LastRunAt       *time.Time      `json:"last_run_at"`
+	// The service request started by the last run
+	LastServiceRequestId string    `json:"last_service_request_id"`
+	CreatedOn            time.Time `json:"created_on"`
+	LastUpdated          time.Time `json:"last_updated"`
+}
@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+// A secret of an organization which steps can reference with ${secrets.NAME}. The value is encrypted and is never
+// returned by the API.
+type SecretModel struct {
+	OrganizationId int       `json:"org_id"`
+	Name           string    `json:"name"`
+	Value          []byte    `json:"-"`
+	CreatedBy      string    `json:"created_by"` // the user who last set the value
+	CreatedOn      time.Time `json:"created_on"`
+	LastUpdated    time.Time `json:"last_updated"`
+}
@@ -32,15 +32,21 @@ func ValidateServiceRequestStatus(status string) bool {
 type FormData map[string]any
 
 type ServiceRequestModel struct {
-	Id              primitive.ObjectID   `bson:"_id,omitempty" json:"id,omitempty"`
-	UserId          string               `bson:"user_id" json:"user_id"`
-	OrganizationId  int                  `bson:"org_id" json:"org_id"`
-	PipelineId      string               `bson:"pipeline_id" json:"pipeline_id"` // should we use primitive.ObjectID here?
-	PipelineName    string               `bson:"pipeline_name" json:"pipeline_name"`
-	PipelineVersion int                  `bson:"pipeline_version" json:"pipeline_version"`
-	Status          ServiceRequestStatus `bson:"status" json:"status"`
-	CreatedOn       time.Time            `bson:"created_on" json:"created_on"`
-	LastUpdated     time.Time            `bson:"last_updated" json:"last_updated"`
-	Remarks         string               `bson:"remarks" json:"remarks"`
-	FormData        FormData             `bson:"form_data" json:"form_data"`
+	Id                     primitive.ObjectID   `bson:"_id,omitempty" json:"id,omitempty"`
+	UserId                 string               `bson:"user_id" json:"user_id"`
+	OrganizationId         int                  `bson:"org_id" json:"org_id"`
+	PipelineId             string               `bson:"pipeline_id" json:"pipeline_id"` // should we use primitive.ObjectID here?
+	PipelineName           string               `bson:"pipeline_name" json:"pipeline_name"`
+	PipelineVersion        int                  `bson:"pipeline_version" json:"pipeline_version"`
+	Status                 ServiceRequestStatus `bson:"status" json:"status"`
+	CreatedOn              time.Time            `bson:"created_on" json:"created_on"`
+	StartedOn              time.Time            `bson:"started_on,omitempty" json:"started_on,omitempty"`
+	RetriedOn              time.Time            `bson:"retried_on,omitempty" json:"retried_on,omitempty"` // when a step of the service request was last retried, from which the pipeline timeout is measured again
+	LastUpdated            time.Time            `bson:"last_updated" json:"last_updated"`
+	Remarks                string               `bson:"remarks" json:"remarks"`
+	FormData               FormData             `bson:"form_data" json:"form_data"`
+	ParentServiceRequestId string               `bson:"parent_service_request_id,omitempty" json:"parent_service_request_id,omitempty"` // set for child service requests of PIPELINE steps
+	ParentStepName         string               `bson:"parent_step_name,omitempty" json:"parent_step_name,omitempty"`                   // the PIPELINE step of the parent which created the service request
+	ScheduleId             int                  `bson:"schedule_id,omitempty" json:"schedule_id,omitempty"`                             // set for service requests started by a schedule
+	Environment            string               `bson:"environment,omitempty" json:"environment,omitempty"`                             // the environment of the pipeline which the service request runs in
 }
@@ -7,17 +7,29 @@ type EventType string
 const (
 	STEP_NOT_STARTED EventType = "Not Started"
 	STEP_RUNNING     EventType = "Running"
+	STEP_RETRYING    EventType = "Retrying"    // an attempt failed and the step will be attempted again after a backoff
+	STEP_INTERRUPTED EventType = "Interrupted" // the step was running when the server stopped
 	STEP_FAILED      EventType = "Failed"
 	STEP_CANCELLED   EventType = "Cancelled"
 	STEP_COMPLETED   EventType = "Completed"
+
+	STEP_COMPENSATING        EventType = "Compensating"        // the compensation of the completed step is running
+	STEP_COMPENSATED         EventType = "Compensated"         // the compensation of the completed step has completed
+	STEP_COMPENSATION_FAILED EventType = "Compensation Failed" // the compensation of the completed step has failed
 )
 
+// Returns true if the event records the compensation of a step
+func IsCompensationEventType(eventType EventType) bool {
+	return eventType == STEP_COMPENSATING || eventType == STEP_COMPENSATED || eventType == STEP_COMPENSATION_FAILED
+}
+
 type ServiceRequestEventModel struct {
 	EventId          int
 	EventType        EventType
 	ServiceRequestId string
 	StepName         string
 	StepType         PipelineStepType
+	ExecutionId      string // identifies the attempt of the step which the event belongs to, if any
 	CreatedBy        string
 	CreatedAt        time.Time
 }
@@ -0,0 +1,22 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Stores the results of executing a step of a service request
+type ServiceRequestStepModel struct {
+	Id                  primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	ServiceRequestId    string             `bson:"service_request_id" json:"service_request_id"`
+	StepName            string             `bson:"step_name" json:"step_name"`
+	Output              map[string]any     `bson:"output" json:"output"`
+	Parameters          map[string]any     `bson:"parameters,omitempty" json:"parameters,omitempty"` // parameters of the step once placeholders are replaced
+	Callback            map[string]any     `bson:"callback,omitempty" json:"callback,omitempty"`     // payload received by a WAIT_FOR_CALLBACK step
+	CallbackReceivedOn  time.Time          `bson:"callback_received_on,omitempty" json:"callback_received_on,omitempty"`
+	ApprovalDeadline    time.Time          `bson:"approval_deadline,omitempty" json:"approval_deadline,omitempty"` // when the deadline action of a WAIT_FOR_APPROVAL step is carried out
+	Deadline            time.Time          `bson:"deadline,omitempty" json:"deadline,omitempty"`                   // when an attempt of a step which waits outside of its executor times out
+	DeadlineExecutionId string             `bson:"deadline_execution_id,omitempty" json:"deadline_execution_id,omitempty"`
+	LastUpdated         time.Time          `bson:"last_updated" json:"last_updated"`
+}
@@ -0,0 +1,117 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/joshtyf/flowforge/src/database/models"
+)
+
+type Schedule struct {
+	c *sql.DB
+}
+
+func NewSchedule(c *sql.DB) *Schedule {
+	return &Schedule{c: c}
+}
+
+func (s *Schedule) Create(sm *models.ScheduleModel) (*models.ScheduleModel, error) {
+	formData, err := json.Marshal(sm.FormData)
+	if err != nil {
+		return nil, err
+	}
+	err = s.c.QueryRow(CreateScheduleStatement, sm.PipelineId, sm.OrganizationId, sm.UserId, sm.CronExpression, sm.TimeZone, formData, sm.Environment, sm.MissedRunPolicy, sm.Enabled, sm.NextRunAt).
+		Scan(&sm.ScheduleId, &sm.CreatedOn, &sm.LastUpdated)
+	if err != nil {
+		return nil, err
+	}
+	return sm, nil
+}
+
+func (s *Schedule) GetById(scheduleId int) (*models.ScheduleModel, error) {
+	return scanSchedule(s.c.QueryRow(SelectScheduleByIdStatement, scheduleId))
+}
+
+func (s *Schedule) GetAllByPipelineId(pipelineId string) ([]*models.ScheduleModel, error) {
+	return s.query(SelectSchedulesByPipelineIdStatement, pipelineId)
+}
+
+// Returns the enabled schedules which should have run by the given time
+func (s *Schedule) GetAllDue(t time.Time) ([]*models.ScheduleModel, error) {
+	return s.query(SelectDueSchedulesStatement, t)
+}
+
+// Updates the fields of the schedule which can be changed by its users
+func (s *Schedule) Update(sm *models.ScheduleModel) (*models.ScheduleModel, error) {
+	formData, err := json.Marshal(sm.FormData)
+	if err != nil {
+		return nil, err
+	}
+	err = s.c.QueryRow(UpdateScheduleStatement, sm.ScheduleId, sm.CronExpression, sm.TimeZone, formData, sm.Environment, sm.MissedRunPolicy, sm.Enabled, sm.NextRunAt).
+		Scan(&sm.LastUpdated)
+	if err != nil {
+		return nil, err
+	}
+	return sm, nil
+}
+
+// Records a run of the schedule which started the service request
+func (s *Schedule) UpdateRun(scheduleId int, nextRunAt time.Time, lastRunAt time.Time, serviceRequestId string) error {
+	_, err := s.c.Exec(UpdateScheduleRunStatement, scheduleId, nextRunAt, lastRunAt, serviceRequestId)
+	return err
+}
+
+// Moves the next run of the schedule without recording a run, e.g. when missed runs are skipped
+func (s *Schedule) UpdateNextRunAt(scheduleId int, nextRunAt time.Time) error {
+	_, err := s.c.Exec(UpdateScheduleNextRunAtStatement, scheduleId, nextRunAt)
+	return err
+}
+
+func (s *Schedule) Delete(scheduleId int) error {
+	_, err := s.c.Exec(DeleteScheduleStatement, scheduleId)
+	return err
+}
+
+func (s *Schedule) query(statement string, args ...any) ([]*models.ScheduleModel, error) {
+	rows, err := s.c.Query(statement, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sms := []*models.ScheduleModel{}
+	for rows.Next() {
+		sm, err := scanSchedule(rows)
+		if err != nil {
+			return nil, err
+		}
+		sms = append(sms, sm)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return sms, nil
+}
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanSchedule(row scanner) (*models.ScheduleModel, error) {
+	sm := &models.ScheduleModel{}
+	var formData []byte
+	var lastRunAt sql.NullTime
+	err := row.Scan(&sm.ScheduleId, &sm.PipelineId, &sm.OrganizationId, &sm.UserId, &sm.CronExpression, &sm.TimeZone, &formData, &sm.Environment,
+		&sm.MissedRunPolicy, &sm.Enabled, &sm.NextRunAt, &lastRunAt, &sm.LastServiceRequestId, &sm.CreatedOn, &sm.LastUpdated)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(formData, &sm.FormData); err != nil {
+		return nil, err
+	}
+	if lastRunAt.Valid {
+		sm.LastRunAt = &lastRunAt.Time
+	}
+	return sm, nil
+}
@@ -0,0 +1,59 @@
+package database
+
+import (
+	"database/sql"
+
+	"github.com/joshtyf/flowforge/src/database/models"
+)
+
+type Secret struct {
+	c *sql.DB
+}
+
+func NewSecret(c *sql.DB) *Secret {
+	return &Secret{c: c}
+}
+
+// Creates the secret, or replaces the value of the secret if it exists
+func (s *Secret) Upsert(sm *models.SecretModel) (*models.SecretModel, error) {
+	if err := s.c.QueryRow(UpsertSecretStatement, sm.OrganizationId, sm.Name, sm.Value, sm.CreatedBy).Scan(&sm.CreatedOn, &sm.LastUpdated); err != nil {
+		return nil, err
+	}
+	return sm, nil
+}
+
+// Returns the secrets of the organization without their values
+func (s *Secret) GetAllByOrgId(orgId int) ([]*models.SecretModel, error) {
+	rows, err := s.c.Query(SelectSecretsByOrgIdStatement, orgId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sms := []*models.SecretModel{}
+	for rows.Next() {
+		sm := &models.SecretModel{}
+		if err := rows.Scan(&sm.OrganizationId, &sm.Name, &sm.CreatedBy, &sm.CreatedOn, &sm.LastUpdated); err != nil {
+			return nil, err
+		}
+		sms = append(sms, sm)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return sms, nil
+}
+
+// Returns the secret with its encrypted value
+func (s *Secret) GetByOrgIdAndName(orgId int, name string) (*models.SecretModel, error) {
+	sm := &models.SecretModel{}
+	err := s.c.QueryRow(SelectSecretByOrgIdAndNameStatement, orgId, name).Scan(&sm.OrganizationId, &sm.Name, &sm.Value, &sm.CreatedBy, &sm.CreatedOn, &sm.LastUpdated)
+	if err != nil {
+		return nil, err
+	}
+	return sm, nil
+}
+
+func (s *Secret) Delete(orgId int, name string) (sql.Result, error) {
+	return s.c.Exec(DeleteSecretStatement, orgId, name)
+}
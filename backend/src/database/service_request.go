@@ -3,11 +3,13 @@ package database
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"github.com/joshtyf/flowforge/src/database/models"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 type ServiceRequest struct {
@@ -67,6 +69,43 @@ func (sr *ServiceRequest) GetAll() ([]*models.ServiceRequestModel, error) {
 	return srms, nil
 }
 
+func (sr *ServiceRequest) GetAllByStatuses(statuses []models.ServiceRequestStatus) ([]*models.ServiceRequestModel, error) {
+	result, err := sr.c.Database(DatabaseName).Collection("service_requests").Find(context.Background(), bson.M{"status": bson.M{"$in": statuses}})
+	if err != nil {
+		return nil, err
+	}
+	srms := []*models.ServiceRequestModel{}
+	for result.Next(context.Background()) {
+		srm := &models.ServiceRequestModel{}
+		if err := result.Decode(srm); err != nil {
+			return nil, err
+		}
+		srms = append(srms, srm)
+	}
+	return srms, nil
+}
+
+// Returns the child service requests created by the PIPELINE steps of the service request, oldest first
+func (sr *ServiceRequest) GetAllByParentId(parentId string) ([]*models.ServiceRequestModel, error) {
+	result, err := sr.c.Database(DatabaseName).Collection("service_requests").Find(
+		context.Background(),
+		bson.M{"parent_service_request_id": parentId},
+		options.Find().SetSort(bson.M{"created_on": 1}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	srms := []*models.ServiceRequestModel{}
+	for result.Next(context.Background()) {
+		srm := &models.ServiceRequestModel{}
+		if err := result.Decode(srm); err != nil {
+			return nil, err
+		}
+		srms = append(srms, srm)
+	}
+	return srms, nil
+}
+
 func (sr *ServiceRequest) UpdateStatus(id string, status models.ServiceRequestStatus) error {
 	objectId, err := primitive.ObjectIDFromHex(id)
 	if err != nil {
@@ -77,6 +116,28 @@ func (sr *ServiceRequest) UpdateStatus(id string, status models.ServiceRequestSt
 	return err
 }
 
+// Updates the status of the service request to running and records when it was started
+func (sr *ServiceRequest) UpdateStarted(id string, startedOn time.Time) error {
+	objectId, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return err
+	}
+	_, err = sr.c.Database(DatabaseName).Collection("service_requests").UpdateOne(
+		context.Background(), bson.M{"_id": objectId}, bson.M{"$set": bson.M{"status": models.RUNNING, "started_on": startedOn}})
+	return err
+}
+
+// Updates the status of the service request to running and records when its failed step was retried
+func (sr *ServiceRequest) UpdateRetried(id string, retriedOn time.Time) error {
+	objectId, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return err
+	}
+	_, err = sr.c.Database(DatabaseName).Collection("service_requests").UpdateOne(
+		context.Background(), bson.M{"_id": objectId}, bson.M{"$set": bson.M{"status": models.RUNNING, "retried_on": retriedOn}})
+	return err
+}
+
 type GetServiceRequestFilters struct {
 	UserId   string
 	Statuses []string
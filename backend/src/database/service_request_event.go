@@ -17,13 +17,14 @@ func NewServiceRequestEvent(db *sql.DB) *ServiceRequestEvent {
 }
 
 func (sre *ServiceRequestEvent) Create(srem *models.ServiceRequestEventModel) error {
-	queryStr := "INSERT INTO service_request_event (event_type, service_request_id, step_name, step_type, created_by) VALUES ($1, $2, $3, $4, $5)"
+	queryStr := "INSERT INTO service_request_event (event_type, service_request_id, step_name, step_type, execution_id, created_by) VALUES ($1, $2, $3, $4, $5, $6)"
 	_, err := sre.db.Exec(
 		queryStr,
 		srem.EventType,
 		srem.ServiceRequestId,
 		srem.StepName,
 		srem.StepType,
+		srem.ExecutionId,
 		srem.CreatedBy,
 	)
 	return err
@@ -36,7 +37,7 @@ func (sre *ServiceRequestEvent) GetStepsLatestEvent(serviceRequestId string) ([]
 			FROM service_request_event
 			WHERE service_request_id = $1
 		)
-		SELECT event_id, event_type, service_request_id, step_name, step_type, created_by, created_at FROM LatestEvents
+		SELECT event_id, event_type, service_request_id, step_name, step_type, execution_id, created_by, created_at FROM LatestEvents
 		WHERE row_num = 1;`
 
 	rows, err := sre.db.Query(queryStr, serviceRequestId)
@@ -54,6 +55,7 @@ func (sre *ServiceRequestEvent) GetStepsLatestEvent(serviceRequestId string) ([]
 			&srem.ServiceRequestId,
 			&srem.StepName,
 			&srem.StepType,
+			&srem.ExecutionId,
 			&srem.CreatedBy,
 			&srem.CreatedAt,
 		)
@@ -65,9 +67,36 @@ func (sre *ServiceRequestEvent) GetStepsLatestEvent(serviceRequestId string) ([]
 	return srems, nil
 }
 
+// Returns the ids of the service requests with a step whose latest event is of the event type
+func (sre *ServiceRequestEvent) GetServiceRequestIdsByStepLatestEventType(eventType models.EventType) ([]string, error) {
+	queryStr := `
+		WITH LatestEvents AS (
+			SELECT service_request_id, event_type, ROW_NUMBER() OVER (PARTITION BY service_request_id, step_name ORDER BY created_at DESC) AS row_num
+			FROM service_request_event
+		)
+		SELECT DISTINCT service_request_id FROM LatestEvents
+		WHERE row_num = 1 AND event_type = $1;`
+
+	rows, err := sre.db.Query(queryStr, eventType)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var serviceRequestIds []string
+	for rows.Next() {
+		var serviceRequestId string
+		if err := rows.Scan(&serviceRequestId); err != nil {
+			return nil, err
+		}
+		serviceRequestIds = append(serviceRequestIds, serviceRequestId)
+	}
+	return serviceRequestIds, rows.Err()
+}
+
 func (sre *ServiceRequestEvent) GetStepLatestEvent(serviceRequestId, stepName string) (*models.ServiceRequestEventModel, error) {
 	queryStr := `
-		SELECT event_id, event_type, service_request_id, step_name, step_type, created_by, created_at
+		SELECT event_id, event_type, service_request_id, step_name, step_type, execution_id, created_by, created_at
 		FROM service_request_event
 		WHERE service_request_id = $1 AND step_name = $2
 		ORDER BY created_at DESC
@@ -81,6 +110,7 @@ func (sre *ServiceRequestEvent) GetStepLatestEvent(serviceRequestId, stepName st
 		&srem.ServiceRequestId,
 		&srem.StepName,
 		&srem.StepType,
+		&srem.ExecutionId,
 		&srem.CreatedBy,
 		&srem.CreatedAt,
 	)
@@ -92,7 +122,7 @@ func (sre *ServiceRequestEvent) GetStepLatestEvent(serviceRequestId, stepName st
 
 func (sr *ServiceRequestEvent) GetLatestStepEvent(serviceRequestId string) (*models.ServiceRequestEventModel, error) {
 	queryStr := `
-		SELECT event_id, event_type, service_request_id, step_name, step_type, created_by, created_at
+		SELECT event_id, event_type, service_request_id, step_name, step_type, execution_id, created_by, created_at
 		FROM service_request_event
 		WHERE service_request_id = $1
 		ORDER BY created_at DESC
@@ -106,6 +136,7 @@ func (sr *ServiceRequestEvent) GetLatestStepEvent(serviceRequestId string) (*mod
 		&srem.ServiceRequestId,
 		&srem.StepName,
 		&srem.StepType,
+		&srem.ExecutionId,
 		&srem.CreatedBy,
 		&srem.CreatedAt,
 	)
@@ -114,3 +145,18 @@ func (sr *ServiceRequestEvent) GetLatestStepEvent(serviceRequestId string) (*mod
 	}
 	return srem, nil
 }
+
+// Returns the number of events of the given type recorded for the step
+func (sre *ServiceRequestEvent) GetStepEventCount(serviceRequestId, stepName string, eventType models.EventType) (int, error) {
+	queryStr := `
+		SELECT COUNT(*)
+		FROM service_request_event
+		WHERE service_request_id = $1 AND step_name = $2 AND event_type = $3;`
+
+	var count int
+	err := sre.db.QueryRow(queryStr, serviceRequestId, stepName, eventType).Scan(&count)
+	if err != nil {
+		return 0, err
+	}
+	return count, nil
+}
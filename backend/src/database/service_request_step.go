@@ -0,0 +1,170 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/joshtyf/flowforge/src/database/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type ServiceRequestStep struct {
+	c *mongo.Client
+}
+
+func NewServiceRequestStep(c *mongo.Client) *ServiceRequestStep {
+	return &ServiceRequestStep{c: c}
+}
+
+// Creates the indexes of the deadlines which are polled for steps which have exceeded them. The indexes are sparse, as
+// only the steps which are waiting have a deadline. Indexes which exist are left as they are.
+func (srs *ServiceRequestStep) CreateIndexes() error {
+	_, err := srs.c.Database(DatabaseName).Collection("service_request_steps").Indexes().CreateMany(
+		context.Background(),
+		[]mongo.IndexModel{
+			{Keys: bson.D{{Key: "approval_deadline", Value: 1}}, Options: options.Index().SetSparse(true)},
+			{Keys: bson.D{{Key: "deadline", Value: 1}}, Options: options.Index().SetSparse(true)},
+		},
+	)
+	return err
+}
+
+// Saves the output of the step, replacing the output of any previous execution of the step
+func (srs *ServiceRequestStep) UpdateOutput(serviceRequestId, stepName string, output map[string]any) error {
+	_, err := srs.c.Database(DatabaseName).Collection("service_request_steps").UpdateOne(
+		context.Background(),
+		bson.M{"service_request_id": serviceRequestId, "step_name": stepName},
+		bson.M{"$set": bson.M{"output": output, "last_updated": time.Now()}},
+		options.Update().SetUpsert(true),
+	)
+	return err
+}
+
+// Saves the parameters of the step once placeholders are replaced, which are reused when the step is retried
+func (srs *ServiceRequestStep) UpdateParameters(serviceRequestId, stepName string, parameters map[string]any) error {
+	_, err := srs.c.Database(DatabaseName).Collection("service_request_steps").UpdateOne(
+		context.Background(),
+		bson.M{"service_request_id": serviceRequestId, "step_name": stepName},
+		bson.M{"$set": bson.M{"parameters": parameters, "last_updated": time.Now()}},
+		options.Update().SetUpsert(true),
+	)
+	return err
+}
+
+// Saves the payload received by the callback of a WAIT_FOR_CALLBACK step
+func (srs *ServiceRequestStep) UpdateCallback(serviceRequestId, stepName string, payload map[string]any) error {
+	now := time.Now()
+	_, err := srs.c.Database(DatabaseName).Collection("service_request_steps").UpdateOne(
+		context.Background(),
+		bson.M{"service_request_id": serviceRequestId, "step_name": stepName},
+		bson.M{"$set": bson.M{"callback": payload, "callback_received_on": now, "last_updated": now}},
+		options.Update().SetUpsert(true),
+	)
+	return err
+}
+
+// Removes the payload received by the callback of a WAIT_FOR_CALLBACK step, so that the next attempt of the step waits
+// for a new callback
+func (srs *ServiceRequestStep) ClearCallback(serviceRequestId, stepName string) error {
+	_, err := srs.c.Database(DatabaseName).Collection("service_request_steps").UpdateOne(
+		context.Background(),
+		bson.M{"service_request_id": serviceRequestId, "step_name": stepName},
+		bson.M{"$unset": bson.M{"callback": "", "callback_received_on": ""}, "$set": bson.M{"last_updated": time.Now()}},
+	)
+	return err
+}
+
+// Sets when the attempt of a step which waits outside of its executor times out. The deadline is removed if it is zero.
+func (srs *ServiceRequestStep) UpdateDeadline(serviceRequestId, stepName, executionId string, deadline time.Time) error {
+	update := bson.M{"$set": bson.M{"deadline": deadline, "deadline_execution_id": executionId, "last_updated": time.Now()}}
+	if deadline.IsZero() {
+		update = bson.M{"$unset": bson.M{"deadline": "", "deadline_execution_id": ""}, "$set": bson.M{"last_updated": time.Now()}}
+	}
+	_, err := srs.c.Database(DatabaseName).Collection("service_request_steps").UpdateOne(
+		context.Background(),
+		bson.M{"service_request_id": serviceRequestId, "step_name": stepName},
+		update,
+		options.Update().SetUpsert(true),
+	)
+	return err
+}
+
+// Returns the steps whose deadline is before t
+func (srs *ServiceRequestStep) GetAllByDeadlineBefore(t time.Time) ([]*models.ServiceRequestStepModel, error) {
+	res, err := srs.c.Database(DatabaseName).Collection("service_request_steps").Find(context.Background(), bson.M{"deadline": bson.M{"$lte": t}})
+	if err != nil {
+		return nil, err
+	}
+	srsms := []*models.ServiceRequestStepModel{}
+	for res.Next(context.Background()) {
+		srsm := &models.ServiceRequestStepModel{}
+		if err := res.Decode(srsm); err != nil {
+			return nil, err
+		}
+		srsms = append(srsms, srsm)
+	}
+	return srsms, nil
+}
+
+// Sets when the deadline action of a WAIT_FOR_APPROVAL step is carried out. The deadline is removed if it is zero.
+func (srs *ServiceRequestStep) UpdateApprovalDeadline(serviceRequestId, stepName string, deadline time.Time) error {
+	update := bson.M{"$set": bson.M{"approval_deadline": deadline, "last_updated": time.Now()}}
+	if deadline.IsZero() {
+		update = bson.M{"$unset": bson.M{"approval_deadline": ""}, "$set": bson.M{"last_updated": time.Now()}}
+	}
+	_, err := srs.c.Database(DatabaseName).Collection("service_request_steps").UpdateOne(
+		context.Background(),
+		bson.M{"service_request_id": serviceRequestId, "step_name": stepName},
+		update,
+		options.Update().SetUpsert(true),
+	)
+	return err
+}
+
+// Returns the WAIT_FOR_APPROVAL steps whose deadline is before t
+func (srs *ServiceRequestStep) GetAllByApprovalDeadlineBefore(t time.Time) ([]*models.ServiceRequestStepModel, error) {
+	res, err := srs.c.Database(DatabaseName).Collection("service_request_steps").Find(context.Background(), bson.M{"approval_deadline": bson.M{"$lte": t}})
+	if err != nil {
+		return nil, err
+	}
+	srsms := []*models.ServiceRequestStepModel{}
+	for res.Next(context.Background()) {
+		srsm := &models.ServiceRequestStepModel{}
+		if err := res.Decode(srsm); err != nil {
+			return nil, err
+		}
+		srsms = append(srsms, srsm)
+	}
+	return srsms, nil
+}
+
+func (srs *ServiceRequestStep) GetByServiceRequestIdAndStepName(serviceRequestId, stepName string) (*models.ServiceRequestStepModel, error) {
+	result := srs.c.Database(DatabaseName).Collection("service_request_steps").FindOne(
+		context.Background(), bson.M{"service_request_id": serviceRequestId, "step_name": stepName})
+	if result.Err() != nil {
+		return nil, result.Err()
+	}
+	srsm := &models.ServiceRequestStepModel{}
+	if err := result.Decode(srsm); err != nil {
+		return nil, err
+	}
+	return srsm, nil
+}
+
+func (srs *ServiceRequestStep) GetAllByServiceRequestId(serviceRequestId string) ([]*models.ServiceRequestStepModel, error) {
+	res, err := srs.c.Database(DatabaseName).Collection("service_request_steps").Find(context.Background(), bson.M{"service_request_id": serviceRequestId})
+	if err != nil {
+		return nil, err
+	}
+	srsms := []*models.ServiceRequestStepModel{}
+	for res.Next(context.Background()) {
+		srsm := &models.ServiceRequestStepModel{}
+		if err := res.Decode(srsm); err != nil {
+			return nil, err
+		}
+		srsms = append(srsms, srsm)
+	}
+	return srsms, nil
+}
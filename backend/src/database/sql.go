@@ -89,6 +89,189 @@ var (
 									SET deleted = $1
 									WHERE user_id = $2
 									AND org_id = $3`
+
+	// Job Queue
+	CreateJobStatement = `INSERT INTO public."job_queue" (name, payload)
+							VALUES ($1, $2)`
+
+	ClaimJobStatement = `UPDATE public."job_queue"
+							SET locked_until = NOW() + make_interval(secs => $1), attempts = attempts + 1
+							WHERE job_id = (
+								SELECT job_id FROM public."job_queue"
+								WHERE status = 'pending'
+								AND run_at <= NOW()
+								AND (locked_until IS NULL OR locked_until < NOW())
+								ORDER BY job_id
+								FOR UPDATE SKIP LOCKED
+								LIMIT 1
+							)
+							RETURNING job_id, name, payload, status, attempts, run_at, created_at`
+
+	DeleteJobStatement = `DELETE FROM public."job_queue" WHERE job_id = $1`
+
+	RetryJobStatement = `UPDATE public."job_queue"
+							SET run_at = NOW() + make_interval(secs => $2), locked_until = NULL, last_error = $3
+							WHERE job_id = $1`
+
+	FailJobStatement = `UPDATE public."job_queue"
+							SET status = 'failed', locked_until = NULL, last_error = $2
+							WHERE job_id = $1`
+
+	// Pipeline Schedule
+	CreateScheduleStatement = `INSERT INTO public."pipeline_schedule" (pipeline_id, org_id, user_id, cron_expression, time_zone, form_data, environment, missed_run_policy, enabled, next_run_at)
+								VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10) RETURNING schedule_id, created_on, last_updated`
+
+	SelectScheduleByIdStatement = `SELECT schedule_id, pipeline_id, org_id, user_id, cron_expression, time_zone, form_data, environment, missed_run_policy, enabled, next_run_at, last_run_at, last_service_request_id, created_on, last_updated
+									FROM public."pipeline_schedule"
+									WHERE schedule_id = $1`
+
+	SelectSchedulesByPipelineIdStatement = `SELECT schedule_id, pipeline_id, org_id, user_id, cron_expression, time_zone, form_data, environment, missed_run_policy, enabled, next_run_at, last_run_at, last_service_request_id, created_on, last_updated
+											FROM public."pipeline_schedule"
+											WHERE pipeline_id = $1
+											ORDER BY schedule_id`
+
+	SelectDueSchedulesStatement = `SELECT schedule_id, pipeline_id, org_id, user_id, cron_expression, time_zone, form_data, environment, missed_run_policy, enabled, next_run_at, last_run_at, last_service_request_id, created_on, last_updated
+									FROM public."pipeline_schedule"
+									WHERE enabled = true
+									AND next_run_at <= $1
+									ORDER BY next_run_at`
+
+	UpdateScheduleStatement = `UPDATE public."pipeline_schedule"
+								SET cron_expression = $2, time_zone = $3, form_data = $4, environment = $5, missed_run_policy = $6, enabled = $7, next_run_at = $8, last_updated = NOW()
+								WHERE schedule_id = $1
+								RETURNING last_updated`
+
+	UpdateScheduleRunStatement = `UPDATE public."pipeline_schedule"
+									SET next_run_at = $2, last_run_at = $3, last_service_request_id = $4, last_updated = NOW()
+									WHERE schedule_id = $1`
+
+	UpdateScheduleNextRunAtStatement = `UPDATE public."pipeline_schedule"
+										SET next_run_at = $2, last_updated = NOW()
+										WHERE schedule_id = $1`
+
+	DeleteScheduleStatement = `DELETE FROM public."pipeline_schedule" WHERE schedule_id = $1`
+
+	// Organization Secret
+	UpsertSecretStatement = `INSERT INTO public."organization_secret" (org_id, name, value, created_by)
+								VALUES ($1, $2, $3, $4)
+								ON CONFLICT (org_id, name) DO UPDATE SET value = $3, created_by = $4, last_updated = NOW()
+								RETURNING created_on, last_updated`
+
+	SelectSecretsByOrgIdStatement = `SELECT org_id, name, created_by, created_on, last_updated
+										FROM public."organization_secret"
+										WHERE org_id = $1
+										ORDER BY name`
+
+	SelectSecretByOrgIdAndNameStatement = `SELECT org_id, name, value, created_by, created_on, last_updated
+											FROM public."organization_secret"
+											WHERE org_id = $1
+											AND name = $2`
+
+	DeleteSecretStatement = `DELETE FROM public."organization_secret" WHERE org_id = $1 AND name = $2`
+
+	// Approval Event
+	CreateApprovalEventStatement = `INSERT INTO public."approval_event" (event_type, service_request_id, step_name, execution_id, created_by, reason)
+									VALUES ($1, $2, $3, NULLIF($4, ''), NULLIF($5, ''), NULLIF($6, ''))
+									RETURNING event_id, created_at`
+
+	SelectApprovalEventsByServiceRequestIdStatement = `SELECT event_id, event_type, service_request_id, step_name, COALESCE(execution_id, ''), COALESCE(created_by, ''), COALESCE(reason, ''), created_at
+														FROM public."approval_event"
+														WHERE service_request_id = $1
+														ORDER BY created_at`
+
+	SelectStepApprovalEventsByExecutionIdStatement = `SELECT event_id, event_type, service_request_id, step_name, COALESCE(execution_id, ''), COALESCE(created_by, ''), COALESCE(reason, ''), created_at
+														FROM public."approval_event"
+														WHERE service_request_id = $1
+														AND step_name = $2
+														AND COALESCE(execution_id, '') = $3
+														ORDER BY created_at`
+
+	// Agent
+	CreateAgentStatement = `INSERT INTO public."agent" (org_id, name, token_hash, created_by)
+							VALUES ($1, $2, $3, $4)
+							RETURNING agent_id, created_on`
+
+	SelectAgentsByOrgIdStatement = `SELECT agent_id, org_id, name, token_hash, created_by, created_on, last_seen_on
+									FROM public."agent"
+									WHERE org_id = $1
+									ORDER BY agent_id`
+
+	SelectAgentByTokenHashStatement = `SELECT agent_id, org_id, name, token_hash, created_by, created_on, last_seen_on
+										FROM public."agent"
+										WHERE token_hash = $1`
+
+	UpdateAgentLastSeenOnStatement = `UPDATE public."agent" SET last_seen_on = NOW() WHERE agent_id = $1`
+
+	// The tasks claimed by the agent are queued again so that they are run by another agent
+	DeleteAgentStatement = `WITH requeued AS (
+								UPDATE public."agent_task"
+								SET status = 'queued', agent_id = NULL, claimed_at = NULL, lease_expires_at = NULL
+								WHERE org_id = $1
+								AND agent_id = $2
+								AND status = 'claimed'
+							)
+							DELETE FROM public."agent" WHERE org_id = $1 AND agent_id = $2`
+
+	// Agent Task
+	CreateAgentTaskStatement = `INSERT INTO public."agent_task" (org_id, service_request_id, step_name, step_type, labels, execution_id)
+								VALUES ($1, $2, $3, $4, $5, $6)
+								RETURNING task_id, status, created_at`
+
+	SelectAgentTaskByIdStatement = `SELECT task_id, org_id, service_request_id, step_name, step_type, labels, status, agent_id, created_at, claimed_at, finished_at, lease_expires_at, execution_id
+									FROM public."agent_task"
+									WHERE task_id = $1`
+
+	SelectActiveAgentTaskByStepStatement = `SELECT task_id, org_id, service_request_id, step_name, step_type, labels, status, agent_id, created_at, claimed_at, finished_at, lease_expires_at, execution_id
+											FROM public."agent_task"
+											WHERE service_request_id = $1
+											AND step_name = $2
+											AND status IN ('queued', 'claimed')
+											ORDER BY task_id DESC
+											LIMIT 1`
+
+	ClaimAgentTaskStatement = `UPDATE public."agent_task"
+								SET status = 'claimed', agent_id = $2, claimed_at = NOW(), lease_expires_at = NOW() + make_interval(secs => $5)
+								WHERE task_id = (
+									SELECT task_id FROM public."agent_task"
+									WHERE org_id = $1
+									AND status = 'queued'
+									AND step_type = ANY($3::character varying[])
+									AND labels <@ $4::character varying[]
+									ORDER BY task_id
+									FOR UPDATE SKIP LOCKED
+									LIMIT 1
+								)
+								RETURNING task_id, org_id, service_request_id, step_name, step_type, labels, status, agent_id, created_at, claimed_at, finished_at, lease_expires_at, execution_id`
+
+	UpdateAgentTaskExecutionIdStatement = `UPDATE public."agent_task"
+											SET execution_id = $2
+											WHERE task_id = $1
+											AND status IN ('queued', 'claimed')`
+
+	RenewAgentTaskLeaseStatement = `UPDATE public."agent_task"
+									SET lease_expires_at = NOW() + make_interval(secs => $3)
+									WHERE task_id = $1
+									AND agent_id = $2
+									AND status = 'claimed'`
+
+	// Tasks whose agent stopped reporting on them, e.g. because the agent crashed, are queued again so that they are run
+	// by another agent
+	RequeueExpiredAgentTasksStatement = `UPDATE public."agent_task"
+										SET status = 'queued', agent_id = NULL, claimed_at = NULL, lease_expires_at = NULL
+										WHERE status = 'claimed'
+										AND lease_expires_at < NOW()
+										RETURNING task_id, org_id, service_request_id, step_name, step_type, labels, status, agent_id, created_at, claimed_at, finished_at, lease_expires_at, execution_id`
+
+	FinishAgentTaskStatement = `UPDATE public."agent_task"
+								SET status = $3, finished_at = NOW()
+								WHERE task_id = $1
+								AND agent_id = $2
+								AND status = 'claimed'`
+
+	CancelAgentTaskStatement = `UPDATE public."agent_task"
+								SET status = 'cancelled', finished_at = NOW()
+								WHERE task_id = $1
+								AND status IN ('queued', 'claimed')`
 )
 
 // TODO: figure out how to log this
@@ -1,7 +1,10 @@
 package events
 
 import (
-	"github.com/gookit/event"
+	"encoding/json"
+	"errors"
+	"fmt"
+
 	"github.com/joshtyf/flowforge/src/database/models"
 )
 
@@ -9,44 +12,125 @@ const (
 	NewServiceRequestEventName = "NewServiceRequestEvent"
 	StepCompletedEventName     = "StepCompletedEvent"
 	StepFailedEventName        = "StepFailedEvent"
+	RetryStepEventName         = "RetryStepEvent"
+	CompensateEventName        = "CompensateEvent"
 )
 
+var ErrUnknownEvent = errors.New("unknown event")
+
+// Events are published to a Queue and must be serialisable to JSON so that they can be persisted.
+type Event interface {
+	Name() string
+}
+
+// Decodes the payload of a persisted event based on its name.
+func DecodeEvent(name string, payload []byte) (Event, error) {
+	var e Event
+	switch name {
+	case NewServiceRequestEventName:
+		e = &NewServiceRequestEvent{}
+	case StepCompletedEventName:
+		e = &StepCompletedEvent{}
+	case StepFailedEventName:
+		e = &StepFailedEvent{}
+	case RetryStepEventName:
+		e = &RetryStepEvent{}
+	case CompensateEventName:
+		e = &CompensateEvent{}
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnknownEvent, name)
+	}
+	if err := json.Unmarshal(payload, e); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// Errors are persisted as their message
+func errorMessage(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
+
+func errorFromMessage(msg string) error {
+	if msg == "" {
+		return nil
+	}
+	return errors.New(msg)
+}
+
 type NewServiceRequestEvent struct {
-	event.BasicEvent
 	serviceRequest *models.ServiceRequestModel
 }
 
+type newServiceRequestEventPayload struct {
+	ServiceRequest *models.ServiceRequestModel `json:"service_request"`
+}
+
 func NewNewServiceRequestEvent(serviceRequest *models.ServiceRequestModel) *NewServiceRequestEvent {
-	e := &NewServiceRequestEvent{
+	return &NewServiceRequestEvent{
 		serviceRequest: serviceRequest,
 	}
-	e.SetName(NewServiceRequestEventName)
-	return e
+}
+
+func (e *NewServiceRequestEvent) Name() string {
+	return NewServiceRequestEventName
 }
 
 func (e *NewServiceRequestEvent) ServiceRequest() *models.ServiceRequestModel {
 	return e.serviceRequest
 }
 
+func (e *NewServiceRequestEvent) MarshalJSON() ([]byte, error) {
+	return json.Marshal(newServiceRequestEventPayload{
+		ServiceRequest: e.serviceRequest,
+	})
+}
+
+func (e *NewServiceRequestEvent) UnmarshalJSON(data []byte) error {
+	payload := newServiceRequestEventPayload{}
+	if err := json.Unmarshal(data, &payload); err != nil {
+		return err
+	}
+	e.serviceRequest = payload.ServiceRequest
+	return nil
+}
+
+// Signals that an execution of a step completed. Completions of executions which are not the current execution of the
+// step, e.g. duplicate approvals or approvals of an earlier attempt, are ignored.
 type StepCompletedEvent struct {
-	event.BasicEvent
 	completedStep    string
 	serviceRequestId string
+	executionId      string
 	createdBy        string
 	results          interface{}
 	err              error
 }
 
-func NewStepCompletedEvent(completedStep string, serviceRequestId string, createdBy string, results interface{}, err error) *StepCompletedEvent {
-	e := &StepCompletedEvent{
+type stepCompletedEventPayload struct {
+	CompletedStep    string      `json:"completed_step"`
+	ServiceRequestId string      `json:"service_request_id"`
+	ExecutionId      string      `json:"execution_id,omitempty"`
+	CreatedBy        string      `json:"created_by"`
+	Results          interface{} `json:"results"`
+	Err              string      `json:"err,omitempty"`
+}
+
+func NewStepCompletedEvent(completedStep string, serviceRequestId string, executionId string, createdBy string, results interface{}, err error) *StepCompletedEvent {
+	return &StepCompletedEvent{
 		completedStep:    completedStep,
 		serviceRequestId: serviceRequestId,
+		executionId:      executionId,
 		createdBy:        createdBy,
 		results:          results,
 		err:              err,
 	}
-	e.SetName(StepCompletedEventName)
-	return e
+}
+
+func (e *StepCompletedEvent) Name() string {
+	return StepCompletedEventName
 }
 
 func (e *StepCompletedEvent) CompletedStep() string {
@@ -57,10 +141,16 @@ func (e *StepCompletedEvent) ServiceRequestId() string {
 	return e.serviceRequestId
 }
 
+// Returns the ID of the execution of the step which completed. Events published before steps had execution IDs have none.
+func (e *StepCompletedEvent) ExecutionId() string {
+	return e.executionId
+}
+
 func (e *StepCompletedEvent) CreatedBy() string {
 	return e.createdBy
 }
 
+// Returns the results of the step. Results of events which were read from a queue are decoded from JSON.
 func (e *StepCompletedEvent) Results() interface{} {
 	return e.results
 }
@@ -69,25 +159,62 @@ func (e *StepCompletedEvent) Err() error {
 	return e.err
 }
 
+func (e *StepCompletedEvent) MarshalJSON() ([]byte, error) {
+	return json.Marshal(stepCompletedEventPayload{
+		CompletedStep:    e.completedStep,
+		ServiceRequestId: e.serviceRequestId,
+		ExecutionId:      e.executionId,
+		CreatedBy:        e.createdBy,
+		Results:          e.results,
+		Err:              errorMessage(e.err),
+	})
+}
+
+func (e *StepCompletedEvent) UnmarshalJSON(data []byte) error {
+	payload := stepCompletedEventPayload{}
+	if err := json.Unmarshal(data, &payload); err != nil {
+		return err
+	}
+	e.completedStep = payload.CompletedStep
+	e.serviceRequestId = payload.ServiceRequestId
+	e.executionId = payload.ExecutionId
+	e.createdBy = payload.CreatedBy
+	e.results = payload.Results
+	e.err = errorFromMessage(payload.Err)
+	return nil
+}
+
 type StepFailedEvent struct {
-	event.BasicEvent
 	failedStep     string
 	serviceRequest *models.ServiceRequestModel
+	executionId    string
 	createdBy      string
 	remarks        string
 	err            error
 }
 
-func NewStepFailedEvent(failedStep string, serviceRequest *models.ServiceRequestModel, createdBy string, remarks string, err error) *StepFailedEvent {
-	e := &StepFailedEvent{
+type stepFailedEventPayload struct {
+	FailedStep     string                      `json:"failed_step"`
+	ServiceRequest *models.ServiceRequestModel `json:"service_request"`
+	ExecutionId    string                      `json:"execution_id,omitempty"`
+	CreatedBy      string                      `json:"created_by"`
+	Remarks        string                      `json:"remarks"`
+	Err            string                      `json:"err,omitempty"`
+}
+
+func NewStepFailedEvent(failedStep string, serviceRequest *models.ServiceRequestModel, executionId string, createdBy string, remarks string, err error) *StepFailedEvent {
+	return &StepFailedEvent{
 		failedStep:     failedStep,
 		serviceRequest: serviceRequest,
+		executionId:    executionId,
 		createdBy:      createdBy,
 		remarks:        remarks,
 		err:            err,
 	}
-	e.SetName(StepFailedEventName)
-	return e
+}
+
+func (e *StepFailedEvent) Name() string {
+	return StepFailedEventName
 }
 
 func (e *StepFailedEvent) FailedStep() string {
@@ -98,6 +225,12 @@ func (e *StepFailedEvent) ServiceRequest() *models.ServiceRequestModel {
 	return e.serviceRequest
 }
 
+// Returns the ID of the execution of the step which failed. Failures of steps which had not started, and events
+// published before failures had execution IDs, have none.
+func (e *StepFailedEvent) ExecutionId() string {
+	return e.executionId
+}
+
 func (e *StepFailedEvent) CreatedBy() string {
 	return e.createdBy
 }
@@ -109,3 +242,122 @@ func (e *StepFailedEvent) Remarks() string {
 func (e *StepFailedEvent) Err() error {
 	return e.err
 }
+
+func (e *StepFailedEvent) MarshalJSON() ([]byte, error) {
+	return json.Marshal(stepFailedEventPayload{
+		FailedStep:     e.failedStep,
+		ServiceRequest: e.serviceRequest,
+		ExecutionId:    e.executionId,
+		CreatedBy:      e.createdBy,
+		Remarks:        e.remarks,
+		Err:            errorMessage(e.err),
+	})
+}
+
+func (e *StepFailedEvent) UnmarshalJSON(data []byte) error {
+	payload := stepFailedEventPayload{}
+	if err := json.Unmarshal(data, &payload); err != nil {
+		return err
+	}
+	e.failedStep = payload.FailedStep
+	e.serviceRequest = payload.ServiceRequest
+	e.executionId = payload.ExecutionId
+	e.createdBy = payload.CreatedBy
+	e.remarks = payload.Remarks
+	e.err = errorFromMessage(payload.Err)
+	return nil
+}
+
+// Requests that a failed step is run again, after which the service request continues from the step
+type RetryStepEvent struct {
+	stepName         string
+	serviceRequestId string
+	createdBy        string
+}
+
+type retryStepEventPayload struct {
+	StepName         string `json:"step_name"`
+	ServiceRequestId string `json:"service_request_id"`
+	CreatedBy        string `json:"created_by"`
+}
+
+func NewRetryStepEvent(stepName string, serviceRequestId string, createdBy string) *RetryStepEvent {
+	return &RetryStepEvent{
+		stepName:         stepName,
+		serviceRequestId: serviceRequestId,
+		createdBy:        createdBy,
+	}
+}
+
+func (e *RetryStepEvent) Name() string {
+	return RetryStepEventName
+}
+
+func (e *RetryStepEvent) StepName() string {
+	return e.stepName
+}
+
+func (e *RetryStepEvent) ServiceRequestId() string {
+	return e.serviceRequestId
+}
+
+func (e *RetryStepEvent) CreatedBy() string {
+	return e.createdBy
+}
+
+func (e *RetryStepEvent) MarshalJSON() ([]byte, error) {
+	return json.Marshal(retryStepEventPayload{
+		StepName:         e.stepName,
+		ServiceRequestId: e.serviceRequestId,
+		CreatedBy:        e.createdBy,
+	})
+}
+
+func (e *RetryStepEvent) UnmarshalJSON(data []byte) error {
+	payload := retryStepEventPayload{}
+	if err := json.Unmarshal(data, &payload); err != nil {
+		return err
+	}
+	e.stepName = payload.StepName
+	e.serviceRequestId = payload.ServiceRequestId
+	e.createdBy = payload.CreatedBy
+	return nil
+}
+
+// Requests that the completed steps of a failed or cancelled service request are compensated
+type CompensateEvent struct {
+	serviceRequestId string
+}
+
+type compensateEventPayload struct {
+	ServiceRequestId string `json:"service_request_id"`
+}
+
+func NewCompensateEvent(serviceRequestId string) *CompensateEvent {
+	return &CompensateEvent{
+		serviceRequestId: serviceRequestId,
+	}
+}
+
+func (e *CompensateEvent) Name() string {
+	return CompensateEventName
+}
+
+func (e *CompensateEvent) ServiceRequestId() string {
+	return e.serviceRequestId
+}
+
+func (e *CompensateEvent) MarshalJSON() ([]byte, error) {
+	return json.Marshal(compensateEventPayload{
+		ServiceRequestId: e.serviceRequestId,
+	})
+}
+
+func (e *CompensateEvent) UnmarshalJSON(data []byte) error {
+	payload := compensateEventPayload{}
+	if err := json.Unmarshal(data, &payload); err != nil {
+		return err
+	}
+	e.serviceRequestId = payload.ServiceRequestId
+	return nil
+}
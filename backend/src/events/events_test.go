@@ -0,0 +1,124 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/joshtyf/flowforge/src/database/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestDecodeEvent(t *testing.T) {
+	serviceRequest := &models.ServiceRequestModel{
+		Id:       primitive.NewObjectID(),
+		FormData: models.FormData{"name": "vm-1"},
+	}
+
+	t.Run("NewServiceRequestEvent", func(t *testing.T) {
+		decoded := encodeAndDecode(t, NewNewServiceRequestEvent(serviceRequest)).(*NewServiceRequestEvent)
+		if decoded.ServiceRequest().Id != serviceRequest.Id {
+			t.Errorf("Expected service request id %s, got %s", serviceRequest.Id.Hex(), decoded.ServiceRequest().Id.Hex())
+		}
+		if decoded.ServiceRequest().FormData["name"] != "vm-1" {
+			t.Errorf("Expected form data to be decoded, got %v", decoded.ServiceRequest().FormData)
+		}
+	})
+
+	t.Run("StepCompletedEvent", func(t *testing.T) {
+		results := map[string]any{"output": map[string]any{"status": 200}}
+		decoded := encodeAndDecode(t, NewStepCompletedEvent("step1", serviceRequest.Id.Hex(), "execution1", "user1", results, nil)).(*StepCompletedEvent)
+		if decoded.CompletedStep() != "step1" || decoded.ServiceRequestId() != serviceRequest.Id.Hex() || decoded.CreatedBy() != "user1" {
+			t.Errorf("Expected step1, %s and user1, got %s, %s and %s", serviceRequest.Id.Hex(), decoded.CompletedStep(), decoded.ServiceRequestId(), decoded.CreatedBy())
+		}
+		if decoded.ExecutionId() != "execution1" {
+			t.Errorf("Expected execution id execution1, got %s", decoded.ExecutionId())
+		}
+		expected := map[string]any{"output": map[string]any{"status": float64(200)}}
+		if !reflect.DeepEqual(decoded.Results(), expected) {
+			t.Errorf("Expected results %v, got %v", expected, decoded.Results())
+		}
+		if decoded.Err() != nil {
+			t.Errorf("Expected no error, got %v", decoded.Err())
+		}
+	})
+
+	t.Run("StepFailedEvent", func(t *testing.T) {
+		decoded := encodeAndDecode(t, NewStepFailedEvent("step1", serviceRequest, "execution1", "user1", "rejected", errors.New("failed"))).(*StepFailedEvent)
+		if decoded.FailedStep() != "step1" || decoded.Remarks() != "rejected" || decoded.CreatedBy() != "user1" {
+			t.Errorf("Expected step1, rejected and user1, got %s, %s and %s", decoded.FailedStep(), decoded.Remarks(), decoded.CreatedBy())
+		}
+		if decoded.ExecutionId() != "execution1" {
+			t.Errorf("Expected execution1, got %s", decoded.ExecutionId())
+		}
+		if decoded.ServiceRequest().Id != serviceRequest.Id {
+			t.Errorf("Expected service request id %s, got %s", serviceRequest.Id.Hex(), decoded.ServiceRequest().Id.Hex())
+		}
+		if decoded.Err() == nil || decoded.Err().Error() != "failed" {
+			t.Errorf("Expected error 'failed', got %v", decoded.Err())
+		}
+	})
+
+	t.Run("RetryStepEvent", func(t *testing.T) {
+		decoded := encodeAndDecode(t, NewRetryStepEvent("step1", serviceRequest.Id.Hex(), "user1")).(*RetryStepEvent)
+		if decoded.StepName() != "step1" || decoded.ServiceRequestId() != serviceRequest.Id.Hex() || decoded.CreatedBy() != "user1" {
+			t.Errorf("Expected step1, %s and user1, got %s, %s and %s", serviceRequest.Id.Hex(), decoded.StepName(), decoded.ServiceRequestId(), decoded.CreatedBy())
+		}
+	})
+
+	t.Run("CompensateEvent", func(t *testing.T) {
+		decoded := encodeAndDecode(t, NewCompensateEvent(serviceRequest.Id.Hex())).(*CompensateEvent)
+		if decoded.ServiceRequestId() != serviceRequest.Id.Hex() {
+			t.Errorf("Expected service request id %s, got %s", serviceRequest.Id.Hex(), decoded.ServiceRequestId())
+		}
+	})
+
+	t.Run("unknown event", func(t *testing.T) {
+		_, err := DecodeEvent("UnknownEvent", []byte("{}"))
+		if !errors.Is(err, ErrUnknownEvent) {
+			t.Errorf("Expected %v, got %v", ErrUnknownEvent, err)
+		}
+	})
+}
+
+func encodeAndDecode(t *testing.T, e Event) Event {
+	payload, err := json.Marshal(e)
+	if err != nil {
+		t.Fatalf("Expected no error encoding event, got %v", err)
+	}
+	decoded, err := DecodeEvent(e.Name(), payload)
+	if err != nil {
+		t.Fatalf("Expected no error decoding event, got %v", err)
+	}
+	return decoded
+}
+
+func TestMemoryQueue(t *testing.T) {
+	queue := NewMemoryQueue()
+	handled := make(chan Event, 1)
+	queue.Subscribe(StepCompletedEventName, func(e Event) error {
+		handled <- e
+		return nil
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	queue.Start(ctx)
+
+	if err := queue.Publish(NewStepCompletedEvent("step1", "sr1", "", "", nil, nil)); err != nil {
+		t.Fatalf("Expected no error publishing event, got %v", err)
+	}
+	select {
+	case e := <-handled:
+		if e.(*StepCompletedEvent).CompletedStep() != "step1" {
+			t.Errorf("Expected step1, got %s", e.(*StepCompletedEvent).CompletedStep())
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected event to be handled")
+	}
+	if len(queue.Published()) != 1 {
+		t.Errorf("Expected 1 published event, got %d", len(queue.Published()))
+	}
+}
@@ -0,0 +1,85 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+)
+
+// An in-memory Queue for tests. Events are encoded and decoded like they are by the PostgresQueue, so handlers receive
+// the same values, but they are lost when the process stops and are not retried when their handler fails.
+type MemoryQueue struct {
+	events    chan Event
+	handlers  map[string]Handler
+	published []Event
+	errs      []error
+	mu        sync.Mutex
+}
+
+func NewMemoryQueue() *MemoryQueue {
+	return &MemoryQueue{
+		events:   make(chan Event, 100),
+		handlers: map[string]Handler{},
+	}
+}
+
+func (q *MemoryQueue) Publish(e Event) error {
+	payload, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	decoded, err := DecodeEvent(e.Name(), payload)
+	if err != nil {
+		return err
+	}
+	q.mu.Lock()
+	q.published = append(q.published, decoded)
+	q.mu.Unlock()
+	q.events <- decoded
+	return nil
+}
+
+func (q *MemoryQueue) Subscribe(name string, handler Handler) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.handlers[name] = handler
+}
+
+func (q *MemoryQueue) Start(ctx context.Context) {
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case e := <-q.events:
+				q.mu.Lock()
+				handler, ok := q.handlers[e.Name()]
+				q.mu.Unlock()
+				err := fmt.Errorf("no handler subscribed to %s", e.Name())
+				if ok {
+					err = handler(e)
+				}
+				if err != nil {
+					q.mu.Lock()
+					q.errs = append(q.errs, err)
+					q.mu.Unlock()
+				}
+			}
+		}
+	}()
+}
+
+// Returns the events published to the queue
+func (q *MemoryQueue) Published() []Event {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return append([]Event{}, q.published...)
+}
+
+// Returns the errors returned by handlers
+func (q *MemoryQueue) Errors() []error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return append([]error{}, q.errs...)
+}
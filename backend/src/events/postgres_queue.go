@@ -0,0 +1,130 @@
+package events
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/joshtyf/flowforge/src/database"
+	"github.com/joshtyf/flowforge/src/logger"
+)
+
+const (
+	defaultQueueWorkers = 4
+	queuePollInterval   = time.Second
+	jobLease            = 5 * time.Minute // handlers taking longer than this may be run again by another worker
+	maxJobAttempts      = 5
+	jobRetryBackoff     = 5 * time.Second // multiplied by the number of attempts
+)
+
+// A Queue backed by the job_queue table. Jobs are claimed with SELECT ... FOR UPDATE SKIP LOCKED, so multiple backend
+// instances can share the same queue. Jobs whose worker stops before handling them are claimed again once their lease
+// expires.
+type PostgresQueue struct {
+	jobs     *database.Job
+	logger   logger.ServerLogger
+	workers  int
+	handlers map[string]Handler
+	mu       sync.RWMutex
+}
+
+type PostgresQueueConfig func(*PostgresQueue)
+
+func WithWorkers(workers int) PostgresQueueConfig {
+	return func(q *PostgresQueue) {
+		q.workers = workers
+	}
+}
+
+func NewPostgresQueue(psqlClient *sql.DB, logger logger.ServerLogger, configs ...PostgresQueueConfig) *PostgresQueue {
+	q := &PostgresQueue{
+		jobs:     database.NewJob(psqlClient),
+		logger:   logger,
+		workers:  defaultQueueWorkers,
+		handlers: map[string]Handler{},
+	}
+	for _, c := range configs {
+		c(q)
+	}
+	return q
+}
+
+func (q *PostgresQueue) Publish(e Event) error {
+	payload, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	return q.jobs.Create(e.Name(), payload)
+}
+
+func (q *PostgresQueue) Subscribe(name string, handler Handler) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.handlers[name] = handler
+}
+
+func (q *PostgresQueue) Start(ctx context.Context) {
+	for i := 0; i < q.workers; i++ {
+		go q.work(ctx)
+	}
+}
+
+func (q *PostgresQueue) work(ctx context.Context) {
+	for {
+		if ctx.Err() != nil {
+			return
+		}
+		job, err := q.jobs.Claim(jobLease)
+		if err != nil {
+			if !errors.Is(err, sql.ErrNoRows) {
+				q.logger.Error(fmt.Sprintf("unable to claim job: %s", err))
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(queuePollInterval):
+			}
+			continue
+		}
+
+		err = q.handle(job.Name, job.Payload)
+		if err == nil {
+			if err := q.jobs.Delete(job.JobId); err != nil {
+				q.logger.Error(fmt.Sprintf("unable to delete job %d: %s", job.JobId, err))
+			}
+			continue
+		}
+		q.logger.Error(fmt.Sprintf("error handling job %d (%s) on attempt %d: %s", job.JobId, job.Name, job.Attempts, err))
+		if job.Attempts >= maxJobAttempts {
+			err = q.jobs.Fail(job.JobId, err.Error())
+		} else {
+			err = q.jobs.Retry(job.JobId, time.Duration(job.Attempts)*jobRetryBackoff, err.Error())
+		}
+		if err != nil {
+			q.logger.Error(fmt.Sprintf("unable to release job %d: %s", job.JobId, err))
+		}
+	}
+}
+
+func (q *PostgresQueue) handle(name string, payload []byte) (err error) {
+	q.mu.RLock()
+	handler, ok := q.handlers[name]
+	q.mu.RUnlock()
+	if !ok {
+		return fmt.Errorf("no handler subscribed to %s", name)
+	}
+	e, err := DecodeEvent(name, payload)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("handler panicked: %v", r)
+		}
+	}()
+	return handler(e)
+}
@@ -0,0 +1,17 @@
+package events
+
+import "context"
+
+// Handles an event read from a queue. Events whose handler returns an error may be delivered again, so handlers
+// should be safe to run more than once for the same event.
+type Handler func(Event) error
+
+// A queue of events which are handled asynchronously by workers
+type Queue interface {
+	// Adds the event to the queue
+	Publish(e Event) error
+	// Registers the handler for events with the given name. Must be called before the queue is started.
+	Subscribe(name string, handler Handler)
+	// Starts handling events in the background until the context is cancelled
+	Start(ctx context.Context)
+}
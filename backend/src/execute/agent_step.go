@@ -0,0 +1,130 @@
+package execute
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/joshtyf/flowforge/src/database"
+	"github.com/joshtyf/flowforge/src/database/models"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Interval at which the leases of the tasks claimed by agents are checked
+const agentTaskLeasePollInterval = 30 * time.Second
+
+// Hands steps to the remote agents of the organization of the service request. The agents pull the steps from the
+// server, which publishes the completion or failure of the steps when the agents report on them.
+type agentStepExecutor struct {
+	mongoClient *mongo.Client
+	psqlClient  *sql.DB
+	stepType    models.PipelineStepType
+}
+
+func newAgentStepExecutor(mongoClient *mongo.Client, psqlClient *sql.DB, stepType models.PipelineStepType) *agentStepExecutor {
+	return &agentStepExecutor{
+		mongoClient: mongoClient,
+		psqlClient:  psqlClient,
+		stepType:    stepType,
+	}
+}
+
+// Queues a task of the step for the agents. The task of the step which is queued or claimed is kept, e.g. when the step
+// is re-driven after a server restart, so that the step is not run twice. The step is failed by the execution manager
+// if the agent does not report on it before the step timeout.
+func (e *agentStepExecutor) Execute(ctx context.Context, execution *StepExecution) (*StepExecResult, error) {
+	l := execution.Logger
+	step := execution.Step
+	serviceRequest := execution.ServiceRequest
+	var deadline time.Time
+	if timeout := step.GetTimeout(); timeout > 0 {
+		deadline = time.Now().Add(timeout)
+	}
+	if err := database.NewServiceRequestStep(e.mongoClient).UpdateDeadline(serviceRequest.Id.Hex(), step.StepName, execution.ExecutionId, deadline); err != nil {
+		l.Error(fmt.Sprintf("error setting deadline of step: %s", err))
+		return nil, err
+	}
+
+	agentTaskDAO := database.NewAgentTask(e.psqlClient)
+	task, err := agentTaskDAO.GetActiveByStep(serviceRequest.Id.Hex(), step.StepName)
+	if err == nil {
+		// The task is now run for this execution, so that the report of the agent is not taken to be of an earlier one
+		if err := agentTaskDAO.UpdateExecutionId(task.TaskId, execution.ExecutionId); err != nil {
+			l.Error(fmt.Sprintf("error updating task of the step: %s", err))
+			return nil, err
+		}
+		l.Info(fmt.Sprintf("task %d of the step is already %s", task.TaskId, task.Status))
+		return &StepExecResult{Waiting: true}, nil
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		l.Error(fmt.Sprintf("error getting task of the step: %s", err))
+		return nil, err
+	}
+
+	task, err = agentTaskDAO.Create(&models.AgentTaskModel{
+		OrganizationId:   serviceRequest.OrganizationId,
+		ServiceRequestId: serviceRequest.Id.Hex(),
+		StepName:         step.StepName,
+		StepType:         step.StepType,
+		Labels:           step.Agent.Labels,
+		ExecutionId:      execution.ExecutionId,
+	})
+	if err != nil {
+		l.Error(fmt.Sprintf("error queueing task of the step: %s", err))
+		return nil, err
+	}
+	if len(task.Labels) > 0 {
+		l.Info(fmt.Sprintf("queued task %d for an agent with labels %s", task.TaskId, strings.Join(task.Labels, ", ")))
+	} else {
+		l.Info(fmt.Sprintf("queued task %d for an agent", task.TaskId))
+	}
+	return &StepExecResult{Waiting: true}, nil
+}
+
+func (e *agentStepExecutor) StepType() models.PipelineStepType {
+	return e.stepType
+}
+
+// Returns the executor of the step, which is the agent executor for steps run by remote agents, or nil if there is no
+// executor for the step type
+func (srm *ExecutionManager) getExecutor(step *models.PipelineStepModel) StepExecutor {
+	if step.IsRunByAgent() {
+		return newAgentStepExecutor(srm.mongoClient, srm.psqlClient, step.StepType)
+	}
+	return srm.executors[step.StepType]
+}
+
+// Queues the tasks whose agents stopped reporting on them again, so that they are run by another agent, until ctx is
+// cancelled
+func (srm *ExecutionManager) enforceAgentTaskLeases(ctx context.Context) {
+	ticker := time.NewTicker(agentTaskLeasePollInterval)
+	defer ticker.Stop()
+	for {
+		tasks, err := database.NewAgentTask(srm.psqlClient).RequeueExpired()
+		if err != nil {
+			srm.logger.Error(fmt.Sprintf("unable to queue agent tasks whose lease expired: %s", err))
+		}
+		for _, task := range tasks {
+			srm.logger.Info(fmt.Sprintf("queued task %d of step %s of service request %s again as its agent stopped reporting on it", task.TaskId, task.StepName, task.ServiceRequestId))
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Cancels the task of the step which is queued or claimed, if there is one
+func (srm *ExecutionManager) cancelAgentTask(serviceRequestId, stepName string) error {
+	agentTaskDAO := database.NewAgentTask(srm.psqlClient)
+	task, err := agentTaskDAO.GetActiveByStep(serviceRequestId, stepName)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	return agentTaskDAO.Cancel(task.TaskId)
+}
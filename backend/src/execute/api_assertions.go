@@ -0,0 +1,129 @@
+package execute
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/joshtyf/flowforge/src/helper"
+)
+
+// Responses with these status codes are successful if the step does not assert the status
+var defaultAcceptedStatusCodes = []helper.StatusCodeRange{{Min: 200, Max: 299}}
+
+// Returned by the API step when the response fails the assertions on its headers or body
+type apiAssertionError struct {
+	failures []string
+}
+
+func (e *apiAssertionError) Error() string {
+	return fmt.Sprintf("response failed %d assertion(s): %s", len(e.failures), strings.Join(e.failures, "; "))
+}
+
+// Assertions on the response of an API step, set by the "assertions" parameter of the step
+type apiAssertions struct {
+	statusCodes []helper.StatusCodeRange
+	headers     map[string]string    // header names and the values they must contain. Headers with an empty value must be present.
+	body        []*helper.Expression // conditions on the JSON response body, which is referenced by $
+}
+
+func parseApiAssertions(parameter any) (*apiAssertions, error) {
+	assertions := &apiAssertions{
+		statusCodes: defaultAcceptedStatusCodes,
+		headers:     map[string]string{},
+		body:        []*helper.Expression{},
+	}
+	if parameter == nil {
+		return assertions, nil
+	}
+	m, ok := helper.ToMap(parameter)
+	if !ok {
+		return nil, fmt.Errorf("expected an object of assertions, got %T", parameter)
+	}
+
+	if status, ok := m["status"]; ok {
+		elems, ok := helper.ToSlice(status)
+		if !ok {
+			elems = []any{status}
+		}
+		assertions.statusCodes = make([]helper.StatusCodeRange, 0, len(elems))
+		for _, elem := range elems {
+			r, err := helper.ParseStatusCodeRange(elem)
+			if err != nil {
+				return nil, err
+			}
+			assertions.statusCodes = append(assertions.statusCodes, r)
+		}
+	}
+	headers, err := toStringMap(m["headers"])
+	if err != nil {
+		return nil, fmt.Errorf("invalid header assertions: %w", err)
+	}
+	assertions.headers = headers
+	conditions, err := toStringSlice(m["body"])
+	if err != nil {
+		return nil, fmt.Errorf("invalid body assertions: %w", err)
+	}
+	for _, condition := range conditions {
+		expr, err := helper.ParseExpression(condition)
+		if err != nil {
+			return nil, err
+		}
+		assertions.body = append(assertions.body, expr)
+	}
+	return assertions, nil
+}
+
+// Returns the expected status codes if the status code is not accepted
+func (a *apiAssertions) checkStatus(statusCode int) (string, bool) {
+	expected := make([]string, 0, len(a.statusCodes))
+	for _, r := range a.statusCodes {
+		if r.Contains(statusCode) {
+			return "", true
+		}
+		expected = append(expected, r.String())
+	}
+	return strings.Join(expected, ", "), false
+}
+
+// Returns a description of each failed assertion on the headers and body of the response, with the expected and
+// actual values
+func (a *apiAssertions) check(headers http.Header, body any) []string {
+	failures := make([]string, 0)
+	names := make([]string, 0, len(a.headers))
+	for name := range a.headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		expected := a.headers[name]
+		values, ok := headers[http.CanonicalHeaderKey(name)]
+		actual := strings.Join(values, ", ")
+		if !ok {
+			failures = append(failures, fmt.Sprintf("header %s: expected to be present, got none", name))
+		} else if !strings.Contains(strings.ToLower(actual), strings.ToLower(expected)) {
+			failures = append(failures, fmt.Sprintf("header %s: expected to contain %q, got %q", name, expected, actual))
+		}
+	}
+	values := map[string]any{"$": body}
+	for _, expr := range a.body {
+		result, err := expr.Evaluate(values)
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("body %s: %s", expr, err))
+			continue
+		}
+		if helper.IsTruthy(result) {
+			continue
+		}
+		actual := make([]string, 0)
+		for _, path := range expr.Identifiers() {
+			value, _ := helper.LookupValue(values, path)
+			encoded, _ := json.Marshal(value)
+			actual = append(actual, fmt.Sprintf("%s=%s", path, encoded))
+		}
+		failures = append(failures, fmt.Sprintf("body: expected %s, got %s", expr, strings.Join(actual, ", ")))
+	}
+	return failures
+}
@@ -0,0 +1,131 @@
+package execute
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/joshtyf/flowforge/src/database"
+	"github.com/joshtyf/flowforge/src/database/models"
+	"github.com/joshtyf/flowforge/src/events"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Interval at which the deadlines of WAIT_FOR_APPROVAL steps are checked
+const approvalDeadlinePollInterval = 30 * time.Second
+
+// Carries out the deadline actions of WAIT_FOR_APPROVAL steps whose deadline has been exceeded until ctx is cancelled.
+// Every backend instance checks the deadlines, as each deadline is handled under the lock of its service request.
+func (srm *ExecutionManager) enforceApprovalDeadlines(ctx context.Context) {
+	ticker := time.NewTicker(approvalDeadlinePollInterval)
+	defer ticker.Stop()
+	for {
+		steps, err := database.NewServiceRequestStep(srm.mongoClient).GetAllByApprovalDeadlineBefore(time.Now())
+		if err != nil {
+			srm.logger.Error(fmt.Sprintf("unable to get approval steps past their deadline: %s", err))
+		}
+		for _, step := range steps {
+			if err := srm.enforceApprovalDeadline(step.ServiceRequestId, step.StepName); err != nil {
+				srm.logger.Error(fmt.Sprintf("unable to enforce approval deadline of step %s of service request %s: %s", step.StepName, step.ServiceRequestId, err))
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (srm *ExecutionManager) enforceApprovalDeadline(serviceRequestId, stepName string) error {
+	unlock, err := srm.lockServiceRequest(serviceRequestId)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	// The step may have been approved, or its deadline handled by another instance, while waiting for the lock
+	serviceRequestStepDAO := database.NewServiceRequestStep(srm.mongoClient)
+	srsm, err := serviceRequestStepDAO.GetByServiceRequestIdAndStepName(serviceRequestId, stepName)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	if srsm.ApprovalDeadline.IsZero() || srsm.ApprovalDeadline.After(now) {
+		return nil
+	}
+	serviceRequest, err := database.NewServiceRequest(srm.mongoClient).GetById(serviceRequestId)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return serviceRequestStepDAO.UpdateApprovalDeadline(serviceRequestId, stepName, time.Time{})
+	} else if err != nil {
+		return err
+	}
+	latestEvent, err := database.NewServiceRequestEvent(srm.psqlClient).GetStepLatestEvent(serviceRequestId, stepName)
+	if err != nil {
+		return err
+	}
+	if serviceRequest.Status != models.PENDING || latestEvent.EventType != models.STEP_RUNNING || latestEvent.StepType != models.WaitForApprovalStep {
+		// The step is no longer waiting for approval
+		return serviceRequestStepDAO.UpdateApprovalDeadline(serviceRequestId, stepName, time.Time{})
+	}
+	policy, err := models.GetApprovalPolicy(srsm.Parameters)
+	if err != nil {
+		return err
+	}
+
+	// A step which has been escalated is rejected at the escalation deadline
+	approvalEvents, err := database.NewApprovalEvent(srm.psqlClient).GetAllByExecutionId(serviceRequestId, stepName, latestEvent.ExecutionId)
+	if err != nil {
+		return err
+	}
+	escalated := false
+	for _, event := range approvalEvents {
+		if event.EventType == models.APPROVAL_TIMED_OUT && policy.OnDeadline == models.EscalateAtDeadline {
+			escalated = true
+		}
+	}
+	action := policy.OnDeadline
+	reason := fmt.Sprintf("approval deadline of %s exceeded", policy.Deadline)
+	if escalated {
+		action = models.RejectAtDeadline
+		reason = fmt.Sprintf("escalation deadline of %s exceeded", policy.EscalationDeadline)
+	}
+	switch action {
+	case models.ApproveAtDeadline:
+		reason += ", approving the step"
+	case models.EscalateAtDeadline:
+		reason += ", escalating the step"
+	default:
+		reason += ", rejecting the step"
+	}
+
+	_, err = database.NewApprovalEvent(srm.psqlClient).Create(&models.ApprovalEventModel{
+		EventType:        models.APPROVAL_TIMED_OUT,
+		ServiceRequestId: serviceRequestId,
+		StepName:         stepName,
+		ExecutionId:      latestEvent.ExecutionId,
+		Reason:           reason,
+	})
+	if err != nil {
+		return err
+	}
+	srm.logger.Info(fmt.Sprintf("step %s of service request %s: %s", stepName, serviceRequestId, reason))
+
+	switch action {
+	case models.EscalateAtDeadline:
+		var deadline time.Time
+		if policy.EscalationDeadline > 0 {
+			deadline = now.Add(policy.EscalationDeadline)
+		}
+		return serviceRequestStepDAO.UpdateApprovalDeadline(serviceRequestId, stepName, deadline)
+	case models.ApproveAtDeadline:
+		err = srm.queue.Publish(events.NewStepCompletedEvent(stepName, serviceRequestId, latestEvent.ExecutionId, "", nil, nil))
+	default:
+		err = srm.queue.Publish(events.NewStepFailedEvent(stepName, serviceRequest, latestEvent.ExecutionId, "", reason, nil))
+	}
+	if err != nil {
+		return err
+	}
+	return serviceRequestStepDAO.UpdateApprovalDeadline(serviceRequestId, stepName, time.Time{})
+}
@@ -0,0 +1,197 @@
+package execute
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/joshtyf/flowforge/src/database"
+	"github.com/joshtyf/flowforge/src/database/models"
+	"github.com/joshtyf/flowforge/src/events"
+	"github.com/joshtyf/flowforge/src/helper"
+	"github.com/joshtyf/flowforge/src/logger"
+)
+
+func compensationLockKey(serviceRequestId string) string {
+	return fmt.Sprintf("compensation/%s", serviceRequestId)
+}
+
+func (srm *ExecutionManager) handleCompensateEvent(e events.Event) error {
+	srm.logger.Info("handling compensate event")
+	serviceRequestId := e.(*events.CompensateEvent).ServiceRequestId()
+	if serviceRequestId == "" {
+		srm.logger.Error(fmt.Sprintf("event %s missing data: %s", e.Name(), "service request"))
+		return fmt.Errorf("service request is not provided")
+	}
+	serviceRequest, err := database.NewServiceRequest(srm.mongoClient).GetById(serviceRequestId)
+	if err != nil {
+		srm.logger.Error(fmt.Sprintf("error encountered while handling event: %s", err))
+		return err
+	}
+	if serviceRequest.Status != models.FAILED && serviceRequest.Status != models.CANCELLED {
+		srm.logger.Info(fmt.Sprintf("service request %s has not failed or been cancelled. Will not compensate steps", serviceRequestId))
+		return nil
+	}
+	// Compensations can take as long as steps, so they are not run by the worker of the queue
+	go srm.compensateServiceRequest(serviceRequest)
+	return nil
+}
+
+// Publishes a compensate event for the service request if any of its steps can be compensated
+func (srm *ExecutionManager) requestCompensation(serviceRequestId string, pipeline *models.PipelineModel) {
+	for _, step := range pipeline.Steps {
+		if step.Compensation != nil {
+			if err := srm.queue.Publish(events.NewCompensateEvent(serviceRequestId)); err != nil {
+				srm.logger.Error(fmt.Sprintf("unable to publish compensation of service request %s: %s", serviceRequestId, err))
+			}
+			return
+		}
+	}
+}
+
+// Runs the compensations of the completed steps of a failed or cancelled service request, in the reverse order in which
+// the steps completed. A compensation which fails is not retried and does not stop the remaining compensations. Runs
+// for the same service request are serialised, and steps which have been compensated are skipped.
+func (srm *ExecutionManager) compensateServiceRequest(serviceRequest *models.ServiceRequestModel) error {
+	serviceRequestId := serviceRequest.Id.Hex()
+	// Wait for the compensations which are running, as steps which completed since they started, e.g. parallel steps
+	// which completed after the service request failed, are only compensated by this run
+	release, err := database.NewLock(srm.psqlClient).Acquire(compensationLockKey(serviceRequestId))
+	if err != nil {
+		srm.logger.Error(fmt.Sprintf("error encountered while compensating service request %s: %s", serviceRequestId, err))
+		return err
+	}
+	defer func() {
+		if err := release(); err != nil {
+			srm.logger.Error(fmt.Sprintf("unable to release compensation of service request %s: %s", serviceRequestId, err))
+		}
+	}()
+
+	pipeline, err := database.NewPipeline(srm.mongoClient).GetById(serviceRequest.PipelineId)
+	if err != nil {
+		srm.logger.Error(fmt.Sprintf("error encountered while compensating service request %s: %s", serviceRequestId, err))
+		return err
+	}
+	if err := logger.CreateExecutorLogDir(serviceRequestId); err != nil {
+		srm.logger.Error(fmt.Sprintf("error encountered while compensating service request %s: %s", serviceRequestId, err))
+		return err
+	}
+	stepsLatestEvent, err := database.NewServiceRequestEvent(srm.psqlClient).GetStepsLatestEvent(serviceRequestId)
+	if err != nil {
+		srm.logger.Error(fmt.Sprintf("error encountered while compensating service request %s: %s", serviceRequestId, err))
+		return err
+	}
+
+	// Compensations which were running when the server stopped are run again, before those of steps which completed earlier
+	toCompensate := make([]*models.ServiceRequestEventModel, 0)
+	for _, event := range stepsLatestEvent {
+		if event.EventType != models.STEP_COMPLETED && event.EventType != models.STEP_COMPENSATING {
+			continue
+		}
+		if step := pipeline.GetPipelineStep(event.StepName); step != nil && step.Compensation != nil {
+			toCompensate = append(toCompensate, event)
+		}
+	}
+	sort.SliceStable(toCompensate, func(i, j int) bool {
+		return toCompensate[i].CreatedAt.After(toCompensate[j].CreatedAt)
+	})
+
+	values, err := srm.getPlaceholderValues(serviceRequest, pipeline)
+	if err != nil {
+		srm.logger.Error(fmt.Sprintf("error encountered while compensating service request %s: %s", serviceRequestId, err))
+		return err
+	}
+	for _, event := range toCompensate {
+		step := pipeline.GetPipelineStep(event.StepName)
+		// The compensation is a different request to the step, so it has its own execution ID
+		executionId, err := newExecutionId()
+		if err != nil {
+			srm.logger.Error(fmt.Sprintf("error encountered while compensating service request %s: %s", serviceRequestId, err))
+			return err
+		}
+		eventType := models.STEP_COMPENSATED
+		if err := srm.compensateStep(serviceRequest, step, executionId, values); err != nil {
+			srm.logger.Error(fmt.Sprintf("unable to compensate step %s of service request %s: %s", step.StepName, serviceRequestId, err))
+			eventType = models.STEP_COMPENSATION_FAILED
+		}
+		if err := srm.createStepEvent(serviceRequest, step, executionId, eventType); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Runs the compensation of the step once, logging to the log file of the step
+func (srm *ExecutionManager) compensateStep(serviceRequest *models.ServiceRequestModel, step *models.PipelineStepModel, executionId string, values map[string]any) error {
+	if err := srm.createStepEvent(serviceRequest, step, executionId, models.STEP_COMPENSATING); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(
+		logger.CreateExecutorLogFilePath(serviceRequest.Id.Hex(), step.StepName),
+		os.O_RDWR|os.O_CREATE|os.O_APPEND,
+		0644,
+	)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	executor_logger := logger.NewExecutorLogger(io.MultiWriter(os.Stdout, f), step.StepName)
+
+	compensationStep := step.GetCompensationStep()
+	executor := srm.executors[compensationStep.StepType]
+	if executor == nil {
+		executor_logger.Error(fmt.Sprintf("missing executor for compensation of type %s", compensationStep.StepType))
+		return fmt.Errorf("no executor found for compensation")
+	}
+	for key, val := range compensationStep.Parameters {
+		replaced, err := renderParameter(val, values)
+		if err != nil {
+			executor_logger.Error(fmt.Sprintf("unable to replace placeholders of compensation parameter %s: %s", key, err))
+			return err
+		}
+		compensationStep.Parameters[key] = replaced
+	}
+	compensationStep, secretValues, err := srm.resolveSecrets(serviceRequest.OrganizationId, compensationStep)
+	if err != nil {
+		executor_logger.Error(fmt.Sprintf("unable to resolve secrets of compensation: %s", err))
+		return err
+	}
+	executor_logger = logger.NewExecutorLogger(helper.NewRedactingWriter(io.MultiWriter(os.Stdout, f), secretValues), step.StepName)
+
+	execution := &StepExecution{
+		ServiceRequest: serviceRequest,
+		Step:           compensationStep,
+		Parameters:     compensationStep.Parameters,
+		Values:         values,
+		ExecutionId:    executionId,
+		Logger:         executor_logger,
+	}
+	executor_logger.Info("running compensation")
+	if _, err := srm.attemptStep(context.Background(), execution, executor); err != nil {
+		executor_logger.Error(fmt.Sprintf("compensation failed: %s", err))
+		return errors.New(helper.RedactSecrets(err.Error(), secretValues))
+	}
+	executor_logger.Info("compensation completed")
+	return nil
+}
+
+// Runs the compensations of the service requests which were being compensated when the server stopped
+func (srm *ExecutionManager) resumeCompensations() {
+	serviceRequestIds, err := database.NewServiceRequestEvent(srm.psqlClient).GetServiceRequestIdsByStepLatestEventType(models.STEP_COMPENSATING)
+	if err != nil {
+		srm.logger.Error(fmt.Sprintf("unable to get service requests to compensate: %s", err))
+		return
+	}
+	for _, serviceRequestId := range serviceRequestIds {
+		serviceRequest, err := database.NewServiceRequest(srm.mongoClient).GetById(serviceRequestId)
+		if err != nil {
+			srm.logger.Error(fmt.Sprintf("unable to resume compensation of service request %s: %s", serviceRequestId, err))
+			continue
+		}
+		go srm.compensateServiceRequest(serviceRequest)
+	}
+}
@@ -0,0 +1,45 @@
+package execute
+
+import (
+	"context"
+
+	"github.com/joshtyf/flowforge/src/database/models"
+	"github.com/joshtyf/flowforge/src/logger"
+)
+
+// Executes the steps of a step type. Executors of new step types can be registered with the execution manager by
+// WithStepExecutor, after which pipelines with steps of the type are valid.
+//
+// Execute is called for every attempt of a step. The context is cancelled once the attempt exceeds the timeout of the
+// step or the service request exceeds the timeout of its pipeline. Executors should return the error of the context
+// once it is cancelled. Executors must be safe for concurrent use, as steps of several service requests, and parallel
+// steps of a service request, may run at the same time.
+type StepExecutor interface {
+	StepType() models.PipelineStepType
+	Execute(ctx context.Context, execution *StepExecution) (*StepExecResult, error)
+}
+
+// The step which is executed by a StepExecutor
+type StepExecution struct {
+	ServiceRequest *models.ServiceRequestModel
+	Step           *models.PipelineStepModel // the step of the pipeline, whose parameters are the rendered parameters
+	Parameters     map[string]any            // parameters of the step with placeholders, including secrets, replaced
+	Values         map[string]any            // values available to placeholders, e.g. the form data of the service request
+	ExecutionId    string                    // unique ID of the attempt, e.g. to deduplicate requests to other services
+	Logger         *logger.ExecutorLogger    // writes to the logs of the step, with the secrets of the step redacted
+}
+
+type StepExecResult struct {
+	NextStepName string         `json:"next_step_name,omitempty"` // Set by executors which choose the step to proceed to, e.g. BRANCH steps
+	Output       map[string]any `json:"output,omitempty"`         // Referenced by later steps through `${steps.<step_name>.<key>}` placeholders
+	Waiting      bool           `json:"-"`                        // Set by executors of steps which are completed later, e.g. by an approval, or which were cancelled
+}
+
+// Registers the executor of a step type, which replaces the executor of the step type if there is one. Step types
+// without a built-in executor become valid step types of pipelines.
+func WithStepExecutor(executor StepExecutor) ExecutionManagerConfig {
+	return func(srm *ExecutionManager) {
+		models.RegisterPipelineStepType(executor.StepType())
+		srm.executors[executor.StepType()] = executor
+	}
+}
@@ -0,0 +1,123 @@
+package execute
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/joshtyf/flowforge/src/database"
+	"github.com/joshtyf/flowforge/src/database/models"
+)
+
+// Interval at which the pipeline timeouts of service requests are checked
+const pipelineDeadlinePollInterval = 30 * time.Second
+
+// Returns the time at which the service request exceeds the timeout of its pipeline, or the zero time if the pipeline
+// has no timeout. The timeout is measured from when the service request started, or from when a failed step was last
+// retried.
+func getPipelineDeadline(serviceRequest *models.ServiceRequestModel, pipeline *models.PipelineModel) time.Time {
+	timeout := pipeline.GetTimeout()
+	if timeout <= 0 || serviceRequest.StartedOn.IsZero() {
+		return time.Time{}
+	}
+	if serviceRequest.RetriedOn.After(serviceRequest.StartedOn) {
+		return serviceRequest.RetriedOn.Add(timeout)
+	}
+	return serviceRequest.StartedOn.Add(timeout)
+}
+
+// Returns true if the service request has exceeded the timeout of its pipeline at now
+func hasExceededPipelineDeadline(serviceRequest *models.ServiceRequestModel, pipeline *models.PipelineModel, now time.Time) bool {
+	deadline := getPipelineDeadline(serviceRequest, pipeline)
+	return !deadline.IsZero() && !now.Before(deadline)
+}
+
+// Fails the steps of service requests which have exceeded the timeout of their pipeline until ctx is cancelled. Steps
+// which are being executed are stopped by the deadline of their context, so only the steps which wait outside of their
+// executor are failed, e.g. steps waiting on an approval, a callback, a child service request or an agent.
+func (srm *ExecutionManager) enforcePipelineDeadlines(ctx context.Context) {
+	ticker := time.NewTicker(pipelineDeadlinePollInterval)
+	defer ticker.Stop()
+	for {
+		serviceRequests, err := database.NewServiceRequest(srm.mongoClient).GetAllByStatuses([]models.ServiceRequestStatus{models.RUNNING, models.PENDING})
+		if err != nil {
+			srm.logger.Error(fmt.Sprintf("unable to get service requests to check their pipeline timeout: %s", err))
+		}
+		pipelines := make(map[string]*models.PipelineModel)
+		for _, serviceRequest := range serviceRequests {
+			pipeline, ok := pipelines[serviceRequest.PipelineId]
+			if !ok {
+				if pipeline, err = database.NewPipeline(srm.mongoClient).GetById(serviceRequest.PipelineId); err != nil {
+					srm.logger.Error(fmt.Sprintf("unable to get pipeline %s: %s", serviceRequest.PipelineId, err))
+					continue
+				}
+				pipelines[serviceRequest.PipelineId] = pipeline
+			}
+			deadline := getPipelineDeadline(serviceRequest, pipeline)
+			if deadline.IsZero() || deadline.After(time.Now()) {
+				continue
+			}
+			if err := srm.enforcePipelineDeadline(serviceRequest.Id.Hex(), pipeline); err != nil {
+				srm.logger.Error(fmt.Sprintf("unable to enforce pipeline timeout of service request %s: %s", serviceRequest.Id.Hex(), err))
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (srm *ExecutionManager) enforcePipelineDeadline(serviceRequestId string, pipeline *models.PipelineModel) error {
+	unlock, err := srm.lockServiceRequest(serviceRequestId)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	// The service request may have finished while waiting for the lock
+	serviceRequest, err := database.NewServiceRequest(srm.mongoClient).GetById(serviceRequestId)
+	if err != nil {
+		return err
+	}
+	if serviceRequest.Status != models.RUNNING && serviceRequest.Status != models.PENDING {
+		return nil
+	}
+	latestEvents, err := database.NewServiceRequestEvent(srm.psqlClient).GetStepsLatestEvent(serviceRequestId)
+	if err != nil {
+		return err
+	}
+	stepsLatestEvent := make(map[string]*models.ServiceRequestEventModel, len(latestEvents))
+	for _, event := range latestEvents {
+		stepsLatestEvent[event.StepName] = event
+	}
+	for _, step := range pipeline.Steps {
+		step := step
+		latestEvent, ok := stepsLatestEvent[step.StepName]
+		if !ok || (latestEvent.EventType != models.STEP_RUNNING && latestEvent.EventType != models.STEP_RETRYING) {
+			continue
+		}
+		running, err := srm.isStepRunningElsewhere(serviceRequestId, step.StepName)
+		if err != nil {
+			return err
+		}
+		if running {
+			// The executor of the step fails it once the deadline of its context is exceeded
+			continue
+		}
+		// The agent running the step has not reported on it, so its task is cancelled to stop it from being reported on
+		if step.IsRunByAgent() {
+			if err := srm.cancelAgentTask(serviceRequestId, step.StepName); err != nil {
+				return err
+			}
+		}
+		srm.logger.Info(fmt.Sprintf("failing step %s of service request %s which exceeded the pipeline timeout", step.StepName, serviceRequestId))
+		srm.failStep(serviceRequest, &step, latestEvent.ExecutionId, pipelineTimeoutReason(pipeline))
+	}
+	return nil
+}
+
+func pipelineTimeoutReason(pipeline *models.PipelineModel) string {
+	return fmt.Sprintf("service request exceeded the pipeline timeout of %s", pipeline.GetTimeout())
+}
@@ -0,0 +1,60 @@
+package execute
+
+import (
+	"testing"
+	"time"
+
+	"github.com/joshtyf/flowforge/src/database/models"
+)
+
+func TestGetPipelineDeadline(t *testing.T) {
+	startedOn := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	testCases := []struct {
+		testDescription string
+		serviceRequest  *models.ServiceRequestModel
+		pipeline        *models.PipelineModel
+		expected        time.Time
+	}{
+		{"Pipeline without timeout", &models.ServiceRequestModel{StartedOn: startedOn}, &models.PipelineModel{}, time.Time{}},
+		{"Service request not started", &models.ServiceRequestModel{}, &models.PipelineModel{Timeout: "1h"}, time.Time{}},
+		{"Pipeline with timeout", &models.ServiceRequestModel{StartedOn: startedOn}, &models.PipelineModel{Timeout: "1h"}, startedOn.Add(time.Hour)},
+		{
+			"Retried service request",
+			&models.ServiceRequestModel{StartedOn: startedOn, RetriedOn: startedOn.Add(2 * time.Hour)},
+			&models.PipelineModel{Timeout: "1h"},
+			startedOn.Add(3 * time.Hour),
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.testDescription, func(t *testing.T) {
+			deadline := getPipelineDeadline(tc.serviceRequest, tc.pipeline)
+			if !deadline.Equal(tc.expected) {
+				t.Errorf("Expected %s, got %s", tc.expected, deadline)
+			}
+		})
+	}
+}
+
+func TestHasExceededPipelineDeadline(t *testing.T) {
+	startedOn := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	serviceRequest := &models.ServiceRequestModel{StartedOn: startedOn}
+	testCases := []struct {
+		testDescription string
+		pipeline        *models.PipelineModel
+		now             time.Time
+		expected        bool
+	}{
+		{"Pipeline without timeout", &models.PipelineModel{}, startedOn.Add(24 * time.Hour), false},
+		{"Before timeout", &models.PipelineModel{Timeout: "1h"}, startedOn.Add(time.Minute), false},
+		{"At timeout", &models.PipelineModel{Timeout: "1h"}, startedOn.Add(time.Hour), true},
+		{"After timeout", &models.PipelineModel{Timeout: "1h"}, startedOn.Add(2 * time.Hour), true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.testDescription, func(t *testing.T) {
+			exceeded := hasExceededPipelineDeadline(serviceRequest, tc.pipeline, tc.now)
+			if exceeded != tc.expected {
+				t.Errorf("Expected %t, got %t", tc.expected, exceeded)
+			}
+		})
+	}
+}
@@ -0,0 +1,226 @@
+package execute
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/joshtyf/flowforge/src/database"
+	"github.com/joshtyf/flowforge/src/database/models"
+	"github.com/joshtyf/flowforge/src/events"
+	"github.com/joshtyf/flowforge/src/helper"
+	"github.com/joshtyf/flowforge/src/logger"
+	"github.com/joshtyf/flowforge/src/servicerequest"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	// Interval at which PIPELINE steps check the status of their child service request
+	childServiceRequestPollInterval = 2 * time.Second
+	// Maximum number of ancestors of a service request, which stops pipelines from launching each other indefinitely
+	maxServiceRequestDepth = 5
+)
+
+type pipelineStepExecutor struct {
+	mongoClient *mongo.Client
+	psqlClient  *sql.DB
+	queue       events.Queue
+}
+
+func NewPipelineStepExecutor(mongoClient *mongo.Client, psqlClient *sql.DB, queue events.Queue) *pipelineStepExecutor {
+	return &pipelineStepExecutor{
+		mongoClient: mongoClient,
+		psqlClient:  psqlClient,
+		queue:       queue,
+	}
+}
+
+// Launches a child service request of another pipeline and waits for it to complete. The child service request of an
+// earlier execution of the step is waited on instead if it has not failed or been cancelled.
+func (e *pipelineStepExecutor) Execute(ctx context.Context, execution *StepExecution) (*StepExecResult, error) {
+	l := execution.Logger
+	step := execution.Step
+	serviceRequest := execution.ServiceRequest
+
+	child, err := e.getChildServiceRequest(serviceRequest, step, l)
+	if err != nil {
+		return nil, err
+	}
+	if child == nil {
+		child, err = e.createChildServiceRequest(serviceRequest, step, l)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	serviceRequestDAO := database.NewServiceRequest(e.mongoClient)
+	for {
+		child, err = serviceRequestDAO.GetById(child.Id.Hex())
+		if err != nil {
+			l.Error(fmt.Sprintf("error getting child service request: %s", err))
+			return nil, err
+		}
+		switch child.Status {
+		case models.COMPLETED:
+			l.Info(fmt.Sprintf("child service request %s completed", child.Id.Hex()))
+			return e.getResult(child)
+		case models.FAILED, models.CANCELLED:
+			l.Error(fmt.Sprintf("child service request %s %s", child.Id.Hex(), strings.ToLower(string(child.Status))))
+			return nil, fmt.Errorf("child service request %s %s", child.Id.Hex(), strings.ToLower(string(child.Status)))
+		}
+
+		parent, err := serviceRequestDAO.GetById(serviceRequest.Id.Hex())
+		if err != nil {
+			l.Error(fmt.Sprintf("error getting service request status: %s", err))
+			return nil, err
+		}
+		if parent.Status == models.CANCELLED || parent.Status == models.FAILED {
+			l.Info(fmt.Sprintf("service request has been %s. Cancelling child service request %s", strings.ToLower(string(parent.Status)), child.Id.Hex()))
+			e.cancelChildServiceRequest(child, l)
+			return &StepExecResult{Waiting: true}, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			l.Error(fmt.Sprintf("child service request %s did not complete before the step timed out", child.Id.Hex()))
+			e.cancelChildServiceRequest(child, l)
+			return nil, ctx.Err()
+		case <-time.After(childServiceRequestPollInterval):
+		}
+	}
+}
+
+// Returns the latest child service request of the step, or nil if there is none which may still complete
+func (e *pipelineStepExecutor) getChildServiceRequest(serviceRequest *models.ServiceRequestModel, step *models.PipelineStepModel, l *logger.ExecutorLogger) (*models.ServiceRequestModel, error) {
+	children, err := database.NewServiceRequest(e.mongoClient).GetAllByParentId(serviceRequest.Id.Hex())
+	if err != nil {
+		l.Error(fmt.Sprintf("error getting child service requests: %s", err))
+		return nil, err
+	}
+	for i := len(children) - 1; i >= 0; i-- {
+		if children[i].ParentStepName != step.StepName {
+			continue
+		}
+		if children[i].Status == models.FAILED || children[i].Status == models.CANCELLED {
+			return nil, nil
+		}
+		l.Info(fmt.Sprintf("waiting for existing child service request %s", children[i].Id.Hex()))
+		return children[i], nil
+	}
+	return nil, nil
+}
+
+func (e *pipelineStepExecutor) createChildServiceRequest(serviceRequest *models.ServiceRequestModel, step *models.PipelineStepModel, l *logger.ExecutorLogger) (*models.ServiceRequestModel, error) {
+	pipelineId, ok := step.Parameters["pipeline_id"].(string)
+	if !ok || pipelineId == "" {
+		l.Error("pipeline_id is not provided")
+		return nil, errors.New("pipeline_id is not provided")
+	}
+	formData, err := toFormData(step.Parameters["form_data"])
+	if err != nil {
+		l.Error(fmt.Sprintf("invalid form_data: %s", err))
+		return nil, err
+	}
+
+	pipeline, err := database.NewPipeline(e.mongoClient).GetById(pipelineId)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		l.Error(fmt.Sprintf("pipeline %s not found", pipelineId))
+		return nil, fmt.Errorf("pipeline %s not found", pipelineId)
+	}
+	if err != nil {
+		l.Error(fmt.Sprintf("error getting pipeline: %s", err))
+		return nil, err
+	}
+	if pipeline.OrganizationId != serviceRequest.OrganizationId {
+		l.Error(fmt.Sprintf("pipeline %s does not belong to the organization of the service request", pipelineId))
+		return nil, fmt.Errorf("pipeline %s not found", pipelineId)
+	}
+	if err := e.checkDepth(serviceRequest); err != nil {
+		l.Error(err.Error())
+		return nil, err
+	}
+
+	child := &models.ServiceRequestModel{
+		UserId:                 serviceRequest.UserId,
+		OrganizationId:         serviceRequest.OrganizationId,
+		FormData:               formData,
+		ParentServiceRequestId: serviceRequest.Id.Hex(),
+		ParentStepName:         step.StepName,
+	}
+	// The child service request runs in the default environment of its pipeline unless the step chooses one
+	if environment, ok := step.Parameters["environment"].(string); ok {
+		child.Environment = environment
+	}
+	if err := servicerequest.Create(e.mongoClient, e.psqlClient, child, pipeline); err != nil {
+		l.Error(fmt.Sprintf("error creating child service request: %s", err))
+		return nil, err
+	}
+	if err := servicerequest.Start(e.queue, child); err != nil {
+		l.Error(fmt.Sprintf("error starting child service request: %s", err))
+		return nil, err
+	}
+	l.Info(fmt.Sprintf("started child service request %s of pipeline %s", child.Id.Hex(), pipeline.PipelineName))
+	return child, nil
+}
+
+func (e *pipelineStepExecutor) checkDepth(serviceRequest *models.ServiceRequestModel) error {
+	depth := 0
+	for parentId := serviceRequest.ParentServiceRequestId; parentId != ""; depth++ {
+		if depth >= maxServiceRequestDepth {
+			return fmt.Errorf("service requests cannot be nested more than %d levels deep", maxServiceRequestDepth)
+		}
+		parent, err := database.NewServiceRequest(e.mongoClient).GetById(parentId)
+		if err != nil {
+			return err
+		}
+		parentId = parent.ParentServiceRequestId
+	}
+	return nil
+}
+
+// Cancels the child service request like a user would, which stops its steps and compensates those which completed
+func (e *pipelineStepExecutor) cancelChildServiceRequest(child *models.ServiceRequestModel, l *logger.ExecutorLogger) {
+	if child.Status == models.COMPLETED || child.Status == models.FAILED || child.Status == models.CANCELLED {
+		return
+	}
+	if err := servicerequest.Cancel(e.mongoClient, e.psqlClient, e.queue, child, ""); err != nil {
+		l.Error(fmt.Sprintf("error cancelling child service request %s: %s", child.Id.Hex(), err))
+	}
+}
+
+// The output of the step contains the outputs of the steps of the child service request
+func (e *pipelineStepExecutor) getResult(child *models.ServiceRequestModel) (*StepExecResult, error) {
+	stepOutputs, err := database.NewServiceRequestStep(e.mongoClient).GetAllByServiceRequestId(child.Id.Hex())
+	if err != nil {
+		return nil, err
+	}
+	steps := make(map[string]any, len(stepOutputs))
+	for _, s := range stepOutputs {
+		steps[s.StepName] = s.Output
+	}
+	return &StepExecResult{
+		Output: map[string]any{
+			"service_request_id": child.Id.Hex(),
+			"status":             string(child.Status),
+			"steps":              steps,
+		},
+	}, nil
+}
+
+func (e *pipelineStepExecutor) StepType() models.PipelineStepType {
+	return models.PipelineStep
+}
+
+func toFormData(value any) (models.FormData, error) {
+	if value == nil {
+		return models.FormData{}, nil
+	}
+	m, ok := helper.ToMap(value)
+	if !ok {
+		return nil, fmt.Errorf("expected an object, got %T", value)
+	}
+	return models.FormData(m), nil
+}
@@ -0,0 +1,188 @@
+package execute
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/joshtyf/flowforge/src/database"
+	"github.com/joshtyf/flowforge/src/database/models"
+	"github.com/joshtyf/flowforge/src/logger"
+)
+
+// Steps which are completed outside of their execution, e.g. by an approval, a callback or a child service request.
+// Their executors only wait for the step to be completed, so they are safe to re-drive.
+var externallyCompletedStepTypes = []models.PipelineStepType{
+	models.WaitForApprovalStep,
+	models.WaitForCallbackStep,
+	models.PipelineStep,
+}
+
+// Resumes the service requests which were in progress when the server stopped.
+//
+// Steps which were running are recorded as interrupted. They are then re-driven if they have attempts remaining under
+// their retry policy, and failed otherwise. Steps whose previous steps completed, or failed without failing the service
+// request, but which were never started are started, as is the first step of a service request which was started before
+// its first step was. Service requests whose steps have all finished are marked as completed or failed.
+func (srm *ExecutionManager) resumeServiceRequests() {
+	serviceRequests, err := database.NewServiceRequest(srm.mongoClient).GetAllByStatuses([]models.ServiceRequestStatus{models.RUNNING, models.PENDING})
+	if err != nil {
+		srm.logger.Error(fmt.Sprintf("unable to get service requests to resume: %s", err))
+		return
+	}
+	for _, serviceRequest := range serviceRequests {
+		if err := srm.resumeServiceRequest(serviceRequest); err != nil {
+			srm.logger.Error(fmt.Sprintf("unable to resume service request %s: %s", serviceRequest.Id.Hex(), err))
+		}
+	}
+}
+
+func (srm *ExecutionManager) resumeServiceRequest(serviceRequest *models.ServiceRequestModel) error {
+	serviceRequestId := serviceRequest.Id.Hex()
+	pipeline, err := database.NewPipeline(srm.mongoClient).GetById(serviceRequest.PipelineId)
+	if err != nil {
+		return err
+	}
+	if err := logger.CreateExecutorLogDir(serviceRequestId); err != nil {
+		return err
+	}
+	stepsLatestEvent, err := srm.getStepsLatestEventType(serviceRequestId)
+	if err != nil {
+		return err
+	}
+
+	// A failed step fails the service request, which may not have happened before the server stopped
+	for stepName, eventType := range stepsLatestEvent {
+		if step := pipeline.GetPipelineStep(stepName); eventType == models.STEP_FAILED && (step == nil || step.OnFailure.GetAction() == models.FailOnFailure) {
+			srm.logger.Info(fmt.Sprintf("marking service request %s failed", serviceRequestId))
+			if err := database.NewServiceRequest(srm.mongoClient).UpdateStatus(serviceRequestId, models.FAILED); err != nil {
+				return err
+			}
+			srm.requestCompensation(serviceRequestId, pipeline)
+			return nil
+		}
+	}
+
+	unlock, err := srm.lockServiceRequest(serviceRequestId)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	stepsToRun := make([]*models.PipelineStepModel, 0)
+	hasCompletedTerminalStep := false
+	for _, step := range pipeline.Steps {
+		step := step
+		switch stepsLatestEvent[step.StepName] {
+		case models.STEP_RUNNING, models.STEP_RETRYING:
+			running, err := srm.isStepRunningElsewhere(serviceRequestId, step.StepName)
+			if err != nil {
+				return err
+			}
+			if running {
+				// The step is being run by another backend instance
+				continue
+			}
+			if step.IsRunByAgent() {
+				// The executor keeps the task of the step if it was queued, so it is safe to run again
+				stepsToRun = append(stepsToRun, &step)
+				continue
+			}
+			if slices.Contains(externallyCompletedStepTypes, step.StepType) {
+				// The executor has run if the service request is waiting, otherwise run it again
+				if serviceRequest.Status != models.PENDING {
+					stepsToRun = append(stepsToRun, &step)
+				}
+				continue
+			}
+			if err := srm.createStepEvent(serviceRequest, &step, "", models.STEP_INTERRUPTED); err != nil {
+				return err
+			}
+			attempts, err := database.NewServiceRequestEvent(srm.psqlClient).GetStepEventCount(serviceRequestId, step.StepName, models.STEP_RUNNING)
+			if err != nil {
+				return err
+			}
+			if attempts >= step.Retry.GetMaxAttempts() {
+				srm.logger.Info(fmt.Sprintf("failing interrupted step %s of service request %s", step.StepName, serviceRequestId))
+				srm.failStep(serviceRequest, &step, "", fmt.Sprintf("step was interrupted by a server restart after %d of %d attempts", attempts, step.Retry.GetMaxAttempts()))
+				continue
+			}
+			srm.logger.Info(fmt.Sprintf("re-driving interrupted step %s of service request %s", step.StepName, serviceRequestId))
+			stepsToRun = append(stepsToRun, &step)
+		case models.STEP_COMPLETED:
+			if step.IsTerminalStep {
+				hasCompletedTerminalStep = true
+			}
+		case models.STEP_FAILED:
+			// The service request continues after steps whose on_failure action does not fail it
+			if len(step.GetFailureNextStepNames()) == 0 && step.IsTerminalStep {
+				hasCompletedTerminalStep = true
+			}
+		}
+	}
+
+	// Start the steps whose previous steps have finished but which were never started
+	readiness, err := srm.newStepReadiness(serviceRequestId, pipeline, stepsLatestEvent)
+	if err != nil {
+		return err
+	}
+	stepNames := make([]string, 0, len(pipeline.Steps))
+	for _, step := range pipeline.Steps {
+		stepNames = append(stepNames, step.StepName)
+	}
+	stepsToRun = append(stepsToRun, srm.getStepsNotStarted(serviceRequestId, readiness, stepNames)...)
+	// The server may have stopped after the service request was started but before its first step was
+	if firstStep := pipeline.GetPipelineStep(pipeline.FirstStepName); firstStep != nil && serviceRequest.Status == models.RUNNING && stepsLatestEvent[firstStep.StepName] == models.STEP_NOT_STARTED {
+		srm.logger.Info(fmt.Sprintf("starting first step %s of service request %s which was not started", firstStep.StepName, serviceRequestId))
+		stepsToRun = append(stepsToRun, firstStep)
+	}
+
+	if len(stepsToRun) == 0 {
+		// The last step completed but the service request may not have been marked as completed before the server stopped
+		if hasCompletedTerminalStep && serviceRequest.Status == models.RUNNING {
+			srm.logger.Info(fmt.Sprintf("marking service request %s completed", serviceRequestId))
+			return database.NewServiceRequest(srm.mongoClient).UpdateStatus(serviceRequestId, models.COMPLETED)
+		}
+		return nil
+	}
+
+	for _, step := range stepsToRun {
+		executor := srm.getExecutor(step)
+		if executor == nil {
+			return fmt.Errorf("no executor found for step %s", step.StepName)
+		}
+		executionId, release, err := srm.startStep(serviceRequest, step)
+		if err != nil {
+			return err
+		}
+		go srm.runStep(serviceRequest, pipeline, step, executionId, executor, release)
+	}
+	return nil
+}
+
+// Returns the next steps which are ready to run but were never started, and marks them as started so that they are not
+// returned again for another step
+func (srm *ExecutionManager) getStepsNotStarted(serviceRequestId string, readiness *stepReadiness, nextStepNames []string) []*models.PipelineStepModel {
+	steps := make([]*models.PipelineStepModel, 0)
+	for _, nextStepName := range nextStepNames {
+		nextStep := readiness.pipeline.GetPipelineStep(nextStepName)
+		if nextStep == nil || !readiness.isReady(nextStep) {
+			continue
+		}
+		readiness.stepsLatestEvent[nextStepName] = models.STEP_RUNNING
+		srm.logger.Info(fmt.Sprintf("starting step %s of service request %s which was not started", nextStepName, serviceRequestId))
+		steps = append(steps, nextStep)
+	}
+	return steps
+}
+
+// Returns true if the lock on the step is held, which means that it is being run by another backend instance
+func (srm *ExecutionManager) isStepRunningElsewhere(serviceRequestId, stepName string) (bool, error) {
+	release, acquired, err := database.NewLock(srm.psqlClient).TryAcquire(stepLockKey(serviceRequestId, stepName))
+	if err != nil {
+		return false, err
+	}
+	if !acquired {
+		return true, nil
+	}
+	return false, release()
+}
@@ -0,0 +1,252 @@
+package execute
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/joshtyf/flowforge/src/database/models"
+	"github.com/joshtyf/flowforge/src/helper"
+)
+
+const (
+	// Scripts only see these variables and the ones configured in the step, so secrets of the server are not leaked
+	scriptPath = "/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin"
+	// Scripts of steps without a timeout are stopped after this duration
+	defaultScriptTimeout = 10 * time.Minute
+	// Output of the script which is referenced by later steps is truncated to this size
+	maxScriptStdoutSize = 64 * 1024
+	// Time given to the script to release its stdout and stderr once it has been killed
+	scriptWaitDelay = 5 * time.Second
+	// Lines of output which are longer than this are split, so that output without newlines is not buffered indefinitely
+	maxScriptLineSize = 64 * 1024
+)
+
+// Returned by the SCRIPT step when the script exits with a non-zero exit code
+type scriptExitError struct {
+	exitCode int
+}
+
+func (e *scriptExitError) Error() string {
+	return fmt.Sprintf("script exited with code %d", e.exitCode)
+}
+
+type scriptStepExecutor struct {
+	workDir string
+}
+
+// Scripts are run in a working directory per service request within workDir, which is shared by the SCRIPT steps of
+// the service request.
+func NewScriptStepExecutor(workDir string) *scriptStepExecutor {
+	return &scriptStepExecutor{
+		workDir: workDir,
+	}
+}
+
+func (e *scriptStepExecutor) Execute(ctx context.Context, execution *StepExecution) (*StepExecResult, error) {
+	l := execution.Logger
+	step := execution.Step
+	serviceRequest := execution.ServiceRequest
+	command, ok := step.Parameters["command"].(string)
+	if !ok || command == "" {
+		l.Error("command is not provided")
+		return nil, errors.New("command is not provided")
+	}
+	args, err := toStringSlice(step.Parameters["args"])
+	if err != nil {
+		l.Error(fmt.Sprintf("invalid args: %s", err))
+		return nil, err
+	}
+	env, err := toStringMap(step.Parameters["env"])
+	if err != nil {
+		l.Error(fmt.Sprintf("invalid env: %s", err))
+		return nil, err
+	}
+	// Pipelines created before the names were reserved are not rejected by the validation
+	for k := range env {
+		if models.IsReservedScriptEnvName(k) {
+			l.Error(fmt.Sprintf("invalid env: %s is reserved", k))
+			return nil, fmt.Errorf("invalid env: %s is reserved", k)
+		}
+	}
+
+	dir, err := filepath.Abs(filepath.Join(e.workDir, serviceRequest.Id.Hex()))
+	if err != nil {
+		l.Error(fmt.Sprintf("error resolving working directory: %s", err))
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		l.Error(fmt.Sprintf("error creating working directory: %s", err))
+		return nil, err
+	}
+
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, defaultScriptTimeout)
+		defer cancel()
+	}
+
+	name, cmdArgs := command, args
+	// Parameters which are a single placeholder keep the type of their value, e.g. a number from the form data
+	if cpuLimit, ok := helper.FormatScalar(step.Parameters["cpu_limit"]); ok && cpuLimit != "" {
+		d, err := time.ParseDuration(cpuLimit)
+		if err != nil || d <= 0 {
+			l.Error(fmt.Sprintf("invalid cpu_limit: %s", cpuLimit))
+			return nil, fmt.Errorf("invalid cpu_limit: %s", cpuLimit)
+		}
+		// Limit the CPU time of the script with ulimit before replacing the shell with the script
+		name = "/bin/sh"
+		cmdArgs = append([]string{"-c", `ulimit -t "$0" && exec "$@"`, fmt.Sprint(int(math.Ceil(d.Seconds()))), command}, args...)
+	}
+
+	cmd := exec.CommandContext(ctx, name, cmdArgs...)
+	cmd.Dir = dir
+	cmd.Env = []string{"PATH=" + scriptPath, "HOME=" + dir, "TMPDIR=" + dir}
+	for k, v := range env {
+		cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%s", k, v))
+	}
+	cmd.WaitDelay = scriptWaitDelay
+	// Run the script in its own process group, so that the processes it starts are killed with it when it is stopped
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+
+	stdout := &bytes.Buffer{}
+	stdoutWriter := newLineWriter(func(line string) {
+		l.Info(fmt.Sprintf("stdout: %s", line))
+		if stdout.Len()+len(line) < maxScriptStdoutSize {
+			stdout.WriteString(line)
+			stdout.WriteString("\n")
+		}
+	})
+	stderrWriter := newLineWriter(func(line string) {
+		l.Warn(fmt.Sprintf("stderr: %s", line))
+	})
+	cmd.Stdout = stdoutWriter
+	cmd.Stderr = stderrWriter
+
+	l.Info(fmt.Sprintf("running command=%s args=%v dir=%s", command, args, dir))
+	err = cmd.Run()
+	stdoutWriter.Flush()
+	stderrWriter.Flush()
+	if ctx.Err() != nil {
+		l.Error(fmt.Sprintf("script was stopped: %s", ctx.Err()))
+		return nil, ctx.Err()
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		l.Error(fmt.Sprintf("script exited with code %d", exitErr.ExitCode()))
+		return nil, &scriptExitError{exitCode: exitErr.ExitCode()}
+	}
+	if err != nil {
+		l.Error(fmt.Sprintf("error running script: %s", err))
+		return nil, err
+	}
+	l.Info("script exited with code 0")
+	return &StepExecResult{
+		Output: map[string]any{
+			"exit_code": 0,
+			"stdout":    strings.TrimRight(stdout.String(), "\n"),
+		},
+	}, nil
+}
+
+func (e *scriptStepExecutor) StepType() models.PipelineStepType {
+	return models.ScriptStep
+}
+
+// Writes every complete line written to it to a function. Lines longer than the max line size are written in parts.
+type lineWriter struct {
+	mu          sync.Mutex
+	buf         []byte
+	maxLineSize int
+	onLine      func(string)
+}
+
+func newLineWriter(onLine func(string)) *lineWriter {
+	return &lineWriter{maxLineSize: maxScriptLineSize, onLine: onLine}
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.buf = append(w.buf, p...)
+	for {
+		if i := bytes.IndexByte(w.buf, '\n'); i >= 0 && i <= w.maxLineSize {
+			w.onLine(strings.TrimSuffix(string(w.buf[:i]), "\r"))
+			w.buf = w.buf[i+1:]
+		} else if len(w.buf) >= w.maxLineSize {
+			w.onLine(string(w.buf[:w.maxLineSize]))
+			w.buf = w.buf[w.maxLineSize:]
+		} else {
+			break
+		}
+	}
+	return len(p), nil
+}
+
+// Writes the last line if it does not end with a newline
+func (w *lineWriter) Flush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if len(w.buf) > 0 {
+		w.onLine(string(w.buf))
+		w.buf = nil
+	}
+}
+
+// Numbers and booleans are converted to strings, as placeholders of numbers, e.g. ${form.replicas}, are replaced with
+// numbers
+func toStringSlice(value any) ([]string, error) {
+	switch v := value.(type) {
+	case nil:
+		return []string{}, nil
+	case []string:
+		return v, nil
+	}
+	elems, ok := helper.ToSlice(value)
+	if !ok {
+		return nil, fmt.Errorf("expected a list of strings, got %T", value)
+	}
+	s := make([]string, 0, len(elems))
+	for _, elem := range elems {
+		str, ok := helper.FormatScalar(elem)
+		if !ok {
+			return nil, fmt.Errorf("expected a list of strings, got element of type %T", elem)
+		}
+		s = append(s, str)
+	}
+	return s, nil
+}
+
+func toStringMap(value any) (map[string]string, error) {
+	switch v := value.(type) {
+	case nil:
+		return map[string]string{}, nil
+	case map[string]string:
+		return v, nil
+	}
+	m, ok := helper.ToMap(value)
+	if !ok {
+		return nil, fmt.Errorf("expected an object of strings, got %T", value)
+	}
+	s := make(map[string]string, len(m))
+	for k, elem := range m {
+		str, ok := helper.FormatScalar(elem)
+		if !ok {
+			return nil, fmt.Errorf("expected an object of strings, got value of type %T for %s", elem, k)
+		}
+		s[k] = str
+	}
+	return s, nil
+}
@@ -0,0 +1,225 @@
+package execute
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/joshtyf/flowforge/src/database/models"
+	"github.com/joshtyf/flowforge/src/logger"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestLineWriter(t *testing.T) {
+	testCases := []struct {
+		testDescription string
+		writes          []string
+		expected        []string
+	}{
+		{"Single line", []string{"hello\n"}, []string{"hello"}},
+		{"Several lines in one write", []string{"a\nb\n"}, []string{"a", "b"}},
+		{"Line split across writes", []string{"hel", "lo\nwor", "ld\n"}, []string{"hello", "world"}},
+		{"Carriage return", []string{"a\r\n"}, []string{"a"}},
+		{"Last line without newline", []string{"a\nb"}, []string{"a", "b"}},
+		{"Empty line", []string{"\n"}, []string{""}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.testDescription, func(t *testing.T) {
+			lines := []string{}
+			w := newLineWriter(func(line string) {
+				lines = append(lines, line)
+			})
+			for _, write := range tc.writes {
+				if n, err := w.Write([]byte(write)); err != nil || n != len(write) {
+					t.Errorf("Expected %d and no error, got %d and %v", len(write), n, err)
+				}
+			}
+			w.Flush()
+			if !slices.Equal(lines, tc.expected) {
+				t.Errorf("Expected %q, got %q", tc.expected, lines)
+			}
+		})
+	}
+}
+
+func TestLineWriterSplitsLongLines(t *testing.T) {
+	testCases := []struct {
+		testDescription string
+		writes          []string
+		expected        []string
+	}{
+		{"Line of the max line size", []string{"abcd\n"}, []string{"abcd"}},
+		{"Line longer than the max line size", []string{"abcdefghij\n"}, []string{"abcd", "efgh", "ij"}},
+		{"Output without newlines across writes", []string{"abc", "def", "ghi"}, []string{"abcd", "efgh", "i"}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.testDescription, func(t *testing.T) {
+			lines := []string{}
+			w := newLineWriter(func(line string) {
+				lines = append(lines, line)
+			})
+			w.maxLineSize = 4
+			for _, write := range tc.writes {
+				w.Write([]byte(write))
+				if len(w.buf) >= w.maxLineSize {
+					t.Errorf("Expected less than %d buffered bytes, got %d", w.maxLineSize, len(w.buf))
+				}
+			}
+			w.Flush()
+			if !slices.Equal(lines, tc.expected) {
+				t.Errorf("Expected %q, got %q", tc.expected, lines)
+			}
+		})
+	}
+}
+
+func TestToStringSlice(t *testing.T) {
+	testCases := []struct {
+		testDescription string
+		value           any
+		expected        []string
+		expectErr       bool
+	}{
+		{"Nil", nil, []string{}, false},
+		{"Strings", []string{"a"}, []string{"a"}, false},
+		{"Decoded from JSON", []any{"a", "b"}, []string{"a", "b"}, false},
+		{"Decoded from the database", primitive.A{"a"}, []string{"a"}, false},
+		{"Not a list", "a", nil, true},
+		{"Numbers and booleans", []any{"-n", 3, int32(2), int64(1), 1.5, true}, []string{"-n", "3", "2", "1", "1.5", "true"}, false},
+		{"Object in list", []any{map[string]any{}}, nil, true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.testDescription, func(t *testing.T) {
+			s, err := toStringSlice(tc.value)
+			if (err != nil) != tc.expectErr {
+				t.Errorf("Expected error %t, got %v", tc.expectErr, err)
+			}
+			if !reflect.DeepEqual(s, tc.expected) {
+				t.Errorf("Expected %q, got %q", tc.expected, s)
+			}
+		})
+	}
+}
+
+func newScriptExecution(t *testing.T, parameters map[string]any) *StepExecution {
+	step := &models.PipelineStepModel{StepName: "script", StepType: models.ScriptStep, Parameters: parameters}
+	return &StepExecution{
+		ServiceRequest: &models.ServiceRequestModel{Id: primitive.NewObjectID()},
+		Step:           step,
+		Parameters:     parameters,
+		Logger:         logger.NewExecutorLogger(io.Discard, step.StepName),
+	}
+}
+
+func TestScriptStepExecutor(t *testing.T) {
+	workDir := t.TempDir()
+	executor := NewScriptStepExecutor(workDir)
+
+	t.Run("Output of the script", func(t *testing.T) {
+		execution := newScriptExecution(t, map[string]any{
+			"command": "/bin/sh",
+			"args":    []any{"-c", `echo "$GREETING $1"; pwd`, "sh", "world"},
+			"env":     map[string]any{"GREETING": "hello"},
+		})
+		result, err := executor.Execute(context.Background(), execution)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		dir := filepath.Join(workDir, execution.ServiceRequest.Id.Hex())
+		expected := map[string]any{"exit_code": 0, "stdout": "hello world\n" + dir}
+		if !reflect.DeepEqual(result.Output, expected) {
+			t.Errorf("Expected %v, got %v", expected, result.Output)
+		}
+	})
+
+	t.Run("Numeric arguments and environment", func(t *testing.T) {
+		execution := newScriptExecution(t, map[string]any{
+			"command": "/bin/sh",
+			"args":    []any{"-c", `echo "$1 $REPLICAS"`, "sh", 3},
+			"env":     map[string]any{"REPLICAS": int32(2)},
+		})
+		result, err := executor.Execute(context.Background(), execution)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if result.Output["stdout"] != "3 2" {
+			t.Errorf("Expected 3 2, got %v", result.Output["stdout"])
+		}
+	})
+
+	t.Run("Numeric cpu_limit is not a duration", func(t *testing.T) {
+		execution := newScriptExecution(t, map[string]any{
+			"command":   "/bin/sh",
+			"args":      []any{"-c", "true"},
+			"cpu_limit": 10,
+		})
+		if _, err := executor.Execute(context.Background(), execution); err == nil || err.Error() != "invalid cpu_limit: 10" {
+			t.Errorf("Expected invalid cpu_limit: 10, got %v", err)
+		}
+	})
+
+	t.Run("Reserved environment variables", func(t *testing.T) {
+		for _, name := range []string{"PATH", "HOME", "LD_PRELOAD"} {
+			execution := newScriptExecution(t, map[string]any{
+				"command": "/bin/sh",
+				"args":    []any{"-c", "true"},
+				"env":     map[string]any{name: "/tmp"},
+			})
+			if _, err := executor.Execute(context.Background(), execution); err == nil || err.Error() != "invalid env: "+name+" is reserved" {
+				t.Errorf("Expected invalid env: %s is reserved, got %v", name, err)
+			}
+		}
+	})
+
+	t.Run("Script does not inherit the environment of the server", func(t *testing.T) {
+		os.Setenv("FLOWFORGE_TEST_SECRET", "secret")
+		defer os.Unsetenv("FLOWFORGE_TEST_SECRET")
+		execution := newScriptExecution(t, map[string]any{
+			"command": "/bin/sh",
+			"args":    []any{"-c", `echo "[$FLOWFORGE_TEST_SECRET]"`},
+		})
+		result, err := executor.Execute(context.Background(), execution)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if result.Output["stdout"] != "[]" {
+			t.Errorf("Expected [], got %v", result.Output["stdout"])
+		}
+	})
+
+	t.Run("Non-zero exit code", func(t *testing.T) {
+		execution := newScriptExecution(t, map[string]any{
+			"command": "/bin/sh",
+			"args":    []any{"-c", "exit 3"},
+		})
+		_, err := executor.Execute(context.Background(), execution)
+		var exitErr *scriptExitError
+		if !errors.As(err, &exitErr) || exitErr.exitCode != 3 {
+			t.Errorf("Expected exit code 3, got %v", err)
+		}
+	})
+
+	t.Run("Processes started by the script are killed on timeout", func(t *testing.T) {
+		execution := newScriptExecution(t, map[string]any{
+			"command": "/bin/sh",
+			"args":    []any{"-c", "sleep 30 & wait"},
+		})
+		ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+		defer cancel()
+		start := time.Now()
+		_, err := executor.Execute(ctx, execution)
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("Expected %v, got %v", context.DeadlineExceeded, err)
+		}
+		// The script would only return after the wait delay if the sleep kept its stdout open
+		if elapsed := time.Since(start); elapsed >= scriptWaitDelay {
+			t.Errorf("Expected script to be stopped before %s, got %s", scriptWaitDelay, elapsed)
+		}
+	})
+}
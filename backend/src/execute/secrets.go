@@ -0,0 +1,145 @@
+package execute
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/joshtyf/flowforge/src/database"
+	"github.com/joshtyf/flowforge/src/database/models"
+	"github.com/joshtyf/flowforge/src/helper"
+	"github.com/joshtyf/flowforge/src/servicerequest"
+)
+
+var (
+	ErrSecretsNotConfigured       = errors.New("secrets are not configured on the server")
+	ErrSecretNotFound             = errors.New("secret not found")
+	ErrSecretPlaceholderInValue   = errors.New("secrets can only be referenced by the parameters of the pipeline")
+	ErrSecretInPipelineParameters = errors.New("secrets cannot be passed to child service requests")
+)
+
+// Sets the cipher which decrypts the secrets of organizations referenced by ${secrets.NAME} placeholders
+func WithSecretCipher(secretCipher *helper.SecretCipher) ExecutionManagerConfig {
+	return func(srm *ExecutionManager) {
+		srm.secretCipher = secretCipher
+	}
+}
+
+// Replaces the placeholders in a step parameter with their values. Secret placeholders are left in the parameter to be
+// resolved when the step is executed, so that the rendered parameter can be saved. Only secret placeholders written
+// in the pipeline or in its variables are left, so that form data and step outputs cannot reference secrets.
+func renderParameter(parameter any, values map[string]any) (any, error) {
+	parameter, err := servicerequest.RenderVariables(parameter, values[servicerequest.VariablesKey])
+	if err != nil {
+		return nil, err
+	}
+	templatePlaceholders, err := helper.GetPlaceholders(parameter)
+	if err != nil {
+		return nil, err
+	}
+	// Secret placeholders are left as is, rather than replaced with their defaults
+	rendered, unresolved, err := helper.RenderPlaceholdersIf(parameter, values, func(placeholder string) bool {
+		return !helper.IsSecretPlaceholder(placeholder)
+	})
+	if err != nil {
+		return nil, err
+	}
+	secretPlaceholders := 0
+	for _, placeholder := range unresolved {
+		if !helper.IsSecretPlaceholder(placeholder) {
+			return nil, helper.ErrPlaceholderNotReplaced
+		}
+		secretPlaceholders++
+	}
+	for _, placeholder := range templatePlaceholders {
+		if helper.IsSecretPlaceholder(placeholder) {
+			secretPlaceholders--
+		}
+	}
+	if secretPlaceholders > 0 {
+		return nil, ErrSecretPlaceholderInValue
+	}
+	return rendered, nil
+}
+
+func (srm *ExecutionManager) resolveSecrets(orgId int, step *models.PipelineStepModel) (*models.PipelineStepModel, []string, error) {
+	return ResolveSecrets(srm.psqlClient, srm.secretCipher, orgId, step)
+}
+
+// Returns a copy of the step with the secrets of the organization in its parameters, along with the values of the
+// secrets so that they can be redacted. The step is returned as is if it does not reference secrets. The secrets of
+// steps run by remote agents are resolved by the server when an agent claims the step.
+func ResolveSecrets(psqlClient *sql.DB, secretCipher *helper.SecretCipher, orgId int, step *models.PipelineStepModel) (*models.PipelineStepModel, []string, error) {
+	names := []string{}
+	secretPlaceholders := []string{}
+	for _, parameter := range step.Parameters {
+		placeholders, err := helper.GetPlaceholders(parameter)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, placeholder := range placeholders {
+			if !helper.IsSecretPlaceholder(placeholder) {
+				continue
+			}
+			secretPlaceholders = append(secretPlaceholders, placeholder)
+			for _, name := range helper.SecretPlaceholderNames(placeholder) {
+				if !helper.StringInSlice(name, names) {
+					names = append(names, name)
+				}
+			}
+		}
+	}
+	if len(names) == 0 {
+		return step, nil, nil
+	}
+	if step.StepType == models.PipelineStep {
+		return nil, nil, ErrSecretInPipelineParameters
+	}
+	if secretCipher == nil {
+		return nil, nil, ErrSecretsNotConfigured
+	}
+
+	secrets := make(map[string]any, len(names))
+	secretValues := make([]string, 0, len(names))
+	secretDAO := database.NewSecret(psqlClient)
+	for _, name := range names {
+		sm, err := secretDAO.GetByOrgIdAndName(orgId, name)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil, fmt.Errorf("%w: %s", ErrSecretNotFound, name)
+		} else if err != nil {
+			return nil, nil, err
+		}
+		value, err := secretCipher.Decrypt(orgId, name, sm.Value)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%w %s", err, name)
+		}
+		secrets[name] = value
+		secretValues = append(secretValues, value)
+	}
+
+	values := map[string]any{"secrets": secrets}
+	secretValues = appendRenderedSecrets(secretValues, secretPlaceholders, values)
+	resolved := *step
+	resolved.Parameters = make(map[string]any, len(step.Parameters))
+	for key, parameter := range step.Parameters {
+		replaced, err := helper.ReplacePlaceholders(parameter, values)
+		if err != nil {
+			return nil, nil, fmt.Errorf("unable to replace secrets of parameter %s: %w", key, err)
+		}
+		resolved.Parameters[key] = replaced
+	}
+	return &resolved, secretValues, nil
+}
+
+// Appends the values of the secret placeholders to the values of the secrets, so that secrets which are transformed by
+// the placeholders, e.g. ${secrets.TOKEN | base64}, are redacted as well
+func appendRenderedSecrets(secretValues []string, secretPlaceholders []string, values map[string]any) []string {
+	for _, placeholder := range secretPlaceholders {
+		rendered, err := helper.ReplacePlaceholdersInString(placeholder, values)
+		if err != nil || rendered == "" || helper.StringInSlice(rendered, secretValues) {
+			continue
+		}
+		secretValues = append(secretValues, rendered)
+	}
+	return secretValues
+}
@@ -0,0 +1,28 @@
+package execute
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestAppendRenderedSecrets(t *testing.T) {
+	values := map[string]any{"secrets": map[string]any{"TOKEN": "s3cret", "USER": "admin"}}
+	testCases := []struct {
+		testDescription string
+		placeholders    []string
+		expected        []string
+	}{
+		{"Secret", []string{"${secrets.TOKEN}"}, []string{"s3cret", "admin"}},
+		{"Encoded secret", []string{"${secrets.TOKEN | base64}"}, []string{"s3cret", "admin", "czNjcmV0"}},
+		{"Transformed secrets", []string{"${secrets.TOKEN | upper}", "${secrets.USER | urlencode}"}, []string{"s3cret", "admin", "S3CRET"}},
+		{"Combined secrets", []string{`${secrets.USER + ":" + secrets.TOKEN}`}, []string{"s3cret", "admin", "admin:s3cret"}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.testDescription, func(t *testing.T) {
+			secretValues := appendRenderedSecrets([]string{"s3cret", "admin"}, tc.placeholders, values)
+			if !slices.Equal(secretValues, tc.expected) {
+				t.Errorf("Expected %v, got %v", tc.expected, secretValues)
+			}
+		})
+	}
+}
@@ -0,0 +1,90 @@
+package execute
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/joshtyf/flowforge/src/database"
+	"github.com/joshtyf/flowforge/src/database/models"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Interval at which the deadlines of steps which wait outside of their executor are checked
+const stepDeadlinePollInterval = 30 * time.Second
+
+// Fails the attempts of steps which wait outside of their executor, e.g. for a callback or an agent, once they exceed
+// the step timeout, until ctx is cancelled. Every backend instance checks the deadlines, as each deadline is handled
+// under the lock of its service request.
+func (srm *ExecutionManager) enforceStepDeadlines(ctx context.Context) {
+	ticker := time.NewTicker(stepDeadlinePollInterval)
+	defer ticker.Stop()
+	for {
+		steps, err := database.NewServiceRequestStep(srm.mongoClient).GetAllByDeadlineBefore(time.Now())
+		if err != nil {
+			srm.logger.Error(fmt.Sprintf("unable to get steps past their deadline: %s", err))
+		}
+		for _, step := range steps {
+			if err := srm.enforceStepDeadline(step.ServiceRequestId, step.StepName); err != nil {
+				srm.logger.Error(fmt.Sprintf("unable to enforce deadline of step %s of service request %s: %s", step.StepName, step.ServiceRequestId, err))
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (srm *ExecutionManager) enforceStepDeadline(serviceRequestId, stepName string) error {
+	unlock, err := srm.lockServiceRequest(serviceRequestId)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	// The step may have completed, or its deadline handled by another instance, while waiting for the lock
+	serviceRequestStepDAO := database.NewServiceRequestStep(srm.mongoClient)
+	srsm, err := serviceRequestStepDAO.GetByServiceRequestIdAndStepName(serviceRequestId, stepName)
+	if err != nil {
+		return err
+	}
+	if srsm.Deadline.IsZero() || srsm.Deadline.After(time.Now()) {
+		return nil
+	}
+	serviceRequest, err := database.NewServiceRequest(srm.mongoClient).GetById(serviceRequestId)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return serviceRequestStepDAO.UpdateDeadline(serviceRequestId, stepName, "", time.Time{})
+	} else if err != nil {
+		return err
+	}
+	latestEvent, err := database.NewServiceRequestEvent(srm.psqlClient).GetStepLatestEvent(serviceRequestId, stepName)
+	if err != nil {
+		return err
+	}
+	isActive := serviceRequest.Status == models.RUNNING || serviceRequest.Status == models.PENDING
+	if !isActive || !isCurrentExecution(latestEvent, srsm.DeadlineExecutionId) {
+		// The attempt which the deadline is of is no longer running
+		return serviceRequestStepDAO.UpdateDeadline(serviceRequestId, stepName, "", time.Time{})
+	}
+	pipeline, err := database.NewPipeline(srm.mongoClient).GetById(serviceRequest.PipelineId)
+	if err != nil {
+		return err
+	}
+	step := pipeline.GetPipelineStep(stepName)
+	if step == nil {
+		return fmt.Errorf("no step %s found", stepName)
+	}
+
+	// The agent running the step has not reported on it, so its task is cancelled to stop it from being reported on
+	if step.IsRunByAgent() {
+		if err := srm.cancelAgentTask(serviceRequestId, stepName); err != nil {
+			return err
+		}
+	}
+	srm.logger.Info(fmt.Sprintf("failing step %s of service request %s which exceeded its timeout", stepName, serviceRequestId))
+	srm.failStep(serviceRequest, step, srsm.DeadlineExecutionId, fmt.Sprintf("step timed out after %s", step.GetTimeout()))
+	return serviceRequestStepDAO.UpdateDeadline(serviceRequestId, stepName, "", time.Time{})
+}
@@ -2,34 +2,51 @@ package execute
 
 import (
 	"context"
+	"crypto/rand"
 	"database/sql"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"os"
+	"slices"
+	"strings"
+	"time"
 
-	"github.com/gookit/event"
 	"github.com/joshtyf/flowforge/src/database"
 	"github.com/joshtyf/flowforge/src/database/models"
 	"github.com/joshtyf/flowforge/src/events"
 	"github.com/joshtyf/flowforge/src/helper"
 	"github.com/joshtyf/flowforge/src/logger"
-	"github.com/joshtyf/flowforge/src/util"
+	"github.com/joshtyf/flowforge/src/servicerequest"
 	"go.mongodb.org/mongo-driver/mongo"
 )
 
 type ExecutionManager struct {
-	logger      logger.ServerLogger
-	mongoClient *mongo.Client
-	psqlClient  *sql.DB
-	executors   map[models.PipelineStepType]*stepExecutor
+	logger         logger.ServerLogger
+	mongoClient    *mongo.Client
+	psqlClient     *sql.DB
+	executors      map[models.PipelineStepType]StepExecutor
+	queue          events.Queue
+	callbackSigner *helper.CallbackSigner
+	secretCipher   *helper.SecretCipher
+	stop           context.CancelFunc
 }
 
 type ExecutionManagerConfig func(*ExecutionManager)
 
-func WithStepExecutor(step stepExecutor) ExecutionManagerConfig {
+// Sets the queue which events are published to and consumed from. Defaults to a PostgresQueue.
+func WithQueue(queue events.Queue) ExecutionManagerConfig {
 	return func(srm *ExecutionManager) {
-		srm.executors[step.getStepType()] = &step
+		srm.queue = queue
+	}
+}
+
+// Sets the signer of the callbacks of WAIT_FOR_CALLBACK steps, which can then be referenced by placeholders
+func WithCallbackSigner(signer *helper.CallbackSigner) ExecutionManagerConfig {
+	return func(srm *ExecutionManager) {
+		srm.callbackSigner = signer
 	}
 }
 
@@ -44,7 +61,7 @@ func NewStepExecutionManager(mongoClient *mongo.Client, psqlClient *sql.DB, logg
 		return nil, fmt.Errorf("logger is nil")
 	}
 	srm := &ExecutionManager{
-		executors:   map[models.PipelineStepType]*stepExecutor{},
+		executors:   map[models.PipelineStepType]StepExecutor{},
 		mongoClient: mongoClient,
 		psqlClient:  psqlClient,
 		logger:      logger,
@@ -52,17 +69,41 @@ func NewStepExecutionManager(mongoClient *mongo.Client, psqlClient *sql.DB, logg
 	for _, c := range configs {
 		c(srm)
 	}
+	if srm.queue == nil {
+		srm.queue = events.NewPostgresQueue(psqlClient, logger)
+	}
 	return srm, nil
 }
 
-// Starts the manager by registering event listeners
+// Starts the manager by subscribing to events of the queue and resuming the service requests which were in progress.
+// The deadlines of approval steps, the timeouts of steps which wait outside of their executor and the timeouts of
+// pipelines are enforced in the background until the manager is stopped.
 func (srm *ExecutionManager) Start() {
-	event.On(events.NewServiceRequestEventName, event.ListenerFunc(srm.handleNewServiceRequestEvent), event.Normal)
-	event.On(events.StepFailedEventName, event.ListenerFunc(srm.handleFailedStepEvent), event.Normal)
-	event.On(events.StepCompletedEventName, event.ListenerFunc(srm.handleCompletedStepEvent), event.Normal)
+	srm.queue.Subscribe(events.NewServiceRequestEventName, srm.handleNewServiceRequestEvent)
+	srm.queue.Subscribe(events.StepFailedEventName, srm.handleFailedStepEvent)
+	srm.queue.Subscribe(events.StepCompletedEventName, srm.handleCompletedStepEvent)
+	srm.queue.Subscribe(events.RetryStepEventName, srm.handleRetryStepEvent)
+	srm.queue.Subscribe(events.CompensateEventName, srm.handleCompensateEvent)
+	srm.resumeServiceRequests()
+	srm.resumeCompensations()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	srm.stop = cancel
+	srm.queue.Start(ctx)
+	go srm.enforceApprovalDeadlines(ctx)
+	go srm.enforceStepDeadlines(ctx)
+	go srm.enforcePipelineDeadlines(ctx)
+	go srm.enforceAgentTaskLeases(ctx)
 }
 
-func (srm *ExecutionManager) handleNewServiceRequestEvent(e event.Event) error {
+// Stops consuming events from the queue. Steps which are running are not stopped.
+func (srm *ExecutionManager) Stop() {
+	if srm.stop != nil {
+		srm.stop()
+	}
+}
+
+func (srm *ExecutionManager) handleNewServiceRequestEvent(e events.Event) error {
 	srm.logger.Info("handling service request event")
 	serviceRequest := e.(*events.NewServiceRequestEvent).ServiceRequest()
 	if serviceRequest == nil {
@@ -73,6 +114,7 @@ func (srm *ExecutionManager) handleNewServiceRequestEvent(e event.Event) error {
 	pipeline, err := database.NewPipeline(srm.mongoClient).GetById(serviceRequest.PipelineId)
 	if err != nil {
 		srm.logger.Error(fmt.Sprintf("error encountered while handling event: %s", err))
+		return err
 	}
 
 	// Get the first step and its executor
@@ -81,15 +123,34 @@ func (srm *ExecutionManager) handleNewServiceRequestEvent(e event.Event) error {
 		srm.logger.Error(fmt.Sprintf("missing pipeline step: %s", pipeline.FirstStepName))
 		return fmt.Errorf("no first step found")
 	}
-	currExecutor := srm.executors[firstStep.StepType]
+	currExecutor := srm.getExecutor(firstStep)
 	if currExecutor == nil {
-		// TODO: Handle error
 		srm.logger.Error(fmt.Sprintf("missing executor for step: %s", firstStep.StepName))
-		return fmt.Errorf("no executor found for first step")
+		srm.failStep(serviceRequest, firstStep, "", fmt.Sprintf("no executor found for step type %s", firstStep.StepType))
+		return nil
+	}
+
+	unlock, err := srm.lockServiceRequest(serviceRequest.Id.Hex())
+	if err != nil {
+		srm.logger.Error(fmt.Sprintf("error encountered while handling event: %s", err))
+		return err
+	}
+	defer unlock()
+
+	// Events may be delivered more than once, so check that the service request has not been started
+	firstStepEvent, err := database.NewServiceRequestEvent(srm.psqlClient).GetStepLatestEvent(serviceRequest.Id.Hex(), firstStep.StepName)
+	if err != nil {
+		srm.logger.Error(fmt.Sprintf("error encountered while handling event: %s", err))
+		return err
+	}
+	if firstStepEvent.EventType != models.STEP_NOT_STARTED {
+		srm.logger.Info(fmt.Sprintf("service request %s has already been started", serviceRequest.Id.Hex()))
+		return nil
 	}
 
 	// Update the service request status to running
-	err = database.NewServiceRequest(srm.mongoClient).UpdateStatus(serviceRequest.Id.Hex(), models.RUNNING)
+	serviceRequest.StartedOn = time.Now()
+	err = database.NewServiceRequest(srm.mongoClient).UpdateStarted(serviceRequest.Id.Hex(), serviceRequest.StartedOn)
 	if err != nil {
 		srm.logger.Error(fmt.Sprintf("failed to run service request %s: %s", serviceRequest.Id.Hex(), err))
 		return err
@@ -102,43 +163,157 @@ func (srm *ExecutionManager) handleNewServiceRequestEvent(e event.Event) error {
 		return err
 	}
 
-	err = srm.execute(serviceRequest, firstStep, currExecutor)
-	return err
+	executionId, release, err := srm.startStep(serviceRequest, firstStep)
+	if err != nil {
+		return err
+	}
+	go srm.runStep(serviceRequest, pipeline, firstStep, executionId, currExecutor, release)
+	return nil
 }
 
-func (srm *ExecutionManager) execute(serviceRequest *models.ServiceRequestModel, step *models.PipelineStepModel, executor *stepExecutor) error {
-	// Parse and replace step parameters with service request form data
-	for key, val := range step.Parameters {
-		replaced, err := helper.ReplacePlaceholders(val, serviceRequest.FormData)
-		if err != nil {
-			srm.logger.Error(fmt.Sprintf("unable to replace placeholder based on form data for %s", key))
-			return err
+// Acquires the lock on the service request, which serialises recording of step completions and the start of their
+// successors across backend instances so that parallel steps have a consistent view of which steps are in progress
+func (srm *ExecutionManager) lockServiceRequest(serviceRequestId string) (func(), error) {
+	unlock, err := database.NewLock(srm.psqlClient).Acquire(fmt.Sprintf("service_request/%s", serviceRequestId))
+	if err != nil {
+		return nil, err
+	}
+	return func() {
+		if err := unlock(); err != nil {
+			srm.logger.Error(fmt.Sprintf("unable to unlock service request %s: %s", serviceRequestId, err))
 		}
-		step.Parameters[key] = replaced
+	}, nil
+}
+
+func stepLockKey(serviceRequestId, stepName string) string {
+	return fmt.Sprintf("step/%s/%s", serviceRequestId, stepName)
+}
+
+// Acquires the lock on the step, which is held by the backend instance running the step, and logs the step started
+// event with the execution ID of the first attempt of the step. The returned function releases the lock once the step
+// has run.
+func (srm *ExecutionManager) startStep(serviceRequest *models.ServiceRequestModel, step *models.PipelineStepModel) (string, func(), error) {
+	executionId, err := newExecutionId()
+	if err != nil {
+		srm.logger.Error(fmt.Sprintf("error encountered while handling event: %s", err))
+		return "", nil, err
 	}
+	release, acquired, err := database.NewLock(srm.psqlClient).TryAcquire(stepLockKey(serviceRequest.Id.Hex(), step.StepName))
+	if err != nil {
+		srm.logger.Error(fmt.Sprintf("error encountered while handling event: %s", err))
+		return "", nil, err
+	}
+	if !acquired {
+		return "", nil, fmt.Errorf("step %s of service request %s is already running", step.StepName, serviceRequest.Id.Hex())
+	}
+	releaseStep := func() {
+		if err := release(); err != nil {
+			srm.logger.Error(fmt.Sprintf("unable to release step %s of service request %s: %s", step.StepName, serviceRequest.Id.Hex(), err))
+		}
+	}
+	if err := srm.createStepEvent(serviceRequest, step, executionId, models.STEP_RUNNING); err != nil {
+		releaseStep()
+		return "", nil, err
+	}
+	return executionId, releaseStep, nil
+}
 
-	// Create an execution context with the current step and service request
-	executeCtx := context.WithValue(
-		context.WithValue(
-			context.Background(),
-			util.ServiceRequestKey,
-			serviceRequest),
-		util.StepKey,
-		step,
-	)
-	// Log step started event
+// Returns a random ID which identifies an attempt of a step, so that the completion of the attempt is only handled
+// once and requests made by the attempt can be deduplicated
+func newExecutionId() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// Logs an event of the step. Events of an attempt of the step are logged with the execution ID of the attempt.
+func (srm *ExecutionManager) createStepEvent(serviceRequest *models.ServiceRequestModel, step *models.PipelineStepModel, executionId string, eventType models.EventType) error {
 	serviceRequestEvent := database.NewServiceRequestEvent(srm.psqlClient)
 	err := serviceRequestEvent.Create(&models.ServiceRequestEventModel{
-		EventType:        models.STEP_RUNNING,
+		EventType:        eventType,
 		ServiceRequestId: serviceRequest.Id.Hex(),
 		StepName:         step.StepName,
 		CreatedBy:        "", // TODO: Add user id
 		StepType:         step.StepType,
+		ExecutionId:      executionId,
 	})
 	if err != nil {
 		srm.logger.Error(fmt.Sprintf("error encountered while handling event: %s", err))
 		return err
 	}
+	return nil
+}
+
+func (srm *ExecutionManager) runStep(serviceRequest *models.ServiceRequestModel, pipeline *models.PipelineModel, step *models.PipelineStepModel, executionId string, executor StepExecutor, release func()) error {
+	defer release()
+
+	values, err := srm.getPlaceholderValues(serviceRequest, pipeline)
+	if err != nil {
+		srm.logger.Error(fmt.Sprintf("error encountered while handling event: %s", err))
+		return err
+	}
+	if err := srm.renderParameters(serviceRequest, step, executionId, values); err != nil {
+		return err
+	}
+	return srm.executeStep(serviceRequest, pipeline, step, executionId, executor, values)
+}
+
+// Runs a failed step again with the parameters it was rendered with when it first ran
+func (srm *ExecutionManager) retryStep(serviceRequest *models.ServiceRequestModel, pipeline *models.PipelineModel, step *models.PipelineStepModel, executionId string, executor StepExecutor, release func()) error {
+	defer release()
+
+	values, err := srm.getPlaceholderValues(serviceRequest, pipeline)
+	if err != nil {
+		srm.logger.Error(fmt.Sprintf("error encountered while handling event: %s", err))
+		return err
+	}
+	srsm, err := database.NewServiceRequestStep(srm.mongoClient).GetByServiceRequestIdAndStepName(serviceRequest.Id.Hex(), step.StepName)
+	if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+		srm.logger.Error(fmt.Sprintf("error encountered while handling event: %s", err))
+		return err
+	}
+	if err == nil && srsm.Parameters != nil {
+		step.Parameters = srsm.Parameters
+	} else if err := srm.renderParameters(serviceRequest, step, executionId, values); err != nil {
+		// The step failed before its parameters were rendered
+		return err
+	}
+	return srm.executeStep(serviceRequest, pipeline, step, executionId, executor, values)
+}
+
+// Replaces the placeholders in the step parameters with service request form data and the outputs of previous steps,
+// and saves the rendered parameters. Secrets are resolved when the step is executed, so they are never saved.
+func (srm *ExecutionManager) renderParameters(serviceRequest *models.ServiceRequestModel, step *models.PipelineStepModel, executionId string, values map[string]any) error {
+	for key, val := range step.Parameters {
+		replaced, err := renderParameter(val, values)
+		if err != nil {
+			srm.logger.Error(fmt.Sprintf("unable to replace placeholder based on form data for %s", key))
+			srm.failStep(serviceRequest, step, executionId, fmt.Sprintf("unable to replace placeholders of parameter %s: %s", key, err))
+			return err
+		}
+		step.Parameters[key] = replaced
+	}
+	err := database.NewServiceRequestStep(srm.mongoClient).UpdateParameters(serviceRequest.Id.Hex(), step.StepName, step.Parameters)
+	if err != nil {
+		srm.logger.Error(fmt.Sprintf("error encountered while handling event: %s", err))
+		return err
+	}
+	return nil
+}
+
+// Executes the step, retrying according to its retry policy, and publishes its completion or failure. Every attempt has
+// its own execution ID, starting with the execution ID of the attempt which was logged when the step started.
+func (srm *ExecutionManager) executeStep(serviceRequest *models.ServiceRequestModel, pipeline *models.PipelineModel, step *models.PipelineStepModel, executionId string, executor StepExecutor, values map[string]any) error {
+	// Create an execution context with the current step and service request,
+	// which is cancelled once the service request exceeds the pipeline timeout
+	serviceRequestCtx := context.Background()
+	if deadline := getPipelineDeadline(serviceRequest, pipeline); !deadline.IsZero() {
+		var cancel context.CancelFunc
+		serviceRequestCtx, cancel = context.WithDeadline(serviceRequestCtx, deadline)
+		defer cancel()
+	}
 
 	// Create a log file for the current step
 	f, err := os.OpenFile(
@@ -155,20 +330,124 @@ func (srm *ExecutionManager) execute(serviceRequest *models.ServiceRequestModel,
 			srm.logger.Error(fmt.Sprintf("error encountered while handling event: %s", err))
 		}
 	}()
-	executor_logger := logger.NewExecutorLogger(io.MultiWriter(os.Stdout, f), step.StepName)
 
-	// Execute the current step
-	_, err = (*executor).execute(executeCtx, executor_logger)
+	// The executor gets the secrets, which are redacted from the step logs, outputs and failure
+	resolvedStep, secretValues, err := srm.resolveSecrets(serviceRequest.OrganizationId, step)
 	if err != nil {
-		srm.logger.Error(fmt.Sprintf("error encountered while executing step %s: %s", step.StepName, err))
-		// TODO: Handle error
+		logger.NewExecutorLogger(io.MultiWriter(os.Stdout, f), step.StepName).Error(fmt.Sprintf("unable to resolve secrets: %s", err))
+		srm.failStep(serviceRequest, step, executionId, fmt.Sprintf("unable to resolve secrets: %s", err))
 		return err
 	}
+	executor_logger := logger.NewExecutorLogger(helper.NewRedactingWriter(io.MultiWriter(os.Stdout, f), secretValues), step.StepName)
+	execution := &StepExecution{
+		ServiceRequest: serviceRequest,
+		Step:           resolvedStep,
+		Parameters:     resolvedStep.Parameters,
+		Values:         values,
+		ExecutionId:    executionId,
+		Logger:         executor_logger,
+	}
 
-	return nil
+	// Execute the current step, retrying according to the retry policy of the step
+	maxAttempts := step.Retry.GetMaxAttempts()
+	attempt := 1
+	for ; ; attempt++ {
+		var result *StepExecResult
+		result, err = srm.attemptStep(serviceRequestCtx, execution, executor)
+		if err == nil {
+			if result != nil && result.Waiting {
+				return nil
+			}
+			if result != nil && result.Output != nil && len(secretValues) > 0 {
+				result.Output = helper.RedactSecretsInValue(result.Output, secretValues).(map[string]any)
+			}
+			return srm.completeStep(serviceRequest, step, execution.ExecutionId, result)
+		}
+		if attempt >= maxAttempts || !isRetryableError(step.Retry, err) || serviceRequestCtx.Err() != nil {
+			break
+		}
+
+		backoff := step.Retry.GetBackoff(attempt)
+		executor_logger.Warn(fmt.Sprintf("attempt %d of %d failed: %s. Retrying in %s", attempt, maxAttempts, err, backoff))
+		if err := srm.createStepEvent(serviceRequest, step, execution.ExecutionId, models.STEP_RETRYING); err != nil {
+			return err
+		}
+		select {
+		case <-time.After(backoff):
+		case <-serviceRequestCtx.Done():
+		}
+		if serviceRequestCtx.Err() != nil {
+			err = serviceRequestCtx.Err()
+			break
+		}
+
+		// Do not retry if the service request was cancelled while backing off
+		latest, err := database.NewServiceRequest(srm.mongoClient).GetById(serviceRequest.Id.Hex())
+		if err != nil {
+			srm.logger.Error(fmt.Sprintf("error encounter while verifying sr status: %s", err))
+			return err
+		}
+		if latest.Status == models.CANCELLED {
+			executor_logger.Info("service request has been cancelled. Will not retry step")
+			return nil
+		}
+		if execution.ExecutionId, err = newExecutionId(); err != nil {
+			srm.logger.Error(fmt.Sprintf("error encountered while handling event: %s", err))
+			return err
+		}
+		if err := srm.createStepEvent(serviceRequest, step, execution.ExecutionId, models.STEP_RUNNING); err != nil {
+			return err
+		}
+		executor_logger.Info(fmt.Sprintf("starting attempt %d of %d", attempt+1, maxAttempts))
+	}
+	reason := helper.RedactSecrets(err.Error(), secretValues)
+	srm.logger.Error(fmt.Sprintf("error encountered while executing step %s: %s", step.StepName, reason))
+
+	if serviceRequestCtx.Err() != nil {
+		reason = pipelineTimeoutReason(pipeline)
+	} else if errors.Is(err, context.DeadlineExceeded) {
+		reason = fmt.Sprintf("step timed out after %s", step.GetTimeout())
+	}
+	if maxAttempts > 1 {
+		reason = fmt.Sprintf("step failed after %d of %d attempts: %s", attempt, maxAttempts, reason)
+	}
+	srm.failStep(serviceRequest, step, execution.ExecutionId, reason)
+	return err
+}
+
+// Executes a single attempt of the step, which is cancelled once it exceeds the step timeout
+func (srm *ExecutionManager) attemptStep(ctx context.Context, execution *StepExecution, executor StepExecutor) (*StepExecResult, error) {
+	if timeout := execution.Step.GetTimeout(); timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	result, err := executor.Execute(ctx, execution)
+	if err != nil && ctx.Err() != nil {
+		// Executors may not wrap the context error, so make sure that the failure is reported as a timeout
+		return nil, fmt.Errorf("%w: %s", ctx.Err(), err)
+	}
+	return result, err
+}
+
+func (srm *ExecutionManager) completeStep(serviceRequest *models.ServiceRequestModel, step *models.PipelineStepModel, executionId string, result *StepExecResult) error {
+	err := srm.queue.Publish(events.NewStepCompletedEvent(step.StepName, serviceRequest.Id.Hex(), executionId, "", result, nil))
+	if err != nil {
+		srm.logger.Error(fmt.Sprintf("unable to publish completion of step %s: %s", step.StepName, err))
+	}
+	return err
+}
+
+// Marks the step and the service request as failed. The failure is of the execution of the step, which is empty if the
+// step failed before it started.
+func (srm *ExecutionManager) failStep(serviceRequest *models.ServiceRequestModel, step *models.PipelineStepModel, executionId string, reason string) {
+	err := srm.queue.Publish(events.NewStepFailedEvent(step.StepName, serviceRequest, executionId, "", reason, nil))
+	if err != nil {
+		srm.logger.Error(fmt.Sprintf("unable to publish failure of step %s: %s", step.StepName, err))
+	}
 }
 
-func (srm *ExecutionManager) handleCompletedStepEvent(e event.Event) error {
+func (srm *ExecutionManager) handleCompletedStepEvent(e events.Event) error {
 	srm.logger.Info("handling step completed event")
 	completedStepEvent := e.(*events.StepCompletedEvent)
 	completedStep := completedStepEvent.CompletedStep()
@@ -199,56 +478,449 @@ func (srm *ExecutionManager) handleCompletedStepEvent(e event.Event) error {
 	}
 
 	completedStepModel := pipeline.GetPipelineStep(completedStep)
+	if completedStepModel == nil {
+		srm.logger.Error(fmt.Sprintf("missing pipeline step: %s", completedStep))
+		return fmt.Errorf("no completed step found")
+	}
+	result, err := decodeStepExecResult(completedStepEvent.Results())
+	if err != nil {
+		srm.logger.Error(fmt.Sprintf("error encountered while handling event: %s", err))
+		return err
+	}
 
-	// Log step completed event
+	unlock, err := srm.lockServiceRequest(serviceRequestId)
+	if err != nil {
+		srm.logger.Error(fmt.Sprintf("error encountered while handling event: %s", err))
+		return err
+	}
+	defer unlock()
+
+	// Events may be delivered more than once, so check that the completion has not been recorded
 	serviceRequestEvent := database.NewServiceRequestEvent(srm.psqlClient)
-	err = serviceRequestEvent.Create(&models.ServiceRequestEventModel{
-		EventType:        models.STEP_COMPLETED,
-		ServiceRequestId: serviceRequest.Id.Hex(),
-		StepName:         completedStep,
-		CreatedBy:        completedStepEvent.CreatedBy(),
-		StepType:         completedStepModel.StepType,
-	})
+	latestEvent, err := serviceRequestEvent.GetStepLatestEvent(serviceRequestId, completedStep)
 	if err != nil {
-		// TODO: not sure if we should return here. We need to handle the error better
 		srm.logger.Error(fmt.Sprintf("error encountered while handling event: %s", err))
 		return err
 	}
+	switch getCompletionAction(latestEvent, completedStepEvent.ExecutionId()) {
+	case completionIgnore:
+		// Completions of earlier attempts, e.g. approvals of an attempt which was rejected and retried, are stale, and
+		// steps which have been compensated cannot complete again
+		srm.logger.Info(fmt.Sprintf("ignoring completion of execution %s of step %s of service request %s, which is not the current execution", completedStepEvent.ExecutionId(), completedStep, serviceRequestId))
+		return nil
+	case completionResume:
+		// The completion was recorded but the event may not have been handled completely, e.g. when the next steps could
+		// not be started, so the next steps are started again. It is safe to do so as steps are only started once.
+		srm.logger.Info(fmt.Sprintf("completion of step %s of service request %s has already been recorded", completedStep, serviceRequestId))
+	default:
+		// Save the step output so that it can be referenced by later steps
+		if result != nil && result.Output != nil {
+			err = database.NewServiceRequestStep(srm.mongoClient).UpdateOutput(serviceRequestId, completedStep, result.Output)
+			if err != nil {
+				srm.logger.Error(fmt.Sprintf("error encountered while handling event: %s", err))
+				return err
+			}
+		}
 
-	if completedStepModel.IsTerminalStep {
-		err := database.NewServiceRequest(srm.mongoClient).UpdateStatus(serviceRequest.Id.Hex(), models.COMPLETED)
+		// Log step completed event
+		err = serviceRequestEvent.Create(&models.ServiceRequestEventModel{
+			EventType:        models.STEP_COMPLETED,
+			ServiceRequestId: serviceRequest.Id.Hex(),
+			StepName:         completedStep,
+			CreatedBy:        completedStepEvent.CreatedBy(),
+			StepType:         completedStepModel.StepType,
+			ExecutionId:      latestEvent.ExecutionId,
+		})
 		if err != nil {
-			// TODO: Handle error
-			// Need to ensure idempotency or figure out a rollback solution
-			srm.logger.Error(fmt.Sprintf("failed to mark service request %s successful: %s", serviceRequest.Id.Hex(), err))
+			// TODO: not sure if we should return here. We need to handle the error better
+			srm.logger.Error(fmt.Sprintf("error encountered while handling event: %s", err))
+			return err
+		}
+	}
+
+	stepsLatestEvent, err := srm.getStepsLatestEventType(serviceRequest.Id.Hex())
+	if err != nil {
+		srm.logger.Error(fmt.Sprintf("error encountered while handling event: %s", err))
+		return err
+	}
+
+	// Check if SR has been cancelled or has failed, e.g. in a parallel step
+	if serviceRequest.Status == models.CANCELLED || serviceRequest.Status == models.FAILED {
+		srm.logger.Info(fmt.Sprintf("service request %s has been %s. Will not proceed to execute next step", serviceRequestId, strings.ToLower(string(serviceRequest.Status))))
+		// The step completed after the service request stopped, so its compensation has not run with those of the other steps
+		if completedStepModel.Compensation != nil {
+			srm.requestCompensation(serviceRequestId, pipeline)
 		}
 		return nil
 	}
 
-	// Check if SR has been cancelled
-	if serviceRequest.Status == models.CANCELLED {
-		srm.logger.Info(fmt.Sprintf("service request %s has been cancelled. Will not proceed to execute next step", serviceRequestId))
+	if completedStepModel.IsTerminalStep {
+		srm.completeServiceRequest(serviceRequestId, stepsLatestEvent)
 		return nil
 	}
 
-	// Set the current executor to the next executor
-	nextStep := pipeline.GetPipelineStep(completedStepModel.NextStepName)
-	if nextStep == nil {
-		srm.logger.Error(fmt.Sprintf("missing pipeline step: %s", completedStepModel.NextStepName))
-		return fmt.Errorf("no next step found")
+	// Follow the edge chosen by the step if any, e.g. for BRANCH steps
+	nextStepNames := completedStepModel.GetNextStepNames()
+	if result != nil && result.NextStepName != "" {
+		nextStepNames = []string{result.NextStepName}
 	}
-	nextExecutor := srm.executors[nextStep.StepType]
-	if nextExecutor == nil {
+	return srm.startNextSteps(serviceRequest, pipeline, nextStepNames, stepsLatestEvent)
+}
+
+// How a completion of a step is handled, given the latest event of the step
+type completionAction int
+
+const (
+	completionRecord completionAction = iota // the completion is recorded and the next steps are started
+	completionResume                         // the completion was recorded, and the next steps are started again
+	completionIgnore                         // the completion is stale
+)
+
+// Returns how the completion of the execution of a step is handled. A completion which has already been recorded, e.g.
+// when the event is delivered again after its handler failed to start the next steps, resumes the handling of the
+// completion, so that the next steps are still started.
+func getCompletionAction(latestEvent *models.ServiceRequestEventModel, executionId string) completionAction {
+	if models.IsCompensationEventType(latestEvent.EventType) {
+		return completionIgnore
+	}
+	if latestEvent.EventType == models.STEP_COMPLETED {
+		if executionId == "" || latestEvent.ExecutionId == executionId {
+			return completionResume
+		}
+		return completionIgnore
+	}
+	if !isCurrentExecution(latestEvent, executionId) {
+		return completionIgnore
+	}
+	return completionRecord
+}
+
+// Returns how the failure of the execution of a step is handled, in the same way as a completion. Failures of an
+// attempt which is backing off, e.g. when the service request exceeds the pipeline timeout, are of the current
+// execution. Failures without an execution ID, e.g. of steps which failed before they started, are always recorded.
+func getFailureAction(latestEvent *models.ServiceRequestEventModel, executionId string) completionAction {
+	if models.IsCompensationEventType(latestEvent.EventType) {
+		return completionIgnore
+	}
+	if latestEvent.EventType == models.STEP_FAILED {
+		if executionId == "" || latestEvent.ExecutionId == executionId {
+			return completionResume
+		}
+		return completionIgnore
+	}
+	if executionId == "" {
+		return completionRecord
+	}
+	isRunning := latestEvent.EventType == models.STEP_RUNNING || latestEvent.EventType == models.STEP_RETRYING
+	if !isRunning || latestEvent.ExecutionId != executionId {
+		return completionIgnore
+	}
+	return completionRecord
+}
+
+// How a service request continues once the failure of one of its steps has been recorded
+type failureOutcome int
+
+const (
+	failureFail     failureOutcome = iota // the service request fails and its steps are compensated
+	failureContinue                       // the steps of the on_failure action of the step are run
+	failureIgnore                         // the service request was cancelled, which compensates its steps
+)
+
+// Returns how the service request continues after the step failed at now. The failure only decides the status of the
+// service request, e.g. a rejection of an approval step fails the service request once the failure is handled. A
+// service request which has already failed, e.g. as another step failed or the failure is handled again after the
+// server stopped, is failed again so that its steps are compensated, which skips the steps that were compensated.
+func getFailureOutcome(serviceRequest *models.ServiceRequestModel, pipeline *models.PipelineModel, step *models.PipelineStepModel, now time.Time) failureOutcome {
+	switch serviceRequest.Status {
+	case models.CANCELLED:
+		return failureIgnore
+	case models.FAILED:
+		return failureFail
+	}
+	// The steps which would run next cannot finish within the pipeline timeout, so the on_failure action is not carried
+	// out once the timeout has been exceeded
+	if step.OnFailure.GetAction() != models.FailOnFailure && !hasExceededPipelineDeadline(serviceRequest, pipeline, now) {
+		return failureContinue
+	}
+	return failureFail
+}
+
+// Returns true if the execution is the attempt of the step which is running, given the latest event of the step.
+// Completions published before steps had execution IDs have none, and are always of the current execution.
+func isCurrentExecution(latestEvent *models.ServiceRequestEventModel, executionId string) bool {
+	if executionId == "" {
+		return true
+	}
+	return latestEvent.EventType == models.STEP_RUNNING && latestEvent.ExecutionId == executionId
+}
+
+// Marks the service request as completed once a terminal step has finished
+func (srm *ExecutionManager) completeServiceRequest(serviceRequestId string, stepsLatestEvent map[string]models.EventType) {
+	// Parallel steps may still be running, in which case the last of them to finish completes the service request
+	for stepName, eventType := range stepsLatestEvent {
+		if eventType == models.STEP_RUNNING || eventType == models.STEP_RETRYING {
+			srm.logger.Info(fmt.Sprintf("step %s of service request %s is still running", stepName, serviceRequestId))
+			return
+		}
+	}
+	err := database.NewServiceRequest(srm.mongoClient).UpdateStatus(serviceRequestId, models.COMPLETED)
+	if err != nil {
 		// TODO: Handle error
-		srm.logger.Error(fmt.Sprintf("missing executor for step: %s", nextStep.StepName))
-		return fmt.Errorf("no executor found for next step")
+		// Need to ensure idempotency or figure out a rollback solution
+		srm.logger.Error(fmt.Sprintf("failed to mark service request %s successful: %s", serviceRequestId, err))
+	}
+}
+
+// Starts the next steps which are ready to run, in parallel. Other steps which are waiting on a step, e.g. join steps
+// after a branch which was not chosen, may be ready as well, so every step which is ready is started.
+func (srm *ExecutionManager) startNextSteps(serviceRequest *models.ServiceRequestModel, pipeline *models.PipelineModel, nextStepNames []string, stepsLatestEvent map[string]models.EventType) error {
+	serviceRequestId := serviceRequest.Id.Hex()
+	readiness, err := srm.newStepReadiness(serviceRequestId, pipeline, stepsLatestEvent)
+	if err != nil {
+		srm.logger.Error(fmt.Sprintf("error encountered while handling event: %s", err))
+		return err
+	}
+	candidates := make([]*models.PipelineStepModel, 0, len(pipeline.Steps))
+	for _, nextStepName := range nextStepNames {
+		nextStep := pipeline.GetPipelineStep(nextStepName)
+		if nextStep == nil {
+			srm.logger.Error(fmt.Sprintf("missing pipeline step: %s", nextStepName))
+			return fmt.Errorf("no next step found")
+		}
+		if !readiness.isReady(nextStep) {
+			srm.logger.Info(fmt.Sprintf("step %s of service request %s is not ready to run", nextStepName, serviceRequestId))
+			continue
+		}
+		candidates = append(candidates, nextStep)
+	}
+	for _, step := range pipeline.Steps {
+		step := step
+		if !slices.Contains(nextStepNames, step.StepName) && readiness.isReady(&step) {
+			candidates = append(candidates, &step)
+		}
 	}
 
-	srm.execute(serviceRequest, nextStep, nextExecutor)
+	nextSteps := make([]*models.PipelineStepModel, 0, len(candidates))
+	executionIds := make([]string, 0, len(candidates))
+	releases := make([]func(), 0, len(candidates))
+	for _, nextStep := range candidates {
+		if srm.getExecutor(nextStep) == nil {
+			srm.logger.Error(fmt.Sprintf("missing executor for step: %s", nextStep.StepName))
+			srm.failStep(serviceRequest, nextStep, "", fmt.Sprintf("no executor found for step type %s", nextStep.StepType))
+			continue
+		}
+		executionId, release, err := srm.startStep(serviceRequest, nextStep)
+		if err != nil {
+			return err
+		}
+		nextSteps = append(nextSteps, nextStep)
+		executionIds = append(executionIds, executionId)
+		releases = append(releases, release)
+	}
+
+	// Run the next steps in parallel
+	for i, nextStep := range nextSteps {
+		go srm.runStep(serviceRequest, pipeline, nextStep, executionIds[i], srm.getExecutor(nextStep), releases[i])
+	}
 	return nil
 }
 
-func (srm *ExecutionManager) handleFailedStepEvent(e event.Event) error {
+// Results of events read from a queue are decoded from JSON
+func decodeStepExecResult(results any) (*StepExecResult, error) {
+	switch r := results.(type) {
+	case nil:
+		return nil, nil
+	case *StepExecResult:
+		return r, nil
+	}
+	encoded, err := json.Marshal(results)
+	if err != nil {
+		return nil, err
+	}
+	result := &StepExecResult{}
+	if err := json.Unmarshal(encoded, result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Returns the values available to placeholders in the step parameters: the form data of the service request, also
+// under "form", the outputs of completed steps under "steps", the variables of the environment of the service request under "vars"
+// and the callbacks of WAIT_FOR_CALLBACK steps under "callbacks"
+func (srm *ExecutionManager) getPlaceholderValues(serviceRequest *models.ServiceRequestModel, pipeline *models.PipelineModel) (map[string]any, error) {
+	stepOutputs, err := database.NewServiceRequestStep(srm.mongoClient).GetAllByServiceRequestId(serviceRequest.Id.Hex())
+	if err != nil {
+		return nil, err
+	}
+	steps := make(map[string]any, len(stepOutputs))
+	for _, s := range stepOutputs {
+		steps[s.StepName] = s.Output
+	}
+	values := make(map[string]any, len(serviceRequest.FormData)+3)
+	for k, v := range serviceRequest.FormData {
+		values[k] = v
+	}
+	values["steps"] = steps
+	values[servicerequest.FormDataKey] = map[string]any(serviceRequest.FormData)
+	values[servicerequest.VariablesKey] = pipeline.GetVariables(serviceRequest.Environment)
+	// Secrets are only resolved when a step is executed
+	delete(values, "secrets")
+	if srm.callbackSigner != nil {
+		callbacks := make(map[string]any)
+		for _, step := range pipeline.Steps {
+			if step.StepType != models.WaitForCallbackStep {
+				continue
+			}
+			callbacks[step.StepName] = map[string]any{
+				"url":   srm.callbackSigner.Url(serviceRequest.Id.Hex(), step.StepName),
+				"token": srm.callbackSigner.Token(serviceRequest.Id.Hex(), step.StepName),
+			}
+		}
+		values["callbacks"] = callbacks
+	}
+	return values, nil
+}
+
+// Returns the latest event type of each step of the service request
+func (srm *ExecutionManager) getStepsLatestEventType(serviceRequestId string) (map[string]models.EventType, error) {
+	events, err := database.NewServiceRequestEvent(srm.psqlClient).GetStepsLatestEvent(serviceRequestId)
+	if err != nil {
+		return nil, err
+	}
+	latestEventTypes := make(map[string]models.EventType, len(events))
+	for _, e := range events {
+		latestEventTypes[e.StepName] = e.EventType
+	}
+	return latestEventTypes, nil
+}
+
+// Decides which steps of a service request are ready to run. A step waits on every step which leads to it, and is ready
+// once each of them has either led to it or can no longer lead to it, and at least one of them has led to it. Steps
+// which can no longer run, e.g. the steps of a branch which was not chosen, are skipped, so a step after a BRANCH step
+// only waits on the branch which was chosen.
+type stepReadiness struct {
+	pipeline         *models.PipelineModel
+	stepsLatestEvent map[string]models.EventType
+	branchChoices    map[string]string // the step chosen by each completed BRANCH step
+	canRun           map[string]bool
+}
+
+// Whether a step leads to one of the steps after it
+type stepOutcome int
+
+const (
+	outcomeUndecided stepOutcome = iota // the step may still lead to the next step
+	outcomeLeads
+	outcomeSkips
+)
+
+func (srm *ExecutionManager) newStepReadiness(serviceRequestId string, pipeline *models.PipelineModel, stepsLatestEvent map[string]models.EventType) (*stepReadiness, error) {
+	branchChoices, err := srm.getBranchChoices(serviceRequestId, pipeline, stepsLatestEvent)
+	if err != nil {
+		return nil, err
+	}
+	return newStepReadiness(pipeline, stepsLatestEvent, branchChoices), nil
+}
+
+func newStepReadiness(pipeline *models.PipelineModel, stepsLatestEvent map[string]models.EventType, branchChoices map[string]string) *stepReadiness {
+	return &stepReadiness{
+		pipeline:         pipeline,
+		stepsLatestEvent: stepsLatestEvent,
+		branchChoices:    branchChoices,
+		canRun:           make(map[string]bool),
+	}
+}
+
+// Returns the steps chosen by the completed BRANCH steps of the service request
+func (srm *ExecutionManager) getBranchChoices(serviceRequestId string, pipeline *models.PipelineModel, stepsLatestEvent map[string]models.EventType) (map[string]string, error) {
+	branchChoices := make(map[string]string)
+	hasCompletedBranch := false
+	for _, step := range pipeline.Steps {
+		if step.StepType == models.BranchStep && stepsLatestEvent[step.StepName] == models.STEP_COMPLETED {
+			hasCompletedBranch = true
+		}
+	}
+	if !hasCompletedBranch {
+		return branchChoices, nil
+	}
+	stepOutputs, err := database.NewServiceRequestStep(srm.mongoClient).GetAllByServiceRequestId(serviceRequestId)
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range stepOutputs {
+		if nextStepName, ok := s.Output["next_step_name"].(string); ok {
+			branchChoices[s.StepName] = nextStepName
+		}
+	}
+	return branchChoices, nil
+}
+
+// Returns true if the step has not been started and is ready to run
+func (r *stepReadiness) isReady(step *models.PipelineStepModel) bool {
+	if r.stepsLatestEvent[step.StepName] != models.STEP_NOT_STARTED {
+		return false
+	}
+	led := false
+	for _, prevStepName := range r.pipeline.GetPredecessorStepNames(step.StepName) {
+		switch r.leadsTo(prevStepName, step.StepName) {
+		case outcomeUndecided:
+			return false
+		case outcomeLeads:
+			led = true
+		}
+	}
+	return led
+}
+
+// Returns whether the step has led to the next step, e.g. by completing or by failing with the continue or route action,
+// or can no longer lead to it
+func (r *stepReadiness) leadsTo(stepName string, nextStepName string) stepOutcome {
+	step := r.pipeline.GetPipelineStep(stepName)
+	var nextStepNames []string
+	switch eventType := r.stepsLatestEvent[stepName]; {
+	case eventType == models.STEP_COMPLETED || models.IsCompensationEventType(eventType):
+		nextStepNames = step.GetNextStepNames()
+		if step.StepType == models.BranchStep {
+			nextStepNames = []string{r.branchChoices[stepName]}
+		}
+	case eventType == models.STEP_FAILED:
+		nextStepNames = step.GetFailureNextStepNames()
+	case eventType == models.STEP_CANCELLED:
+		return outcomeSkips
+	case eventType == models.STEP_NOT_STARTED:
+		if r.canStillRun(stepName) {
+			return outcomeUndecided
+		}
+		return outcomeSkips
+	default:
+		// The step is running
+		return outcomeUndecided
+	}
+	if slices.Contains(nextStepNames, nextStepName) {
+		return outcomeLeads
+	}
+	return outcomeSkips
+}
+
+// Returns true if a step which has not been started may still run, which is the case for the first step and for steps
+// with a step before them which may still lead to them
+func (r *stepReadiness) canStillRun(stepName string) bool {
+	if canRun, ok := r.canRun[stepName]; ok {
+		return canRun
+	}
+	canRun := stepName == r.pipeline.FirstStepName
+	for _, prevStepName := range r.pipeline.GetPredecessorStepNames(stepName) {
+		if canRun {
+			break
+		}
+		canRun = r.leadsTo(prevStepName, stepName) != outcomeSkips
+	}
+	r.canRun[stepName] = canRun
+	return canRun
+}
+
+func (srm *ExecutionManager) handleFailedStepEvent(e events.Event) error {
 	srm.logger.Info("handling step failed event")
 	failedStepEvent := e.(*events.StepFailedEvent)
 	failedStep := failedStepEvent.FailedStep()
@@ -272,6 +944,11 @@ func (srm *ExecutionManager) handleFailedStepEvent(e event.Event) error {
 		return err
 	}
 
+	// Steps may fail before they start, e.g. when they have no executor
+	if err := logger.CreateExecutorLogDir(serviceRequest.Id.Hex()); err != nil {
+		srm.logger.Error(fmt.Sprintf("error encountered while handling event: %s", err))
+		return err
+	}
 	f, err := logger.GetExecutorLogFileForWrite(serviceRequest.Id.Hex(), failedStep)
 
 	if err != nil {
@@ -288,22 +965,177 @@ func (srm *ExecutionManager) handleFailedStepEvent(e event.Event) error {
 
 	}
 	failedStepModel := pipeline.GetPipelineStep(failedStep)
+	if failedStepModel == nil {
+		srm.logger.Error(fmt.Sprintf("missing pipeline step: %s", failedStep))
+		return fmt.Errorf("no failed step found")
+	}
 
-	// Create step failed event
+	unlock, err := srm.lockServiceRequest(serviceRequest.Id.Hex())
+	if err != nil {
+		srm.logger.Error(fmt.Sprintf("error encountered while handling event: %s", err))
+		return err
+	}
+	defer unlock()
+
+	// Events may be delivered more than once, so check that the failure has not been recorded
 	serviceRequestEvent := database.NewServiceRequestEvent(srm.psqlClient)
-	err = serviceRequestEvent.Create(&models.ServiceRequestEventModel{
-		EventType:        models.STEP_FAILED,
-		ServiceRequestId: serviceRequest.Id.Hex(),
-		StepName:         failedStep,
-		CreatedBy:        failedStepEvent.CreatedBy(),
-		StepType:         failedStepModel.StepType,
-	})
+	latestEvent, err := serviceRequestEvent.GetStepLatestEvent(serviceRequest.Id.Hex(), failedStep)
 	if err != nil {
-		// TODO: not sure if we should return here. We need to handle the error better
 		srm.logger.Error(fmt.Sprintf("error encountered while handling event: %s", err))
 		return err
 	}
+	switch getFailureAction(latestEvent, failedStepEvent.ExecutionId()) {
+	case completionIgnore:
+		// The failure is of an attempt which is no longer running, e.g. an attempt which was retried or whose agent
+		// reported on it after it timed out
+		srm.logger.Info(fmt.Sprintf("ignoring failure of execution %s of step %s of service request %s which is no longer running", failedStepEvent.ExecutionId(), failedStep, serviceRequest.Id.Hex()))
+		return nil
+	case completionResume:
+		// The failure was recorded but the event may not have been handled completely, so the action is carried out
+		// again. It is safe to do so as the next steps are only started if they have not been started.
+		srm.logger.Info(fmt.Sprintf("failure of step %s of service request %s has already been recorded", failedStep, serviceRequest.Id.Hex()))
+	case completionRecord:
+		// The reason of the failure can be referenced by the steps which run after it
+		err = database.NewServiceRequestStep(srm.mongoClient).UpdateOutput(serviceRequest.Id.Hex(), failedStep, map[string]any{"error": failedStepEvent.Remarks()})
+		if err != nil {
+			srm.logger.Error(fmt.Sprintf("error encountered while handling event: %s", err))
+			return err
+		}
+		// Callback tokens are the same for every attempt of the step, so the next attempt waits for a new callback
+		if failedStepModel.StepType == models.WaitForCallbackStep {
+			if err := database.NewServiceRequestStep(srm.mongoClient).ClearCallback(serviceRequest.Id.Hex(), failedStep); err != nil {
+				srm.logger.Error(fmt.Sprintf("error encountered while handling event: %s", err))
+				return err
+			}
+		}
+
+		// Create step failed event
+		err = serviceRequestEvent.Create(&models.ServiceRequestEventModel{
+			EventType:        models.STEP_FAILED,
+			ServiceRequestId: serviceRequest.Id.Hex(),
+			StepName:         failedStep,
+			CreatedBy:        failedStepEvent.CreatedBy(),
+			StepType:         failedStepModel.StepType,
+			ExecutionId:      latestEvent.ExecutionId,
+		})
+		if err != nil {
+			// TODO: not sure if we should return here. We need to handle the error better
+			srm.logger.Error(fmt.Sprintf("error encountered while handling event: %s", err))
+			return err
+		}
+	}
+
+	serviceRequest, err = database.NewServiceRequest(srm.mongoClient).GetById(serviceRequest.Id.Hex())
+	if err != nil {
+		srm.logger.Error(fmt.Sprintf("error encounter while verifying sr status: %s", err))
+		return err
+	}
+	switch getFailureOutcome(serviceRequest, pipeline, failedStepModel, time.Now()) {
+	case failureIgnore:
+		return nil
+	case failureContinue:
+		executor_logger.Info(fmt.Sprintf("continuing service request as the on_failure action of the step is %s", failedStepModel.OnFailure.GetAction()))
+		return srm.continueAfterFailedStep(serviceRequest, pipeline, failedStepModel)
+	}
 
 	// Stop execution of any future steps
+	err = database.NewServiceRequest(srm.mongoClient).UpdateStatus(serviceRequest.Id.Hex(), models.FAILED)
+	if err != nil {
+		srm.logger.Error(fmt.Sprintf("failed to mark service request %s failed: %s", serviceRequest.Id.Hex(), err))
+		return err
+	}
+	srm.requestCompensation(serviceRequest.Id.Hex(), pipeline)
+	return nil
+}
+
+// Runs the steps which follow a failed step whose failure does not fail the service request
+func (srm *ExecutionManager) continueAfterFailedStep(serviceRequest *models.ServiceRequestModel, pipeline *models.PipelineModel, step *models.PipelineStepModel) error {
+	stepsLatestEvent, err := srm.getStepsLatestEventType(serviceRequest.Id.Hex())
+	if err != nil {
+		srm.logger.Error(fmt.Sprintf("error encountered while handling event: %s", err))
+		return err
+	}
+	nextStepNames := step.GetFailureNextStepNames()
+	if len(nextStepNames) == 0 && step.IsTerminalStep {
+		srm.completeServiceRequest(serviceRequest.Id.Hex(), stepsLatestEvent)
+		return nil
+	}
+	return srm.startNextSteps(serviceRequest, pipeline, nextStepNames, stepsLatestEvent)
+}
+
+func (srm *ExecutionManager) handleRetryStepEvent(e events.Event) error {
+	srm.logger.Info("handling retry step event")
+	retryStepEvent := e.(*events.RetryStepEvent)
+	serviceRequestId := retryStepEvent.ServiceRequestId()
+	stepName := retryStepEvent.StepName()
+	if serviceRequestId == "" || stepName == "" {
+		srm.logger.Error(fmt.Sprintf("event %s missing data: %s", e.Name(), "service request or step"))
+		return fmt.Errorf("service request or step is not provided")
+	}
+
+	serviceRequest, err := database.NewServiceRequest(srm.mongoClient).GetById(serviceRequestId)
+	if err != nil {
+		srm.logger.Error(fmt.Sprintf("error encountered while handling event: %s", err))
+		return err
+	}
+	pipeline, err := database.NewPipeline(srm.mongoClient).GetById(serviceRequest.PipelineId)
+	if err != nil {
+		srm.logger.Error(fmt.Sprintf("error encountered while handling event: %s", err))
+		return err
+	}
+	step := pipeline.GetPipelineStep(stepName)
+	if step == nil {
+		srm.logger.Error(fmt.Sprintf("missing pipeline step: %s", stepName))
+		return fmt.Errorf("no step found")
+	}
+	executor := srm.getExecutor(step)
+	if executor == nil {
+		srm.logger.Error(fmt.Sprintf("missing executor for step: %s", step.StepName))
+		return fmt.Errorf("no executor found for step")
+	}
+
+	unlock, err := srm.lockServiceRequest(serviceRequestId)
+	if err != nil {
+		srm.logger.Error(fmt.Sprintf("error encountered while handling event: %s", err))
+		return err
+	}
+	defer unlock()
+
+	// Events may be delivered more than once, so check that the step has not been retried
+	latestEvent, err := database.NewServiceRequestEvent(srm.psqlClient).GetStepLatestEvent(serviceRequestId, stepName)
+	if err != nil {
+		srm.logger.Error(fmt.Sprintf("error encountered while handling event: %s", err))
+		return err
+	}
+	if latestEvent.EventType != models.STEP_FAILED {
+		srm.logger.Info(fmt.Sprintf("step %s of service request %s has already been retried", stepName, serviceRequestId))
+		return nil
+	}
+
+	if err := logger.CreateExecutorLogDir(serviceRequestId); err != nil {
+		srm.logger.Error(fmt.Sprintf("error encountered while handling event: %s", err))
+		return err
+	}
+	f, err := logger.GetExecutorLogFileForWrite(serviceRequestId, stepName)
+	if err != nil {
+		srm.logger.Error(fmt.Sprintf("error encountered while handling event: %s", err))
+		return err
+	}
+	logger.NewExecutorLogger(io.MultiWriter(os.Stdout, f), stepName).Info(fmt.Sprintf("retrying step, requested by %s", retryStepEvent.CreatedBy()))
+	f.Close()
+
+	// The pipeline timeout is measured from the retry, so that the retried step does not time out straight away
+	serviceRequest.RetriedOn = time.Now()
+	err = database.NewServiceRequest(srm.mongoClient).UpdateRetried(serviceRequestId, serviceRequest.RetriedOn)
+	if err != nil {
+		srm.logger.Error(fmt.Sprintf("failed to run service request %s: %s", serviceRequestId, err))
+		return err
+	}
+	serviceRequest.Status = models.RUNNING
+	executionId, release, err := srm.startStep(serviceRequest, step)
+	if err != nil {
+		return err
+	}
+	go srm.retryStep(serviceRequest, pipeline, step, executionId, executor, release)
 	return nil
 }
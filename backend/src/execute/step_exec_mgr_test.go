@@ -0,0 +1,254 @@
+package execute
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/joshtyf/flowforge/src/database/models"
+	"github.com/joshtyf/flowforge/src/events"
+	"github.com/joshtyf/flowforge/src/logger"
+)
+
+func TestStepReadinessIsReady(t *testing.T) {
+	// start branches to a or b, which join at join. c runs in parallel with the branch and also leads to join.
+	pipeline := &models.PipelineModel{
+		FirstStepName: "start",
+		Steps: []models.PipelineStepModel{
+			{StepName: "start", NextStepName: "branch", NextStepNames: []string{"c"}},
+			{StepName: "branch", StepType: models.BranchStep, NextStepName: "a", Branches: []models.PipelineStepBranch{{Condition: "x", NextStepName: "b"}}},
+			{StepName: "a", NextStepName: "a2"},
+			{StepName: "a2", NextStepName: "join"},
+			{StepName: "b", NextStepName: "join"},
+			{StepName: "c", NextStepName: "join", OnFailure: &models.OnFailurePolicy{Action: models.RouteOnFailure, StepName: "handler"}},
+			{StepName: "handler", IsTerminalStep: true},
+			{StepName: "join", IsTerminalStep: true},
+		},
+	}
+	notStarted := func(overrides map[string]models.EventType) map[string]models.EventType {
+		stepsLatestEvent := make(map[string]models.EventType)
+		for _, step := range pipeline.Steps {
+			stepsLatestEvent[step.StepName] = models.STEP_NOT_STARTED
+		}
+		for stepName, eventType := range overrides {
+			stepsLatestEvent[stepName] = eventType
+		}
+		return stepsLatestEvent
+	}
+	testCases := []struct {
+		testDescription  string
+		stepsLatestEvent map[string]models.EventType
+		branchChoices    map[string]string
+		stepName         string
+		expected         bool
+	}{
+		{"First step is not ready before it is started", notStarted(nil), map[string]string{}, "start", false},
+		{"Step after a completed step", notStarted(map[string]models.EventType{"start": models.STEP_COMPLETED}), map[string]string{}, "c", true},
+		{"Started step is not ready", notStarted(map[string]models.EventType{"start": models.STEP_COMPLETED, "c": models.STEP_RUNNING}), map[string]string{}, "c", false},
+		{
+			"Chosen branch",
+			notStarted(map[string]models.EventType{"start": models.STEP_COMPLETED, "branch": models.STEP_COMPLETED}),
+			map[string]string{"branch": "b"},
+			"b",
+			true,
+		},
+		{
+			"Branch which was not chosen",
+			notStarted(map[string]models.EventType{"start": models.STEP_COMPLETED, "branch": models.STEP_COMPLETED}),
+			map[string]string{"branch": "b"},
+			"a",
+			false,
+		},
+		{
+			"Join waits on the chosen branch",
+			notStarted(map[string]models.EventType{"start": models.STEP_COMPLETED, "branch": models.STEP_COMPLETED, "c": models.STEP_COMPLETED}),
+			map[string]string{"branch": "b"},
+			"join",
+			false,
+		},
+		{
+			"Join skips the branch which was not chosen",
+			notStarted(map[string]models.EventType{"start": models.STEP_COMPLETED, "branch": models.STEP_COMPLETED, "b": models.STEP_COMPLETED, "c": models.STEP_COMPLETED}),
+			map[string]string{"branch": "b"},
+			"join",
+			true,
+		},
+		{
+			"Join waits on parallel steps without prev_step_names",
+			notStarted(map[string]models.EventType{"start": models.STEP_COMPLETED, "branch": models.STEP_COMPLETED, "b": models.STEP_COMPLETED, "c": models.STEP_RUNNING}),
+			map[string]string{"branch": "b"},
+			"join",
+			false,
+		},
+		{
+			"Join skips a step which was routed elsewhere",
+			notStarted(map[string]models.EventType{"start": models.STEP_COMPLETED, "branch": models.STEP_COMPLETED, "a": models.STEP_COMPLETED, "a2": models.STEP_COMPLETED, "c": models.STEP_FAILED}),
+			map[string]string{"branch": "a"},
+			"join",
+			true,
+		},
+		{
+			"Failure route",
+			notStarted(map[string]models.EventType{"start": models.STEP_COMPLETED, "c": models.STEP_FAILED}),
+			map[string]string{},
+			"handler",
+			true,
+		},
+		{
+			"Join is not started if no step led to it",
+			notStarted(map[string]models.EventType{"start": models.STEP_COMPLETED, "branch": models.STEP_CANCELLED, "c": models.STEP_FAILED}),
+			map[string]string{},
+			"join",
+			false,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.testDescription, func(t *testing.T) {
+			readiness := newStepReadiness(pipeline, tc.stepsLatestEvent, tc.branchChoices)
+			if ready := readiness.isReady(pipeline.GetPipelineStep(tc.stepName)); ready != tc.expected {
+				t.Errorf("Expected %t, got %t", tc.expected, ready)
+			}
+		})
+	}
+}
+
+func TestGetCompletionAction(t *testing.T) {
+	testCases := []struct {
+		testDescription string
+		latestEvent     *models.ServiceRequestEventModel
+		executionId     string
+		expected        completionAction
+	}{
+		{"Completion of the running attempt", &models.ServiceRequestEventModel{EventType: models.STEP_RUNNING, ExecutionId: "a"}, "a", completionRecord},
+		{"Completion without execution ID", &models.ServiceRequestEventModel{EventType: models.STEP_RUNNING, ExecutionId: "a"}, "", completionRecord},
+		{"Completion of an earlier attempt", &models.ServiceRequestEventModel{EventType: models.STEP_RUNNING, ExecutionId: "b"}, "a", completionIgnore},
+		{"Completion of a failed attempt", &models.ServiceRequestEventModel{EventType: models.STEP_FAILED, ExecutionId: "a"}, "a", completionIgnore},
+		{"Completion which was recorded", &models.ServiceRequestEventModel{EventType: models.STEP_COMPLETED, ExecutionId: "a"}, "a", completionResume},
+		{"Completion without execution ID which was recorded", &models.ServiceRequestEventModel{EventType: models.STEP_COMPLETED, ExecutionId: "a"}, "", completionResume},
+		{"Completion of an earlier attempt of a completed step", &models.ServiceRequestEventModel{EventType: models.STEP_COMPLETED, ExecutionId: "b"}, "a", completionIgnore},
+		{"Completion of a compensated step", &models.ServiceRequestEventModel{EventType: models.STEP_COMPENSATED, ExecutionId: "a"}, "a", completionIgnore},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.testDescription, func(t *testing.T) {
+			if action := getCompletionAction(tc.latestEvent, tc.executionId); action != tc.expected {
+				t.Errorf("Expected %d, got %d", tc.expected, action)
+			}
+		})
+	}
+}
+
+func TestGetFailureAction(t *testing.T) {
+	testCases := []struct {
+		testDescription string
+		latestEvent     *models.ServiceRequestEventModel
+		executionId     string
+		expected        completionAction
+	}{
+		{"Failure of the running attempt", &models.ServiceRequestEventModel{EventType: models.STEP_RUNNING, ExecutionId: "a"}, "a", completionRecord},
+		{"Failure of the attempt which is backing off", &models.ServiceRequestEventModel{EventType: models.STEP_RETRYING, ExecutionId: "a"}, "a", completionRecord},
+		{"Failure of a step which did not start", &models.ServiceRequestEventModel{EventType: models.STEP_NOT_STARTED}, "", completionRecord},
+		{"Failure without execution ID", &models.ServiceRequestEventModel{EventType: models.STEP_RUNNING, ExecutionId: "a"}, "", completionRecord},
+		{"Failure of an earlier attempt", &models.ServiceRequestEventModel{EventType: models.STEP_RUNNING, ExecutionId: "b"}, "a", completionIgnore},
+		{"Failure of a completed attempt", &models.ServiceRequestEventModel{EventType: models.STEP_COMPLETED, ExecutionId: "a"}, "a", completionIgnore},
+		{"Failure of a cancelled attempt", &models.ServiceRequestEventModel{EventType: models.STEP_CANCELLED, ExecutionId: "a"}, "a", completionIgnore},
+		{"Failure which was recorded", &models.ServiceRequestEventModel{EventType: models.STEP_FAILED, ExecutionId: "a"}, "a", completionResume},
+		{"Failure without execution ID which was recorded", &models.ServiceRequestEventModel{EventType: models.STEP_FAILED, ExecutionId: "a"}, "", completionResume},
+		{"Failure of an earlier attempt of a failed step", &models.ServiceRequestEventModel{EventType: models.STEP_FAILED, ExecutionId: "b"}, "a", completionIgnore},
+		{"Failure of a compensated step", &models.ServiceRequestEventModel{EventType: models.STEP_COMPENSATED, ExecutionId: "a"}, "", completionIgnore},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.testDescription, func(t *testing.T) {
+			if action := getFailureAction(tc.latestEvent, tc.executionId); action != tc.expected {
+				t.Errorf("Expected %d, got %d", tc.expected, action)
+			}
+		})
+	}
+}
+
+func TestGetFailureOutcome(t *testing.T) {
+	startedOn := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	pipeline := &models.PipelineModel{Timeout: "1h"}
+	approvalStep := &models.PipelineStepModel{StepName: "approve", StepType: models.WaitForApprovalStep}
+	routedApprovalStep := &models.PipelineStepModel{StepName: "approve", StepType: models.WaitForApprovalStep, OnFailure: &models.OnFailurePolicy{Action: models.RouteOnFailure, StepName: "handler"}}
+	testCases := []struct {
+		testDescription string
+		status          models.ServiceRequestStatus
+		step            *models.PipelineStepModel
+		now             time.Time
+		expected        failureOutcome
+	}{
+		{"Rejected approval step fails and compensates the service request", models.PENDING, approvalStep, startedOn.Add(time.Minute), failureFail},
+		{"Rejected approval step follows its on_failure action", models.PENDING, routedApprovalStep, startedOn.Add(time.Minute), failureContinue},
+		{"Failed step of a running service request", models.RUNNING, approvalStep, startedOn.Add(time.Minute), failureFail},
+		{"Failure after the pipeline timeout", models.PENDING, routedApprovalStep, startedOn.Add(2 * time.Hour), failureFail},
+		{"Failure of a service request which has failed is compensated again", models.FAILED, approvalStep, startedOn.Add(time.Minute), failureFail},
+		{"Failure of a service request which has failed does not follow the on_failure action", models.FAILED, routedApprovalStep, startedOn.Add(time.Minute), failureFail},
+		{"Failure of a cancelled service request", models.CANCELLED, routedApprovalStep, startedOn.Add(time.Minute), failureIgnore},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.testDescription, func(t *testing.T) {
+			serviceRequest := &models.ServiceRequestModel{Status: tc.status, StartedOn: startedOn}
+			if outcome := getFailureOutcome(serviceRequest, pipeline, tc.step, tc.now); outcome != tc.expected {
+				t.Errorf("Expected %d, got %d", tc.expected, outcome)
+			}
+		})
+	}
+}
+
+func TestIsCurrentExecution(t *testing.T) {
+	testCases := []struct {
+		testDescription string
+		latestEvent     *models.ServiceRequestEventModel
+		executionId     string
+		expected        bool
+	}{
+		{"Running attempt", &models.ServiceRequestEventModel{EventType: models.STEP_RUNNING, ExecutionId: "a"}, "a", true},
+		{"Event without execution ID", &models.ServiceRequestEventModel{EventType: models.STEP_RUNNING, ExecutionId: "a"}, "", true},
+		{"Earlier attempt", &models.ServiceRequestEventModel{EventType: models.STEP_RUNNING, ExecutionId: "b"}, "a", false},
+		{"Attempt which is backing off", &models.ServiceRequestEventModel{EventType: models.STEP_RETRYING, ExecutionId: "a"}, "a", false},
+		{"Attempt which has completed", &models.ServiceRequestEventModel{EventType: models.STEP_COMPLETED, ExecutionId: "a"}, "a", false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.testDescription, func(t *testing.T) {
+			if current := isCurrentExecution(tc.latestEvent, tc.executionId); current != tc.expected {
+				t.Errorf("Expected %t, got %t", tc.expected, current)
+			}
+		})
+	}
+}
+
+func TestExecutionManagerRejectsEventsWithoutStep(t *testing.T) {
+	queue := events.NewMemoryQueue()
+	srm := &ExecutionManager{
+		logger:    logger.NewServerLog(io.Discard),
+		executors: map[models.PipelineStepType]StepExecutor{},
+		queue:     queue,
+	}
+	queue.Subscribe(events.StepCompletedEventName, srm.handleCompletedStepEvent)
+	queue.Subscribe(events.StepFailedEventName, srm.handleFailedStepEvent)
+	queue.Subscribe(events.RetryStepEventName, srm.handleRetryStepEvent)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	queue.Start(ctx)
+
+	published := []events.Event{
+		events.NewStepCompletedEvent("", "sr", "a", "", nil, nil),
+		events.NewStepCompletedEvent("step", "", "a", "", nil, nil),
+		events.NewStepFailedEvent("", &models.ServiceRequestModel{}, "", "", "failed", nil),
+		events.NewStepFailedEvent("step", nil, "", "", "failed", nil),
+		events.NewRetryStepEvent("", "sr", "user"),
+	}
+	for _, e := range published {
+		if err := queue.Publish(e); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+	}
+	deadline := time.Now().Add(time.Second)
+	for len(queue.Errors()) < len(published) && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if errs := queue.Errors(); len(errs) != len(published) {
+		t.Errorf("Expected %d errors, got %v", len(published), errs)
+	}
+}
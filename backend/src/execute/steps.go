@@ -6,80 +6,159 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"net"
 	"net/http"
 	"strings"
+	"time"
 
-	"github.com/gookit/event"
 	"github.com/joshtyf/flowforge/src/database"
 	"github.com/joshtyf/flowforge/src/database/models"
-	"github.com/joshtyf/flowforge/src/events"
-	"github.com/joshtyf/flowforge/src/logger"
-	"github.com/joshtyf/flowforge/src/util"
+	"github.com/joshtyf/flowforge/src/helper"
 	"go.mongodb.org/mongo-driver/mongo"
 )
 
-type stepExecResult struct {
+// Returned by the API step when the response status code is not accepted
+type apiResponseError struct {
+	statusCode int
+	expected   string
 }
 
-type stepExecutor interface {
-	execute(context.Context, *logger.ExecutorLogger) (*stepExecResult, error)
-	getStepType() models.PipelineStepType
+func (e *apiResponseError) Error() string {
+	return fmt.Sprintf("unexpected response status: expected %s, got %d", e.expected, e.statusCode)
+}
+
+// Returns true if the step should be attempted again after failing with the error
+func isRetryableError(policy *models.RetryPolicy, err error) bool {
+	var respErr *apiResponseError
+	if errors.As(err, &respErr) {
+		return policy.IsRetryableStatusCode(respErr.statusCode)
+	}
+	var exitErr *scriptExitError
+	if errors.As(err, &exitErr) {
+		return policy.IsRetryableError(models.RetryableExitError)
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		if netErr.Timeout() {
+			return policy.IsRetryableError(models.RetryableTimeoutError)
+		}
+		return policy.IsRetryableError(models.RetryableNetworkError)
+	}
+	return false
 }
 
 type apiStepExecutor struct {
+	client *http.Client
 }
 
 func NewApiStepExecutor() *apiStepExecutor {
-	return &apiStepExecutor{}
+	// Requests are bounded by the deadline of the execution context instead of a client timeout
+	return &apiStepExecutor{
+		client: &http.Client{},
+	}
 }
 
-func (e *apiStepExecutor) execute(ctx context.Context, l *logger.ExecutorLogger) (*stepExecResult, error) {
-	step, ok := ctx.Value(util.StepKey).(*models.PipelineStepModel)
+func (e *apiStepExecutor) Execute(ctx context.Context, execution *StepExecution) (*StepExecResult, error) {
+	l := execution.Logger
+	step := execution.Step
+	assertions, err := parseApiAssertions(step.Parameters["assertions"])
+	if err != nil {
+		l.Error(fmt.Sprintf("invalid assertions: %s", err))
+		return nil, err
+	}
+	// Parameters which are a single placeholder keep the type of their value, e.g. a number from the form data
+	requestMethod, ok := helper.FormatScalar(step.Parameters["method"])
 	if !ok {
-		l.Error("error getting step from context")
-		return nil, errors.New("error getting step from context")
+		l.Error("method is not provided")
+		return nil, errors.New("method is not provided")
 	}
-	serviceRequest, ok := ctx.Value(util.ServiceRequestKey).(*models.ServiceRequestModel)
+	url, ok := helper.FormatScalar(step.Parameters["url"])
 	if !ok {
-		l.Error("error getting service request from context")
-		return nil, errors.New("error getting service request from context")
+		l.Error("url is not provided")
+		return nil, errors.New("url is not provided")
+	}
+	headers, err := toStringMap(step.Parameters["headers"])
+	if err != nil {
+		l.Error(fmt.Sprintf("invalid headers: %s", err))
+		return nil, err
 	}
-	requestMethod := step.Parameters["method"].(string) // TODO: add documentation for parameters, specifically the type for safe type assertion
-	url := step.Parameters["url"].(string)
 	requestBody, err := json.Marshal(step.Parameters["data"])
 	if err != nil {
 		l.Error(fmt.Sprintf("error marshalling request body: %s", err))
 		return nil, err
 	}
-	req, err := http.NewRequest(strings.ToUpper(requestMethod), url, bytes.NewBuffer(requestBody))
+	req, err := http.NewRequestWithContext(ctx, strings.ToUpper(requestMethod), url, bytes.NewBuffer(requestBody))
+	if err != nil {
+		l.Error(fmt.Sprintf("error creating request: %s", err))
+		return nil, err
+	}
 	req.Header.Set("Content-Type", "application/json")
-	headers := step.Parameters["headers"].(map[string]interface{})
+	// Downstream services can deduplicate requests of the same attempt. The headers of the step take precedence.
+	if execution.ExecutionId != "" {
+		req.Header.Set("Idempotency-Key", execution.ExecutionId)
+	}
 	for k, v := range headers {
-		req.Header.Set(k, v.(string))
+		req.Header.Set(k, v)
 	}
-	l.Info(fmt.Sprintf("request=%v", req))
+	// Headers are not logged as they usually hold credentials
+	l.Info(fmt.Sprintf("request method=%s url=%s", req.Method, req.URL))
+	resp, err := e.client.Do(req)
 	if err != nil {
 		return nil, err
 	}
-	resp, err := http.DefaultClient.Do(req)
+	defer resp.Body.Close()
+	rawResp, err := io.ReadAll(resp.Body)
 	if err != nil {
+		l.Error(fmt.Sprintf("error reading response body: %s", err))
 		return nil, err
 	}
-	var unmarshalledResp interface{}
-	json.NewDecoder(resp.Body).Decode(&unmarshalledResp)
+	unmarshalledResp, isJson := decodeResponseBody(rawResp)
+	if !isJson {
+		l.Info("response body is not JSON")
+	}
 	l.Info(fmt.Sprintf("response_body=%v", unmarshalledResp))
-	defer resp.Body.Close()
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("non-200 response")
+	if expected, ok := assertions.checkStatus(resp.StatusCode); !ok {
+		l.Error(fmt.Sprintf("assertion failed: status expected %s, got %d", expected, resp.StatusCode))
+		return nil, &apiResponseError{statusCode: resp.StatusCode, expected: expected}
+	}
+	if failures := assertions.check(resp.Header, unmarshalledResp); len(failures) > 0 {
+		for _, failure := range failures {
+			l.Error(fmt.Sprintf("assertion failed: %s", failure))
+		}
+		return nil, &apiAssertionError{failures: failures}
 	}
-	event.FireAsync(events.NewStepCompletedEvent(step.StepName, serviceRequest.Id.Hex(), "", &stepExecResult{}, nil))
-	return &stepExecResult{}, nil
+	responseHeaders := make(map[string]any, len(resp.Header))
+	for k, v := range resp.Header {
+		responseHeaders[k] = strings.Join(v, ", ")
+	}
+	result := &StepExecResult{
+		Output: map[string]any{
+			"status":  resp.StatusCode,
+			"headers": responseHeaders,
+			"body":    unmarshalledResp,
+		},
+	}
+	return result, nil
 }
 
-func (e *apiStepExecutor) getStepType() models.PipelineStepType {
+func (e *apiStepExecutor) StepType() models.PipelineStepType {
 	return models.APIStep
 }
 
+// Returns the decoded JSON response body, and false if the body is not JSON, e.g. plain text or HTML, in which case it
+// is returned as a string. An empty body is nil.
+func decodeResponseBody(body []byte) (any, bool) {
+	if len(bytes.TrimSpace(body)) == 0 {
+		return nil, true
+	}
+	var decoded any
+	if err := json.Unmarshal(body, &decoded); err != nil {
+		return string(body), false
+	}
+	return decoded, true
+}
+
 type waitForApprovalStepExecutor struct {
 	mongoClient *mongo.Client
 }
@@ -90,21 +169,129 @@ func NewWaitForApprovalStepExecutor(mongoClient *mongo.Client) *waitForApprovalS
 	}
 }
 
-func (e *waitForApprovalStepExecutor) execute(ctx context.Context, l *logger.ExecutorLogger) (*stepExecResult, error) {
-	serviceRequest, ok := ctx.Value(util.ServiceRequestKey).(*models.ServiceRequestModel)
-	if !ok {
-		l.Error("error getting service request from context")
-		return nil, errors.New("error getting service request from context")
+// Waits for the approvals of the step, which are recorded by the server. The step is completed by the server once the
+// quorum of the step is reached, or by the execution manager once its deadline is exceeded.
+func (e *waitForApprovalStepExecutor) Execute(ctx context.Context, execution *StepExecution) (*StepExecResult, error) {
+	l := execution.Logger
+	step := execution.Step
+	serviceRequest := execution.ServiceRequest
+	// The parameters may have been set by placeholders, so the policy is only known to be valid once they are rendered
+	policy, err := models.GetApprovalPolicy(step.Parameters)
+	if err != nil {
+		l.Error(fmt.Sprintf("invalid approval parameters: %s", err))
+		return nil, err
+	}
+	// The deadline of a previous attempt of the step is removed if the step has no deadline
+	var deadline time.Time
+	if policy.Deadline > 0 {
+		deadline = time.Now().Add(policy.Deadline)
 	}
-	err := database.NewServiceRequest(e.mongoClient).UpdateStatus(serviceRequest.Id.Hex(), models.PENDING)
+	err = database.NewServiceRequestStep(e.mongoClient).UpdateApprovalDeadline(serviceRequest.Id.Hex(), step.StepName, deadline)
+	if err != nil {
+		l.Error(fmt.Sprintf("error updating approval deadline: %s", err))
+		return nil, err
+	}
+	err = database.NewServiceRequest(e.mongoClient).UpdateStatus(serviceRequest.Id.Hex(), models.PENDING)
 	if err != nil {
 		l.Error(fmt.Sprintf("error updating service request status: %s", err))
 		return nil, err
 	}
-	l.Info(fmt.Sprintf("waiting for approval for service request %s", serviceRequest.Id.Hex()))
-	return &stepExecResult{}, nil
+	if !deadline.IsZero() {
+		l.Info(fmt.Sprintf("waiting for %d approval(s) for service request %s until %s, after which the step will %s", policy.Quorum, serviceRequest.Id.Hex(), deadline.Format(time.RFC3339), policy.OnDeadline))
+	} else {
+		l.Info(fmt.Sprintf("waiting for %d approval(s) for service request %s", policy.Quorum, serviceRequest.Id.Hex()))
+	}
+	return &StepExecResult{Waiting: true}, nil
 }
 
-func (e *waitForApprovalStepExecutor) getStepType() models.PipelineStepType {
+func (e *waitForApprovalStepExecutor) StepType() models.PipelineStepType {
 	return models.WaitForApprovalStep
 }
+
+type waitForCallbackStepExecutor struct {
+	mongoClient *mongo.Client
+}
+
+func NewWaitForCallbackStepExecutor(mongoClient *mongo.Client) *waitForCallbackStepExecutor {
+	return &waitForCallbackStepExecutor{
+		mongoClient: mongoClient,
+	}
+}
+
+// Completes the step with its callback if it was received before the step started. Otherwise the step waits for the
+// callback, which completes the step once it is received, and times out at the step timeout.
+func (e *waitForCallbackStepExecutor) Execute(ctx context.Context, execution *StepExecution) (*StepExecResult, error) {
+	l := execution.Logger
+	step := execution.Step
+	serviceRequest := execution.ServiceRequest
+	serviceRequestStepDAO := database.NewServiceRequestStep(e.mongoClient)
+	srsm, err := serviceRequestStepDAO.GetByServiceRequestIdAndStepName(serviceRequest.Id.Hex(), step.StepName)
+	if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+		l.Error(fmt.Sprintf("error getting callback: %s", err))
+		return nil, err
+	}
+	if err == nil && srsm.Callback != nil {
+		l.Info(fmt.Sprintf("callback received at %s", srsm.CallbackReceivedOn.Format(time.RFC3339)))
+		return &StepExecResult{Output: srsm.Callback}, nil
+	}
+
+	var deadline time.Time
+	if timeout := step.GetTimeout(); timeout > 0 {
+		deadline = time.Now().Add(timeout)
+	}
+	if err := serviceRequestStepDAO.UpdateDeadline(serviceRequest.Id.Hex(), step.StepName, execution.ExecutionId, deadline); err != nil {
+		l.Error(fmt.Sprintf("error setting deadline of step: %s", err))
+		return nil, err
+	}
+	l.Info(fmt.Sprintf("waiting for callback for service request %s", serviceRequest.Id.Hex()))
+	return &StepExecResult{Waiting: true}, nil
+}
+
+func (e *waitForCallbackStepExecutor) StepType() models.PipelineStepType {
+	return models.WaitForCallbackStep
+}
+
+type branchStepExecutor struct {
+}
+
+func NewBranchStepExecutor() *branchStepExecutor {
+	return &branchStepExecutor{}
+}
+
+func (e *branchStepExecutor) Execute(ctx context.Context, execution *StepExecution) (*StepExecResult, error) {
+	l := execution.Logger
+	step := execution.Step
+	serviceRequest := execution.ServiceRequest
+	values := execution.Values
+	if values == nil {
+		values = serviceRequest.FormData
+	}
+	nextStepName := ""
+	for _, branch := range step.Branches {
+		matched, err := helper.EvaluateCondition(branch.Condition, values)
+		if err != nil {
+			l.Error(fmt.Sprintf("error evaluating condition '%s': %s", branch.Condition, err))
+			return nil, err
+		}
+		if matched {
+			l.Info(fmt.Sprintf("condition '%s' matched", branch.Condition))
+			nextStepName = branch.NextStepName
+			break
+		}
+	}
+	if nextStepName == "" {
+		if step.NextStepName == "" {
+			l.Error("no branch condition matched and no default step is defined")
+			return nil, errors.New("no branch condition matched")
+		}
+		l.Info("no branch condition matched, using default step")
+		nextStepName = step.NextStepName
+	}
+	l.Info(fmt.Sprintf("proceeding to step %s", nextStepName))
+	result := &StepExecResult{NextStepName: nextStepName, Output: map[string]any{"next_step_name": nextStepName}}
+	return result, nil
+}
+
+func (e *branchStepExecutor) StepType() models.PipelineStepType {
+	return models.BranchStep
+}
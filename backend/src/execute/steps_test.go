@@ -0,0 +1,85 @@
+package execute
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/joshtyf/flowforge/src/database/models"
+	"github.com/joshtyf/flowforge/src/logger"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func newApiExecution(parameters map[string]any) *StepExecution {
+	step := &models.PipelineStepModel{StepName: "api", StepType: models.APIStep, Parameters: parameters}
+	return &StepExecution{
+		ServiceRequest: &models.ServiceRequestModel{Id: primitive.NewObjectID()},
+		Step:           step,
+		Parameters:     parameters,
+		Logger:         logger.NewExecutorLogger(io.Discard, step.StepName),
+	}
+}
+
+func TestApiStepExecutor(t *testing.T) {
+	var receivedHeader string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		receivedHeader = r.Header.Get("X-Replicas")
+		w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+	executor := NewApiStepExecutor()
+
+	testCases := []struct {
+		testDescription string
+		parameters      map[string]any
+		expectedHeader  string
+		expectErr       bool
+	}{
+		{"String header", map[string]any{"method": "GET", "url": server.URL, "headers": map[string]any{"X-Replicas": "3"}}, "3", false},
+		{"Numeric header", map[string]any{"method": "GET", "url": server.URL, "headers": map[string]any{"X-Replicas": 3}}, "3", false},
+		{"Decoded from the database", map[string]any{"method": "GET", "url": server.URL, "headers": primitive.M{"X-Replicas": int32(2)}}, "2", false},
+		{"Without headers", map[string]any{"method": "GET", "url": server.URL}, "", false},
+		{"Object header", map[string]any{"method": "GET", "url": server.URL, "headers": map[string]any{"X-Replicas": map[string]any{}}}, "", true},
+		{"Missing url", map[string]any{"method": "GET"}, "", true},
+		{"Missing method", map[string]any{"url": server.URL}, "", true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.testDescription, func(t *testing.T) {
+			receivedHeader = ""
+			_, err := executor.Execute(context.Background(), newApiExecution(tc.parameters))
+			if (err != nil) != tc.expectErr {
+				t.Errorf("Expected error %t, got %v", tc.expectErr, err)
+			}
+			if receivedHeader != tc.expectedHeader {
+				t.Errorf("Expected header %q, got %q", tc.expectedHeader, receivedHeader)
+			}
+		})
+	}
+}
+
+func TestDecodeResponseBody(t *testing.T) {
+	testCases := []struct {
+		testDescription string
+		body            string
+		expected        any
+		expectedIsJson  bool
+	}{
+		{"JSON object", `{"id": "a"}`, map[string]any{"id": "a"}, true},
+		{"JSON string", `"ok"`, "ok", true},
+		{"Empty body", "", nil, true},
+		{"Whitespace", "\n", nil, true},
+		{"Plain text", "OK", "OK", false},
+		{"HTML", "<html></html>", "<html></html>", false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.testDescription, func(t *testing.T) {
+			decoded, isJson := decodeResponseBody([]byte(tc.body))
+			if !reflect.DeepEqual(decoded, tc.expected) || isJson != tc.expectedIsJson {
+				t.Errorf("Expected %v and %t, got %v and %t", tc.expected, tc.expectedIsJson, decoded, isJson)
+			}
+		})
+	}
+}
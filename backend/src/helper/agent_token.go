@@ -0,0 +1,37 @@
+package helper
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+)
+
+// Prefix of agent tokens, which makes them recognisable, e.g. by secret scanners
+const agentTokenPrefix = "ffagent_"
+
+// Generates a random token which a remote agent authenticates with
+func GenerateAgentToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return agentTokenPrefix + hex.EncodeToString(b), nil
+}
+
+// Returns the hash of the agent token which is saved in place of the token. Tokens are random, so they do not need
+// a slow or salted hash.
+func HashAgentToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
+
+// Returns true if the token has the format of the tokens generated by GenerateAgentToken
+func IsAgentToken(token string) bool {
+	encoded, ok := strings.CutPrefix(token, agentTokenPrefix)
+	if !ok || len(encoded) != 64 {
+		return false
+	}
+	_, err := hex.DecodeString(encoded)
+	return err == nil
+}
@@ -0,0 +1,57 @@
+package helper
+
+import (
+	"testing"
+)
+
+func TestGenerateAgentToken(t *testing.T) {
+	token, err := GenerateAgentToken()
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+	if !IsAgentToken(token) {
+		t.Errorf("Expected %s to be an agent token", token)
+	}
+	other, err := GenerateAgentToken()
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+	if token == other {
+		t.Errorf("Expected generated tokens to differ, got %s twice", token)
+	}
+}
+
+func TestHashAgentToken(t *testing.T) {
+	token := "ffagent_" + "00112233445566778899aabbccddeeff00112233445566778899aabbccddeeff"
+	hash := HashAgentToken(token)
+	if hash == token || len(hash) != 64 {
+		t.Errorf("Expected a hex encoded SHA-256 hash, got %s", hash)
+	}
+	if HashAgentToken(token) != hash {
+		t.Errorf("Expected the hash of a token to be the same every time")
+	}
+	if HashAgentToken(token+"0") == hash {
+		t.Errorf("Expected the hashes of different tokens to differ")
+	}
+}
+
+func TestIsAgentToken(t *testing.T) {
+	testCases := []struct {
+		description string
+		token       string
+		expected    bool
+	}{
+		{"Valid token", "ffagent_00112233445566778899aabbccddeeff00112233445566778899aabbccddeeff", true},
+		{"Missing prefix", "00112233445566778899aabbccddeeff00112233445566778899aabbccddeeff", false},
+		{"Too short", "ffagent_0011", false},
+		{"Not hex encoded", "ffagent_zz112233445566778899aabbccddeeff00112233445566778899aabbccddeeff", false},
+		{"Empty token", "", false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			if IsAgentToken(tc.token) != tc.expected {
+				t.Errorf("Expected %v, got %v", tc.expected, !tc.expected)
+			}
+		})
+	}
+}
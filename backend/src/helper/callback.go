@@ -0,0 +1,39 @@
+package helper
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// Generates the callback URLs and tokens of WAIT_FOR_CALLBACK steps. Tokens are derived from the service request and
+// step with a server secret, so they do not need to be stored and cannot be guessed without the secret.
+type CallbackSigner struct {
+	baseUrl string
+	secret  []byte
+}
+
+func NewCallbackSigner(baseUrl string, secret []byte) *CallbackSigner {
+	return &CallbackSigner{
+		baseUrl: strings.TrimSuffix(baseUrl, "/"),
+		secret:  secret,
+	}
+}
+
+func (s *CallbackSigner) Token(serviceRequestId, stepName string) string {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(serviceRequestId + "/" + stepName))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Returns the URL which the callback of the step is posted to, which includes the token
+func (s *CallbackSigner) Url(serviceRequestId, stepName string) string {
+	return fmt.Sprintf("%s/api/service_request/%s/steps/%s/callback?token=%s", s.baseUrl, url.PathEscape(serviceRequestId), url.PathEscape(stepName), s.Token(serviceRequestId, stepName))
+}
+
+func (s *CallbackSigner) Verify(serviceRequestId, stepName, token string) bool {
+	return hmac.Equal([]byte(token), []byte(s.Token(serviceRequestId, stepName)))
+}
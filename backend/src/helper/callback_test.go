@@ -0,0 +1,39 @@
+package helper
+
+import (
+	"testing"
+)
+
+func TestCallbackSignerVerify(t *testing.T) {
+	signer := NewCallbackSigner("http://localhost:8080/", []byte("secret"))
+	token := signer.Token("sr1", "step1")
+	testCases := []struct {
+		description      string
+		signer           *CallbackSigner
+		serviceRequestId string
+		stepName         string
+		token            string
+		expected         bool
+	}{
+		{"Valid token", signer, "sr1", "step1", token, true},
+		{"Token of another step", signer, "sr1", "step2", token, false},
+		{"Token of another service request", signer, "sr2", "step1", token, false},
+		{"Token signed with another secret", NewCallbackSigner("http://localhost:8080", []byte("other")), "sr1", "step1", token, false},
+		{"Empty token", signer, "sr1", "step1", "", false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			if tc.signer.Verify(tc.serviceRequestId, tc.stepName, tc.token) != tc.expected {
+				t.Errorf("Expected %v, got %v", tc.expected, !tc.expected)
+			}
+		})
+	}
+}
+
+func TestCallbackSignerUrl(t *testing.T) {
+	signer := NewCallbackSigner("http://localhost:8080/", []byte("secret"))
+	expected := "http://localhost:8080/api/service_request/sr1/steps/Wait%20For%20Job/callback?token=" + signer.Token("sr1", "Wait For Job")
+	if url := signer.Url("sr1", "Wait For Job"); url != expected {
+		t.Errorf("Expected %s, got %s", expected, url)
+	}
+}
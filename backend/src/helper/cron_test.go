@@ -0,0 +1,75 @@
+package helper
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestParseCron(t *testing.T) {
+	testCases := []struct {
+		description string
+		expr        string
+		valid       bool
+	}{
+		{"Every minute", "* * * * *", true},
+		{"Ranges, steps and lists", "*/15 9-17 1,15 * MON-FRI", true},
+		{"Named months", "0 0 1 JAN,jul *", true},
+		{"Sunday as 7", "0 0 * * 7", true},
+		{"Macro", "@daily", true},
+		{"Too few fields", "* * * *", false},
+		{"Value out of range", "60 * * * *", false},
+		{"Invalid step", "*/0 * * * *", false},
+		{"Reversed range", "0 0 10-5 * *", false},
+		{"Unknown name", "0 0 * * FUN", false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			_, err := ParseCron(tc.expr)
+			if tc.valid && err != nil {
+				t.Errorf("Expected no error, got %v", err)
+			}
+			if !tc.valid && !errors.Is(err, ErrInvalidCronExpression) {
+				t.Errorf("Expected %v, got %v", ErrInvalidCronExpression, err)
+			}
+		})
+	}
+}
+
+func TestCronScheduleNext(t *testing.T) {
+	singapore, err := time.LoadLocation("Asia/Singapore")
+	if err != nil {
+		t.Fatalf("Expected no error loading location, got %v", err)
+	}
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatalf("Expected no error loading location, got %v", err)
+	}
+	testCases := []struct {
+		description string
+		expr        string
+		from        time.Time
+		expected    time.Time
+	}{
+		{"Every minute", "* * * * *", time.Date(2024, 3, 1, 10, 0, 30, 0, time.UTC), time.Date(2024, 3, 1, 10, 1, 0, 0, time.UTC)},
+		{"Later the same day", "30 2 * * *", time.Date(2024, 3, 1, 1, 0, 0, 0, time.UTC), time.Date(2024, 3, 1, 2, 30, 0, 0, time.UTC)},
+		{"Next day", "30 2 * * *", time.Date(2024, 3, 1, 2, 30, 0, 0, time.UTC), time.Date(2024, 3, 2, 2, 30, 0, 0, time.UTC)},
+		{"Day of week", "0 9 * * MON", time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC), time.Date(2024, 3, 4, 9, 0, 0, 0, time.UTC)},
+		{"Day of month or day of week", "0 0 15 * MON", time.Date(2024, 3, 5, 0, 0, 0, 0, time.UTC), time.Date(2024, 3, 11, 0, 0, 0, 0, time.UTC)},
+		{"Leap day", "0 0 29 2 *", time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC), time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{"Never", "0 0 30 2 *", time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), time.Time{}},
+		{"Time zone", "0 2 * * *", time.Date(2024, 3, 1, 3, 0, 0, 0, singapore), time.Date(2024, 3, 2, 2, 0, 0, 0, singapore)},
+		{"Skipped by daylight saving", "30 2 * * *", time.Date(2024, 3, 10, 0, 0, 0, 0, newYork), time.Date(2024, 3, 11, 2, 30, 0, 0, newYork)},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			schedule, err := ParseCron(tc.expr)
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if next := schedule.Next(tc.from); !next.Equal(tc.expected) {
+				t.Errorf("Expected %v, got %v", tc.expected, next)
+			}
+		})
+	}
+}
@@ -0,0 +1,731 @@
+package helper
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+var (
+	ErrInvalidExpression     = errors.New("invalid expression")
+	ErrUnsupportedComparison = errors.New("unsupported comparison between values")
+	ErrUnsupportedOperation  = errors.New("unsupported operation on values")
+	ErrInvalidArgument       = errors.New("invalid function argument")
+
+	// Returned when evaluating placeholders, whose values must all be present
+	errMissingValue = errors.New("value not found")
+)
+
+type tokenType int
+
+const (
+	tokenEOF tokenType = iota
+	tokenIdentifier
+	tokenString
+	tokenNumber
+	tokenOperator
+	tokenLeftParen
+	tokenRightParen
+	tokenComma
+)
+
+type token struct {
+	typ   tokenType
+	value string
+	pos   int
+}
+
+// Splits an expression into tokens. Identifiers may contain dots to reference nested values, e.g. owner.email, and
+// brackets to reference elements of lists, e.g. regions[0].
+func tokenize(input string) ([]token, error) {
+	tokens := make([]token, 0)
+	i := 0
+	for i < len(input) {
+		c := rune(input[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '(':
+			tokens = append(tokens, token{tokenLeftParen, "(", i})
+			i++
+		case c == ')':
+			tokens = append(tokens, token{tokenRightParen, ")", i})
+			i++
+		case c == ',':
+			tokens = append(tokens, token{tokenComma, ",", i})
+			i++
+		case c == '"' || c == '\'':
+			start := i
+			i++
+			var sb strings.Builder
+			for i < len(input) && rune(input[i]) != c {
+				if input[i] == '\\' && i+1 < len(input) {
+					i++
+				}
+				sb.WriteByte(input[i])
+				i++
+			}
+			if i >= len(input) {
+				return nil, fmt.Errorf("%w: unterminated string at position %d", ErrInvalidExpression, start)
+			}
+			i++
+			tokens = append(tokens, token{tokenString, sb.String(), start})
+		case unicode.IsDigit(c):
+			start := i
+			for i < len(input) && (unicode.IsDigit(rune(input[i])) || input[i] == '.') {
+				i++
+			}
+			tokens = append(tokens, token{tokenNumber, input[start:i], start})
+		case unicode.IsLetter(c) || c == '_' || c == '$':
+			// Identifiers starting with $ reference JSON documents, e.g. $.items[0].id
+			start := i
+			i++
+			for i < len(input) && (unicode.IsLetter(rune(input[i])) || unicode.IsDigit(rune(input[i])) || strings.ContainsRune("_.[]", rune(input[i]))) {
+				i++
+			}
+			tokens = append(tokens, token{tokenIdentifier, input[start:i], start})
+		default:
+			start := i
+			op := ""
+			for _, candidate := range []string{"==", "!=", "<=", ">=", "&&", "||", "<", ">", "!", "|", "+", "-", "*", "/", "%"} {
+				if strings.HasPrefix(input[i:], candidate) {
+					op = candidate
+					break
+				}
+			}
+			if op == "" {
+				return nil, fmt.Errorf("%w: unexpected character '%c' at position %d", ErrInvalidExpression, c, i)
+			}
+			i += len(op)
+			tokens = append(tokens, token{tokenOperator, op, start})
+		}
+	}
+	tokens = append(tokens, token{tokenEOF, "", len(input)})
+	return tokens, nil
+}
+
+// The values an expression is evaluated against. Placeholders are evaluated strictly, so that a placeholder whose values
+// are missing is left to be replaced later, while conditions treat missing values as null.
+type evalContext struct {
+	values map[string]any
+	strict bool
+}
+
+type exprNode interface {
+	eval(ctx *evalContext) (any, error)
+}
+
+type literalNode struct {
+	value any
+}
+
+func (n *literalNode) eval(ctx *evalContext) (any, error) {
+	return n.value, nil
+}
+
+var identifierPathReplacer = strings.NewReplacer("[", ".", "]", "")
+
+type identifierNode struct {
+	path string
+}
+
+func (n *identifierNode) eval(ctx *evalContext) (any, error) {
+	// Missing values evaluate to nil so that optional form fields can be compared against
+	value, _ := LookupValue(ctx.values, n.path)
+	if value == nil && ctx.strict {
+		return nil, fmt.Errorf("%w: %s", errMissingValue, n.path)
+	}
+	return value, nil
+}
+
+type unaryNode struct {
+	operator string
+	operand  exprNode
+}
+
+func (n *unaryNode) eval(ctx *evalContext) (any, error) {
+	value, err := n.operand.eval(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if n.operator == "-" {
+		number, ok := toFloat(value)
+		if !ok {
+			return nil, fmt.Errorf("%w: -%v", ErrUnsupportedOperation, value)
+		}
+		return -number, nil
+	}
+	return !IsTruthy(value), nil
+}
+
+type binaryNode struct {
+	operator string
+	left     exprNode
+	right    exprNode
+}
+
+func (n *binaryNode) eval(ctx *evalContext) (any, error) {
+	left, err := n.left.eval(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// Short circuit logical operators
+	switch n.operator {
+	case "&&":
+		if !IsTruthy(left) {
+			return false, nil
+		}
+		right, err := n.right.eval(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return IsTruthy(right), nil
+	case "||":
+		if IsTruthy(left) {
+			return true, nil
+		}
+		right, err := n.right.eval(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return IsTruthy(right), nil
+	}
+
+	right, err := n.right.eval(ctx)
+	if err != nil {
+		return nil, err
+	}
+	switch n.operator {
+	case "==":
+		return valuesEqual(left, right), nil
+	case "!=":
+		return !valuesEqual(left, right), nil
+	case "+", "-", "*", "/", "%":
+		return applyArithmetic(n.operator, left, right)
+	default:
+		return compareValues(n.operator, left, right)
+	}
+}
+
+// A call of a function, either as name(args) or as a filter, e.g. region | default "us-east-1", whose input is the
+// first argument
+type callNode struct {
+	name string
+	args []exprNode
+}
+
+func (n *callNode) eval(ctx *evalContext) (any, error) {
+	if n.name == "default" {
+		// The default replaces missing values, so the first argument may be missing
+		value, err := n.args[0].eval(ctx)
+		if err != nil && !errors.Is(err, errMissingValue) {
+			return nil, err
+		}
+		if err == nil && value != nil && value != "" {
+			return value, nil
+		}
+		return n.args[1].eval(ctx)
+	}
+	args := make([]any, 0, len(n.args))
+	for _, arg := range n.args {
+		value, err := arg.eval(ctx)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, value)
+	}
+	return expressionFunctions[n.name].call(args)
+}
+
+type expressionParser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *expressionParser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *expressionParser) next() token {
+	t := p.tokens[p.pos]
+	if t.typ != tokenEOF {
+		p.pos++
+	}
+	return t
+}
+
+// Filters have the lowest precedence, so that they apply to the whole expression before them
+func (p *expressionParser) parsePipe() (exprNode, error) {
+	input, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().typ == tokenOperator && p.peek().value == "|" {
+		p.next()
+		name := p.next()
+		if name.typ != tokenIdentifier {
+			return nil, fmt.Errorf("%w: expected filter at position %d", ErrInvalidExpression, name.pos)
+		}
+		args := []exprNode{input}
+		if p.peek().typ == tokenLeftParen {
+			p.next()
+			callArgs, err := p.parseArguments()
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, callArgs...)
+		} else {
+			// Arguments of filters may also follow the filter, e.g. join ", "
+			for startsOperand(p.peek()) {
+				arg, err := p.parseUnary()
+				if err != nil {
+					return nil, err
+				}
+				args = append(args, arg)
+				if p.peek().typ != tokenComma {
+					break
+				}
+				p.next()
+			}
+		}
+		if input, err = newCallNode(name, args); err != nil {
+			return nil, err
+		}
+	}
+	return input, nil
+}
+
+func (p *expressionParser) parseOr() (exprNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().typ == tokenOperator && p.peek().value == "||" {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryNode{operator: "||", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *expressionParser) parseAnd() (exprNode, error) {
+	left, err := p.parseComparison()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().typ == tokenOperator && p.peek().value == "&&" {
+		p.next()
+		right, err := p.parseComparison()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryNode{operator: "&&", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *expressionParser) parseComparison() (exprNode, error) {
+	left, err := p.parseAdditive()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.typ == tokenOperator && StringInSlice(t.value, []string{"==", "!=", "<", "<=", ">", ">="}) {
+		p.next()
+		right, err := p.parseAdditive()
+		if err != nil {
+			return nil, err
+		}
+		return &binaryNode{operator: t.value, left: left, right: right}, nil
+	}
+	return left, nil
+}
+
+func (p *expressionParser) parseAdditive() (exprNode, error) {
+	left, err := p.parseMultiplicative()
+	if err != nil {
+		return nil, err
+	}
+	for t := p.peek(); t.typ == tokenOperator && (t.value == "+" || t.value == "-"); t = p.peek() {
+		p.next()
+		right, err := p.parseMultiplicative()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryNode{operator: t.value, left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *expressionParser) parseMultiplicative() (exprNode, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for t := p.peek(); t.typ == tokenOperator && StringInSlice(t.value, []string{"*", "/", "%"}); t = p.peek() {
+		p.next()
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryNode{operator: t.value, left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *expressionParser) parseUnary() (exprNode, error) {
+	if t := p.peek(); t.typ == tokenOperator && (t.value == "!" || t.value == "-") {
+		p.next()
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &unaryNode{operator: t.value, operand: operand}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *expressionParser) parsePrimary() (exprNode, error) {
+	t := p.next()
+	switch t.typ {
+	case tokenLeftParen:
+		node, err := p.parsePipe()
+		if err != nil {
+			return nil, err
+		}
+		if closing := p.next(); closing.typ != tokenRightParen {
+			return nil, fmt.Errorf("%w: expected ')' at position %d", ErrInvalidExpression, closing.pos)
+		}
+		return node, nil
+	case tokenString:
+		return &literalNode{value: t.value}, nil
+	case tokenNumber:
+		number, err := strconv.ParseFloat(t.value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid number '%s' at position %d", ErrInvalidExpression, t.value, t.pos)
+		}
+		return &literalNode{value: number}, nil
+	case tokenIdentifier:
+		switch t.value {
+		case "true":
+			return &literalNode{value: true}, nil
+		case "false":
+			return &literalNode{value: false}, nil
+		case "null":
+			return &literalNode{value: nil}, nil
+		}
+		if p.peek().typ == tokenLeftParen {
+			p.next()
+			args, err := p.parseArguments()
+			if err != nil {
+				return nil, err
+			}
+			return newCallNode(t, args)
+		}
+		// regions[0] is the same as regions.0
+		return &identifierNode{path: identifierPathReplacer.Replace(t.value)}, nil
+	case tokenEOF:
+		return nil, fmt.Errorf("%w: unexpected end of expression", ErrInvalidExpression)
+	default:
+		return nil, fmt.Errorf("%w: unexpected '%s' at position %d", ErrInvalidExpression, t.value, t.pos)
+	}
+}
+
+// Parses the comma separated arguments of a function call, after its opening parenthesis
+func (p *expressionParser) parseArguments() ([]exprNode, error) {
+	args := make([]exprNode, 0)
+	if p.peek().typ == tokenRightParen {
+		p.next()
+		return args, nil
+	}
+	for {
+		arg, err := p.parsePipe()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+		switch t := p.next(); t.typ {
+		case tokenComma:
+			continue
+		case tokenRightParen:
+			return args, nil
+		default:
+			return nil, fmt.Errorf("%w: expected ',' or ')' at position %d", ErrInvalidExpression, t.pos)
+		}
+	}
+}
+
+// Returns true if the token can start an operand, e.g. an argument of a filter
+func startsOperand(t token) bool {
+	switch t.typ {
+	case tokenString, tokenNumber, tokenIdentifier, tokenLeftParen:
+		return true
+	case tokenOperator:
+		return t.value == "!" || t.value == "-"
+	}
+	return false
+}
+
+// Unknown functions and calls with the wrong number of arguments are reported when the expression is parsed
+func newCallNode(name token, args []exprNode) (exprNode, error) {
+	function, ok := expressionFunctions[name.value]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown function '%s' at position %d", ErrInvalidExpression, name.value, name.pos)
+	}
+	if len(args) < function.minArgs || len(args) > function.maxArgs {
+		return nil, fmt.Errorf("%w: wrong number of arguments for '%s' at position %d", ErrInvalidExpression, name.value, name.pos)
+	}
+	return &callNode{name: name.value, args: args}, nil
+}
+
+type Expression struct {
+	source string
+	root   exprNode
+}
+
+// Parses an expression such as `environment == "prod" && replicas > 2`.
+//
+// Supported syntax: string, number, boolean and null literals, identifiers referencing (nested) values,
+// comparison operators (==, !=, <, <=, >, >=), logical operators (&&, ||, !), arithmetic operators (+, -, *, /, %),
+// function calls, e.g. upper(region), filters, e.g. region | default "us-east-1", and parentheses.
+func ParseExpression(input string) (*Expression, error) {
+	tokens, err := tokenize(input)
+	if err != nil {
+		return nil, err
+	}
+	p := &expressionParser{tokens: tokens}
+	root, err := p.parsePipe()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.typ != tokenEOF {
+		return nil, fmt.Errorf("%w: unexpected '%s' at position %d", ErrInvalidExpression, t.value, t.pos)
+	}
+	return &Expression{source: input, root: root}, nil
+}
+
+func (e *Expression) String() string {
+	return e.source
+}
+
+// Returns the paths of the values referenced by the expression, in the order they appear
+func (e *Expression) Identifiers() []string {
+	identifiers := make([]string, 0)
+	var collect func(node exprNode)
+	collect = func(node exprNode) {
+		switch n := node.(type) {
+		case *identifierNode:
+			if !StringInSlice(n.path, identifiers) {
+				identifiers = append(identifiers, n.path)
+			}
+		case *unaryNode:
+			collect(n.operand)
+		case *binaryNode:
+			collect(n.left)
+			collect(n.right)
+		case *callNode:
+			for _, arg := range n.args {
+				collect(arg)
+			}
+		}
+	}
+	collect(e.root)
+	return identifiers
+}
+
+// Evaluates the expression against the given values. Missing values are null.
+func (e *Expression) Evaluate(values map[string]any) (any, error) {
+	return e.root.eval(&evalContext{values: values})
+}
+
+// Evaluates the expression against the given values, failing if a value is missing or null unless it has a default
+func (e *Expression) evaluateStrict(values map[string]any) (any, error) {
+	return e.root.eval(&evalContext{values: values, strict: true})
+}
+
+// Parses and evaluates the expression, returning whether the result is truthy.
+func EvaluateCondition(input string, values map[string]any) (bool, error) {
+	expr, err := ParseExpression(input)
+	if err != nil {
+		return false, err
+	}
+	result, err := expr.Evaluate(values)
+	if err != nil {
+		return false, err
+	}
+	return IsTruthy(result), nil
+}
+
+// Resolves a dot separated path (e.g. owner.email) against the values.
+// A key matching the full path takes precedence over a nested lookup.
+func LookupValue(values map[string]any, path string) (any, bool) {
+	if value, ok := values[path]; ok {
+		return value, true
+	}
+	var current any = values
+	for _, segment := range strings.Split(path, ".") {
+		switch c := current.(type) {
+		case map[string]any:
+			value, ok := c[segment]
+			if !ok {
+				return nil, false
+			}
+			current = value
+		case bson.M:
+			value, ok := c[segment]
+			if !ok {
+				return nil, false
+			}
+			current = value
+		case bson.D:
+			found := false
+			for _, elem := range c {
+				if elem.Key == segment {
+					current = elem.Value
+					found = true
+					break
+				}
+			}
+			if !found {
+				return nil, false
+			}
+		default:
+			index, err := strconv.Atoi(segment)
+			if err != nil {
+				return nil, false
+			}
+			rv := reflect.ValueOf(current)
+			if rv.Kind() != reflect.Slice || index < 0 || index >= rv.Len() {
+				return nil, false
+			}
+			current = rv.Index(index).Interface()
+		}
+	}
+	return current, true
+}
+
+// Returns false for nil, false, zero numbers, empty strings and empty collections. Everything else is true.
+func IsTruthy(value any) bool {
+	if value == nil {
+		return false
+	}
+	if b, ok := value.(bool); ok {
+		return b
+	}
+	if number, ok := toFloat(value); ok {
+		return number != 0
+	}
+	rv := reflect.ValueOf(value)
+	switch rv.Kind() {
+	case reflect.String, reflect.Slice, reflect.Map:
+		return rv.Len() > 0
+	}
+	return true
+}
+
+func toFloat(value any) (float64, bool) {
+	switch v := value.(type) {
+	case int:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case float32:
+		return float64(v), true
+	case float64:
+		return v, true
+	}
+	return 0, false
+}
+
+func valuesEqual(left, right any) bool {
+	if l, ok := toFloat(left); ok {
+		if r, ok := toFloat(right); ok {
+			return l == r
+		}
+		return false
+	}
+	return reflect.DeepEqual(left, right)
+}
+
+func compareValues(operator string, left, right any) (bool, error) {
+	var cmp int
+	if l, ok := toFloat(left); ok {
+		r, ok := toFloat(right)
+		if !ok {
+			return false, fmt.Errorf("%w: %v %s %v", ErrUnsupportedComparison, left, operator, right)
+		}
+		switch {
+		case l < r:
+			cmp = -1
+		case l > r:
+			cmp = 1
+		}
+	} else if l, ok := left.(string); ok {
+		r, ok := right.(string)
+		if !ok {
+			return false, fmt.Errorf("%w: %v %s %v", ErrUnsupportedComparison, left, operator, right)
+		}
+		cmp = strings.Compare(l, r)
+	} else {
+		return false, fmt.Errorf("%w: %v %s %v", ErrUnsupportedComparison, left, operator, right)
+	}
+
+	switch operator {
+	case "<":
+		return cmp < 0, nil
+	case "<=":
+		return cmp <= 0, nil
+	case ">":
+		return cmp > 0, nil
+	case ">=":
+		return cmp >= 0, nil
+	}
+	return false, fmt.Errorf("%w: unknown operator '%s'", ErrInvalidExpression, operator)
+}
+
+func applyArithmetic(operator string, left, right any) (any, error) {
+	l, leftIsNumber := toFloat(left)
+	r, rightIsNumber := toFloat(right)
+	if leftIsNumber && rightIsNumber {
+		switch operator {
+		case "+":
+			return l + r, nil
+		case "-":
+			return l - r, nil
+		case "*":
+			return l * r, nil
+		case "/", "%":
+			if r == 0 {
+				return nil, fmt.Errorf("%w: division by zero", ErrUnsupportedOperation)
+			}
+			if operator == "/" {
+				return l / r, nil
+			}
+			return math.Mod(l, r), nil
+		}
+	}
+	// Strings are concatenated with other strings and scalars
+	if _, leftIsString := left.(string); operator == "+" && (leftIsString || isString(right)) {
+		l, leftOk := FormatScalar(left)
+		r, rightOk := FormatScalar(right)
+		if leftOk && rightOk {
+			return l + r, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %v %s %v", ErrUnsupportedOperation, left, operator, right)
+}
+
+func isString(value any) bool {
+	_, ok := value.(string)
+	return ok
+}
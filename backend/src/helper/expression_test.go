@@ -0,0 +1,130 @@
+package helper
+
+import (
+	"errors"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestEvaluateCondition(t *testing.T) {
+	values := map[string]any{
+		"env":      "prod",
+		"replicas": 3,
+		"approved": true,
+		"owner":    map[string]any{"email": "john@example.com"},
+		"regions":  bson.A{"us-east-1", "eu-west-1"},
+		"empty":    "",
+	}
+	testCases := []struct {
+		expression string
+		expected   bool
+		err        error
+	}{
+		{`env == "prod"`, true, nil},
+		{`env == 'dev'`, false, nil},
+		{`env != "dev"`, true, nil},
+		{`replicas > 2`, true, nil},
+		{`replicas <= 2`, false, nil},
+		{`replicas == 3`, true, nil},
+		{`approved`, true, nil},
+		{`!approved`, false, nil},
+		{`empty`, false, nil},
+		{`missing`, false, nil},
+		{`missing == null`, true, nil},
+		{`owner.email == "john@example.com"`, true, nil},
+		{`regions.1 == "eu-west-1"`, true, nil},
+		{`regions[1] == "eu-west-1"`, true, nil},
+		{`env == "prod" && replicas > 5`, false, nil},
+		{`env == "prod" && (replicas > 5 || approved)`, true, nil},
+		{`env == "dev" || !approved || replicas >= 3`, true, nil},
+		{`env > 3`, false, ErrUnsupportedComparison},
+		{`env ==`, false, ErrInvalidExpression},
+		{`(env == "prod"`, false, ErrInvalidExpression},
+		{`env == "prod`, false, ErrInvalidExpression},
+		{`env = "prod"`, false, ErrInvalidExpression},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.expression, func(t *testing.T) {
+			result, err := EvaluateCondition(tc.expression, values)
+			if !errors.Is(err, tc.err) {
+				t.Errorf("Expected error: %v, Got: %v", tc.err, err)
+			}
+			if result != tc.expected {
+				t.Errorf("Expected: %v, Got: %v", tc.expected, result)
+			}
+		})
+	}
+}
+
+func TestExpressionIdentifiers(t *testing.T) {
+	expr, err := ParseExpression(`$.status == "ok" && ($.items[0].id != null || !$.status)`)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	expected := []string{"$.status", "$.items.0.id"}
+	if identifiers := expr.Identifiers(); !StringSliceEqual(identifiers, expected) {
+		t.Errorf("Expected %v, got %v", expected, identifiers)
+	}
+}
+
+func TestEvaluateExpression(t *testing.T) {
+	values := map[string]any{
+		"name":     " vm-1 ",
+		"region":   "",
+		"replicas": int32(3),
+		"owner":    map[string]any{"email": "john@example.com"},
+		"regions":  bson.A{"us-east-1", "eu-west-1"},
+		"tags":     bson.D{{Key: "team", Value: "infra"}},
+	}
+	testCases := []struct {
+		expression string
+		expected   any
+		err        error
+	}{
+		{`replicas * 2 + 1`, float64(7), nil},
+		{`(replicas + 1) / 2`, float64(2), nil},
+		{`replicas % 2`, float64(1), nil},
+		{`-replicas`, float64(-3), nil},
+		{`"vm-" + replicas`, "vm-3", nil},
+		{`replicas - 1 > 1`, true, nil},
+		{`upper(owner.email)`, "JOHN@EXAMPLE.COM", nil},
+		{`owner.email | upper`, "JOHN@EXAMPLE.COM", nil},
+		{`name | trim | lower`, "vm-1", nil},
+		{`region | default "us-east-1"`, "us-east-1", nil},
+		{`missing | default("us-east-1")`, "us-east-1", nil},
+		{`default(owner.email, "none")`, "john@example.com", nil},
+		{`regions | join ", "`, "us-east-1, eu-west-1", nil},
+		{`join(regions)`, "us-east-1,eu-west-1", nil},
+		{`tags | json`, `{"team":"infra"}`, nil},
+		{`regions | json`, `["us-east-1","eu-west-1"]`, nil},
+		{`"user:pass" | base64`, "dXNlcjpwYXNz", nil},
+		{`"a b&c" | urlencode`, "a+b%26c", nil},
+		{`replicas / 0`, nil, ErrUnsupportedOperation},
+		{`owner * 2`, nil, ErrUnsupportedOperation},
+		{`owner | upper`, nil, ErrInvalidArgument},
+		{`regions | upper`, nil, ErrInvalidArgument},
+		{`name | capitalize`, nil, ErrInvalidExpression},
+		{`upper(name, region)`, nil, ErrInvalidExpression},
+		{`name | default`, nil, ErrInvalidExpression},
+		{`name |`, nil, ErrInvalidExpression},
+		{`join(regions,`, nil, ErrInvalidExpression},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.expression, func(t *testing.T) {
+			expr, err := ParseExpression(tc.expression)
+			var result any
+			if err == nil {
+				result, err = expr.Evaluate(values)
+			}
+			if !errors.Is(err, tc.err) {
+				t.Errorf("Expected error: %v, Got: %v", tc.err, err)
+			}
+			if result != tc.expected {
+				t.Errorf("Expected: %v, Got: %v", tc.expected, result)
+			}
+		})
+	}
+}
@@ -0,0 +1,155 @@
+package helper
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// A function which expressions can call, e.g. upper(region), or apply as a filter, e.g. region | upper. The input of a
+// filter is the first argument of the function.
+type expressionFunction struct {
+	minArgs int
+	maxArgs int
+	call    func(args []any) (any, error)
+}
+
+var expressionFunctions = map[string]expressionFunction{
+	// Returns the second argument if the first is missing, null or empty. It is evaluated by the call node, as the first
+	// argument may be missing.
+	"default":   {minArgs: 2, maxArgs: 2},
+	"upper":     {minArgs: 1, maxArgs: 1, call: stringFunction("upper", strings.ToUpper)},
+	"lower":     {minArgs: 1, maxArgs: 1, call: stringFunction("lower", strings.ToLower)},
+	"trim":      {minArgs: 1, maxArgs: 1, call: stringFunction("trim", strings.TrimSpace)},
+	"urlencode": {minArgs: 1, maxArgs: 1, call: stringFunction("urlencode", url.QueryEscape)},
+	"base64":    {minArgs: 1, maxArgs: 1, call: stringFunction("base64", encodeBase64)},
+	"json":      {minArgs: 1, maxArgs: 1, call: toJson},
+	"join":      {minArgs: 1, maxArgs: 2, call: join},
+}
+
+func encodeBase64(s string) string {
+	return base64.StdEncoding.EncodeToString([]byte(s))
+}
+
+// Returns a function of a string. Numbers and booleans are converted to strings.
+func stringFunction(name string, f func(string) string) func(args []any) (any, error) {
+	return func(args []any) (any, error) {
+		s, ok := FormatScalar(args[0])
+		if !ok {
+			return nil, fmt.Errorf("%w: %s expects a string, got %v", ErrInvalidArgument, name, args[0])
+		}
+		return f(s), nil
+	}
+}
+
+func toJson(args []any) (any, error) {
+	b, err := json.Marshal(normalizeValue(args[0]))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidArgument, err)
+	}
+	return string(b), nil
+}
+
+// Converts documents and arrays decoded from the database to maps and slices, so that documents, which are ordered
+// lists of keys and values, are encoded as JSON objects
+func normalizeValue(value any) any {
+	switch v := value.(type) {
+	case bson.D:
+		m := make(map[string]any, len(v))
+		for _, elem := range v {
+			m[elem.Key] = normalizeValue(elem.Value)
+		}
+		return m
+	case bson.M:
+		return normalizeValue(map[string]any(v))
+	case map[string]any:
+		m := make(map[string]any, len(v))
+		for key, elem := range v {
+			m[key] = normalizeValue(elem)
+		}
+		return m
+	case bson.A:
+		return normalizeValue([]any(v))
+	case []any:
+		s := make([]any, 0, len(v))
+		for _, elem := range v {
+			s = append(s, normalizeValue(elem))
+		}
+		return s
+	}
+	return value
+}
+
+// Joins the elements of a list with the separator, which defaults to ","
+func join(args []any) (any, error) {
+	separator := ","
+	if len(args) > 1 {
+		s, ok := args[1].(string)
+		if !ok {
+			return nil, fmt.Errorf("%w: join expects a string separator, got %v", ErrInvalidArgument, args[1])
+		}
+		separator = s
+	}
+	rv := reflect.ValueOf(args[0])
+	if rv.Kind() != reflect.Slice {
+		return nil, fmt.Errorf("%w: join expects a list, got %v", ErrInvalidArgument, args[0])
+	}
+	elems := make([]string, 0, rv.Len())
+	for i := 0; i < rv.Len(); i++ {
+		elem, ok := FormatScalar(rv.Index(i).Interface())
+		if !ok {
+			return nil, fmt.Errorf("%w: join expects a list of strings, got %v", ErrInvalidArgument, args[0])
+		}
+		elems = append(elems, elem)
+	}
+	return strings.Join(elems, separator), nil
+}
+
+// Converts strings, numbers and booleans to strings. Other values cannot be converted.
+func FormatScalar(value any) (string, bool) {
+	if value == nil {
+		return "", false
+	}
+	if valueType := reflect.TypeOf(value); valueType.Kind() == reflect.String {
+		return reflect.ValueOf(value).String(), true
+	} else if valueType.Kind() == reflect.Int || valueType.Kind() == reflect.Int32 || valueType.Kind() == reflect.Int64 {
+		// Integers decoded from the database are either 32 or 64 bits
+		return strconv.FormatInt(reflect.ValueOf(value).Int(), 10), true
+	} else if valueType.Kind() == reflect.Float64 {
+		return strconv.FormatFloat(reflect.ValueOf(value).Float(), 'f', -1, 64), true
+	} else if valueType.Kind() == reflect.Bool {
+		return strconv.FormatBool(reflect.ValueOf(value).Bool()), true
+	}
+	return "", false
+}
+
+// Lists are decoded from the database as bson.A and from JSON as []any. Returns false if the value is not a list.
+func ToSlice(value any) ([]any, bool) {
+	switch v := value.(type) {
+	case bson.A:
+		return v, true
+	case []any:
+		return v, true
+	default:
+		return nil, false
+	}
+}
+
+// Objects are decoded from the database as bson.M and from JSON as map[string]any. Returns false if the value is not
+// an object.
+func ToMap(value any) (map[string]any, bool) {
+	switch v := value.(type) {
+	case bson.M:
+		return v, true
+	case map[string]any:
+		return v, true
+	default:
+		return nil, false
+	}
+}
@@ -0,0 +1,152 @@
+package helper
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+var (
+	ErrInvalidSecretKey  = errors.New("secret key must be 32 bytes")
+	ErrInvalidCiphertext = errors.New("unable to decrypt secret")
+)
+
+// Placeholders of the form ${secrets.NAME} are replaced with the secrets of the organization when steps are executed
+const SecretPathPrefix = "secrets."
+
+// Replaces secrets in logs and step outputs
+const RedactedSecret = "******"
+
+var secretNameRegex = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+func IsValidSecretName(name string) bool {
+	return secretNameRegex.MatchString(name)
+}
+
+// Returns true if the placeholder only references secrets, e.g. ${secrets.NAME} or ${secrets.NAME | base64}
+func IsSecretPlaceholder(placeholder string) bool {
+	identifiers := PlaceholderIdentifiers(placeholder)
+	for _, identifier := range identifiers {
+		if !strings.HasPrefix(identifier, SecretPathPrefix) {
+			return false
+		}
+	}
+	return len(identifiers) > 0
+}
+
+// Returns the names of the secrets referenced by a secret placeholder, e.g. [NAME] for ${secrets.NAME}
+func SecretPlaceholderNames(placeholder string) []string {
+	names := make([]string, 0)
+	for _, identifier := range PlaceholderIdentifiers(placeholder) {
+		name, _, _ := strings.Cut(strings.TrimPrefix(identifier, SecretPathPrefix), ".")
+		if !StringInSlice(name, names) {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// Encrypts the secrets of organizations with a server key using AES-256-GCM. Each secret is bound to its organization
+// and name, so that its ciphertext cannot be used as another secret.
+type SecretCipher struct {
+	aead cipher.AEAD
+}
+
+func NewSecretCipher(key []byte) (*SecretCipher, error) {
+	if len(key) != 32 {
+		return nil, ErrInvalidSecretKey
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &SecretCipher{aead: aead}, nil
+}
+
+func (c *SecretCipher) Encrypt(orgId int, name string, plaintext string) ([]byte, error) {
+	nonce := make([]byte, c.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	// The nonce is stored in front of the ciphertext
+	return c.aead.Seal(nonce, nonce, []byte(plaintext), secretAdditionalData(orgId, name)), nil
+}
+
+func (c *SecretCipher) Decrypt(orgId int, name string, ciphertext []byte) (string, error) {
+	nonceSize := c.aead.NonceSize()
+	if len(ciphertext) < nonceSize {
+		return "", ErrInvalidCiphertext
+	}
+	plaintext, err := c.aead.Open(nil, ciphertext[:nonceSize], ciphertext[nonceSize:], secretAdditionalData(orgId, name))
+	if err != nil {
+		return "", ErrInvalidCiphertext
+	}
+	return string(plaintext), nil
+}
+
+func secretAdditionalData(orgId int, name string) []byte {
+	return []byte(fmt.Sprintf("%d/%s", orgId, name))
+}
+
+// Replaces every occurrence of the secrets in the string
+func RedactSecrets(s string, secrets []string) string {
+	for _, secret := range secrets {
+		if secret != "" {
+			s = strings.ReplaceAll(s, secret, RedactedSecret)
+		}
+	}
+	return s
+}
+
+// Replaces every occurrence of the secrets in the strings of the value, including those nested in maps and slices
+func RedactSecretsInValue(value any, secrets []string) any {
+	switch v := value.(type) {
+	case string:
+		return RedactSecrets(v, secrets)
+	case map[string]any:
+		redacted := make(map[string]any, len(v))
+		for key, val := range v {
+			redacted[RedactSecrets(key, secrets)] = RedactSecretsInValue(val, secrets)
+		}
+		return redacted
+	case []any:
+		redacted := make([]any, len(v))
+		for i, val := range v {
+			redacted[i] = RedactSecretsInValue(val, secrets)
+		}
+		return redacted
+	default:
+		return value
+	}
+}
+
+type redactingWriter struct {
+	w       io.Writer
+	secrets []string
+}
+
+// Returns a writer which redacts the secrets before writing to w. Secrets are only redacted if they are written in a
+// single call, as log lines are.
+func NewRedactingWriter(w io.Writer, secrets []string) io.Writer {
+	if len(secrets) == 0 {
+		return w
+	}
+	return &redactingWriter{w: w, secrets: secrets}
+}
+
+func (rw *redactingWriter) Write(p []byte) (int, error) {
+	if _, err := io.WriteString(rw.w, RedactSecrets(string(p), rw.secrets)); err != nil {
+		return 0, err
+	}
+	// Report the length of the original bytes, which have all been written
+	return len(p), nil
+}
@@ -0,0 +1,100 @@
+package helper
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestSecretCipher(t *testing.T) {
+	c, err := NewSecretCipher(bytes.Repeat([]byte{1}, 32))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	ciphertext, err := c.Encrypt(1, "API_TOKEN", "s3cr3t")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if bytes.Contains(ciphertext, []byte("s3cr3t")) {
+		t.Errorf("Expected ciphertext to not contain the plaintext")
+	}
+
+	testCases := []struct {
+		description string
+		orgId       int
+		name        string
+		ciphertext  []byte
+		expected    string
+		err         error
+	}{
+		{"Same organization and name", 1, "API_TOKEN", ciphertext, "s3cr3t", nil},
+		{"Other organization", 2, "API_TOKEN", ciphertext, "", ErrInvalidCiphertext},
+		{"Other name", 1, "OTHER_TOKEN", ciphertext, "", ErrInvalidCiphertext},
+		{"Truncated ciphertext", 1, "API_TOKEN", ciphertext[:4], "", ErrInvalidCiphertext},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			plaintext, err := c.Decrypt(tc.orgId, tc.name, tc.ciphertext)
+			if !errors.Is(err, tc.err) {
+				t.Errorf("Expected error %v, got %v", tc.err, err)
+			}
+			if plaintext != tc.expected {
+				t.Errorf("Expected %q, got %q", tc.expected, plaintext)
+			}
+		})
+	}
+
+	t.Run("Invalid key", func(t *testing.T) {
+		if _, err := NewSecretCipher([]byte("short")); !errors.Is(err, ErrInvalidSecretKey) {
+			t.Errorf("Expected %v, got %v", ErrInvalidSecretKey, err)
+		}
+	})
+}
+
+func TestRedactSecrets(t *testing.T) {
+	secrets := []string{"s3cr3t", ""}
+	output := map[string]any{
+		"body":   map[string]any{"token": "Bearer s3cr3t", "items": []any{"s3cr3t", 1}},
+		"status": 200,
+	}
+	expected := map[string]any{
+		"body":   map[string]any{"token": "Bearer ******", "items": []any{"******", 1}},
+		"status": 200,
+	}
+	if redacted := RedactSecretsInValue(output, secrets); !reflect.DeepEqual(redacted, expected) {
+		t.Errorf("Expected %v, got %v", expected, redacted)
+	}
+
+	var buf bytes.Buffer
+	w := NewRedactingWriter(&buf, secrets)
+	if n, err := w.Write([]byte("Authorization: Bearer s3cr3t\n")); err != nil || n != 29 {
+		t.Errorf("Expected 29 bytes written, got %d and error %v", n, err)
+	}
+	if buf.String() != "Authorization: Bearer ******\n" {
+		t.Errorf("Expected secret to be redacted, got %q", buf.String())
+	}
+}
+
+func TestIsSecretPlaceholder(t *testing.T) {
+	testCases := []struct {
+		placeholder   string
+		expected      bool
+		expectedNames []string
+	}{
+		{"${secrets.API_TOKEN}", true, []string{"API_TOKEN"}},
+		{"${secrets.USER + \":\" + secrets.PASSWORD | base64}", true, []string{"USER", "PASSWORD"}},
+		{"${secrets.API_TOKEN + name}", false, nil},
+		{"${name}", false, nil},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.placeholder, func(t *testing.T) {
+			if isSecret := IsSecretPlaceholder(tc.placeholder); isSecret != tc.expected {
+				t.Errorf("Expected %v, got %v", tc.expected, isSecret)
+			}
+			if names := SecretPlaceholderNames(tc.placeholder); tc.expected && !reflect.DeepEqual(names, tc.expectedNames) {
+				t.Errorf("Expected names %v, got %v", tc.expectedNames, names)
+			}
+		})
+	}
+}
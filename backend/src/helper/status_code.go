@@ -0,0 +1,69 @@
+package helper
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var ErrInvalidStatusCodeRange = errors.New("invalid status code range")
+
+// A range of HTTP status codes, which is written as a status code (200), a class of status codes (2xx) or an inclusive
+// range (200-299)
+type StatusCodeRange struct {
+	Min int
+	Max int
+}
+
+func ParseStatusCodeRange(value any) (StatusCodeRange, error) {
+	var s string
+	switch v := value.(type) {
+	case string:
+		s = strings.TrimSpace(v)
+	case int, int32, int64, float64:
+		s = fmt.Sprint(v)
+	default:
+		return StatusCodeRange{}, fmt.Errorf("%w: %v", ErrInvalidStatusCodeRange, value)
+	}
+
+	var r StatusCodeRange
+	var err error
+	if class, ok := strings.CutSuffix(strings.ToLower(s), "xx"); ok {
+		digit, err := strconv.Atoi(class)
+		if err != nil || len(class) != 1 {
+			return StatusCodeRange{}, fmt.Errorf("%w: %s", ErrInvalidStatusCodeRange, s)
+		}
+		r = StatusCodeRange{Min: digit * 100, Max: digit*100 + 99}
+	} else if min, max, ok := strings.Cut(s, "-"); ok {
+		if r.Min, err = strconv.Atoi(strings.TrimSpace(min)); err != nil {
+			return StatusCodeRange{}, fmt.Errorf("%w: %s", ErrInvalidStatusCodeRange, s)
+		}
+		if r.Max, err = strconv.Atoi(strings.TrimSpace(max)); err != nil {
+			return StatusCodeRange{}, fmt.Errorf("%w: %s", ErrInvalidStatusCodeRange, s)
+		}
+	} else {
+		if r.Min, err = strconv.Atoi(s); err != nil {
+			return StatusCodeRange{}, fmt.Errorf("%w: %s", ErrInvalidStatusCodeRange, s)
+		}
+		r.Max = r.Min
+	}
+	if r.Min < 100 || r.Max > 599 || r.Min > r.Max {
+		return StatusCodeRange{}, fmt.Errorf("%w: %s", ErrInvalidStatusCodeRange, s)
+	}
+	return r, nil
+}
+
+func (r StatusCodeRange) Contains(statusCode int) bool {
+	return statusCode >= r.Min && statusCode <= r.Max
+}
+
+func (r StatusCodeRange) String() string {
+	if r.Min == r.Max {
+		return strconv.Itoa(r.Min)
+	}
+	if r.Min%100 == 0 && r.Max == r.Min+99 {
+		return fmt.Sprintf("%dxx", r.Min/100)
+	}
+	return fmt.Sprintf("%d-%d", r.Min, r.Max)
+}
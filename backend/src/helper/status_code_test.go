@@ -0,0 +1,35 @@
+package helper
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseStatusCodeRange(t *testing.T) {
+	testCases := []struct {
+		description string
+		value       any
+		expected    StatusCodeRange
+		err         error
+	}{
+		{"Status code", "201", StatusCodeRange{201, 201}, nil},
+		{"Number", 204, StatusCodeRange{204, 204}, nil},
+		{"Class", "2xx", StatusCodeRange{200, 299}, nil},
+		{"Range", "200-204", StatusCodeRange{200, 204}, nil},
+		{"Out of bounds", "600", StatusCodeRange{}, ErrInvalidStatusCodeRange},
+		{"Reversed range", "204-200", StatusCodeRange{}, ErrInvalidStatusCodeRange},
+		{"Invalid class", "20xx", StatusCodeRange{}, ErrInvalidStatusCodeRange},
+		{"Invalid type", true, StatusCodeRange{}, ErrInvalidStatusCodeRange},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			r, err := ParseStatusCodeRange(tc.value)
+			if !errors.Is(err, tc.err) {
+				t.Errorf("Expected error %v, got %v", tc.err, err)
+			}
+			if r != tc.expected {
+				t.Errorf("Expected %v, got %v", tc.expected, r)
+			}
+		})
+	}
+}
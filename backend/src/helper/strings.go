@@ -2,94 +2,340 @@ package helper
 
 import (
 	"errors"
+	"fmt"
 	"reflect"
 	"regexp"
-	"strconv"
+	"strings"
 
 	"go.mongodb.org/mongo-driver/bson"
 )
 
 var (
 	ErrPlaceholderNotReplaced               = errors.New("some placeholders were not replaced")
-	ErrInvalidTypeForPlaceholderReplacement = errors.New("placeholder replacement is only supported for strings, slices, and maps")
+	ErrInvalidTypeForPlaceholderReplacement = errors.New("placeholder replacement is only supported for strings, numbers, booleans, slices, and maps")
 )
 
 func ReplacePlaceholdersInString(input string, values map[string]any) (string, error) {
-	// Regular expression to find placeholders
-	re := regexp.MustCompile(`\$\{(.*?)\}`)
-
-	// Replace each placeholder found in the string
-	replaced := re.ReplaceAllStringFunc(input, func(match string) string {
-		// Strip '${' prefix and '}' suffix
-		key := match[2 : len(match)-1]
-
-		// Retrieve value from the map
-		value, exists := values[key]
-		if !exists {
-			// If the key doesn't exist, return an error
-			return match // return the original placeholder
-		}
-
-		if valueType := reflect.TypeOf(value); valueType.Kind() == reflect.String {
-			// If the value is a string, replace placeholder with it
-			return value.(string)
-		} else if valueType.Kind() == reflect.Int {
-			// If the value is an integer, convert it to string and replace placeholder with it
-			return strconv.Itoa(value.(int))
-		} else if valueType.Kind() == reflect.Float64 {
-			// If the value is a float, convert it to string and replace placeholder with it
-			return strconv.FormatFloat(value.(float64), 'f', -1, 64)
-		} else if valueType.Kind() == reflect.Bool {
-			// If the value is a boolean, convert it to string and replace placeholder with it
-			return strconv.FormatBool(value.(bool))
-		} else {
-			return match
-		}
-	})
-
-	// Check if there are any leftover placeholders
-	leftoverPlaceholders := re.FindString(replaced)
-	if leftoverPlaceholders != "" {
+	replaced, unresolved := RenderPlaceholdersInString(input, values)
+	if len(unresolved) > 0 {
 		// If there are leftover placeholders, return an error
 		return "", ErrPlaceholderNotReplaced
 	}
-
 	return replaced, nil
 }
 
+// Replaces the placeholders in the string which have a value, and returns the placeholders which are left in the string
+func RenderPlaceholdersInString(input string, values map[string]any) (string, []string) {
+	return renderPlaceholdersInString(input, values, nil)
+}
+
+func renderPlaceholdersInString(input string, values map[string]any, include func(placeholder string) bool) (string, []string) {
+	var sb strings.Builder
+	last := 0
+	for _, loc := range findPlaceholders(input) {
+		sb.WriteString(input[last:loc[0]])
+		placeholder := input[loc[0]:loc[1]]
+		last = loc[1]
+		if include != nil && !include(placeholder) {
+			sb.WriteString(placeholder)
+			continue
+		}
+		value, ok := evaluatePlaceholder(placeholder, values)
+		if !ok {
+			// return the original placeholder
+			sb.WriteString(placeholder)
+			continue
+		}
+		replaced, ok := FormatScalar(value)
+		if !ok {
+			// Lists and objects cannot be written into a string
+			sb.WriteString(placeholder)
+			continue
+		}
+		sb.WriteString(replaced)
+	}
+	sb.WriteString(input[last:])
+	replaced := sb.String()
+
+	// Check if there are any leftover placeholders, including those in the values
+	return replaced, FindPlaceholders(replaced)
+}
+
+// Returns the value of a placeholder, e.g. ${steps.create_vm.body.id} or ${region | default "us-east-1"}, or false if
+// a value it references is missing or it cannot be evaluated. A key matching the whole placeholder takes precedence
+// over an expression, so that keys such as vm-name are not evaluated as expressions.
+func evaluatePlaceholder(placeholder string, values map[string]any) (any, bool) {
+	key := placeholderKey(placeholder)
+	if value, exists := LookupValue(values, key); exists && value != nil {
+		return value, true
+	}
+	expr, err := ParseExpression(key)
+	if err != nil {
+		return nil, false
+	}
+	value, err := expr.evaluateStrict(values)
+	if err != nil || value == nil {
+		return nil, false
+	}
+	return value, true
+}
+
+// Strips the ${ prefix and } suffix of a placeholder
+func placeholderKey(placeholder string) string {
+	return placeholder[2 : len(placeholder)-1]
+}
+
+// Returns the placeholders of the form ${...} in the string. A } in a quoted string does not end the placeholder, e.g.
+// ${body | default "{}"}.
+func FindPlaceholders(input string) []string {
+	placeholders := make([]string, 0)
+	for _, loc := range findPlaceholders(input) {
+		placeholders = append(placeholders, input[loc[0]:loc[1]])
+	}
+	return placeholders
+}
+
+func findPlaceholders(input string) [][2]int {
+	locs := make([][2]int, 0)
+	for i := 0; i < len(input); {
+		start := strings.Index(input[i:], "${")
+		if start < 0 {
+			break
+		}
+		start += i
+		end := placeholderEnd(input, start+2)
+		if end < 0 {
+			break
+		}
+		locs = append(locs, [2]int{start, end})
+		i = end
+	}
+	return locs
+}
+
+// Returns the index after the } which closes the placeholder whose key starts at the index, or -1 if it is not closed
+func placeholderEnd(input string, i int) int {
+	var quote byte
+	for j := i; j < len(input); j++ {
+		switch c := input[j]; {
+		case quote != 0 && c == '\\':
+			j++
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '}':
+			return j + 1
+		}
+	}
+	if quote != 0 {
+		// Unterminated quotes, e.g. in ${owner's}, do not hide the end of the placeholder
+		if end := strings.IndexByte(input[i:], '}'); end >= 0 {
+			return i + end + 1
+		}
+	}
+	return -1
+}
+
+// Returns the paths of the values referenced by a placeholder, e.g. [region] for ${region | default "us-east-1"}.
+// Placeholders which are not expressions, e.g. ${steps.Raise Ticket.body}, reference their key.
+func PlaceholderIdentifiers(placeholder string) []string {
+	key := placeholderKey(placeholder)
+	if expr, err := ParseExpression(key); err == nil {
+		return expr.Identifiers()
+	}
+	return []string{key}
+}
+
+// The first segment of a key which is not an expression, e.g. vm-name in ${vm-name} or steps in ${steps.create_vm.id}
+var placeholderKeyRootRegex = regexp.MustCompile(`^[A-Za-z0-9_-]+(\[[0-9]+\])*$`)
+
+// Returns true if the key of a placeholder is a path of values rather than an expression, e.g. vm-name or
+// steps.Raise Ticket.status. Segments after the first, such as the names of steps, may contain spaces but do not start
+// or end with them.
+func isPlaceholderPath(key string) bool {
+	if strings.ContainsAny(key, `|()"'+*/%<>=!&,`) {
+		return false
+	}
+	segments := strings.Split(key, ".")
+	if !placeholderKeyRootRegex.MatchString(segments[0]) {
+		return false
+	}
+	for _, segment := range segments[1:] {
+		if segment == "" || strings.TrimSpace(segment) != segment {
+			return false
+		}
+	}
+	return true
+}
+
+// Returns an error if a placeholder in the input is an invalid expression. Placeholders which are paths of values are
+// keys, which may not be valid identifiers, e.g. ${vm-name}. Every other placeholder must be a valid expression, so
+// that e.g. ${region upper} is rejected rather than left unreplaced.
+func ValidatePlaceholders(input any) error {
+	switch v := input.(type) {
+	case string:
+		for _, placeholder := range FindPlaceholders(v) {
+			key := placeholderKey(placeholder)
+			if isPlaceholderPath(key) {
+				continue
+			}
+			if _, err := ParseExpression(key); err != nil {
+				return fmt.Errorf("placeholder %s: %w", placeholder, err)
+			}
+		}
+	case bson.A:
+		return ValidatePlaceholders([]any(v))
+	case []any:
+		for _, elem := range v {
+			if err := ValidatePlaceholders(elem); err != nil {
+				return err
+			}
+		}
+	case map[string]any:
+		for key, value := range v {
+			if err := ValidatePlaceholders(key); err != nil {
+				return err
+			}
+			if err := ValidatePlaceholders(value); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Replaces the placeholders in the input, returning an error if any are left. A string which is a single placeholder is
+// replaced with the value of the placeholder, keeping its type.
 func ReplacePlaceholders(input any, values map[string]any) (any, error) {
-	switch reflect.TypeOf(input).Kind() {
-	case reflect.String:
-		return ReplacePlaceholdersInString(input.(string), values)
-	case reflect.Slice:
+	replaced, unresolved, err := RenderPlaceholders(input, values)
+	if err != nil {
+		return nil, err
+	}
+	if len(unresolved) > 0 {
+		return nil, ErrPlaceholderNotReplaced
+	}
+	return replaced, nil
+}
+
+// Replaces the placeholders which have a value, and returns the placeholders which are left in the output
+func RenderPlaceholders(input any, values map[string]any) (any, []string, error) {
+	return renderPlaceholders(input, values, nil)
+}
+
+// Replaces the placeholders for which include returns true and which have a value, and returns the placeholders which
+// are left in the output. The other placeholders are left to be replaced later, e.g. once more values are known.
+func RenderPlaceholdersIf(input any, values map[string]any, include func(placeholder string) bool) (any, []string, error) {
+	return renderPlaceholders(input, values, include)
+}
+
+// Returns the placeholders in the input without replacing any of them
+func GetPlaceholders(input any) ([]string, error) {
+	_, placeholders, err := renderPlaceholders(input, nil, func(string) bool { return false })
+	return placeholders, err
+}
+
+// Strings are rendered, and the elements of lists and objects are rendered in turn. Numbers, booleans and nulls do not
+// have placeholders, and are returned as is.
+func renderPlaceholders(input any, values map[string]any, include func(placeholder string) bool) (any, []string, error) {
+	switch v := input.(type) {
+	case nil:
+		return nil, []string{}, nil
+	case string:
+		if value, ok := evaluateWholePlaceholder(v, values, include); ok {
+			return value, collectPlaceholders(value), nil
+		}
+		replaced, unresolved := renderPlaceholdersInString(v, values, include)
+		return replaced, unresolved, nil
+	case bson.A:
+		// Slices are decoded from the database as bson.A, and are []any once they have been rendered
+		return renderPlaceholders([]any(v), values, include)
+	case []any:
 		// If the input is a slice, iterate over each element and replace placeholders
-		output := make([]any, 0)
-		for _, elem := range input.(bson.A) {
-			replaced, err := ReplacePlaceholders(elem, values)
+		output := make([]any, 0, len(v))
+		unresolved := make([]string, 0)
+		for _, elem := range v {
+			replaced, elemUnresolved, err := renderPlaceholders(elem, values, include)
 			if err != nil {
-				return nil, err
+				return nil, nil, err
 			}
 			output = append(output, replaced)
+			unresolved = append(unresolved, elemUnresolved...)
 		}
-		return output, nil
-	case reflect.Map:
+		return output, unresolved, nil
+	case bson.M:
+		return renderPlaceholders(map[string]any(v), values, include)
+	case map[string]any:
 		// If the input is a map, iterate over each key and value and replace placeholders
-		output := make(map[string]any)
-		for key, value := range input.(map[string]any) {
-			replacedKey, err := ReplacePlaceholdersInString(key, values)
-			if err != nil {
-				return nil, err
-			}
-			replacedValue, err := ReplacePlaceholders(value, values)
+		output := make(map[string]any, len(v))
+		unresolved := make([]string, 0)
+		for key, value := range v {
+			replacedKey, keyUnresolved := renderPlaceholdersInString(key, values, include)
+			replacedValue, valueUnresolved, err := renderPlaceholders(value, values, include)
 			if err != nil {
-				return nil, err
+				return nil, nil, err
 			}
 			output[replacedKey] = replacedValue
+			unresolved = append(unresolved, keyUnresolved...)
+			unresolved = append(unresolved, valueUnresolved...)
 		}
-		return output, nil
+		return output, unresolved, nil
+	}
+	switch reflect.TypeOf(input).Kind() {
+	case reflect.Bool, reflect.Int, reflect.Int32, reflect.Int64, reflect.Float64:
+		return input, []string{}, nil
 	default:
-		return nil, ErrInvalidTypeForPlaceholderReplacement
+		return nil, nil, ErrInvalidTypeForPlaceholderReplacement
+	}
+}
+
+// Returns the value of the placeholder if the input is a single placeholder, e.g. ${replicas}, whose value is a number,
+// boolean, list or object, so that the value keeps its type rather than being written into a string.
+func evaluateWholePlaceholder(input string, values map[string]any, include func(placeholder string) bool) (any, bool) {
+	locs := findPlaceholders(input)
+	if len(locs) != 1 || locs[0] != [2]int{0, len(input)} {
+		return nil, false
+	}
+	if include != nil && !include(input) {
+		return nil, false
+	}
+	value, ok := evaluatePlaceholder(input, values)
+	if !ok {
+		return nil, false
+	}
+	switch value := normalizeValue(value).(type) {
+	case []any, map[string]any:
+		return value, true
+	case string:
+		// Strings are rendered as part of the input, which also finds the placeholders in them
+		return nil, false
+	default:
+		if _, ok := FormatScalar(value); ok {
+			return value, true
+		}
+		return nil, false
+	}
+}
+
+// Returns the placeholders in the strings of a value, including the keys and values of its lists and objects
+func collectPlaceholders(value any) []string {
+	placeholders := make([]string, 0)
+	switch v := value.(type) {
+	case string:
+		placeholders = append(placeholders, FindPlaceholders(v)...)
+	case []any:
+		for _, elem := range v {
+			placeholders = append(placeholders, collectPlaceholders(elem)...)
+		}
+	case map[string]any:
+		for key, elem := range v {
+			placeholders = append(placeholders, FindPlaceholders(key)...)
+			placeholders = append(placeholders, collectPlaceholders(elem)...)
+		}
 	}
+	return placeholders
 }
 
 func StringSliceEqual(a, b []string) bool {
@@ -1,9 +1,12 @@
 package helper
 
 import (
+	"errors"
+	"reflect"
+	"slices"
 	"testing"
 
-	"github.com/joshtyf/flowforge/src/database/models"
+	"go.mongodb.org/mongo-driver/bson"
 )
 
 func TestStringSliceEqual(t *testing.T) {
@@ -58,14 +61,14 @@ func TestStringInSlice(t *testing.T) {
 
 func TestReplacePlaceholders(t *testing.T) {
 	testCases := []struct {
-		input    string
-		values   models.FormData
-		expected string
+		input    any
+		values   map[string]any
+		expected any
 		err      error
 	}{
 		{
 			"Hello ${name}, you are ${age} years old",
-			models.FormData{
+			map[string]any{
 				"name": "john",
 				"age":  50,
 			},
@@ -74,22 +77,22 @@ func TestReplacePlaceholders(t *testing.T) {
 		},
 		{
 			"Hello ${{name}, you are ${age} years old",
-			models.FormData{
+			map[string]any{
 				"name": "john",
 				"age":  50,
 			},
-			"",
+			nil,
 			ErrPlaceholderNotReplaced,
 		},
 		{
 			"Hello",
-			models.FormData{},
+			map[string]any{},
 			"Hello",
 			nil,
 		},
 		{
 			"This parameter is ${boolean}",
-			models.FormData{
+			map[string]any{
 				"boolean": true,
 			},
 			"This parameter is true",
@@ -97,12 +100,50 @@ func TestReplacePlaceholders(t *testing.T) {
 		},
 		{
 			"The value is ${float}",
-			models.FormData{
+			map[string]any{
 				"float": 3.14,
 			},
 			"The value is 3.14",
 			nil,
 		},
+		{
+			"Created VM ${steps.create_vm.body.id} with status ${steps.create_vm.status}",
+			map[string]any{
+				"steps": map[string]any{
+					"create_vm": map[string]any{
+						"status": int32(200),
+						"body":   map[string]any{"id": "vm-123"},
+					},
+				},
+			},
+			"Created VM vm-123 with status 200",
+			nil,
+		},
+		{
+			"Created VM ${steps.create_vm.body.id}",
+			map[string]any{
+				"steps": map[string]any{},
+			},
+			nil,
+			ErrPlaceholderNotReplaced,
+		},
+		{
+			"${replicas}",
+			map[string]any{
+				"replicas": 3,
+			},
+			3,
+			nil,
+		},
+		{
+			[]any{"${enabled}", "${name}"},
+			map[string]any{
+				"enabled": true,
+				"name":    "john",
+			},
+			[]any{true, "john"},
+			nil,
+		},
 	}
 
 	for _, tc := range testCases {
@@ -110,8 +151,194 @@ func TestReplacePlaceholders(t *testing.T) {
 		if tc.err != err {
 			t.Errorf("Expected: %v, Got: %v", tc.err, err)
 		}
-		if replaced != tc.expected {
+		if !reflect.DeepEqual(replaced, tc.expected) {
 			t.Errorf("Expected: %v, Got: %v", tc.expected, replaced)
 		}
 	}
 }
+
+func TestRenderPlaceholders(t *testing.T) {
+	testCases := []struct {
+		description        string
+		input              any
+		values             map[string]any
+		expected           any
+		expectedUnresolved []string
+		err                error
+	}{
+		{
+			"Placeholders in string",
+			"Hello ${name}, your VM is ${steps.create_vm.body.id}",
+			map[string]any{"name": "john"},
+			"Hello john, your VM is ${steps.create_vm.body.id}",
+			[]string{"${steps.create_vm.body.id}"},
+			nil,
+		},
+		{
+			"Placeholders in slice and map",
+			map[string]any{"args": bson.A{"${name}", "${missing}"}},
+			map[string]any{"name": "john"},
+			map[string]any{"args": []any{"john", "${missing}"}},
+			[]string{"${missing}"},
+			nil,
+		},
+		{
+			"Placeholders in rendered slice",
+			[]any{"${name}"},
+			map[string]any{"name": "john"},
+			[]any{"john"},
+			[]string{},
+			nil,
+		},
+		{
+			"Expressions in placeholders",
+			"${form.owner.email | lower}-${region | default \"us-east-1\"}-${replicas * 2}",
+			map[string]any{"form": map[string]any{"owner": map[string]any{"email": "John@example.com"}}, "replicas": 2},
+			"john@example.com-us-east-1-4",
+			[]string{},
+			nil,
+		},
+		{
+			"Expressions with missing values",
+			"${steps.create_vm.body.id | upper} ${name | default \"{}\"}",
+			map[string]any{},
+			"${steps.create_vm.body.id | upper} {}",
+			[]string{"${steps.create_vm.body.id | upper}"},
+			nil,
+		},
+		{
+			"Keys which are not expressions",
+			"${vm-name} ${steps.Raise Ticket.status}",
+			map[string]any{"vm-name": "vm-1", "steps": map[string]any{"Raise Ticket": map[string]any{"status": "done"}}},
+			"vm-1 done",
+			[]string{},
+			nil,
+		},
+		{
+			"Whole-value placeholders keep their type",
+			map[string]any{
+				"replicas": "${replicas}",
+				"ratio":    "${replicas / 2}",
+				"enabled":  "${enabled}",
+				"regions":  "${regions}",
+				"owner":    "${owner}",
+				"name":     "vm-${replicas}",
+			},
+			map[string]any{
+				"replicas": int32(3),
+				"enabled":  false,
+				"regions":  bson.A{"us-east-1", "eu-west-1"},
+				"owner":    bson.D{{Key: "email", Value: "john@example.com"}},
+			},
+			map[string]any{
+				"replicas": int32(3),
+				"ratio":    1.5,
+				"enabled":  false,
+				"regions":  []any{"us-east-1", "eu-west-1"},
+				"owner":    map[string]any{"email": "john@example.com"},
+				"name":     "vm-3",
+			},
+			[]string{},
+			nil,
+		},
+		{
+			"Placeholders in the value of a whole-value placeholder",
+			"${tags}",
+			map[string]any{"tags": []any{"${secrets.TOKEN}"}},
+			[]any{"${secrets.TOKEN}"},
+			[]string{"${secrets.TOKEN}"},
+			nil,
+		},
+		{
+			"Numbers, booleans and nulls",
+			map[string]any{"count": 1, "ratio": 0.5, "enabled": true, "owner": nil},
+			map[string]any{},
+			map[string]any{"count": 1, "ratio": 0.5, "enabled": true, "owner": nil},
+			[]string{},
+			nil,
+		},
+		{
+			"Invalid type",
+			map[string]any{"count": uint8(1)},
+			map[string]any{},
+			nil,
+			nil,
+			ErrInvalidTypeForPlaceholderReplacement,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			rendered, unresolved, err := RenderPlaceholders(tc.input, tc.values)
+			if err != tc.err {
+				t.Errorf("Expected error %v, got %v", tc.err, err)
+			}
+			if !reflect.DeepEqual(rendered, tc.expected) {
+				t.Errorf("Expected %v, got %v", tc.expected, rendered)
+			}
+			if !slices.Equal(unresolved, tc.expectedUnresolved) {
+				t.Errorf("Expected unresolved placeholders %v, got %v", tc.expectedUnresolved, unresolved)
+			}
+		})
+	}
+}
+
+func TestRenderPlaceholdersIf(t *testing.T) {
+	rendered, unresolved, err := RenderPlaceholdersIf(
+		"${vars.base_url}/${name | default \"vm\"}",
+		map[string]any{"vars": map[string]any{"base_url": "https://example.com"}},
+		func(placeholder string) bool { return placeholder == "${vars.base_url}" },
+	)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if expected := "https://example.com/${name | default \"vm\"}"; rendered != expected {
+		t.Errorf("Expected %s, got %v", expected, rendered)
+	}
+	if !slices.Equal(unresolved, []string{"${name | default \"vm\"}"}) {
+		t.Errorf("Expected the excluded placeholder to be unresolved, got %v", unresolved)
+	}
+}
+
+func TestPlaceholderIdentifiers(t *testing.T) {
+	testCases := []struct {
+		placeholder string
+		expected    []string
+	}{
+		{"${name}", []string{"name"}},
+		{"${owner.email | default fallback}", []string{"owner.email", "fallback"}},
+		{"${join(regions, \", \")}", []string{"regions"}},
+		{"${steps.Raise Ticket.status}", []string{"steps.Raise Ticket.status"}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.placeholder, func(t *testing.T) {
+			if identifiers := PlaceholderIdentifiers(tc.placeholder); !slices.Equal(identifiers, tc.expected) {
+				t.Errorf("Expected %v, got %v", tc.expected, identifiers)
+			}
+		})
+	}
+}
+
+func TestValidatePlaceholders(t *testing.T) {
+	testCases := []struct {
+		description string
+		input       any
+		err         error
+	}{
+		{"Valid expressions", map[string]any{"url": "${base_url | trim}/${id}", "args": bson.A{"${replicas + 1}"}}, nil},
+		{"Keys which are not expressions", "${vm-name} ${steps.Raise Ticket.status}", nil},
+		{"Unknown filter", "${name | capitalize}", ErrInvalidExpression},
+		{"Invalid expression in list", bson.A{"${replicas +}"}, ErrInvalidExpression},
+		{"Invalid expression in key", map[string]any{"${name | default}": "value"}, ErrInvalidExpression},
+		{"Indexed keys", "${steps.list_vms.body[0]} ${form.disks[1].size}", nil},
+		{"Expression with spaces", "${ form.name }", nil},
+		{"Incomplete expression without operators", "${replicas -}", ErrInvalidExpression},
+		{"Missing pipe", "${region upper}", ErrInvalidExpression},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			if err := ValidatePlaceholders(tc.input); !errors.Is(err, tc.err) {
+				t.Errorf("Expected error %v, got %v", tc.err, err)
+			}
+		})
+	}
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"database/sql"
+	"encoding/base64"
 	"fmt"
 	"log"
 	"net/http"
@@ -12,18 +13,57 @@ import (
 	"time"
 
 	"github.com/gorilla/mux"
+	"github.com/joshtyf/flowforge/src/database"
 	"github.com/joshtyf/flowforge/src/database/client"
+	"github.com/joshtyf/flowforge/src/events"
 	"github.com/joshtyf/flowforge/src/execute"
+	"github.com/joshtyf/flowforge/src/helper"
 	"github.com/joshtyf/flowforge/src/logger"
+	"github.com/joshtyf/flowforge/src/scheduler"
 	"github.com/joshtyf/flowforge/src/server"
 	"go.mongodb.org/mongo-driver/mongo"
 )
 
 const (
 	SERVER_SHUTDOWN_GRACE_PERIOD = 10 * time.Second
+	SCRIPT_WORK_DIR              = "./script_workdir"
+	DEFAULT_CALLBACK_BASE_URL    = "http://localhost:8080"
 )
 
-func gracefulShutdown(logger logger.ServerLogger, svr *http.Server, psqlClient *sql.DB, mongoClient *mongo.Client) func(string) {
+func getCallbackSigner() *helper.CallbackSigner {
+	baseUrl := os.Getenv("CALLBACK_BASE_URL")
+	if baseUrl == "" {
+		baseUrl = DEFAULT_CALLBACK_BASE_URL
+	}
+	secret := []byte(os.Getenv("CALLBACK_SECRET"))
+	if len(secret) == 0 {
+		// A random secret is not used as callback tokens would no longer be valid once the server restarts, or on other
+		// instances of the backend
+		panic(fmt.Errorf("CALLBACK_SECRET must be set"))
+	}
+	return helper.NewCallbackSigner(baseUrl, secret)
+}
+
+// Returns the cipher of the secrets of organizations, or nil if SECRETS_KEY is not set, in which case secrets cannot be
+// used. A random key is not used as the secrets could no longer be decrypted once the server restarts.
+func getSecretCipher(logger logger.ServerLogger) *helper.SecretCipher {
+	encodedKey := os.Getenv("SECRETS_KEY")
+	if encodedKey == "" {
+		logger.Warn("SECRETS_KEY is not set, secrets cannot be used")
+		return nil
+	}
+	key, err := base64.StdEncoding.DecodeString(encodedKey)
+	if err != nil {
+		panic(fmt.Errorf("SECRETS_KEY must be base64 encoded: %w", err))
+	}
+	secretCipher, err := helper.NewSecretCipher(key)
+	if err != nil {
+		panic(err)
+	}
+	return secretCipher
+}
+
+func gracefulShutdown(logger logger.ServerLogger, svr *http.Server, srm *execute.ExecutionManager, sch *scheduler.Scheduler, psqlClient *sql.DB, mongoClient *mongo.Client) func(string) {
 	shutdownHandler := func(reason string) {
 		logger.Info(fmt.Sprintf("shutting down server: %s", reason))
 		ctx, cancel := context.WithTimeout(context.Background(), SERVER_SHUTDOWN_GRACE_PERIOD)
@@ -32,6 +72,9 @@ func gracefulShutdown(logger logger.ServerLogger, svr *http.Server, psqlClient *
 			log.Println("Error Gracefully Shutting Down API:", err)
 		}
 
+		srm.Stop()
+		sch.Stop()
+
 		if err := psqlClient.Close(); err != nil {
 			log.Println("Error Gracefully Shutting Down PSQL Client:", err)
 		}
@@ -56,26 +99,48 @@ func main() {
 	if err != nil {
 		panic(err)
 	}
+	if err := database.NewServiceRequestStep(mongoClient).CreateIndexes(); err != nil {
+		panic(err)
+	}
+	// Events are shared between the server and the Step Execution Manager through the job queue
+	queue := events.NewPostgresQueue(psqlClient, logger)
+	callbackSigner := getCallbackSigner()
+	secretCipher := getSecretCipher(logger)
+
 	// Start the Step Execution Manager
 	srm, err := execute.NewStepExecutionManager(
 		mongoClient,
 		psqlClient,
 		logger,
+		execute.WithQueue(queue),
+		execute.WithCallbackSigner(callbackSigner),
+		execute.WithSecretCipher(secretCipher),
 		execute.WithStepExecutor(execute.NewApiStepExecutor()),
 		execute.WithStepExecutor(execute.NewWaitForApprovalStepExecutor(mongoClient)),
+		execute.WithStepExecutor(execute.NewBranchStepExecutor()),
+		execute.WithStepExecutor(execute.NewScriptStepExecutor(SCRIPT_WORK_DIR)),
+		execute.WithStepExecutor(execute.NewWaitForCallbackStepExecutor(mongoClient)),
+		execute.WithStepExecutor(execute.NewPipelineStepExecutor(mongoClient, psqlClient, queue)),
 	)
 	if err != nil {
 		panic(err)
 	}
 	srm.Start()
 
+	// Start the scheduler which starts the service requests of schedules when they are due
+	sch := scheduler.NewScheduler(mongoClient, psqlClient, queue, logger)
+	sch.Start()
+
 	// Create the server
 	config := &server.ServerConfig{
-		Address:      ":8080",
-		Router:       mux.NewRouter(),
-		PsqlClient:   psqlClient,
-		MongoClient:  mongoClient,
-		ServerLogger: logger,
+		Address:        ":8080",
+		Router:         mux.NewRouter(),
+		PsqlClient:     psqlClient,
+		MongoClient:    mongoClient,
+		Queue:          queue,
+		CallbackSigner: callbackSigner,
+		SecretCipher:   secretCipher,
+		ServerLogger:   logger,
 	}
 	svr := server.New(config)
 
@@ -92,8 +157,8 @@ func main() {
 	// Block until a signal is received or the server stops
 	select {
 	case err := <-srvErrs:
-		gracefulShutdown(logger, &svr, psqlClient, mongoClient)(err.Error())
+		gracefulShutdown(logger, &svr, srm, sch, psqlClient, mongoClient)(err.Error())
 	case <-done:
-		gracefulShutdown(logger, &svr, psqlClient, mongoClient)("received shutdown signal")
+		gracefulShutdown(logger, &svr, srm, sch, psqlClient, mongoClient)("received shutdown signal")
 	}
 }
@@ -0,0 +1,169 @@
+package scheduler
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/joshtyf/flowforge/src/database"
+	"github.com/joshtyf/flowforge/src/database/models"
+	"github.com/joshtyf/flowforge/src/events"
+	"github.com/joshtyf/flowforge/src/helper"
+	"github.com/joshtyf/flowforge/src/logger"
+	"github.com/joshtyf/flowforge/src/servicerequest"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	pollInterval = 15 * time.Second
+	// A run which is started later than this after it was due, e.g. because the server was down, is a missed run
+	missedRunGracePeriod = time.Minute
+)
+
+var ErrScheduleNeverRuns = errors.New("schedule never runs")
+
+// Returns the first run of a schedule after t, which is evaluated in the time zone of the schedule
+func NextRunAt(cronExpression string, timeZone string, t time.Time) (time.Time, error) {
+	cron, err := helper.ParseCron(cronExpression)
+	if err != nil {
+		return time.Time{}, err
+	}
+	loc, err := time.LoadLocation(timeZone)
+	if err != nil {
+		return time.Time{}, err
+	}
+	next := cron.Next(t.In(loc))
+	if next.IsZero() {
+		return time.Time{}, ErrScheduleNeverRuns
+	}
+	return next, nil
+}
+
+// Creates and starts the service requests of schedules when they are due. Every backend instance can run a scheduler,
+// as each run of a schedule is started by only one of them.
+type Scheduler struct {
+	logger      logger.ServerLogger
+	mongoClient *mongo.Client
+	psqlClient  *sql.DB
+	queue       events.Queue
+	stop        context.CancelFunc
+}
+
+func NewScheduler(mongoClient *mongo.Client, psqlClient *sql.DB, queue events.Queue, logger logger.ServerLogger) *Scheduler {
+	return &Scheduler{
+		logger:      logger,
+		mongoClient: mongoClient,
+		psqlClient:  psqlClient,
+		queue:       queue,
+	}
+}
+
+// Starts checking for due schedules in the background. Schedules which were due while no scheduler was running are
+// handled according to their missed run policy.
+func (s *Scheduler) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	s.stop = cancel
+	go func() {
+		ticker := time.NewTicker(pollInterval)
+		defer ticker.Stop()
+		for {
+			s.runDueSchedules(time.Now())
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+func (s *Scheduler) Stop() {
+	if s.stop != nil {
+		s.stop()
+	}
+}
+
+func (s *Scheduler) runDueSchedules(now time.Time) {
+	schedules, err := database.NewSchedule(s.psqlClient).GetAllDue(now)
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("unable to get due schedules: %s", err))
+		return
+	}
+	for _, schedule := range schedules {
+		if err := s.runSchedule(schedule.ScheduleId, now); err != nil {
+			s.logger.Error(fmt.Sprintf("unable to run schedule %d: %s", schedule.ScheduleId, err))
+		}
+	}
+}
+
+func (s *Scheduler) runSchedule(scheduleId int, now time.Time) error {
+	release, err := database.NewLock(s.psqlClient).Acquire(fmt.Sprintf("schedule/%d", scheduleId))
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	// Another scheduler may have run the schedule, or it may have been changed, while waiting for the lock
+	scheduleDAO := database.NewSchedule(s.psqlClient)
+	schedule, err := scheduleDAO.GetById(scheduleId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if !schedule.Enabled || schedule.NextRunAt.After(now) {
+		return nil
+	}
+
+	// Runs which were missed are not caught up one by one, so the next run is always in the future
+	nextRunAt, err := NextRunAt(schedule.CronExpression, schedule.TimeZone, now)
+	if err != nil {
+		return err
+	}
+	if now.Sub(schedule.NextRunAt) > missedRunGracePeriod && schedule.MissedRunPolicy != models.RunOnceMissedRuns {
+		s.logger.Info(fmt.Sprintf("skipping missed run of schedule %d which was due at %s", scheduleId, schedule.NextRunAt))
+		return scheduleDAO.UpdateNextRunAt(scheduleId, nextRunAt)
+	}
+
+	srm, err := s.startServiceRequest(schedule)
+	if err != nil {
+		// The run is not retried, so that a schedule which cannot start does not start service requests repeatedly
+		if err := scheduleDAO.UpdateNextRunAt(scheduleId, nextRunAt); err != nil {
+			s.logger.Error(fmt.Sprintf("unable to update next run of schedule %d: %s", scheduleId, err))
+		}
+		return err
+	}
+	s.logger.Info(fmt.Sprintf("schedule %d started service request %s", scheduleId, srm.Id.Hex()))
+	return scheduleDAO.UpdateRun(scheduleId, nextRunAt, now, srm.Id.Hex())
+}
+
+// Creates and starts a service request of the pipeline of the schedule on behalf of its owner
+func (s *Scheduler) startServiceRequest(schedule *models.ScheduleModel) (*models.ServiceRequestModel, error) {
+	// Service requests are not created for owners who have left the organization
+	if _, err := database.NewMembership(s.psqlClient).GetMembershipByUserAndOrgId(schedule.UserId, schedule.OrganizationId); err != nil {
+		return nil, fmt.Errorf("unable to get membership of owner %s: %w", schedule.UserId, err)
+	}
+	pipeline, err := database.NewPipeline(s.mongoClient).GetById(schedule.PipelineId)
+	if err != nil {
+		return nil, err
+	}
+	if pipeline.OrganizationId != schedule.OrganizationId {
+		return nil, fmt.Errorf("pipeline %s does not belong to organization %d", schedule.PipelineId, schedule.OrganizationId)
+	}
+	srm := &models.ServiceRequestModel{
+		UserId:         schedule.UserId,
+		OrganizationId: schedule.OrganizationId,
+		FormData:       schedule.FormData,
+		ScheduleId:     schedule.ScheduleId,
+		Environment:    schedule.Environment,
+	}
+	if err := servicerequest.Create(s.mongoClient, s.psqlClient, srm, pipeline); err != nil {
+		return nil, err
+	}
+	if err := servicerequest.Start(s.queue, srm); err != nil {
+		return nil, err
+	}
+	return srm, nil
+}
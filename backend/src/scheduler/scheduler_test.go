@@ -0,0 +1,42 @@
+package scheduler
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/joshtyf/flowforge/src/helper"
+)
+
+func TestNextRunAt(t *testing.T) {
+	from := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	testCases := []struct {
+		description    string
+		cronExpression string
+		timeZone       string
+		expected       time.Time
+		expectedErr    error
+	}{
+		{"UTC", "0 9 * * *", "UTC", time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC), nil},
+		{"Time zone of the schedule", "0 9 * * *", "Asia/Singapore", time.Date(2024, 3, 1, 1, 0, 0, 0, time.UTC), nil},
+		{"Invalid cron expression", "0 25 * * *", "UTC", time.Time{}, helper.ErrInvalidCronExpression},
+		{"Never runs", "0 0 31 2 *", "UTC", time.Time{}, ErrScheduleNeverRuns},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			next, err := NextRunAt(tc.cronExpression, tc.timeZone, from)
+			if !errors.Is(err, tc.expectedErr) {
+				t.Errorf("Expected error %v, got %v", tc.expectedErr, err)
+			}
+			if !next.Equal(tc.expected) {
+				t.Errorf("Expected %v, got %v", tc.expected, next)
+			}
+		})
+	}
+
+	t.Run("Invalid time zone", func(t *testing.T) {
+		if _, err := NextRunAt("0 9 * * *", "Mars/Olympus_Mons", from); err == nil {
+			t.Errorf("Expected error for invalid time zone, got nil")
+		}
+	})
+}
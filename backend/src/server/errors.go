@@ -11,12 +11,28 @@ var (
 	ErrPipelineCreateFail = errors.New("failed to create pipeline")
 	ErrInvalidPipelineId  = errors.New("invalid pipeline id")
 
+	ErrInvalidScheduleId  = errors.New("invalid schedule id")
+	ErrInvalidSchedule    = errors.New("invalid schedule")
+	ErrScheduleCreateFail = errors.New("failed to create schedule")
+	ErrScheduleUpdateFail = errors.New("failed to update schedule")
+	ErrScheduleDeleteFail = errors.New("failed to delete schedule")
+
 	ErrInvalidServiceRequestId        = errors.New("invalid service request id")
 	ErrInvalidServiceRequestStatus    = errors.New("invalid service request status")
+	ErrInvalidEnvironment             = errors.New("invalid environment: the environment is not defined by the pipeline")
 	ErrServiceRequestNotStarted       = errors.New("service request not started")
 	ErrServiceRequestAlreadyStarted   = errors.New("service request already started")
 	ErrServiceRequestAlreadyCompleted = errors.New("service request already completed")
 	ErrFailedToApproveServiceRequest  = errors.New("failed to approve service request")
+	ErrFailedToRetryStep              = errors.New("failed to retry step: service request and step must have failed")
+	ErrServiceRequestCompensated      = errors.New("failed to retry step: steps of the service request have been compensated")
+	ErrInvalidStepName                = errors.New("invalid step name")
+	ErrInvalidCallbackToken           = errors.New("invalid callback token")
+	ErrCallbackNotExpected            = errors.New("step is not waiting for a callback")
+	ErrCallbackAlreadyReceived        = errors.New("callback already received")
+	ErrNotEligibleApprover            = errors.New("user is not an approver of the step")
+	ErrAlreadyApproved                = errors.New("step has already been approved by the user")
+	ErrApprovalStepRequired           = errors.New("step_name is required: service request is waiting on several approval steps")
 
 	ErrUnableToValidateJWT = errors.New("unable to validate JWT")
 	ErrUnauthorised        = errors.New("user does not have required permissions")
@@ -30,6 +46,23 @@ var (
 	ErrOrganizationDeleteFail = errors.New("failed to delete organization")
 	ErrInvalidOrganizationId  = errors.New("invalid organization id")
 
+	ErrInvalidSecretName = errors.New("invalid secret name: must start with a letter or underscore and contain only letters, digits and underscores")
+	ErrSecretNotFound    = errors.New("secret not found")
+	ErrSecretRetrieve    = errors.New("failed to retrieve secrets")
+	ErrSecretUpdateFail  = errors.New("failed to set secret")
+	ErrSecretDeleteFail  = errors.New("failed to delete secret")
+
+	ErrInvalidAgentName      = errors.New("invalid agent name")
+	ErrInvalidAgentId        = errors.New("invalid agent id")
+	ErrAgentNotFound         = errors.New("agent not found")
+	ErrAgentRetrieve         = errors.New("failed to retrieve agents")
+	ErrAgentCreateFail       = errors.New("failed to create agent")
+	ErrAgentDeleteFail       = errors.New("failed to delete agent")
+	ErrInvalidAgentToken     = errors.New("invalid agent token")
+	ErrInvalidAgentStepTypes = errors.New("invalid step types: agents must run at least one step type")
+	ErrInvalidAgentTaskId    = errors.New("invalid agent task id")
+	ErrAgentTaskNotClaimed   = errors.New("task is not claimed by the agent")
+
 	ErrMembershipCreateFail  = errors.New("failed to create membership")
 	ErrMembershipUpdateFail  = errors.New("failed to update membership")
 	ErrMembershipDeleteFail  = errors.New("failed to delete membership")
@@ -11,13 +11,15 @@ import (
 
 	jwtmiddleware "github.com/auth0/go-jwt-middleware/v2"
 	"github.com/auth0/go-jwt-middleware/v2/validator"
-	"github.com/gookit/event"
 	"github.com/gorilla/mux"
 	"github.com/joshtyf/flowforge/src/database"
 	"github.com/joshtyf/flowforge/src/database/models"
 	"github.com/joshtyf/flowforge/src/events"
+	"github.com/joshtyf/flowforge/src/execute"
 	"github.com/joshtyf/flowforge/src/helper"
 	"github.com/joshtyf/flowforge/src/logger"
+	"github.com/joshtyf/flowforge/src/scheduler"
+	"github.com/joshtyf/flowforge/src/servicerequest"
 	"github.com/joshtyf/flowforge/src/util"
 	"github.com/joshtyf/flowforge/src/validation"
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -34,16 +36,22 @@ func newHandlerError(err error, code int) *HandlerError {
 }
 
 type ServerHandler struct {
-	logger      logger.ServerLogger
-	psqlClient  *sql.DB
-	mongoClient *mongo.Client
+	logger         logger.ServerLogger
+	psqlClient     *sql.DB
+	mongoClient    *mongo.Client
+	queue          events.Queue
+	callbackSigner *helper.CallbackSigner
+	secretCipher   *helper.SecretCipher
 }
 
-func NewServerHandler(psqlClient *sql.DB, mongoCLient *mongo.Client, logger logger.ServerLogger) *ServerHandler {
+func NewServerHandler(psqlClient *sql.DB, mongoCLient *mongo.Client, queue events.Queue, callbackSigner *helper.CallbackSigner, secretCipher *helper.SecretCipher, logger logger.ServerLogger) *ServerHandler {
 	return &ServerHandler{
-		psqlClient:  psqlClient,
-		mongoClient: mongoCLient,
-		logger:      logger,
+		psqlClient:     psqlClient,
+		mongoClient:    mongoCLient,
+		queue:          queue,
+		callbackSigner: callbackSigner,
+		secretCipher:   secretCipher,
+		logger:         logger,
 	}
 }
 
@@ -56,11 +64,15 @@ func (s *ServerHandler) registerRoutes(r *mux.Router) {
 	r.Handle("/api/service_request/admin", isAuthenticated(getOrgIdFromQuery(isOrgAdmin(s.psqlClient, handleGetServiceRequestsForAdminByOrganization(s.logger, s.mongoClient), s.logger), s.logger), s.logger)).Methods("GET")
 	r.Handle("/api/service_request/{requestId}", isAuthenticated(getOrgIdUsingSrId(s.mongoClient, isOrgMember(s.psqlClient, handleGetServiceRequest(s.logger, s.mongoClient, s.psqlClient), s.logger), s.logger), s.logger)).Methods("GET")
 	r.Handle("/api/service_request", isAuthenticated(getOrgIdFromRequestBody(isOrgMember(s.psqlClient, handleCreateServiceRequest(s.logger, s.mongoClient, s.psqlClient), s.logger), s.logger), s.logger)).Methods("POST").Headers("Content-Type", "application/json")
+	r.Handle("/api/service_request/render", isAuthenticated(getOrgIdFromRequestBody(isOrgMember(s.psqlClient, handleRenderServiceRequest(s.logger, s.mongoClient), s.logger), s.logger), s.logger)).Methods("POST").Headers("Content-Type", "application/json")
 	r.Handle("/api/service_request/{requestId}", isAuthenticated(getOrgIdFromRequestBody(isOrgMember(s.psqlClient, handleUpdateServiceRequest(s.logger, s.mongoClient), s.logger), s.logger), s.logger)).Methods("PATCH").Headers("Content-Type", "application/json")
-	r.Handle("/api/service_request/{requestId}/cancel", isAuthenticated(getOrgIdUsingSrId(s.mongoClient, isOrgMember(s.psqlClient, handleCancelServiceRequest(s.logger, s.mongoClient, s.psqlClient), s.logger), s.logger), s.logger)).Methods("PUT")
-	r.Handle("/api/service_request/{requestId}/start", isAuthenticated(getOrgIdUsingSrId(s.mongoClient, isOrgMember(s.psqlClient, handleStartServiceRequest(s.logger, s.mongoClient), s.logger), s.logger), s.logger)).Methods("PUT")
-	r.Handle("/api/service_request/{requestId}/approve", isAuthenticated(getOrgIdUsingSrId(s.mongoClient, isOrgAdmin(s.psqlClient, handleApproveServiceRequest(s.logger, s.mongoClient, s.psqlClient), s.logger), s.logger), s.logger)).Methods("PUT")
-	r.Handle("/api/service_request/{requestId}/reject", isAuthenticated(getOrgIdUsingSrId(s.mongoClient, isOrgAdmin(s.psqlClient, handleRejectServiceRequest(s.logger, s.mongoClient, s.psqlClient), s.logger), s.logger), s.logger)).Methods("PUT")
+	r.Handle("/api/service_request/{requestId}/cancel", isAuthenticated(getOrgIdUsingSrId(s.mongoClient, isOrgMember(s.psqlClient, handleCancelServiceRequest(s.logger, s.mongoClient, s.psqlClient, s.queue), s.logger), s.logger), s.logger)).Methods("PUT")
+	r.Handle("/api/service_request/{requestId}/start", isAuthenticated(getOrgIdUsingSrId(s.mongoClient, isOrgMember(s.psqlClient, handleStartServiceRequest(s.logger, s.mongoClient, s.queue), s.logger), s.logger), s.logger)).Methods("PUT")
+	r.Handle("/api/service_request/{requestId}/approve", isAuthenticated(getOrgIdUsingSrId(s.mongoClient, isOrgMember(s.psqlClient, handleApproveServiceRequest(s.logger, s.mongoClient, s.psqlClient, s.queue), s.logger), s.logger), s.logger)).Methods("PUT")
+	r.Handle("/api/service_request/{requestId}/approvals", isAuthenticated(getOrgIdUsingSrId(s.mongoClient, isOrgMember(s.psqlClient, handleGetServiceRequestApprovals(s.logger, s.psqlClient), s.logger), s.logger), s.logger)).Methods("GET")
+	r.Handle("/api/service_request/{requestId}/steps/{stepName}/retry", isAuthenticated(getOrgIdUsingSrId(s.mongoClient, isOrgAdmin(s.psqlClient, handleRetryServiceRequestStep(s.logger, s.mongoClient, s.psqlClient, s.queue), s.logger), s.logger), s.logger)).Methods("PUT")
+	r.Handle("/api/service_request/{requestId}/steps/{stepName}/callback", handleServiceRequestCallback(s.logger, s.mongoClient, s.psqlClient, s.queue, s.callbackSigner)).Methods("POST")
+	r.Handle("/api/service_request/{requestId}/reject", isAuthenticated(getOrgIdUsingSrId(s.mongoClient, isOrgMember(s.psqlClient, handleRejectServiceRequest(s.logger, s.mongoClient, s.psqlClient, s.queue), s.logger), s.logger), s.logger)).Methods("PUT")
 	r.Handle("/api/service_request/{requestId}/logs/{stepName}", isAuthenticated(getOrgIdUsingSrId(s.mongoClient, isOrgMember(s.psqlClient, handleGetStepExecutionLogs(s.logger, s.psqlClient), s.logger), s.logger), s.logger)).Methods("GET")
 	r.Handle("/api/service_request/{requestId}/steps", isAuthenticated(getOrgIdUsingSrId(s.mongoClient, isOrgMember(s.psqlClient, handleGetServiceRequestStepDetails(s.logger, s.mongoClient, s.psqlClient), s.logger), s.logger), s.logger)).Methods("GET")
 
@@ -68,6 +80,11 @@ func (s *ServerHandler) registerRoutes(r *mux.Router) {
 	r.Handle("/api/pipeline", isAuthenticated(getOrgIdFromQuery(isOrgMember(s.psqlClient, handleGetAllPipelines(s.logger, s.mongoClient), s.logger), s.logger), s.logger)).Methods("GET")
 	r.Handle("/api/pipeline/{pipelineId}", isAuthenticated(getOrgIdFromQuery(isOrgMember(s.psqlClient, handleGetPipeline(s.logger, s.mongoClient), s.logger), s.logger), s.logger)).Methods("GET")
 	r.Handle("/api/pipeline", isAuthenticated(getOrgIdFromRequestBody(isOrgAdmin(s.psqlClient, validateCreatePipelineRequest(handleCreatePipeline(s.logger, s.mongoClient), s.logger), s.logger), s.logger), s.logger)).Methods("POST").Headers("Content-Type", "application/json")
+	r.Handle("/api/pipeline/{pipelineId}/schedules", isAuthenticated(getOrgIdFromQuery(isOrgMember(s.psqlClient, handleGetPipelineSchedules(s.logger, s.psqlClient), s.logger), s.logger), s.logger)).Methods("GET")
+	r.Handle("/api/pipeline/{pipelineId}/schedules", isAuthenticated(getOrgIdFromRequestBody(isOrgAdmin(s.psqlClient, handleCreatePipelineSchedule(s.logger, s.mongoClient, s.psqlClient), s.logger), s.logger), s.logger)).Methods("POST").Headers("Content-Type", "application/json")
+	r.Handle("/api/pipeline/{pipelineId}/schedules/{scheduleId}", isAuthenticated(getOrgIdFromQuery(isOrgMember(s.psqlClient, handleGetPipelineSchedule(s.logger, s.psqlClient), s.logger), s.logger), s.logger)).Methods("GET")
+	r.Handle("/api/pipeline/{pipelineId}/schedules/{scheduleId}", isAuthenticated(getOrgIdFromRequestBody(isOrgAdmin(s.psqlClient, handleUpdatePipelineSchedule(s.logger, s.mongoClient, s.psqlClient), s.logger), s.logger), s.logger)).Methods("PATCH").Headers("Content-Type", "application/json")
+	r.Handle("/api/pipeline/{pipelineId}/schedules/{scheduleId}", isAuthenticated(getOrgIdFromQuery(isOrgAdmin(s.psqlClient, handleDeletePipelineSchedule(s.logger, s.psqlClient), s.logger), s.logger), s.logger)).Methods("DELETE")
 
 	// User
 	r.Handle("/api/user", isAuthenticated(handleGetAllUsers(s.logger, s.psqlClient), s.logger)).Methods("GET")
@@ -82,6 +99,18 @@ func (s *ServerHandler) registerRoutes(r *mux.Router) {
 	r.Handle("/api/organization", isAuthenticated(getOrgIdFromRequestBody(isOrgOwner(s.psqlClient, handleDeleteOrganization(s.logger, s.psqlClient), s.logger), s.logger), s.logger)).Methods("DELETE").Headers("Content-Type", "application/json")
 	r.Handle("/api/organization/{orgId}/members", isAuthenticated(handleGetOrganizationMembers(s.logger, s.psqlClient), s.logger)).Methods("GET")
 	r.Handle("/api/organization/{orgId}/membership", isAuthenticated(handleLeaveOrganization(s.logger, s.psqlClient), s.logger)).Methods("DELETE")
+	r.Handle("/api/organization/{organizationId}/secrets", isAuthenticated(getOrgIdFromPath(isOrgAdmin(s.psqlClient, handleGetOrganizationSecrets(s.logger, s.psqlClient), s.logger), s.logger), s.logger)).Methods("GET")
+	r.Handle("/api/organization/{organizationId}/secrets/{secretName}", isAuthenticated(getOrgIdFromPath(isOrgAdmin(s.psqlClient, handleSetOrganizationSecret(s.logger, s.psqlClient, s.secretCipher), s.logger), s.logger), s.logger)).Methods("PUT").Headers("Content-Type", "application/json")
+	r.Handle("/api/organization/{organizationId}/secrets/{secretName}", isAuthenticated(getOrgIdFromPath(isOrgAdmin(s.psqlClient, handleDeleteOrganizationSecret(s.logger, s.psqlClient), s.logger), s.logger), s.logger)).Methods("DELETE")
+	r.Handle("/api/organization/{organizationId}/agents", isAuthenticated(getOrgIdFromPath(isOrgAdmin(s.psqlClient, handleGetOrganizationAgents(s.logger, s.psqlClient), s.logger), s.logger), s.logger)).Methods("GET")
+	r.Handle("/api/organization/{organizationId}/agents", isAuthenticated(getOrgIdFromPath(isOrgAdmin(s.psqlClient, handleCreateOrganizationAgent(s.logger, s.psqlClient), s.logger), s.logger), s.logger)).Methods("POST").Headers("Content-Type", "application/json")
+	r.Handle("/api/organization/{organizationId}/agents/{agentId}", isAuthenticated(getOrgIdFromPath(isOrgAdmin(s.psqlClient, handleDeleteOrganizationAgent(s.logger, s.psqlClient), s.logger), s.logger), s.logger)).Methods("DELETE")
+
+	// Agent
+	r.Handle("/api/agent/tasks/claim", isAgent(s.psqlClient, handleClaimAgentTask(s.logger, s.mongoClient, s.psqlClient, s.secretCipher, s.queue), s.logger)).Methods("POST").Headers("Content-Type", "application/json")
+	r.Handle("/api/agent/tasks/{taskId}/logs", isAgent(s.psqlClient, handleAppendAgentTaskLogs(s.logger, s.mongoClient, s.psqlClient, s.secretCipher), s.logger)).Methods("POST").Headers("Content-Type", "application/json")
+	r.Handle("/api/agent/tasks/{taskId}/complete", isAgent(s.psqlClient, handleCompleteAgentTask(s.logger, s.mongoClient, s.psqlClient, s.secretCipher, s.queue), s.logger)).Methods("POST").Headers("Content-Type", "application/json")
+	r.Handle("/api/agent/tasks/{taskId}/fail", isAgent(s.psqlClient, handleFailAgentTask(s.logger, s.mongoClient, s.psqlClient, s.secretCipher, s.queue), s.logger)).Methods("POST").Headers("Content-Type", "application/json")
 
 	// Membership
 	r.Handle("/api/membership", isAuthenticated(handleGetMembershipsForUser(s.logger, s.psqlClient), s.logger)).Methods("GET")
@@ -104,21 +133,30 @@ func handleHealthCheck(l logger.ServerLogger) http.Handler {
 
 func handleGetServiceRequest(logger logger.ServerLogger, mongoClient *mongo.Client, psqlClient *sql.DB) http.Handler {
 	type ResponseBodyStep struct {
-		Name         string           `json:"name"`
-		Status       models.EventType `json:"status"`
-		UpdatedAt    time.Time        `json:"updated_at"`
-		UpdatedBy    string           `json:"updated_by"`
-		NextStepName string           `json:"next_step_name"`
+		Name          string           `json:"name"`
+		Status        models.EventType `json:"status"`
+		UpdatedAt     time.Time        `json:"updated_at"`
+		UpdatedBy     string           `json:"updated_by"`
+		NextStepName  string           `json:"next_step_name"`
+		NextStepNames []string         `json:"next_step_names,omitempty"`
 	}
 	type ResponseBodyPipeline struct {
 		Name string       `json:"name"`
 		Form *models.Form `json:"form"`
 	}
+	type ResponseBodyRelatedServiceRequest struct {
+		Id             string                      `json:"id"`
+		PipelineName   string                      `json:"pipeline_name"`
+		Status         models.ServiceRequestStatus `json:"status"`
+		ParentStepName string                      `json:"parent_step_name,omitempty"`
+	}
 	type ResponseBody struct {
-		ServiceRequest *models.ServiceRequestModel `json:"service_request"`
-		Steps          map[string]ResponseBodyStep `json:"steps"`
-		FirstStepName  string                      `json:"first_step_name"`
-		Pipeline       *ResponseBodyPipeline       `json:"pipeline"`
+		ServiceRequest       *models.ServiceRequestModel          `json:"service_request"`
+		Steps                map[string]ResponseBodyStep          `json:"steps"`
+		FirstStepName        string                               `json:"first_step_name"`
+		Pipeline             *ResponseBodyPipeline                `json:"pipeline"`
+		ParentServiceRequest *ResponseBodyRelatedServiceRequest   `json:"parent_service_request,omitempty"`
+		ChildServiceRequests []*ResponseBodyRelatedServiceRequest `json:"child_service_requests"`
 	}
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		vars := mux.Vars(r)
@@ -150,13 +188,46 @@ func handleGetServiceRequest(logger logger.ServerLogger, mongoClient *mongo.Clie
 				return
 			}
 			steps[event.StepName] = ResponseBodyStep{
-				Name:         event.StepName,
-				Status:       event.EventType,
-				UpdatedAt:    event.CreatedAt,
-				UpdatedBy:    event.CreatedBy,
-				NextStepName: step.NextStepName,
+				Name:          event.StepName,
+				Status:        event.EventType,
+				UpdatedAt:     event.CreatedAt,
+				UpdatedBy:     event.CreatedBy,
+				NextStepName:  step.NextStepName,
+				NextStepNames: step.GetNextStepNames(),
 			}
 		}
+
+		// Service requests launched by PIPELINE steps are linked to the service request which launched them
+		var parent *ResponseBodyRelatedServiceRequest
+		if sr.ParentServiceRequestId != "" {
+			parentSr, err := database.NewServiceRequest(mongoClient).GetById(sr.ParentServiceRequestId)
+			if err != nil {
+				logger.Error(fmt.Sprintf("error encountered while handling API request: %s", err))
+				encode(w, r, http.StatusInternalServerError, newHandlerError(ErrInternalServerError, http.StatusInternalServerError))
+				return
+			}
+			parent = &ResponseBodyRelatedServiceRequest{
+				Id:           parentSr.Id.Hex(),
+				PipelineName: parentSr.PipelineName,
+				Status:       parentSr.Status,
+			}
+		}
+		childSrs, err := database.NewServiceRequest(mongoClient).GetAllByParentId(requestId)
+		if err != nil {
+			logger.Error(fmt.Sprintf("error encountered while handling API request: %s", err))
+			encode(w, r, http.StatusInternalServerError, newHandlerError(ErrInternalServerError, http.StatusInternalServerError))
+			return
+		}
+		children := make([]*ResponseBodyRelatedServiceRequest, 0, len(childSrs))
+		for _, child := range childSrs {
+			children = append(children, &ResponseBodyRelatedServiceRequest{
+				Id:             child.Id.Hex(),
+				PipelineName:   child.PipelineName,
+				Status:         child.Status,
+				ParentStepName: child.ParentStepName,
+			})
+		}
+
 		response := ResponseBody{
 			ServiceRequest: sr,
 			Steps:          steps,
@@ -165,6 +236,8 @@ func handleGetServiceRequest(logger logger.ServerLogger, mongoClient *mongo.Clie
 				Name: pipeline.PipelineName,
 				Form: &pipeline.Form,
 			},
+			ParentServiceRequest: parent,
+			ChildServiceRequests: children,
 		}
 		encode(w, r, http.StatusOK, response)
 	})
@@ -172,11 +245,12 @@ func handleGetServiceRequest(logger logger.ServerLogger, mongoClient *mongo.Clie
 
 func handleGetServiceRequestStepDetails(logger logger.ServerLogger, mongoClient *mongo.Client, psqlClient *sql.DB) http.Handler {
 	type ResponseBodyStep struct {
-		Name         string           `json:"name"`
-		Status       models.EventType `json:"status"`
-		UpdatedAt    time.Time        `json:"updated_at"`
-		UpdatedBy    string           `json:"updated_by"`
-		NextStepName string           `json:"next_step_name"`
+		Name          string           `json:"name"`
+		Status        models.EventType `json:"status"`
+		UpdatedAt     time.Time        `json:"updated_at"`
+		UpdatedBy     string           `json:"updated_by"`
+		NextStepName  string           `json:"next_step_name"`
+		NextStepNames []string         `json:"next_step_names,omitempty"`
 	}
 	type ResponseBody struct {
 		Steps            map[string]ResponseBodyStep `json:"steps"`
@@ -215,11 +289,12 @@ func handleGetServiceRequestStepDetails(logger logger.ServerLogger, mongoClient
 				return
 			}
 			steps[event.StepName] = ResponseBodyStep{
-				Name:         event.StepName,
-				Status:       event.EventType,
-				UpdatedAt:    event.CreatedAt,
-				UpdatedBy:    event.CreatedBy,
-				NextStepName: step.NextStepName,
+				Name:          event.StepName,
+				Status:        event.EventType,
+				UpdatedAt:     event.CreatedAt,
+				UpdatedBy:     event.CreatedBy,
+				NextStepName:  step.NextStepName,
+				NextStepNames: step.GetNextStepNames(),
 			}
 		}
 		response := ResponseBody{
@@ -254,43 +329,80 @@ func handleCreateServiceRequest(logger logger.ServerLogger, mongoClient *mongo.C
 			return
 		}
 
-		srm.CreatedOn = time.Now()
-		srm.LastUpdated = time.Now()
-		srm.Status = models.NOT_STARTED
-		srm.PipelineName = pipeline.PipelineName
-		srm.PipelineVersion = pipeline.Version
-
 		token := r.Context().Value(jwtmiddleware.ContextKey{}).(*validator.ValidatedClaims)
 		userId := token.RegisteredClaims.Subject
 		srm.UserId = userId
 
-		res, err := database.NewServiceRequest(mongoClient).Create(&srm)
+		// Only child service requests of PIPELINE steps have a parent
+		srm.ParentServiceRequestId = ""
+		srm.ParentStepName = ""
+		srm.ScheduleId = 0
+
+		err = servicerequest.Create(mongoClient, psqlClient, &srm, pipeline)
+		if errors.Is(err, models.ErrInvalidEnvironment) {
+			logger.Error(fmt.Sprintf("environment %s not found in pipeline %s", srm.Environment, srm.PipelineId))
+			encode(w, r, http.StatusBadRequest, newHandlerError(ErrInvalidEnvironment, http.StatusBadRequest))
+			return
+		} else if err != nil {
+			logger.Error(fmt.Sprintf("error encountered while handling API request: %s", err))
+			encode(w, r, http.StatusInternalServerError, newHandlerError(ErrInternalServerError, http.StatusInternalServerError))
+			return
+		}
+		encode(w, r, http.StatusCreated, srm)
+	})
+}
+
+// Renders the parameters of the steps of a pipeline with form data, without creating a service request
+func handleRenderServiceRequest(logger logger.ServerLogger, mongoClient *mongo.Client) http.Handler {
+	type ResponseBody struct {
+		PipelineId      string                         `json:"pipeline_id"`
+		PipelineVersion int                            `json:"pipeline_version"`
+		Environment     string                         `json:"environment"`
+		Valid           bool                           `json:"valid"`
+		Steps           []*servicerequest.RenderedStep `json:"steps"`
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		srm, err := decode[models.ServiceRequestModel](r)
 		if err != nil {
+			logger.Error(fmt.Sprintf("failed to parse json request body: %s", err))
+			encode(w, r, http.StatusBadRequest, newHandlerError(ErrJsonParseError, http.StatusBadRequest))
+			return
+		}
+
+		pipeline, err := database.NewPipeline(mongoClient).GetById(srm.PipelineId)
+		if errors.Is(err, mongo.ErrNoDocuments) || (err == nil && pipeline.OrganizationId != srm.OrganizationId) {
+			logger.Error(fmt.Sprintf("%s %s not found", "pipeline", srm.PipelineId))
+			encode(w, r, http.StatusBadRequest, newHandlerError(ErrInvalidPipelineId, http.StatusBadRequest))
+			return
+		} else if err != nil {
 			logger.Error(fmt.Sprintf("error encountered while handling API request: %s", err))
 			encode(w, r, http.StatusInternalServerError, newHandlerError(ErrInternalServerError, http.StatusInternalServerError))
 			return
 		}
-		stepEventDAO := database.NewServiceRequestEvent(psqlClient)
-		for _, step := range pipeline.Steps {
-			err = stepEventDAO.Create(&models.ServiceRequestEventModel{
-				EventType:        models.STEP_NOT_STARTED,
-				ServiceRequestId: res.InsertedID.(primitive.ObjectID).Hex(),
-				StepName:         step.StepName,
-				StepType:         step.StepType,
-			})
-			if err != nil {
-				logger.Error(fmt.Sprintf("error encountered while handling API request: %s", err))
-				encode(w, r, http.StatusInternalServerError, newHandlerError(ErrInternalServerError, http.StatusInternalServerError))
-				return
-			}
+
+		environment, err := pipeline.GetEnvironment(srm.Environment)
+		if err != nil {
+			logger.Error(fmt.Sprintf("environment %s not found in pipeline %s", srm.Environment, srm.PipelineId))
+			encode(w, r, http.StatusBadRequest, newHandlerError(ErrInvalidEnvironment, http.StatusBadRequest))
+			return
 		}
-		insertedId, _ := res.InsertedID.(primitive.ObjectID)
-		srm.Id = insertedId
-		encode(w, r, http.StatusCreated, srm)
+
+		steps := servicerequest.Render(pipeline, environment, srm.FormData)
+		valid := true
+		for _, step := range steps {
+			valid = valid && step.IsValid()
+		}
+		encode(w, r, http.StatusOK, ResponseBody{
+			PipelineId:      pipeline.Id.Hex(),
+			PipelineVersion: pipeline.Version,
+			Environment:     environment,
+			Valid:           valid,
+			Steps:           steps,
+		})
 	})
 }
 
-func handleCancelServiceRequest(logger logger.ServerLogger, client *mongo.Client, psqlClient *sql.DB) http.Handler {
+func handleCancelServiceRequest(logger logger.ServerLogger, client *mongo.Client, psqlClient *sql.DB, queue events.Queue) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		vars := mux.Vars(r)
 		requestId := vars["requestId"]
@@ -307,39 +419,13 @@ func handleCancelServiceRequest(logger logger.ServerLogger, client *mongo.Client
 			return
 		}
 
-		sre, err := database.NewServiceRequestEvent(psqlClient).GetLatestStepEvent(requestId)
-		if err != nil {
-			logger.Error(fmt.Sprintf("error encountered while handling API request: %s", err))
-			encode(w, r, http.StatusInternalServerError, newHandlerError(ErrInternalServerError, http.StatusInternalServerError))
-			return
-		}
-
-		err = database.NewServiceRequest(client).UpdateStatus(requestId, models.CANCELLED)
-
-		// TODO: discuss how to handle this error
-		if err != nil {
+		userId := r.Context().Value(jwtmiddleware.ContextKey{}).(*validator.ValidatedClaims).RegisteredClaims.Subject
+		if err := servicerequest.Cancel(client, psqlClient, queue, sr, userId); err != nil {
 			logger.Error(fmt.Sprintf("error encountered while handling API request: %s", err))
 			encode(w, r, http.StatusInternalServerError, newHandlerError(ErrInternalServerError, http.StatusInternalServerError))
 			return
 		}
 
-		if models.IsCancellablePipelineStepType(sre.StepType) {
-			userId := r.Context().Value(jwtmiddleware.ContextKey{}).(*validator.ValidatedClaims).RegisteredClaims.Subject
-			// Log step cancelled event
-			serviceRequestEvent := database.NewServiceRequestEvent(psqlClient)
-			err = serviceRequestEvent.Create(&models.ServiceRequestEventModel{
-				EventType:        models.STEP_CANCELLED,
-				ServiceRequestId: sr.Id.Hex(),
-				StepName:         sre.StepName,
-				CreatedBy:        userId,
-				StepType:         sre.StepType,
-			})
-			if err != nil {
-				encode(w, r, http.StatusInternalServerError, newHandlerError(ErrInternalServerError, http.StatusInternalServerError))
-				return
-			}
-		}
-
 		encode[any](w, r, http.StatusOK, nil)
 	})
 }
@@ -376,7 +462,7 @@ func handleUpdateServiceRequest(logger logger.ServerLogger, client *mongo.Client
 	})
 }
 
-func handleStartServiceRequest(logger logger.ServerLogger, client *mongo.Client) http.Handler {
+func handleStartServiceRequest(logger logger.ServerLogger, client *mongo.Client, queue events.Queue) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		vars := mux.Vars(r)
 		requestId := vars["requestId"]
@@ -391,19 +477,37 @@ func handleStartServiceRequest(logger logger.ServerLogger, client *mongo.Client)
 			encode(w, r, http.StatusBadRequest, newHandlerError(ErrServiceRequestAlreadyStarted, http.StatusBadRequest))
 			return
 		}
-		event.FireAsync(events.NewNewServiceRequestEvent(srm))
+		if err := servicerequest.Start(queue, srm); err != nil {
+			logger.Error(fmt.Sprintf("error encountered while handling API request: %s", err))
+			encode(w, r, http.StatusInternalServerError, newHandlerError(ErrInternalServerError, http.StatusInternalServerError))
+			return
+		}
 		encode[any](w, r, http.StatusOK, nil)
 	})
 }
 
-func handleApproveServiceRequest(logger logger.ServerLogger, client *mongo.Client, psqlClient *sql.DB) http.Handler {
+// Records the approval of the WAIT_FOR_APPROVAL step which the service request is waiting on. The step is completed
+// once the quorum of the step is reached.
+func handleApproveServiceRequest(logger logger.ServerLogger, client *mongo.Client, psqlClient *sql.DB, queue events.Queue) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		params := mux.Vars(r)
 		serviceRequestId := params["requestId"]
+
+		// Serialise approvals with each other and with the execution of the service request, so that the quorum is
+		// counted once every approval has been recorded
+		unlock, err := database.NewLock(psqlClient).Acquire(fmt.Sprintf("service_request/%s", serviceRequestId))
+		if err != nil {
+			logger.Error(fmt.Sprintf("error encountered while handling API request: %s", err))
+			encode(w, r, http.StatusInternalServerError, newHandlerError(ErrInternalServerError, http.StatusInternalServerError))
+			return
+		}
+		defer unlock()
+
 		serviceRequest, err := database.NewServiceRequest(client).GetById(serviceRequestId)
 		if errors.Is(err, mongo.ErrNoDocuments) {
 			logger.Error(fmt.Sprintf("%s %s not found", "service request", serviceRequestId))
 			encode(w, r, http.StatusNotFound, newHandlerError(ErrInvalidServiceRequestId, http.StatusNotFound))
+			return
 		}
 		if err != nil {
 			logger.Error(fmt.Sprintf("error encountered while handling API request: %s", err))
@@ -416,38 +520,220 @@ func handleApproveServiceRequest(logger logger.ServerLogger, client *mongo.Clien
 			return
 		}
 
-		latestStep, err := database.NewServiceRequestEvent(psqlClient).GetLatestStepEvent(serviceRequestId)
+		latestStep, ok := getWaitingApprovalStep(logger, psqlClient, w, r, serviceRequestId)
+		if !ok {
+			return
+		}
+
+		userId := r.Context().Value(jwtmiddleware.ContextKey{}).(*validator.ValidatedClaims).RegisteredClaims.Subject
+		policy, approvers, ok := getEligibleApprovalPolicy(logger, client, psqlClient, w, r, serviceRequest, latestStep, userId)
+		if !ok {
+			return
+		}
+		if helper.StringInSlice(userId, approvers) {
+			logger.Error(fmt.Sprintf("unable to approve service request %s: step %s has already been approved by %s", serviceRequestId, latestStep.StepName, userId))
+			encode(w, r, http.StatusConflict, newHandlerError(ErrAlreadyApproved, http.StatusConflict))
+			return
+		}
+
+		user, err := database.NewUser(psqlClient).GetUserById(userId)
 		if err != nil {
 			logger.Error(fmt.Sprintf("error encountered while handling API request: %s", err))
 			encode(w, r, http.StatusInternalServerError, newHandlerError(ErrInternalServerError, http.StatusInternalServerError))
 			return
 		}
-		if latestStep.StepType != models.WaitForApprovalStep {
-			// This check should be redundant but just in case
-			// Because if the status of the request is pending, the latest step should be an approval step
-			// Unless we have a bug in the code somewhere
-			logger.Error(fmt.Sprintf("unable to approve service request %s: latest step is not approval step ", serviceRequestId))
-			encode(w, r, http.StatusBadRequest, newHandlerError(ErrFailedToApproveServiceRequest, http.StatusBadRequest))
+
+		_, err = database.NewApprovalEvent(psqlClient).Create(&models.ApprovalEventModel{
+			EventType:        models.APPROVAL_APPROVED,
+			ServiceRequestId: serviceRequestId,
+			StepName:         latestStep.StepName,
+			ExecutionId:      latestStep.ExecutionId,
+			CreatedBy:        userId,
+		})
+		if err != nil {
+			logger.Error(fmt.Sprintf("error encountered while handling API request: %s", err))
+			encode(w, r, http.StatusInternalServerError, newHandlerError(ErrInternalServerError, http.StatusInternalServerError))
+			return
+		}
+		approvalCount := len(approvers) + 1
+		logger.Info(fmt.Sprintf("approving service request \"%s\" at step \"%s\" (%d of %d), performed by %s", serviceRequestId, latestStep.StepName, approvalCount, policy.Quorum, user.Name))
+		if approvalCount < policy.Quorum {
+			encode[any](w, r, http.StatusOK, nil)
 			return
 		}
 
-		userId := r.Context().Value(jwtmiddleware.ContextKey{}).(*validator.ValidatedClaims).RegisteredClaims.Subject
+		// Outputs of the steps prior to the approval are persisted by the execution manager, so there is no result to pass on.
+		// The completion is of the attempt which was approved, so it is ignored if the attempt is no longer running.
+		if err := queue.Publish(events.NewStepCompletedEvent(latestStep.StepName, serviceRequest.Id.Hex(), latestStep.ExecutionId, userId, nil, nil)); err != nil {
+			logger.Error(fmt.Sprintf("error encountered while handling API request: %s", err))
+			encode(w, r, http.StatusInternalServerError, newHandlerError(ErrInternalServerError, http.StatusInternalServerError))
+			return
+		}
+		encode[any](w, r, http.StatusOK, nil)
+	})
+}
 
-		user, err := database.NewUser(psqlClient).GetUserById(userId)
+// Returns the approval policy of the WAIT_FOR_APPROVAL step and the users who have approved its latest attempt. Writes
+// the error response and returns false if the user is not an approver of the step under its policy.
+func getEligibleApprovalPolicy(logger logger.ServerLogger, client *mongo.Client, psqlClient *sql.DB, w http.ResponseWriter, r *http.Request, serviceRequest *models.ServiceRequestModel, latestStep *models.ServiceRequestEventModel, userId string) (*models.ApprovalPolicy, []string, bool) {
+	serviceRequestId := serviceRequest.Id.Hex()
+	// The approval policy is read from the rendered parameters of the step
+	srsm, err := database.NewServiceRequestStep(client).GetByServiceRequestIdAndStepName(serviceRequestId, latestStep.StepName)
+	if err != nil {
+		logger.Error(fmt.Sprintf("error encountered while handling API request: %s", err))
+		encode(w, r, http.StatusInternalServerError, newHandlerError(ErrInternalServerError, http.StatusInternalServerError))
+		return nil, nil, false
+	}
+	policy, err := models.GetApprovalPolicy(srsm.Parameters)
+	if err != nil {
+		logger.Error(fmt.Sprintf("invalid approval parameters of step %s of service request %s: %s", latestStep.StepName, serviceRequestId, err))
+		encode(w, r, http.StatusInternalServerError, newHandlerError(ErrInternalServerError, http.StatusInternalServerError))
+		return nil, nil, false
+	}
+
+	membership, err := getMembership(serviceRequest.OrganizationId, psqlClient, r)
+	if err != nil {
+		logger.Error(fmt.Sprintf("error encountered while handling API request: %s", err))
+		encode(w, r, http.StatusInternalServerError, newHandlerError(ErrInternalServerError, http.StatusInternalServerError))
+		return nil, nil, false
+	}
+	// Approvals of previous attempts of the step, e.g. before it was rejected and retried, are not counted
+	approvalEvents, err := database.NewApprovalEvent(psqlClient).GetAllByExecutionId(serviceRequestId, latestStep.StepName, latestStep.ExecutionId)
+	if err != nil {
+		logger.Error(fmt.Sprintf("error encountered while handling API request: %s", err))
+		encode(w, r, http.StatusInternalServerError, newHandlerError(ErrInternalServerError, http.StatusInternalServerError))
+		return nil, nil, false
+	}
+	approvers := []string{}
+	escalated := false
+	for _, event := range approvalEvents {
+		if event.EventType == models.APPROVAL_APPROVED {
+			approvers = append(approvers, event.CreatedBy)
+		} else if event.EventType == models.APPROVAL_TIMED_OUT && policy.OnDeadline == models.EscalateAtDeadline {
+			// Once the step is escalated, the escalation approvers can approve it as well
+			escalated = true
+		}
+	}
+	if !policy.IsEligible(userId, membership.Role, escalated) {
+		logger.Error(fmt.Sprintf("user %s is not an approver of step %s of service request %s", userId, latestStep.StepName, serviceRequestId))
+		encode(w, r, http.StatusForbidden, newHandlerError(ErrNotEligibleApprover, http.StatusForbidden))
+		return nil, nil, false
+	}
+	return policy, approvers, true
+}
+
+// Returns the latest event of the WAIT_FOR_APPROVAL step which the service request is waiting on. Parallel steps may
+// wait on approvals at the same time, in which case the step is chosen by the step_name query parameter. Writes the
+// error response and returns false if there is no such step.
+func getWaitingApprovalStep(logger logger.ServerLogger, psqlClient *sql.DB, w http.ResponseWriter, r *http.Request, serviceRequestId string) (*models.ServiceRequestEventModel, bool) {
+	stepName := r.URL.Query().Get("step_name")
+	stepsLatestEvent, err := database.NewServiceRequestEvent(psqlClient).GetStepsLatestEvent(serviceRequestId)
+	if err != nil {
+		logger.Error(fmt.Sprintf("error encountered while handling API request: %s", err))
+		encode(w, r, http.StatusInternalServerError, newHandlerError(ErrInternalServerError, http.StatusInternalServerError))
+		return nil, false
+	}
+	waitingSteps := make([]*models.ServiceRequestEventModel, 0)
+	for _, event := range stepsLatestEvent {
+		if event.StepType == models.WaitForApprovalStep && event.EventType == models.STEP_RUNNING && (stepName == "" || event.StepName == stepName) {
+			waitingSteps = append(waitingSteps, event)
+		}
+	}
+	switch len(waitingSteps) {
+	case 0:
+		logger.Error(fmt.Sprintf("service request %s is not waiting on approval step %q", serviceRequestId, stepName))
+		encode(w, r, http.StatusBadRequest, newHandlerError(ErrFailedToApproveServiceRequest, http.StatusBadRequest))
+		return nil, false
+	case 1:
+		return waitingSteps[0], true
+	default:
+		logger.Error(fmt.Sprintf("service request %s is waiting on %d approval steps", serviceRequestId, len(waitingSteps)))
+		encode(w, r, http.StatusBadRequest, newHandlerError(ErrApprovalStepRequired, http.StatusBadRequest))
+		return nil, false
+	}
+}
+
+// Returns the approvals and deadline timeouts of the WAIT_FOR_APPROVAL steps of the service request
+func handleGetServiceRequestApprovals(logger logger.ServerLogger, psqlClient *sql.DB) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		serviceRequestId := mux.Vars(r)["requestId"]
+		approvals, err := database.NewApprovalEvent(psqlClient).GetAllByServiceRequestId(serviceRequestId)
+		if err != nil {
+			logger.Error(fmt.Sprintf("error encountered while handling API request: %s", err))
+			encode(w, r, http.StatusInternalServerError, newHandlerError(ErrInternalServerError, http.StatusInternalServerError))
+			return
+		}
+		encode(w, r, http.StatusOK, approvals)
+	})
+}
+
+// Re-runs a failed step of a failed service request, after which the service request continues from the step
+func handleRetryServiceRequestStep(logger logger.ServerLogger, client *mongo.Client, psqlClient *sql.DB, queue events.Queue) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		params := mux.Vars(r)
+		serviceRequestId := params["requestId"]
+		stepName := params["stepName"]
+		serviceRequest, err := database.NewServiceRequest(client).GetById(serviceRequestId)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			logger.Error(fmt.Sprintf("%s %s not found", "service request", serviceRequestId))
+			encode(w, r, http.StatusNotFound, newHandlerError(ErrInvalidServiceRequestId, http.StatusNotFound))
+			return
+		}
+		if err != nil {
+			logger.Error(fmt.Sprintf("error encountered while handling API request: %s", err))
+			encode(w, r, http.StatusInternalServerError, newHandlerError(ErrInternalServerError, http.StatusInternalServerError))
+			return
+		}
+		if serviceRequest.Status != models.FAILED {
+			logger.Error(fmt.Sprintf("unable to retry step of service request %s: request has not failed", serviceRequestId))
+			encode(w, r, http.StatusBadRequest, newHandlerError(ErrFailedToRetryStep, http.StatusBadRequest))
+			return
+		}
+
+		latestEvent, err := database.NewServiceRequestEvent(psqlClient).GetStepLatestEvent(serviceRequestId, stepName)
+		if errors.Is(err, sql.ErrNoRows) {
+			logger.Error(fmt.Sprintf("step %s of service request %s not found", stepName, serviceRequestId))
+			encode(w, r, http.StatusNotFound, newHandlerError(ErrInvalidStepName, http.StatusNotFound))
+			return
+		}
+		if err != nil {
+			logger.Error(fmt.Sprintf("error encountered while handling API request: %s", err))
+			encode(w, r, http.StatusInternalServerError, newHandlerError(ErrInternalServerError, http.StatusInternalServerError))
+			return
+		}
+		if latestEvent.EventType != models.STEP_FAILED {
+			logger.Error(fmt.Sprintf("unable to retry step %s of service request %s: step has not failed", stepName, serviceRequestId))
+			encode(w, r, http.StatusBadRequest, newHandlerError(ErrFailedToRetryStep, http.StatusBadRequest))
+			return
+		}
+
+		// The service request cannot continue once the steps it depends on have been undone
+		stepsLatestEvent, err := database.NewServiceRequestEvent(psqlClient).GetStepsLatestEvent(serviceRequestId)
 		if err != nil {
 			logger.Error(fmt.Sprintf("error encountered while handling API request: %s", err))
 			encode(w, r, http.StatusInternalServerError, newHandlerError(ErrInternalServerError, http.StatusInternalServerError))
 			return
 		}
+		for _, event := range stepsLatestEvent {
+			if models.IsCompensationEventType(event.EventType) {
+				logger.Error(fmt.Sprintf("unable to retry step %s of service request %s: steps have been compensated", stepName, serviceRequestId))
+				encode(w, r, http.StatusBadRequest, newHandlerError(ErrServiceRequestCompensated, http.StatusBadRequest))
+				return
+			}
+		}
 
-		logger.Info(fmt.Sprintf("approving service request \"%s\" at step \"%s\", performed by %s", serviceRequestId, latestStep.StepName, user.Name))
-		// TODO: figure out how to pass the step result prior to the approval to the next step
-		event.FireAsync(events.NewStepCompletedEvent(latestStep.StepName, serviceRequest.Id.Hex(), userId, nil, nil))
+		userId := r.Context().Value(jwtmiddleware.ContextKey{}).(*validator.ValidatedClaims).RegisteredClaims.Subject
+		logger.Info(fmt.Sprintf("retrying step \"%s\" of service request \"%s\", performed by %s", stepName, serviceRequestId, userId))
+		if err := queue.Publish(events.NewRetryStepEvent(stepName, serviceRequestId, userId)); err != nil {
+			logger.Error(fmt.Sprintf("error encountered while handling API request: %s", err))
+			encode(w, r, http.StatusInternalServerError, newHandlerError(ErrInternalServerError, http.StatusInternalServerError))
+			return
+		}
 		encode[any](w, r, http.StatusOK, nil)
 	})
 }
 
-func handleRejectServiceRequest(logger logger.ServerLogger, client *mongo.Client, psqlClient *sql.DB) http.Handler {
+func handleRejectServiceRequest(logger logger.ServerLogger, client *mongo.Client, psqlClient *sql.DB, queue events.Queue) http.Handler {
 	type requestBody struct {
 		Remarks string `json:"remarks"`
 	}
@@ -458,6 +744,7 @@ func handleRejectServiceRequest(logger logger.ServerLogger, client *mongo.Client
 		if errors.Is(err, mongo.ErrNoDocuments) {
 			logger.Error(fmt.Sprintf("%s %s not found", "service request", serviceRequestId))
 			encode(w, r, http.StatusNotFound, newHandlerError(ErrInvalidServiceRequestId, http.StatusNotFound))
+			return
 		}
 		if err != nil {
 			logger.Error(fmt.Sprintf("error encountered while handling API request: %s", err))
@@ -471,16 +758,8 @@ func handleRejectServiceRequest(logger logger.ServerLogger, client *mongo.Client
 			return
 		}
 
-		latestStep, err := database.NewServiceRequestEvent(psqlClient).GetLatestStepEvent(serviceRequestId)
-		if err != nil {
-			logger.Error(fmt.Sprintf("error encountered while handling API request: %s", err))
-			encode(w, r, http.StatusInternalServerError, newHandlerError(ErrInternalServerError, http.StatusInternalServerError))
-			return
-		}
-		if latestStep.StepType != models.WaitForApprovalStep {
-			// This check should be redundant but just in case
-			logger.Error(fmt.Sprintf("unable to approve service request %s: latest step is not approval step ", serviceRequestId))
-			encode(w, r, http.StatusBadRequest, newHandlerError(ErrFailedToApproveServiceRequest, http.StatusBadRequest))
+		latestStep, ok := getWaitingApprovalStep(logger, psqlClient, w, r, serviceRequestId)
+		if !ok {
 			return
 		}
 
@@ -491,7 +770,11 @@ func handleRejectServiceRequest(logger logger.ServerLogger, client *mongo.Client
 			return
 		}
 
+		// Only the approvers of the step can reject it
 		userId := r.Context().Value(jwtmiddleware.ContextKey{}).(*validator.ValidatedClaims).RegisteredClaims.Subject
+		if _, _, ok := getEligibleApprovalPolicy(logger, client, psqlClient, w, r, serviceRequest, latestStep, userId); !ok {
+			return
+		}
 
 		user, err := database.NewUser(psqlClient).GetUserById(userId)
 		if err != nil {
@@ -502,17 +785,119 @@ func handleRejectServiceRequest(logger logger.ServerLogger, client *mongo.Client
 
 		logger.Info(fmt.Sprintf("rejecting service request \"%s\" at step \"%s\", performed by %s", serviceRequestId, latestStep.StepName, user.Name))
 
-		// Update Service Request Status
-		err = database.NewServiceRequest(client).UpdateStatus(serviceRequestId, models.FAILED)
+		// Add that SR is rejected at start of remarks. The status of the service request is set once the failure is
+		// handled, which follows the on_failure action of the step and compensates the steps if the request fails.
+		failedEventRemarks := fmt.Sprintf("%s\n%s\n%s", fmt.Sprintf("Rejected by %s", user.Name), "Remarks by admin:", body.Remarks)
+		if err := queue.Publish(events.NewStepFailedEvent(latestStep.StepName, serviceRequest, latestStep.ExecutionId, userId, failedEventRemarks, nil)); err != nil {
+			logger.Error(fmt.Sprintf("error encountered while handling API request: %s", err))
+			encode(w, r, http.StatusInternalServerError, newHandlerError(ErrInternalServerError, http.StatusInternalServerError))
+			return
+		}
+		encode[any](w, r, http.StatusOK, nil)
+	})
+}
+
+// Receives the callback of a WAIT_FOR_CALLBACK step. The request is authenticated by the callback token instead of a
+// JWT, which is passed in the X-Callback-Token header or the token query parameter.
+func handleServiceRequestCallback(logger logger.ServerLogger, client *mongo.Client, psqlClient *sql.DB, queue events.Queue, callbackSigner *helper.CallbackSigner) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		serviceRequestId := vars["requestId"]
+		stepName := vars["stepName"]
+		token := r.Header.Get("X-Callback-Token")
+		if token == "" {
+			token = r.URL.Query().Get("token")
+		}
+		if !callbackSigner.Verify(serviceRequestId, stepName, token) {
+			logger.Error(fmt.Sprintf("invalid callback token for step %s of service request %s", stepName, serviceRequestId))
+			encode(w, r, http.StatusUnauthorized, newHandlerError(ErrInvalidCallbackToken, http.StatusUnauthorized))
+			return
+		}
+
+		serviceRequest, err := database.NewServiceRequest(client).GetById(serviceRequestId)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			logger.Error(fmt.Sprintf("%s %s not found", "service request", serviceRequestId))
+			encode(w, r, http.StatusNotFound, newHandlerError(ErrInvalidServiceRequestId, http.StatusNotFound))
+			return
+		}
+		if err != nil {
+			logger.Error(fmt.Sprintf("error encountered while handling API request: %s", err))
+			encode(w, r, http.StatusInternalServerError, newHandlerError(ErrInternalServerError, http.StatusInternalServerError))
+			return
+		}
+		pipeline, err := database.NewPipeline(client).GetById(serviceRequest.PipelineId)
+		if err != nil {
+			logger.Error(fmt.Sprintf("error encountered while handling API request: %s", err))
+			encode(w, r, http.StatusInternalServerError, newHandlerError(ErrInternalServerError, http.StatusInternalServerError))
+			return
+		}
+		step := pipeline.GetPipelineStep(stepName)
+		if step == nil || step.StepType != models.WaitForCallbackStep {
+			logger.Error(fmt.Sprintf("step %s of service request %s is not a callback step", stepName, serviceRequestId))
+			encode(w, r, http.StatusBadRequest, newHandlerError(ErrWrongStepType, http.StatusBadRequest))
+			return
+		}
+
+		payload, err := decode[map[string]any](r)
+		if err != nil {
+			logger.Error(fmt.Sprintf("failed to parse json request body: %s", err))
+			encode(w, r, http.StatusBadRequest, newHandlerError(ErrJsonParseError, http.StatusBadRequest))
+			return
+		}
+		if payload == nil {
+			payload = map[string]any{}
+		}
+
+		// Serialise with the execution of the service request so that the step cannot complete in between the checks
+		unlock, err := database.NewLock(psqlClient).Acquire(fmt.Sprintf("service_request/%s", serviceRequestId))
 		if err != nil {
 			logger.Error(fmt.Sprintf("error encountered while handling API request: %s", err))
 			encode(w, r, http.StatusInternalServerError, newHandlerError(ErrInternalServerError, http.StatusInternalServerError))
 			return
 		}
+		defer unlock()
 
-		// Add that SR is rejected at start of remarks
-		failedEventRemarks := fmt.Sprintf("%s\n%s\n%s", fmt.Sprintf("Rejected by %s", user.Name), "Remarks by admin:", body.Remarks)
-		event.FireAsync(events.NewStepFailedEvent(latestStep.StepName, serviceRequest, userId, failedEventRemarks, nil))
+		// Callbacks may arrive before the step has started, e.g. when the job was submitted by the previous step
+		latestEvent, err := database.NewServiceRequestEvent(psqlClient).GetStepLatestEvent(serviceRequestId, stepName)
+		if err != nil {
+			logger.Error(fmt.Sprintf("error encountered while handling API request: %s", err))
+			encode(w, r, http.StatusInternalServerError, newHandlerError(ErrInternalServerError, http.StatusInternalServerError))
+			return
+		}
+		isServiceRequestActive := serviceRequest.Status == models.NOT_STARTED || serviceRequest.Status == models.RUNNING || serviceRequest.Status == models.PENDING
+		if !isServiceRequestActive || (latestEvent.EventType != models.STEP_NOT_STARTED && latestEvent.EventType != models.STEP_RUNNING) {
+			logger.Error(fmt.Sprintf("step %s of service request %s is not waiting for a callback", stepName, serviceRequestId))
+			encode(w, r, http.StatusBadRequest, newHandlerError(ErrCallbackNotExpected, http.StatusBadRequest))
+			return
+		}
+		existing, err := database.NewServiceRequestStep(client).GetByServiceRequestIdAndStepName(serviceRequestId, stepName)
+		if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+			logger.Error(fmt.Sprintf("error encountered while handling API request: %s", err))
+			encode(w, r, http.StatusInternalServerError, newHandlerError(ErrInternalServerError, http.StatusInternalServerError))
+			return
+		}
+		if err == nil && existing.Callback != nil {
+			logger.Error(fmt.Sprintf("callback of step %s of service request %s has already been received", stepName, serviceRequestId))
+			encode(w, r, http.StatusConflict, newHandlerError(ErrCallbackAlreadyReceived, http.StatusConflict))
+			return
+		}
+
+		if err := database.NewServiceRequestStep(client).UpdateCallback(serviceRequestId, stepName, payload); err != nil {
+			logger.Error(fmt.Sprintf("error encountered while handling API request: %s", err))
+			encode(w, r, http.StatusInternalServerError, newHandlerError(ErrInternalServerError, http.StatusInternalServerError))
+			return
+		}
+		logger.Info(fmt.Sprintf("received callback of step %s of service request %s", stepName, serviceRequestId))
+
+		// A step which has not started completes with the callback when it starts
+		if latestEvent.EventType == models.STEP_RUNNING {
+			result := &execute.StepExecResult{Output: payload}
+			if err := queue.Publish(events.NewStepCompletedEvent(stepName, serviceRequestId, latestEvent.ExecutionId, "", result, nil)); err != nil {
+				logger.Error(fmt.Sprintf("error encountered while handling API request: %s", err))
+				encode(w, r, http.StatusInternalServerError, newHandlerError(ErrInternalServerError, http.StatusInternalServerError))
+				return
+			}
+		}
 		encode[any](w, r, http.StatusOK, nil)
 	})
 }
@@ -547,47 +932,266 @@ func handleCreatePipeline(logger logger.ServerLogger, client *mongo.Client) http
 		res, err := database.NewPipeline(client).Create(&pipeline)
 		if err != nil {
 			logger.Error(fmt.Sprintf("error encountered while handling API request: %s", err))
-			encode(w, r, http.StatusInternalServerError, newHandlerError(ErrPipelineCreateFail, http.StatusInternalServerError))
+			encode(w, r, http.StatusInternalServerError, newHandlerError(ErrPipelineCreateFail, http.StatusInternalServerError))
+			return
+		}
+		insertedId, _ := res.InsertedID.(primitive.ObjectID)
+		pipeline.Id = insertedId
+		encode(w, r, http.StatusCreated, pipeline)
+	})
+}
+
+func handleGetPipeline(logger logger.ServerLogger, client *mongo.Client) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		pipelineId := vars["pipelineId"]
+		pipeline, err := database.NewPipeline(client).GetById(pipelineId)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			logger.Error(fmt.Sprintf("%s %s not found", "pipeline", pipelineId))
+		}
+		if err != nil {
+			logger.Error(fmt.Sprintf("error encountered while handling API request: %s", err))
+			encode(w, r, http.StatusInternalServerError, newHandlerError(ErrInternalServerError, http.StatusInternalServerError))
+			return
+		}
+		encode(w, r, http.StatusOK, pipeline)
+	})
+}
+
+func handleGetAllPipelines(logger logger.ServerLogger, client *mongo.Client) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		orgId, err := extractQueryParam[int](r.URL.Query(), "org_id", false, -1, integerConverter)
+		if err != nil {
+			logger.Error(fmt.Sprintf("unable to extract org_id from query params: %s", err))
+			encode(w, r, http.StatusBadRequest, newHandlerError(ErrInvalidOrganizationId, http.StatusBadRequest))
+			return
+		}
+		pipelines, err := database.NewPipeline(client).GetAllByOrgId(orgId)
+		if err != nil {
+			logger.Error(fmt.Sprintf("error encountered while handling API request: %s", err))
+			encode(w, r, http.StatusInternalServerError, newHandlerError(ErrInternalServerError, http.StatusInternalServerError))
+			return
+		}
+		encode(w, r, http.StatusOK, pipelines)
+	})
+}
+
+type ScheduleRequestBody struct {
+	OrganizationId  int                     `json:"org_id"`
+	CronExpression  *string                 `json:"cron_expression"`
+	TimeZone        *string                 `json:"time_zone"`
+	FormData        models.FormData         `json:"form_data"`
+	Environment     *string                 `json:"environment"`
+	MissedRunPolicy *models.MissedRunPolicy `json:"missed_run_policy"`
+	Enabled         *bool                   `json:"enabled"`
+}
+
+// Applies the fields which are set in the request body to the schedule of the pipeline and computes its next run
+func (b *ScheduleRequestBody) apply(schedule *models.ScheduleModel, pipeline *models.PipelineModel) error {
+	if b.CronExpression != nil {
+		schedule.CronExpression = *b.CronExpression
+	}
+	if b.TimeZone != nil {
+		schedule.TimeZone = *b.TimeZone
+	}
+	if b.FormData != nil {
+		schedule.FormData = b.FormData
+	}
+	if b.Environment != nil {
+		schedule.Environment = *b.Environment
+	}
+	if b.MissedRunPolicy != nil {
+		schedule.MissedRunPolicy = *b.MissedRunPolicy
+	}
+	if b.Enabled != nil {
+		schedule.Enabled = *b.Enabled
+	}
+	if !models.IsValidMissedRunPolicy(schedule.MissedRunPolicy) {
+		return fmt.Errorf("invalid missed run policy %q", schedule.MissedRunPolicy)
+	}
+	if _, err := pipeline.GetEnvironment(schedule.Environment); err != nil {
+		return fmt.Errorf("invalid environment %q", schedule.Environment)
+	}
+	nextRunAt, err := scheduler.NextRunAt(schedule.CronExpression, schedule.TimeZone, time.Now())
+	if err != nil {
+		return err
+	}
+	schedule.NextRunAt = nextRunAt
+	return nil
+}
+
+// Returns the schedule if it belongs to the pipeline and organization, or sql.ErrNoRows otherwise
+func getPipelineSchedule(client *sql.DB, pipelineId string, scheduleId string, orgId int) (*models.ScheduleModel, error) {
+	id, err := strconv.Atoi(scheduleId)
+	if err != nil {
+		return nil, sql.ErrNoRows
+	}
+	schedule, err := database.NewSchedule(client).GetById(id)
+	if err != nil {
+		return nil, err
+	}
+	if schedule.PipelineId != pipelineId || schedule.OrganizationId != orgId {
+		return nil, sql.ErrNoRows
+	}
+	return schedule, nil
+}
+
+func handleGetPipelineSchedules(logger logger.ServerLogger, psqlClient *sql.DB) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		pipelineId := mux.Vars(r)["pipelineId"]
+		orgId := r.Context().Value(util.OrgContextKey{}).(int)
+		schedules, err := database.NewSchedule(psqlClient).GetAllByPipelineId(pipelineId)
+		if err != nil {
+			logger.Error(fmt.Sprintf("error encountered while handling API request: %s", err))
+			encode(w, r, http.StatusInternalServerError, newHandlerError(ErrInternalServerError, http.StatusInternalServerError))
+			return
+		}
+		orgSchedules := []*models.ScheduleModel{}
+		for _, schedule := range schedules {
+			if schedule.OrganizationId == orgId {
+				orgSchedules = append(orgSchedules, schedule)
+			}
+		}
+		encode(w, r, http.StatusOK, orgSchedules)
+	})
+}
+
+func handleGetPipelineSchedule(logger logger.ServerLogger, psqlClient *sql.DB) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		orgId := r.Context().Value(util.OrgContextKey{}).(int)
+		schedule, err := getPipelineSchedule(psqlClient, vars["pipelineId"], vars["scheduleId"], orgId)
+		if errors.Is(err, sql.ErrNoRows) {
+			logger.Error(fmt.Sprintf("%s %s not found", "schedule", vars["scheduleId"]))
+			encode(w, r, http.StatusNotFound, newHandlerError(ErrInvalidScheduleId, http.StatusNotFound))
+			return
+		} else if err != nil {
+			logger.Error(fmt.Sprintf("error encountered while handling API request: %s", err))
+			encode(w, r, http.StatusInternalServerError, newHandlerError(ErrInternalServerError, http.StatusInternalServerError))
+			return
+		}
+		encode(w, r, http.StatusOK, schedule)
+	})
+}
+
+// Creates a schedule of the pipeline which is owned by the user creating it
+func handleCreatePipelineSchedule(logger logger.ServerLogger, mongoClient *mongo.Client, psqlClient *sql.DB) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := decode[ScheduleRequestBody](r)
+		if err != nil {
+			logger.Error(fmt.Sprintf("failed to parse json request body: %s", err))
+			encode(w, r, http.StatusBadRequest, newHandlerError(ErrJsonParseError, http.StatusBadRequest))
+			return
+		}
+
+		pipelineId := mux.Vars(r)["pipelineId"]
+		pipeline, err := database.NewPipeline(mongoClient).GetById(pipelineId)
+		if errors.Is(err, mongo.ErrNoDocuments) || (err == nil && pipeline.OrganizationId != body.OrganizationId) {
+			logger.Error(fmt.Sprintf("%s %s not found", "pipeline", pipelineId))
+			encode(w, r, http.StatusNotFound, newHandlerError(ErrInvalidPipelineId, http.StatusNotFound))
+			return
+		} else if err != nil {
+			logger.Error(fmt.Sprintf("error encountered while handling API request: %s", err))
+			encode(w, r, http.StatusInternalServerError, newHandlerError(ErrInternalServerError, http.StatusInternalServerError))
+			return
+		}
+
+		if body.CronExpression == nil {
+			logger.Error("cron expression is missing from request body")
+			encode(w, r, http.StatusBadRequest, newHandlerError(ErrInvalidSchedule, http.StatusBadRequest))
+			return
+		}
+		schedule := &models.ScheduleModel{
+			PipelineId:      pipelineId,
+			OrganizationId:  body.OrganizationId,
+			UserId:          r.Context().Value(jwtmiddleware.ContextKey{}).(*validator.ValidatedClaims).RegisteredClaims.Subject,
+			TimeZone:        "UTC",
+			FormData:        models.FormData{},
+			MissedRunPolicy: models.SkipMissedRuns,
+			Enabled:         true,
+		}
+		if err := body.apply(schedule, pipeline); err != nil {
+			logger.Error(fmt.Sprintf("invalid schedule: %s", err))
+			encode(w, r, http.StatusBadRequest, newHandlerError(fmt.Errorf("%w: %s", ErrInvalidSchedule, err), http.StatusBadRequest))
+			return
+		}
+
+		schedule, err = database.NewSchedule(psqlClient).Create(schedule)
+		if err != nil {
+			logger.Error(fmt.Sprintf("unable to create schedule: %s", err))
+			encode(w, r, http.StatusInternalServerError, newHandlerError(ErrScheduleCreateFail, http.StatusInternalServerError))
+			return
+		}
+		encode(w, r, http.StatusCreated, schedule)
+	})
+}
+
+// Updates the schedule. Its next run is computed again from the time of the update.
+func handleUpdatePipelineSchedule(logger logger.ServerLogger, mongoClient *mongo.Client, psqlClient *sql.DB) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := decode[ScheduleRequestBody](r)
+		if err != nil {
+			logger.Error(fmt.Sprintf("failed to parse json request body: %s", err))
+			encode(w, r, http.StatusBadRequest, newHandlerError(ErrJsonParseError, http.StatusBadRequest))
+			return
+		}
+
+		vars := mux.Vars(r)
+		schedule, err := getPipelineSchedule(psqlClient, vars["pipelineId"], vars["scheduleId"], body.OrganizationId)
+		if errors.Is(err, sql.ErrNoRows) {
+			logger.Error(fmt.Sprintf("%s %s not found", "schedule", vars["scheduleId"]))
+			encode(w, r, http.StatusNotFound, newHandlerError(ErrInvalidScheduleId, http.StatusNotFound))
+			return
+		} else if err != nil {
+			logger.Error(fmt.Sprintf("error encountered while handling API request: %s", err))
+			encode(w, r, http.StatusInternalServerError, newHandlerError(ErrInternalServerError, http.StatusInternalServerError))
+			return
+		}
+
+		pipeline, err := database.NewPipeline(mongoClient).GetById(schedule.PipelineId)
+		if err != nil {
+			logger.Error(fmt.Sprintf("error encountered while handling API request: %s", err))
+			encode(w, r, http.StatusInternalServerError, newHandlerError(ErrInternalServerError, http.StatusInternalServerError))
 			return
 		}
-		insertedId, _ := res.InsertedID.(primitive.ObjectID)
-		pipeline.Id = insertedId
-		encode(w, r, http.StatusCreated, pipeline)
-	})
-}
 
-func handleGetPipeline(logger logger.ServerLogger, client *mongo.Client) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		vars := mux.Vars(r)
-		pipelineId := vars["pipelineId"]
-		pipeline, err := database.NewPipeline(client).GetById(pipelineId)
-		if errors.Is(err, mongo.ErrNoDocuments) {
-			logger.Error(fmt.Sprintf("%s %s not found", "pipeline", pipelineId))
+		if err := body.apply(schedule, pipeline); err != nil {
+			logger.Error(fmt.Sprintf("invalid schedule: %s", err))
+			encode(w, r, http.StatusBadRequest, newHandlerError(fmt.Errorf("%w: %s", ErrInvalidSchedule, err), http.StatusBadRequest))
+			return
 		}
+
+		schedule, err = database.NewSchedule(psqlClient).Update(schedule)
 		if err != nil {
-			logger.Error(fmt.Sprintf("error encountered while handling API request: %s", err))
-			encode(w, r, http.StatusInternalServerError, newHandlerError(ErrInternalServerError, http.StatusInternalServerError))
+			logger.Error(fmt.Sprintf("unable to update schedule: %s", err))
+			encode(w, r, http.StatusInternalServerError, newHandlerError(ErrScheduleUpdateFail, http.StatusInternalServerError))
 			return
 		}
-		encode(w, r, http.StatusOK, pipeline)
+		encode(w, r, http.StatusOK, schedule)
 	})
 }
 
-func handleGetAllPipelines(logger logger.ServerLogger, client *mongo.Client) http.Handler {
+func handleDeletePipelineSchedule(logger logger.ServerLogger, psqlClient *sql.DB) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		orgId, err := extractQueryParam[int](r.URL.Query(), "org_id", false, -1, integerConverter)
-		if err != nil {
-			logger.Error(fmt.Sprintf("unable to extract org_id from query params: %s", err))
-			encode(w, r, http.StatusBadRequest, newHandlerError(ErrInvalidOrganizationId, http.StatusBadRequest))
+		vars := mux.Vars(r)
+		orgId := r.Context().Value(util.OrgContextKey{}).(int)
+		schedule, err := getPipelineSchedule(psqlClient, vars["pipelineId"], vars["scheduleId"], orgId)
+		if errors.Is(err, sql.ErrNoRows) {
+			logger.Error(fmt.Sprintf("%s %s not found", "schedule", vars["scheduleId"]))
+			encode(w, r, http.StatusNotFound, newHandlerError(ErrInvalidScheduleId, http.StatusNotFound))
 			return
-		}
-		pipelines, err := database.NewPipeline(client).GetAllByOrgId(orgId)
-		if err != nil {
+		} else if err != nil {
 			logger.Error(fmt.Sprintf("error encountered while handling API request: %s", err))
 			encode(w, r, http.StatusInternalServerError, newHandlerError(ErrInternalServerError, http.StatusInternalServerError))
 			return
 		}
-		encode(w, r, http.StatusOK, pipelines)
+
+		if err := database.NewSchedule(psqlClient).Delete(schedule.ScheduleId); err != nil {
+			logger.Error(fmt.Sprintf("unable to delete schedule: %s", err))
+			encode(w, r, http.StatusInternalServerError, newHandlerError(ErrScheduleDeleteFail, http.StatusInternalServerError))
+			return
+		}
+		encode[any](w, r, http.StatusOK, nil)
 	})
 }
 
@@ -621,7 +1225,7 @@ func handleCreateUser(logger logger.ServerLogger, client *sql.DB) http.Handler {
 		userId := r.Context().Value(jwtmiddleware.ContextKey{}).(*validator.ValidatedClaims).RegisteredClaims.Subject
 		um.UserId = userId
 
-		err = helper.GetAuth0UserDetailsForUser(&um)
+		err = util.GetAuth0UserDetailsForUser(&um)
 		if err != nil {
 			logger.Error(fmt.Sprintf("error encountered while retrieving user details: %s", err))
 			encode(w, r, http.StatusInternalServerError, newHandlerError(ErrInternalServerError, http.StatusInternalServerError))
@@ -1024,7 +1628,7 @@ func handleGetStepExecutionLogs(l logger.ServerLogger, psqlClient *sql.DB) http.
 			encode(w, r, http.StatusInternalServerError, newHandlerError(ErrInternalServerError, http.StatusInternalServerError))
 			return
 		}
-		endOfLogs := stepEvent.EventType != models.STEP_RUNNING
+		endOfLogs := stepEvent.EventType != models.STEP_RUNNING && stepEvent.EventType != models.STEP_RETRYING && stepEvent.EventType != models.STEP_COMPENSATING
 		response := ResponseBody{
 			StepName:  stepName,
 			Logs:      logs,
@@ -1124,6 +1728,504 @@ func handleDeleteOrganization(logger logger.ServerLogger, client *sql.DB) http.H
 	})
 }
 
+// Lists the secrets of the organization, without their values
+func handleGetOrganizationSecrets(logger logger.ServerLogger, client *sql.DB) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		orgId := r.Context().Value(util.OrgContextKey{}).(int)
+		secrets, err := database.NewSecret(client).GetAllByOrgId(orgId)
+		if err != nil {
+			logger.Error(fmt.Sprintf("unable to retrieve secrets: %s", err))
+			encode(w, r, http.StatusInternalServerError, newHandlerError(ErrSecretRetrieve, http.StatusInternalServerError))
+			return
+		}
+		encode(w, r, http.StatusOK, secrets)
+	})
+}
+
+// Creates the secret, or replaces its value if it exists. The value is encrypted before it is saved.
+func handleSetOrganizationSecret(logger logger.ServerLogger, client *sql.DB, secretCipher *helper.SecretCipher) http.Handler {
+	type RequestBody struct {
+		Value string `json:"value"`
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := decode[RequestBody](r)
+		if err != nil {
+			logger.Error(fmt.Sprintf("unable to parse json request body: %s", err))
+			encode(w, r, http.StatusBadRequest, newHandlerError(ErrJsonParseError, http.StatusBadRequest))
+			return
+		}
+		orgId := r.Context().Value(util.OrgContextKey{}).(int)
+		name := mux.Vars(r)["secretName"]
+		if !helper.IsValidSecretName(name) {
+			logger.Error(fmt.Sprintf("invalid secret name %q", name))
+			encode(w, r, http.StatusBadRequest, newHandlerError(ErrInvalidSecretName, http.StatusBadRequest))
+			return
+		}
+		if secretCipher == nil {
+			logger.Error("unable to set secret: secrets are not configured")
+			encode(w, r, http.StatusInternalServerError, newHandlerError(ErrSecretUpdateFail, http.StatusInternalServerError))
+			return
+		}
+
+		value, err := secretCipher.Encrypt(orgId, name, body.Value)
+		if err != nil {
+			logger.Error(fmt.Sprintf("unable to encrypt secret: %s", err))
+			encode(w, r, http.StatusInternalServerError, newHandlerError(ErrSecretUpdateFail, http.StatusInternalServerError))
+			return
+		}
+		userId := r.Context().Value(jwtmiddleware.ContextKey{}).(*validator.ValidatedClaims).RegisteredClaims.Subject
+		secret, err := database.NewSecret(client).Upsert(&models.SecretModel{
+			OrganizationId: orgId,
+			Name:           name,
+			Value:          value,
+			CreatedBy:      userId,
+		})
+		if err != nil {
+			logger.Error(fmt.Sprintf("unable to save secret: %s", err))
+			encode(w, r, http.StatusInternalServerError, newHandlerError(ErrSecretUpdateFail, http.StatusInternalServerError))
+			return
+		}
+		encode(w, r, http.StatusOK, secret)
+	})
+}
+
+func handleDeleteOrganizationSecret(logger logger.ServerLogger, client *sql.DB) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		orgId := r.Context().Value(util.OrgContextKey{}).(int)
+		name := mux.Vars(r)["secretName"]
+		res, err := database.NewSecret(client).Delete(orgId, name)
+		if err != nil {
+			logger.Error(fmt.Sprintf("unable to delete secret: %s", err))
+			encode(w, r, http.StatusInternalServerError, newHandlerError(ErrSecretDeleteFail, http.StatusInternalServerError))
+			return
+		}
+		if deleted, err := res.RowsAffected(); err == nil && deleted == 0 {
+			logger.Error(fmt.Sprintf("%s %s not found", "secret", name))
+			encode(w, r, http.StatusNotFound, newHandlerError(ErrSecretNotFound, http.StatusNotFound))
+			return
+		}
+		encode[any](w, r, http.StatusOK, nil)
+	})
+}
+
+// Lists the remote agents of the organization, without their tokens
+func handleGetOrganizationAgents(logger logger.ServerLogger, client *sql.DB) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		orgId := r.Context().Value(util.OrgContextKey{}).(int)
+		agents, err := database.NewAgent(client).GetAllByOrgId(orgId)
+		if err != nil {
+			logger.Error(fmt.Sprintf("unable to retrieve agents: %s", err))
+			encode(w, r, http.StatusInternalServerError, newHandlerError(ErrAgentRetrieve, http.StatusInternalServerError))
+			return
+		}
+		encode(w, r, http.StatusOK, agents)
+	})
+}
+
+// Creates a remote agent of the organization. The token of the agent is only returned in the response, as only its
+// hash is saved.
+func handleCreateOrganizationAgent(logger logger.ServerLogger, client *sql.DB) http.Handler {
+	type RequestBody struct {
+		Name string `json:"name"`
+	}
+	type ResponseBody struct {
+		*models.AgentModel
+		Token string `json:"token"`
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := decode[RequestBody](r)
+		if err != nil {
+			logger.Error(fmt.Sprintf("unable to parse json request body: %s", err))
+			encode(w, r, http.StatusBadRequest, newHandlerError(ErrJsonParseError, http.StatusBadRequest))
+			return
+		}
+		name := strings.TrimSpace(body.Name)
+		if name == "" {
+			logger.Error("missing agent name")
+			encode(w, r, http.StatusBadRequest, newHandlerError(ErrInvalidAgentName, http.StatusBadRequest))
+			return
+		}
+		token, err := helper.GenerateAgentToken()
+		if err != nil {
+			logger.Error(fmt.Sprintf("unable to generate agent token: %s", err))
+			encode(w, r, http.StatusInternalServerError, newHandlerError(ErrAgentCreateFail, http.StatusInternalServerError))
+			return
+		}
+		orgId := r.Context().Value(util.OrgContextKey{}).(int)
+		userId := r.Context().Value(jwtmiddleware.ContextKey{}).(*validator.ValidatedClaims).RegisteredClaims.Subject
+		agent, err := database.NewAgent(client).Create(&models.AgentModel{
+			OrganizationId: orgId,
+			Name:           name,
+			TokenHash:      helper.HashAgentToken(token),
+			CreatedBy:      userId,
+		})
+		if err != nil {
+			logger.Error(fmt.Sprintf("unable to save agent: %s", err))
+			encode(w, r, http.StatusInternalServerError, newHandlerError(ErrAgentCreateFail, http.StatusInternalServerError))
+			return
+		}
+		encode(w, r, http.StatusCreated, ResponseBody{AgentModel: agent, Token: token})
+	})
+}
+
+// Deletes the agent, which revokes its token. The tasks claimed by the agent are queued again for the other agents.
+func handleDeleteOrganizationAgent(logger logger.ServerLogger, client *sql.DB) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		orgId := r.Context().Value(util.OrgContextKey{}).(int)
+		agentId, err := strconv.Atoi(mux.Vars(r)["agentId"])
+		if err != nil {
+			logger.Error(fmt.Sprintf("invalid agent id: %s", err))
+			encode(w, r, http.StatusBadRequest, newHandlerError(ErrInvalidAgentId, http.StatusBadRequest))
+			return
+		}
+		res, err := database.NewAgent(client).Delete(orgId, agentId)
+		if err != nil {
+			logger.Error(fmt.Sprintf("unable to delete agent: %s", err))
+			encode(w, r, http.StatusInternalServerError, newHandlerError(ErrAgentDeleteFail, http.StatusInternalServerError))
+			return
+		}
+		if deleted, err := res.RowsAffected(); err == nil && deleted == 0 {
+			logger.Error(fmt.Sprintf("%s %d not found", "agent", agentId))
+			encode(w, r, http.StatusNotFound, newHandlerError(ErrAgentNotFound, http.StatusNotFound))
+			return
+		}
+		encode[any](w, r, http.StatusOK, nil)
+	})
+}
+
+const (
+	agentClaimTimeout      = 25 * time.Second // maximum duration of a long poll for tasks
+	agentClaimPollInterval = time.Second
+)
+
+// Claims a task which the agent can run, waiting for one to be queued if there is none. Responds with no content if no
+// task is queued before the poll times out, after which the agent polls again. The parameters of the step are returned
+// with its secrets.
+func handleClaimAgentTask(logger logger.ServerLogger, mongoClient *mongo.Client, psqlClient *sql.DB, secretCipher *helper.SecretCipher, queue events.Queue) http.Handler {
+	type RequestBody struct {
+		StepTypes []models.PipelineStepType `json:"step_types"`
+		Labels    []string                  `json:"labels"`
+	}
+	type ResponseBody struct {
+		TaskId           int                     `json:"task_id"`
+		ServiceRequestId string                  `json:"service_request_id"`
+		StepName         string                  `json:"step_name"`
+		StepType         models.PipelineStepType `json:"step_type"`
+		Parameters       map[string]any          `json:"parameters"`
+		Timeout          string                  `json:"timeout,omitempty"` // enforced by the agent
+		ExecutionId      string                  `json:"execution_id"`      // e.g. sent as the Idempotency-Key of API steps
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := decode[RequestBody](r)
+		if err != nil {
+			logger.Error(fmt.Sprintf("unable to parse json request body: %s", err))
+			encode(w, r, http.StatusBadRequest, newHandlerError(ErrJsonParseError, http.StatusBadRequest))
+			return
+		}
+		if len(body.StepTypes) == 0 {
+			logger.Error("agent polled without step types")
+			encode(w, r, http.StatusBadRequest, newHandlerError(ErrInvalidAgentStepTypes, http.StatusBadRequest))
+			return
+		}
+		agent := r.Context().Value(util.AgentContextKey{}).(*models.AgentModel)
+		agentTaskDAO := database.NewAgentTask(psqlClient)
+		pollUntil := time.Now().Add(agentClaimTimeout)
+		for {
+			task, err := agentTaskDAO.Claim(agent.OrganizationId, agent.AgentId, body.StepTypes, body.Labels)
+			if errors.Is(err, sql.ErrNoRows) {
+				if time.Now().After(pollUntil) {
+					w.WriteHeader(http.StatusNoContent)
+					return
+				}
+				select {
+				case <-r.Context().Done():
+					return
+				case <-time.After(agentClaimPollInterval):
+				}
+				continue
+			} else if err != nil {
+				logger.Error(fmt.Sprintf("unable to claim agent task: %s", err))
+				encode(w, r, http.StatusInternalServerError, newHandlerError(ErrInternalServerError, http.StatusInternalServerError))
+				return
+			}
+
+			serviceRequest, err := database.NewServiceRequest(mongoClient).GetById(task.ServiceRequestId)
+			if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+				logger.Error(fmt.Sprintf("error encountered while handling API request: %s", err))
+				encode(w, r, http.StatusInternalServerError, newHandlerError(ErrInternalServerError, http.StatusInternalServerError))
+				return
+			}
+			// Tasks which were queued before their service request stopped are not run
+			if err != nil || (serviceRequest.Status != models.RUNNING && serviceRequest.Status != models.PENDING) {
+				logger.Info(fmt.Sprintf("cancelling task %d as its service request %s is no longer running", task.TaskId, task.ServiceRequestId))
+				if err := agentTaskDAO.Cancel(task.TaskId); err != nil {
+					logger.Error(fmt.Sprintf("unable to cancel agent task %d: %s", task.TaskId, err))
+				}
+				continue
+			}
+
+			step, _, err := getAgentTaskStep(mongoClient, psqlClient, secretCipher, serviceRequest, task.StepName)
+			if err != nil {
+				// The step cannot run on any agent, e.g. when a secret of the step was deleted
+				logger.Error(fmt.Sprintf("unable to get step of agent task %d: %s", task.TaskId, err))
+				if err := queue.Publish(events.NewStepFailedEvent(task.StepName, serviceRequest, task.ExecutionId, "", fmt.Sprintf("unable to resolve step for agent: %s", err), nil)); err != nil {
+					logger.Error(fmt.Sprintf("unable to publish failure of step %s: %s", task.StepName, err))
+					encode(w, r, http.StatusInternalServerError, newHandlerError(ErrInternalServerError, http.StatusInternalServerError))
+					return
+				}
+				if _, err := agentTaskDAO.Finish(task.TaskId, agent.AgentId, models.AGENT_TASK_FAILED); err != nil {
+					logger.Error(fmt.Sprintf("unable to fail agent task %d: %s", task.TaskId, err))
+				}
+				continue
+			}
+
+			executionId, err := getAgentTaskExecutionId(psqlClient, task)
+			if err != nil {
+				logger.Error(fmt.Sprintf("error encountered while handling API request: %s", err))
+				encode(w, r, http.StatusInternalServerError, newHandlerError(ErrInternalServerError, http.StatusInternalServerError))
+				return
+			}
+
+			logger.Info(fmt.Sprintf("agent %d claimed task %d of step %s of service request %s", agent.AgentId, task.TaskId, task.StepName, task.ServiceRequestId))
+			encode(w, r, http.StatusOK, ResponseBody{
+				TaskId:           task.TaskId,
+				ServiceRequestId: task.ServiceRequestId,
+				StepName:         task.StepName,
+				StepType:         task.StepType,
+				Parameters:       step.Parameters,
+				Timeout:          step.Timeout,
+				ExecutionId:      executionId,
+			})
+			return
+		}
+	})
+}
+
+// Appends log lines of the agent to the logs of the step of the task, with the secrets of the step redacted. The
+// response tells the agent whether the service request has been cancelled or has failed, in which case the agent may
+// stop running the step. Agents append to the logs, with no lines if there are none, to renew the lease of the task.
+func handleAppendAgentTaskLogs(l logger.ServerLogger, mongoClient *mongo.Client, psqlClient *sql.DB, secretCipher *helper.SecretCipher) http.Handler {
+	type RequestBody struct {
+		Lines []string `json:"lines"`
+	}
+	type ResponseBody struct {
+		Cancelled bool `json:"cancelled"`
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := decode[RequestBody](r)
+		if err != nil {
+			l.Error(fmt.Sprintf("unable to parse json request body: %s", err))
+			encode(w, r, http.StatusBadRequest, newHandlerError(ErrJsonParseError, http.StatusBadRequest))
+			return
+		}
+		task, ok := getClaimedAgentTask(l, psqlClient, w, r)
+		if !ok {
+			return
+		}
+		// Appending to the logs shows that the agent is still running the task, which renews its lease
+		if _, err := database.NewAgentTask(psqlClient).RenewLease(task.TaskId, *task.AgentId); err != nil {
+			l.Error(fmt.Sprintf("unable to renew lease of agent task %d: %s", task.TaskId, err))
+			encode(w, r, http.StatusInternalServerError, newHandlerError(ErrInternalServerError, http.StatusInternalServerError))
+			return
+		}
+		serviceRequest, err := database.NewServiceRequest(mongoClient).GetById(task.ServiceRequestId)
+		if err != nil {
+			l.Error(fmt.Sprintf("error encountered while handling API request: %s", err))
+			encode(w, r, http.StatusInternalServerError, newHandlerError(ErrInternalServerError, http.StatusInternalServerError))
+			return
+		}
+		_, secretValues, err := getAgentTaskStep(mongoClient, psqlClient, secretCipher, serviceRequest, task.StepName)
+		if err != nil {
+			l.Error(fmt.Sprintf("unable to get step of agent task %d: %s", task.TaskId, err))
+			encode(w, r, http.StatusInternalServerError, newHandlerError(ErrInternalServerError, http.StatusInternalServerError))
+			return
+		}
+
+		if err := logger.CreateExecutorLogDir(task.ServiceRequestId); err != nil {
+			l.Error(fmt.Sprintf("error encountered while handling API request: %s", err))
+			encode(w, r, http.StatusInternalServerError, newHandlerError(ErrInternalServerError, http.StatusInternalServerError))
+			return
+		}
+		f, err := logger.GetExecutorLogFileForWrite(task.ServiceRequestId, task.StepName)
+		if err != nil {
+			l.Error(fmt.Sprintf("error encountered while handling API request: %s", err))
+			encode(w, r, http.StatusInternalServerError, newHandlerError(ErrInternalServerError, http.StatusInternalServerError))
+			return
+		}
+		defer f.Close()
+		executor_logger := logger.NewExecutorLogger(helper.NewRedactingWriter(f, secretValues), task.StepName)
+		for _, line := range body.Lines {
+			executor_logger.Info(line)
+		}
+		encode(w, r, http.StatusOK, ResponseBody{Cancelled: serviceRequest.Status == models.CANCELLED || serviceRequest.Status == models.FAILED})
+	})
+}
+
+// Records that the agent completed the step of the task, which then proceeds in the same way as steps run by the
+// backend. The output of the step can be referenced by later steps.
+func handleCompleteAgentTask(logger logger.ServerLogger, mongoClient *mongo.Client, psqlClient *sql.DB, secretCipher *helper.SecretCipher, queue events.Queue) http.Handler {
+	type RequestBody struct {
+		Output map[string]any `json:"output"`
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := decode[RequestBody](r)
+		if err != nil {
+			logger.Error(fmt.Sprintf("unable to parse json request body: %s", err))
+			encode(w, r, http.StatusBadRequest, newHandlerError(ErrJsonParseError, http.StatusBadRequest))
+			return
+		}
+		finishAgentTask(logger, mongoClient, psqlClient, secretCipher, queue, w, r, models.AGENT_TASK_COMPLETED, func(serviceRequest *models.ServiceRequestModel, task *models.AgentTaskModel, executionId string, secretValues []string) events.Event {
+			var output map[string]any
+			if body.Output != nil {
+				output = helper.RedactSecretsInValue(body.Output, secretValues).(map[string]any)
+			}
+			return events.NewStepCompletedEvent(task.StepName, task.ServiceRequestId, executionId, "", &execute.StepExecResult{Output: output}, nil)
+		})
+	})
+}
+
+// Records that the step of the task failed on the agent, which is handled in the same way as the failure of steps run
+// by the backend
+func handleFailAgentTask(logger logger.ServerLogger, mongoClient *mongo.Client, psqlClient *sql.DB, secretCipher *helper.SecretCipher, queue events.Queue) http.Handler {
+	type RequestBody struct {
+		Error string `json:"error"`
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := decode[RequestBody](r)
+		if err != nil {
+			logger.Error(fmt.Sprintf("unable to parse json request body: %s", err))
+			encode(w, r, http.StatusBadRequest, newHandlerError(ErrJsonParseError, http.StatusBadRequest))
+			return
+		}
+		agent := r.Context().Value(util.AgentContextKey{}).(*models.AgentModel)
+		finishAgentTask(logger, mongoClient, psqlClient, secretCipher, queue, w, r, models.AGENT_TASK_FAILED, func(serviceRequest *models.ServiceRequestModel, task *models.AgentTaskModel, executionId string, secretValues []string) events.Event {
+			reason := fmt.Sprintf("step failed on agent %s", agent.Name)
+			if body.Error != "" {
+				reason = fmt.Sprintf("%s: %s", reason, helper.RedactSecrets(body.Error, secretValues))
+			}
+			return events.NewStepFailedEvent(task.StepName, serviceRequest, executionId, "", reason, nil)
+		})
+	})
+}
+
+// Publishes the event of the task reported by the agent, and records the status of the task. Reports are serialised
+// with the execution of the service request, so that the agent can only report on the task once. The report is of the
+// execution which the task is run for, so reports on tasks of attempts which are no longer running are ignored.
+func finishAgentTask(logger logger.ServerLogger, mongoClient *mongo.Client, psqlClient *sql.DB, secretCipher *helper.SecretCipher, queue events.Queue, w http.ResponseWriter, r *http.Request, status models.AgentTaskStatus, newEvent func(*models.ServiceRequestModel, *models.AgentTaskModel, string, []string) events.Event) {
+	task, ok := getClaimedAgentTask(logger, psqlClient, w, r)
+	if !ok {
+		return
+	}
+	unlock, err := database.NewLock(psqlClient).Acquire(fmt.Sprintf("service_request/%s", task.ServiceRequestId))
+	if err != nil {
+		logger.Error(fmt.Sprintf("error encountered while handling API request: %s", err))
+		encode(w, r, http.StatusInternalServerError, newHandlerError(ErrInternalServerError, http.StatusInternalServerError))
+		return
+	}
+	defer unlock()
+
+	// The agent may have reported on the task while waiting for the lock
+	task, ok = getClaimedAgentTask(logger, psqlClient, w, r)
+	if !ok {
+		return
+	}
+	serviceRequest, err := database.NewServiceRequest(mongoClient).GetById(task.ServiceRequestId)
+	if err != nil {
+		logger.Error(fmt.Sprintf("error encountered while handling API request: %s", err))
+		encode(w, r, http.StatusInternalServerError, newHandlerError(ErrInternalServerError, http.StatusInternalServerError))
+		return
+	}
+	_, secretValues, err := getAgentTaskStep(mongoClient, psqlClient, secretCipher, serviceRequest, task.StepName)
+	if err != nil {
+		logger.Error(fmt.Sprintf("unable to get step of agent task %d: %s", task.TaskId, err))
+		encode(w, r, http.StatusInternalServerError, newHandlerError(ErrInternalServerError, http.StatusInternalServerError))
+		return
+	}
+
+	executionId, err := getAgentTaskExecutionId(psqlClient, task)
+	if err != nil {
+		logger.Error(fmt.Sprintf("error encountered while handling API request: %s", err))
+		encode(w, r, http.StatusInternalServerError, newHandlerError(ErrInternalServerError, http.StatusInternalServerError))
+		return
+	}
+
+	// The task is only finished once the event is published, so that the agent can report again if publishing fails
+	if err := queue.Publish(newEvent(serviceRequest, task, executionId, secretValues)); err != nil {
+		logger.Error(fmt.Sprintf("unable to publish %s of step %s: %s", status, task.StepName, err))
+		encode(w, r, http.StatusInternalServerError, newHandlerError(ErrInternalServerError, http.StatusInternalServerError))
+		return
+	}
+	if _, err := database.NewAgentTask(psqlClient).Finish(task.TaskId, *task.AgentId, status); err != nil {
+		logger.Error(fmt.Sprintf("unable to record agent task %d as %s: %s", task.TaskId, status, err))
+		encode(w, r, http.StatusInternalServerError, newHandlerError(ErrInternalServerError, http.StatusInternalServerError))
+		return
+	}
+	logger.Info(fmt.Sprintf("task %d of step %s of service request %s %s", task.TaskId, task.StepName, task.ServiceRequestId, status))
+	encode[any](w, r, http.StatusOK, nil)
+}
+
+// Returns the execution of the step which the task is run for. Tasks queued before tasks had execution IDs are run for
+// the latest execution of the step.
+func getAgentTaskExecutionId(psqlClient *sql.DB, task *models.AgentTaskModel) (string, error) {
+	if task.ExecutionId != "" {
+		return task.ExecutionId, nil
+	}
+	latestEvent, err := database.NewServiceRequestEvent(psqlClient).GetStepLatestEvent(task.ServiceRequestId, task.StepName)
+	if err != nil {
+		return "", err
+	}
+	return latestEvent.ExecutionId, nil
+}
+
+// Returns the task in the path if it is claimed by the agent of the request, and responds with an error otherwise.
+// Tasks of other organizations are not found.
+func getClaimedAgentTask(logger logger.ServerLogger, psqlClient *sql.DB, w http.ResponseWriter, r *http.Request) (*models.AgentTaskModel, bool) {
+	agent := r.Context().Value(util.AgentContextKey{}).(*models.AgentModel)
+	taskId, err := strconv.Atoi(mux.Vars(r)["taskId"])
+	if err != nil {
+		logger.Error(fmt.Sprintf("invalid agent task id: %s", err))
+		encode(w, r, http.StatusBadRequest, newHandlerError(ErrInvalidAgentTaskId, http.StatusBadRequest))
+		return nil, false
+	}
+	task, err := database.NewAgentTask(psqlClient).GetById(taskId)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && task.OrganizationId != agent.OrganizationId) {
+		logger.Error(fmt.Sprintf("%s %d not found", "agent task", taskId))
+		encode(w, r, http.StatusNotFound, newHandlerError(ErrInvalidAgentTaskId, http.StatusNotFound))
+		return nil, false
+	} else if err != nil {
+		logger.Error(fmt.Sprintf("error encountered while handling API request: %s", err))
+		encode(w, r, http.StatusInternalServerError, newHandlerError(ErrInternalServerError, http.StatusInternalServerError))
+		return nil, false
+	}
+	if task.Status != models.AGENT_TASK_CLAIMED || task.AgentId == nil || *task.AgentId != agent.AgentId {
+		logger.Error(fmt.Sprintf("agent task %d is %s and not claimed by agent %d", taskId, task.Status, agent.AgentId))
+		encode(w, r, http.StatusConflict, newHandlerError(ErrAgentTaskNotClaimed, http.StatusConflict))
+		return nil, false
+	}
+	return task, true
+}
+
+// Returns the step of the service request run by an agent, with the parameters it was rendered with and the secrets of
+// the organization, along with the values of the secrets so that they can be redacted from what the agent reports
+func getAgentTaskStep(mongoClient *mongo.Client, psqlClient *sql.DB, secretCipher *helper.SecretCipher, serviceRequest *models.ServiceRequestModel, stepName string) (*models.PipelineStepModel, []string, error) {
+	pipeline, err := database.NewPipeline(mongoClient).GetById(serviceRequest.PipelineId)
+	if err != nil {
+		return nil, nil, err
+	}
+	step := pipeline.GetPipelineStep(stepName)
+	if step == nil {
+		return nil, nil, fmt.Errorf("step %s not found in pipeline", stepName)
+	}
+	srsm, err := database.NewServiceRequestStep(mongoClient).GetByServiceRequestIdAndStepName(serviceRequest.Id.Hex(), stepName)
+	if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil, err
+	}
+	if err == nil && srsm.Parameters != nil {
+		step.Parameters = srsm.Parameters
+	}
+	return execute.ResolveSecrets(psqlClient, secretCipher, serviceRequest.OrganizationId, step)
+}
+
 func handleGetMembershipsForUser(logger logger.ServerLogger, client *sql.DB) http.Handler {
 	type ResponseBodyMembership struct {
 		OrgId    int         `json:"org_id"`
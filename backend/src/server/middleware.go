@@ -17,6 +17,7 @@ import (
 	"github.com/gorilla/mux"
 	"github.com/joshtyf/flowforge/src/database"
 	"github.com/joshtyf/flowforge/src/database/models"
+	"github.com/joshtyf/flowforge/src/helper"
 	"github.com/joshtyf/flowforge/src/logger"
 	"github.com/joshtyf/flowforge/src/util"
 	"github.com/joshtyf/flowforge/src/validation"
@@ -188,6 +189,35 @@ func isOrgMember(postgresClient *sql.DB, next http.Handler, logger logger.Server
 	})
 }
 
+// Authenticates remote agents by the token in the X-Agent-Token header, and adds the agent to the request context
+func isAgent(postgresClient *sql.DB, next http.Handler, logger logger.ServerLogger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := r.Header.Get("X-Agent-Token")
+		if !helper.IsAgentToken(token) {
+			logger.Error("missing or malformed agent token")
+			encode(w, r, http.StatusUnauthorized, newHandlerError(ErrInvalidAgentToken, http.StatusUnauthorized))
+			return
+		}
+		agentDAO := database.NewAgent(postgresClient)
+		agent, err := agentDAO.GetByTokenHash(helper.HashAgentToken(token))
+		if errors.Is(err, sql.ErrNoRows) {
+			logger.Error("unknown agent token")
+			encode(w, r, http.StatusUnauthorized, newHandlerError(ErrInvalidAgentToken, http.StatusUnauthorized))
+			return
+		} else if err != nil {
+			logger.Error(fmt.Sprintf("unable to verify agent token: %s", err))
+			encode(w, r, http.StatusInternalServerError, newHandlerError(ErrInternalServerError, http.StatusInternalServerError))
+			return
+		}
+		if err := agentDAO.UpdateLastSeenOn(agent.AgentId); err != nil {
+			logger.Error(fmt.Sprintf("unable to update last seen time of agent %d: %s", agent.AgentId, err))
+		}
+
+		r = r.Clone(context.WithValue(r.Context(), util.AgentContextKey{}, agent))
+		next.ServeHTTP(w, r)
+	})
+}
+
 func getOrgIdFromQuery(next http.Handler, logger logger.ServerLogger) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		var org_id int
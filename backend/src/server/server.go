@@ -6,20 +6,25 @@ import (
 
 	"github.com/gorilla/handlers"
 	"github.com/gorilla/mux"
+	"github.com/joshtyf/flowforge/src/events"
+	"github.com/joshtyf/flowforge/src/helper"
 	"github.com/joshtyf/flowforge/src/logger"
 	"go.mongodb.org/mongo-driver/mongo"
 )
 
 type ServerConfig struct {
-	Address      string
-	Router       *mux.Router
-	PsqlClient   *sql.DB
-	MongoClient  *mongo.Client
-	ServerLogger logger.ServerLogger
+	Address        string
+	Router         *mux.Router
+	PsqlClient     *sql.DB
+	MongoClient    *mongo.Client
+	Queue          events.Queue
+	CallbackSigner *helper.CallbackSigner
+	SecretCipher   *helper.SecretCipher
+	ServerLogger   logger.ServerLogger
 }
 
 func New(c *ServerConfig) http.Server {
-	serverHandler := NewServerHandler(c.PsqlClient, c.MongoClient, c.ServerLogger)
+	serverHandler := NewServerHandler(c.PsqlClient, c.MongoClient, c.Queue, c.CallbackSigner, c.SecretCipher, c.ServerLogger)
 	serverHandler.registerRoutes(c.Router)
 	return http.Server{
 		Addr: c.Address,
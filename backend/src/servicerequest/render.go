@@ -0,0 +1,145 @@
+package servicerequest
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/joshtyf/flowforge/src/database/models"
+	"github.com/joshtyf/flowforge/src/helper"
+)
+
+// The key of the variables of the pipeline in the values of placeholders, which are referenced by ${vars.NAME}
+const VariablesKey = "vars"
+
+// The key of the form data in the values of placeholders, e.g. ${form.owner.email}
+const FormDataKey = "form"
+
+// Form fields cannot have these names, as the values of placeholders with these keys are not form data
+var ReservedFormFieldNames = []string{"steps", FormDataKey, "secrets", "callbacks", VariablesKey}
+
+// Values with these paths only exist once the service request runs, e.g. the outputs of steps and secrets
+var runtimePathPrefixes = []string{"steps.", "callbacks.", helper.SecretPathPrefix}
+
+// A step of a pipeline with its parameters rendered with the form data of a service request
+type RenderedStep struct {
+	StepName   string                  `json:"step_name"`
+	StepType   models.PipelineStepType `json:"step_type"`
+	Parameters map[string]any          `json:"parameters"`
+	// Placeholders which have no value in the form data
+	UnresolvedPlaceholders []string `json:"unresolved_placeholders"`
+	// Placeholders which are replaced when the service request runs
+	RuntimePlaceholders []string      `json:"runtime_placeholders"`
+	Errors              []string      `json:"errors"`
+	Compensation        *RenderedStep `json:"compensation,omitempty"`
+}
+
+// Returns true if the parameters of the step, and those of its compensation, can be rendered when the service request runs
+func (s *RenderedStep) IsValid() bool {
+	if len(s.UnresolvedPlaceholders) > 0 || len(s.Errors) > 0 {
+		return false
+	}
+	return s.Compensation == nil || s.Compensation.IsValid()
+}
+
+// Renders the parameters of every step of the pipeline with the form data and the variables of the environment, in the
+// same way as when a service request of the pipeline runs. Placeholders which cannot be replaced are left in the
+// parameters. Nothing is executed or saved.
+func Render(pipeline *models.PipelineModel, environment string, formData models.FormData) []*RenderedStep {
+	values := make(map[string]any, len(formData)+2)
+	for k, v := range formData {
+		values[k] = v
+	}
+	values[FormDataKey] = map[string]any(formData)
+	values[VariablesKey] = pipeline.GetVariables(environment)
+	renderedSteps := make([]*RenderedStep, 0, len(pipeline.Steps))
+	for _, step := range pipeline.Steps {
+		renderedStep := renderStep(&step, values)
+		if compensationStep := step.GetCompensationStep(); compensationStep != nil {
+			renderedStep.Compensation = renderStep(compensationStep, values)
+		}
+		renderedSteps = append(renderedSteps, renderedStep)
+	}
+	return renderedSteps
+}
+
+func renderStep(step *models.PipelineStepModel, values map[string]any) *RenderedStep {
+	renderedStep := &RenderedStep{
+		StepName:               step.StepName,
+		StepType:               step.StepType,
+		Parameters:             make(map[string]any, len(step.Parameters)),
+		UnresolvedPlaceholders: make([]string, 0),
+		RuntimePlaceholders:    make([]string, 0),
+		Errors:                 make([]string, 0),
+	}
+	keys := make([]string, 0, len(step.Parameters))
+	for key := range step.Parameters {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		parameter, err := RenderVariables(step.Parameters[key], values[VariablesKey])
+		if err != nil {
+			renderedStep.Parameters[key] = step.Parameters[key]
+			renderedStep.Errors = append(renderedStep.Errors, fmt.Sprintf("parameter %s: %s", key, err))
+			continue
+		}
+		// Placeholders referencing runtime values are left as is, rather than replaced with their defaults
+		rendered, unresolved, err := helper.RenderPlaceholdersIf(parameter, values, func(placeholder string) bool {
+			return !isRuntimePlaceholder(placeholder)
+		})
+		if err != nil {
+			renderedStep.Parameters[key] = step.Parameters[key]
+			renderedStep.Errors = append(renderedStep.Errors, fmt.Sprintf("parameter %s: %s", key, err))
+			continue
+		}
+		renderedStep.Parameters[key] = rendered
+		for _, placeholder := range unresolved {
+			if isRuntimePlaceholder(placeholder) {
+				renderedStep.RuntimePlaceholders = appendIfMissing(renderedStep.RuntimePlaceholders, placeholder)
+			} else {
+				renderedStep.UnresolvedPlaceholders = appendIfMissing(renderedStep.UnresolvedPlaceholders, placeholder)
+			}
+		}
+	}
+	return renderedStep
+}
+
+// Returns true if the placeholder references a value which only exists once the service request runs
+func isRuntimePlaceholder(placeholder string) bool {
+	for _, identifier := range helper.PlaceholderIdentifiers(placeholder) {
+		for _, prefix := range runtimePathPrefixes {
+			if strings.HasPrefix(identifier, prefix) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func appendIfMissing(s []string, elem string) []string {
+	if slices.Contains(s, elem) {
+		return s
+	}
+	return append(s, elem)
+}
+
+// Replaces the placeholders in a parameter which only reference variables, e.g. ${vars.NAME}, with the variables of the
+// pipeline, leaving the other placeholders in the parameter. Variables are written by the authors of the pipeline, so
+// the placeholders in their values, e.g. of secrets, are rendered as if they were written in the parameter.
+func RenderVariables(parameter any, variables any) (any, error) {
+	rendered, _, err := helper.RenderPlaceholdersIf(parameter, map[string]any{VariablesKey: variables}, IsVariablePlaceholder)
+	return rendered, err
+}
+
+// Returns true if the placeholder only references variables of the pipeline
+func IsVariablePlaceholder(placeholder string) bool {
+	identifiers := helper.PlaceholderIdentifiers(placeholder)
+	for _, identifier := range identifiers {
+		if !strings.HasPrefix(identifier, VariablesKey+".") {
+			return false
+		}
+	}
+	return len(identifiers) > 0
+}
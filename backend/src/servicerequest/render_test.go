@@ -0,0 +1,151 @@
+package servicerequest
+
+import (
+	"reflect"
+	"slices"
+	"testing"
+
+	"github.com/joshtyf/flowforge/src/database/models"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestRender(t *testing.T) {
+	pipeline := &models.PipelineModel{
+		Steps: []models.PipelineStepModel{
+			{
+				StepName: "create_vm",
+				StepType: models.APIStep,
+				Parameters: map[string]any{
+					"url":  "https://example.com/vms/${name}",
+					"body": map[string]any{"size": "${size}"},
+				},
+				Compensation: &models.PipelineStepCompensation{
+					StepType:   models.APIStep,
+					Parameters: map[string]any{"url": "https://example.com/vms/${steps.create_vm.body.id}"},
+				},
+			},
+			{
+				StepName:   "configure_vm",
+				StepType:   models.ScriptStep,
+				Parameters: map[string]any{"command": "configure", "args": bson.A{"${steps.create_vm.body.id}"}, "cpu": 2, "memory": uint8(1)},
+			},
+		},
+	}
+	renderedSteps := Render(pipeline, "", models.FormData{"name": "vm-1"})
+	if len(renderedSteps) != 2 {
+		t.Fatalf("Expected 2 rendered steps, got %d", len(renderedSteps))
+	}
+
+	t.Run("Step with unresolved placeholders", func(t *testing.T) {
+		step := renderedSteps[0]
+		expected := map[string]any{
+			"url":  "https://example.com/vms/vm-1",
+			"body": map[string]any{"size": "${size}"},
+		}
+		if !reflect.DeepEqual(step.Parameters, expected) {
+			t.Errorf("Expected parameters %v, got %v", expected, step.Parameters)
+		}
+		if !slices.Equal(step.UnresolvedPlaceholders, []string{"${size}"}) {
+			t.Errorf("Expected unresolved placeholders [${size}], got %v", step.UnresolvedPlaceholders)
+		}
+		if step.Compensation == nil || !slices.Equal(step.Compensation.RuntimePlaceholders, []string{"${steps.create_vm.body.id}"}) {
+			t.Errorf("Expected compensation with runtime placeholder, got %v", step.Compensation)
+		}
+		if step.IsValid() {
+			t.Errorf("Expected step to be invalid")
+		}
+	})
+
+	t.Run("Step with type error", func(t *testing.T) {
+		step := renderedSteps[1]
+		if !slices.Equal(step.RuntimePlaceholders, []string{"${steps.create_vm.body.id}"}) {
+			t.Errorf("Expected runtime placeholders [${steps.create_vm.body.id}], got %v", step.RuntimePlaceholders)
+		}
+		if step.Parameters["cpu"] != 2 {
+			t.Errorf("Expected parameter cpu to be 2, got %v", step.Parameters["cpu"])
+		}
+		if len(step.Errors) != 1 || step.Parameters["memory"] != uint8(1) {
+			t.Errorf("Expected error for parameter memory, got %v", step.Errors)
+		}
+	})
+
+	t.Run("Pipeline is not modified", func(t *testing.T) {
+		if pipeline.Steps[0].Parameters["url"] != "https://example.com/vms/${name}" {
+			t.Errorf("Expected parameters of the pipeline to be unchanged, got %v", pipeline.Steps[0].Parameters)
+		}
+	})
+}
+
+func TestRenderVariables(t *testing.T) {
+	pipeline := &models.PipelineModel{
+		Variables: map[string]any{"base_url": "https://staging.example.com", "token": "${secrets.STAGING_TOKEN}"},
+		Environments: map[string]models.PipelineEnvironment{
+			"prod": {Variables: map[string]any{"base_url": "https://example.com", "token": "${secrets.PROD_TOKEN}"}},
+		},
+		Steps: []models.PipelineStepModel{
+			{
+				StepName: "create_vm",
+				StepType: models.APIStep,
+				Parameters: map[string]any{
+					"url":     "${vars.base_url}/vms/${name}",
+					"headers": map[string]any{"Authorization": "Bearer ${vars.token}"},
+					"region":  "${vars.region}",
+				},
+			},
+		},
+	}
+	testCases := []struct {
+		name                string
+		environment         string
+		expectedUrl         string
+		expectedPlaceholder string
+	}{
+		{"Variables of the pipeline", "", "https://staging.example.com/vms/vm-1", "${secrets.STAGING_TOKEN}"},
+		{"Variables of the environment", "prod", "https://example.com/vms/vm-1", "${secrets.PROD_TOKEN}"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			step := Render(pipeline, tc.environment, models.FormData{"name": "vm-1"})[0]
+			if step.Parameters["url"] != tc.expectedUrl {
+				t.Errorf("Expected url %s, got %v", tc.expectedUrl, step.Parameters["url"])
+			}
+			if !slices.Equal(step.RuntimePlaceholders, []string{tc.expectedPlaceholder}) {
+				t.Errorf("Expected runtime placeholders [%s], got %v", tc.expectedPlaceholder, step.RuntimePlaceholders)
+			}
+			if !slices.Equal(step.UnresolvedPlaceholders, []string{"${vars.region}"}) {
+				t.Errorf("Expected unresolved placeholders [${vars.region}], got %v", step.UnresolvedPlaceholders)
+			}
+		})
+	}
+}
+
+func TestRenderExpressions(t *testing.T) {
+	pipeline := &models.PipelineModel{
+		Steps: []models.PipelineStepModel{
+			{
+				StepName: "create_vm",
+				StepType: models.APIStep,
+				Parameters: map[string]any{
+					"url":    "https://example.com/vms/${form.name | upper}",
+					"region": "${region | default \"us-east-1\"}",
+					"owner":  "${steps.get_owner.body.email | default \"admin@example.com\"}",
+				},
+			},
+		},
+	}
+	step := Render(pipeline, "", models.FormData{"name": "vm-1"})[0]
+	expected := map[string]any{
+		"url":    "https://example.com/vms/VM-1",
+		"region": "us-east-1",
+		"owner":  "${steps.get_owner.body.email | default \"admin@example.com\"}",
+	}
+	if !reflect.DeepEqual(step.Parameters, expected) {
+		t.Errorf("Expected parameters %v, got %v", expected, step.Parameters)
+	}
+	if !slices.Equal(step.RuntimePlaceholders, []string{expected["owner"].(string)}) {
+		t.Errorf("Expected runtime placeholders [%s], got %v", expected["owner"], step.RuntimePlaceholders)
+	}
+	if !step.IsValid() {
+		t.Errorf("Expected step to be valid")
+	}
+}
@@ -0,0 +1,93 @@
+package servicerequest
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/joshtyf/flowforge/src/database"
+	"github.com/joshtyf/flowforge/src/database/models"
+	"github.com/joshtyf/flowforge/src/events"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Creates a service request of the pipeline, which is not started, and records the initial event of each step.
+// The id of the service request is set once it is created. Service requests which do not choose an environment run in
+// the default environment of the pipeline.
+func Create(mongoClient *mongo.Client, psqlClient *sql.DB, srm *models.ServiceRequestModel, pipeline *models.PipelineModel) error {
+	environment, err := pipeline.GetEnvironment(srm.Environment)
+	if err != nil {
+		return err
+	}
+	srm.Environment = environment
+	srm.CreatedOn = time.Now()
+	srm.LastUpdated = time.Now()
+	srm.Status = models.NOT_STARTED
+	srm.PipelineId = pipeline.Id.Hex()
+	srm.PipelineName = pipeline.PipelineName
+	srm.PipelineVersion = pipeline.Version
+
+	res, err := database.NewServiceRequest(mongoClient).Create(srm)
+	if err != nil {
+		return err
+	}
+	srm.Id = res.InsertedID.(primitive.ObjectID)
+
+	stepEventDAO := database.NewServiceRequestEvent(psqlClient)
+	for _, step := range pipeline.Steps {
+		err = stepEventDAO.Create(&models.ServiceRequestEventModel{
+			EventType:        models.STEP_NOT_STARTED,
+			ServiceRequestId: srm.Id.Hex(),
+			StepName:         step.StepName,
+			StepType:         step.StepType,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Starts the execution of a service request which has been created
+func Start(queue events.Queue, srm *models.ServiceRequestModel) error {
+	return queue.Publish(events.NewNewServiceRequestEvent(srm))
+}
+
+// Cancels a service request which has not finished. Steps which are waiting to be completed, e.g. by an approval or a
+// child service request, are recorded as cancelled, and the steps which have completed are compensated.
+func Cancel(mongoClient *mongo.Client, psqlClient *sql.DB, queue events.Queue, srm *models.ServiceRequestModel, cancelledBy string) error {
+	// Serialise with the execution of the service request, so that no step completes while it is being cancelled
+	unlock, err := database.NewLock(psqlClient).Acquire(fmt.Sprintf("service_request/%s", srm.Id.Hex()))
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if err := database.NewServiceRequest(mongoClient).UpdateStatus(srm.Id.Hex(), models.CANCELLED); err != nil {
+		return err
+	}
+	stepEventDAO := database.NewServiceRequestEvent(psqlClient)
+	stepsLatestEvent, err := stepEventDAO.GetStepsLatestEvent(srm.Id.Hex())
+	if err != nil {
+		return err
+	}
+	for _, event := range stepsLatestEvent {
+		if event.EventType != models.STEP_RUNNING || !models.IsCancellablePipelineStepType(event.StepType) {
+			continue
+		}
+		err = stepEventDAO.Create(&models.ServiceRequestEventModel{
+			EventType:        models.STEP_CANCELLED,
+			ServiceRequestId: srm.Id.Hex(),
+			StepName:         event.StepName,
+			CreatedBy:        cancelledBy,
+			StepType:         event.StepType,
+			ExecutionId:      event.ExecutionId,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	// Undo the steps which have completed
+	return queue.Publish(events.NewCompensateEvent(srm.Id.Hex()))
+}
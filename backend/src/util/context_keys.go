@@ -11,3 +11,5 @@ const (
 )
 
 type OrgContextKey struct{}
+
+type AgentContextKey struct{}
@@ -199,3 +199,79 @@ func NewInvalidSelectedFormDataError(expectedValues []string, receivedValue stri
 func (e *InvalidSelectedFormDataError) Error() string {
 	return fmt.Sprintf("expected selected value to be one of '%s', got '%s' instead", strings.Join(e.expectedValues, ","), e.receivedValue)
 }
+
+type InvalidBranchConditionError struct {
+	stepName  string
+	condition string
+	err       error
+}
+
+func NewInvalidBranchConditionError(stepName, condition string, err error) *InvalidBranchConditionError {
+	return &InvalidBranchConditionError{
+		stepName:  stepName,
+		condition: condition,
+		err:       err,
+	}
+}
+
+func (e *InvalidBranchConditionError) Error() string {
+	return fmt.Sprintf("invalid branch condition '%s' for step '%s': %s", e.condition, e.stepName, e.err)
+}
+
+type InvalidPlaceholderError struct {
+	stepName string
+	err      error
+}
+
+func NewInvalidPlaceholderError(stepName string, err error) *InvalidPlaceholderError {
+	return &InvalidPlaceholderError{
+		stepName: stepName,
+		err:      err,
+	}
+}
+
+func (e *InvalidPlaceholderError) Error() string {
+	return fmt.Sprintf("invalid placeholder in parameters of step '%s': %s", e.stepName, e.err)
+}
+
+type TerminalBranchStepError struct {
+	stepName string
+}
+
+func NewTerminalBranchStepError(stepName string) *TerminalBranchStepError {
+	return &TerminalBranchStepError{
+		stepName: stepName,
+	}
+}
+
+func (e *TerminalBranchStepError) Error() string {
+	return fmt.Sprintf("branch step '%s' cannot be a terminal step", e.stepName)
+}
+
+type UnreachableStepError struct {
+	stepName string
+}
+
+func NewUnreachableStepError(stepName string) *UnreachableStepError {
+	return &UnreachableStepError{
+		stepName: stepName,
+	}
+}
+
+func (e *UnreachableStepError) Error() string {
+	return fmt.Sprintf("step '%s' cannot be reached from the first step", e.stepName)
+}
+
+type ReservedFormFieldNameError struct {
+	fieldName string
+}
+
+func NewReservedFormFieldNameError(fieldName string) *ReservedFormFieldNameError {
+	return &ReservedFormFieldNameError{
+		fieldName: fieldName,
+	}
+}
+
+func (e *ReservedFormFieldNameError) Error() string {
+	return fmt.Sprintf("form field name '%s' is reserved", e.fieldName)
+}
@@ -1,10 +1,16 @@
 package validation
 
 import (
+	"errors"
 	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/joshtyf/flowforge/src/database/models"
 	"github.com/joshtyf/flowforge/src/helper"
+	"github.com/joshtyf/flowforge/src/servicerequest"
 )
 
 func ValidatePipeline(pipeline *models.PipelineModel) error {
@@ -20,9 +26,19 @@ func ValidatePipeline(pipeline *models.PipelineModel) error {
 	if pipeline.FirstStepName == "" {
 		return NewMissingRequiredFieldError("first_step_name")
 	}
+	if pipeline.Timeout != "" && !isValidTimeout(pipeline.Timeout) {
+		return NewInvalidPropertyValue("timeout")
+	}
+	if err := validateVariables(pipeline); err != nil {
+		return err
+	}
 	stepNames := make(map[string]bool)
 	for _, step := range pipeline.Steps {
-		if !models.IsValidPipelineStepType(step.StepType) {
+		if step.IsRunByAgent() {
+			if err := validateStepAgent(step); err != nil {
+				return err
+			}
+		} else if !models.IsValidPipelineStepType(step.StepType) {
 			return NewInvalidStepTypeError(step.StepName, string(step.StepType))
 		}
 		if step.StepName == "" {
@@ -32,15 +48,60 @@ func ValidatePipeline(pipeline *models.PipelineModel) error {
 		} else {
 			stepNames[step.StepName] = true
 		}
-		if step.NextStepName == "" && !step.IsTerminalStep {
+		if step.Timeout != "" && !isValidTimeout(step.Timeout) {
+			return NewInvalidPropertyValue("timeout")
+		}
+		if step.Retry != nil {
+			if err := validateRetryPolicy(step.Retry); err != nil {
+				return err
+			}
+		}
+		if step.StepType == models.BranchStep {
+			if err := validateBranchStep(step); err != nil {
+				return err
+			}
+		} else if len(step.GetNextStepNames()) == 0 && !step.IsTerminalStep {
 			return NewNoNextStepError(step.StepName)
 		}
-		if stepNames[step.NextStepName] {
-			return NewCircularReferenceError(step.NextStepName, step.StepName)
+		if step.StepType == models.APIStep {
+			if err := validateApiStep(step); err != nil {
+				return err
+			}
+		}
+		if step.StepType == models.WaitForApprovalStep {
+			if err := validateApprovalStep(step); err != nil {
+				return err
+			}
+		}
+		if step.StepType == models.ScriptStep {
+			if err := validateScriptStep(step); err != nil {
+				return err
+			}
+		}
+		if step.StepType == models.PipelineStep {
+			if err := validatePipelineStep(step); err != nil {
+				return err
+			}
 		}
-		if step.StepName == pipeline.FirstStepName && step.PrevStepName != "" {
+		if step.Compensation != nil {
+			if err := validateCompensation(step); err != nil {
+				return err
+			}
+		}
+		if err := validatePlaceholders(pipeline, step); err != nil {
+			return err
+		}
+		if step.OnFailure != nil {
+			if err := validateOnFailure(step); err != nil {
+				return err
+			}
+		}
+		if step.StepName == pipeline.FirstStepName && (step.PrevStepName != "" || step.IsJoinStep()) {
 			return NewFirstStepContainsPrevStepError(step.StepName)
 		}
+		if step.PrevStepName != "" && step.IsJoinStep() {
+			return NewInvalidPropertyValue("prev_step_names")
+		}
 	}
 
 	if !stepNames[pipeline.FirstStepName] {
@@ -51,15 +112,419 @@ func ValidatePipeline(pipeline *models.PipelineModel) error {
 		if step.PrevStepName != "" && !stepNames[step.PrevStepName] {
 			return NewNoStepNameFoundError("prev_step_name", step.PrevStepName)
 		}
-		if step.PrevStepName != "" && pipeline.GetPipelineStep(step.PrevStepName).NextStepName != step.StepName {
+		if step.PrevStepName != "" && !helper.StringInSlice(step.StepName, getSuccessorStepNames(pipeline.GetPipelineStep(step.PrevStepName))) {
 			prevStep := pipeline.GetPipelineStep(step.PrevStepName)
 			return NewInvalidStepReferenceError(prevStep.StepName, prevStep.NextStepName, step.StepName, step.PrevStepName)
 		}
-		if step.NextStepName != "" && !stepNames[step.NextStepName] {
-			return NewNoStepNameFoundError("next_step_name", step.NextStepName)
+		for _, prevStepName := range step.PrevStepNames {
+			if !stepNames[prevStepName] {
+				return NewNoStepNameFoundError("prev_step_names", prevStepName)
+			}
+			if prevStep := pipeline.GetPipelineStep(prevStepName); !helper.StringInSlice(step.StepName, getSuccessorStepNames(prevStep)) {
+				return NewInvalidStepReferenceError(prevStep.StepName, prevStep.NextStepName, step.StepName, prevStepName)
+			}
+		}
+		for _, nextStepName := range step.GetNextStepNames() {
+			if !stepNames[nextStepName] {
+				return NewNoStepNameFoundError("next_step_name", nextStepName)
+			}
+		}
+		if step.OnFailure.GetAction() == models.RouteOnFailure && !stepNames[step.OnFailure.StepName] {
+			return NewNoStepNameFoundError("on_failure.step_name", step.OnFailure.StepName)
+		}
+	}
+
+	return validatePipelineGraph(pipeline)
+}
+
+// Validates that the steps of the pipeline form a directed acyclic graph in which every step can be reached from the first step.
+func validatePipelineGraph(pipeline *models.PipelineModel) error {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make(map[string]int, len(pipeline.Steps))
+	var visit func(stepName string) error
+	visit = func(stepName string) error {
+		state[stepName] = visiting
+		for _, nextStepName := range getSuccessorStepNames(pipeline.GetPipelineStep(stepName)) {
+			switch state[nextStepName] {
+			case visiting:
+				return NewCircularReferenceError(nextStepName, stepName)
+			case unvisited:
+				if err := visit(nextStepName); err != nil {
+					return err
+				}
+			}
+		}
+		state[stepName] = visited
+		return nil
+	}
+	if err := visit(pipeline.FirstStepName); err != nil {
+		return err
+	}
+
+	for _, step := range pipeline.Steps {
+		if state[step.StepName] == unvisited {
+			return NewUnreachableStepError(step.StepName)
+		}
+	}
+	return nil
+}
+
+// Returns the steps which can run after the step, including its error handler step
+func getSuccessorStepNames(step *models.PipelineStepModel) []string {
+	successors := step.GetNextStepNames()
+	if step.OnFailure.GetAction() == models.RouteOnFailure && !helper.StringInSlice(step.OnFailure.StepName, successors) {
+		successors = append(successors, step.OnFailure.StepName)
+	}
+	return successors
+}
+
+// Returns true if the timeout is a positive duration, e.g. 30s or 5m
+func isValidTimeout(timeout string) bool {
+	d, err := time.ParseDuration(timeout)
+	return err == nil && d > 0
+}
+
+// Validates the retry policy of a step. The backoffs are optional, and the max backoff cannot be less than the initial backoff.
+func validateRetryPolicy(policy *models.RetryPolicy) error {
+	if policy.MaxAttempts < 1 {
+		return NewInvalidPropertyValue("max_attempts")
+	}
+	var initialBackoff, maxBackoff time.Duration
+	var err error
+	if policy.InitialBackoff != "" {
+		if initialBackoff, err = time.ParseDuration(policy.InitialBackoff); err != nil || initialBackoff < 0 {
+			return NewInvalidPropertyValue("initial_backoff")
+		}
+	}
+	if policy.MaxBackoff != "" {
+		if maxBackoff, err = time.ParseDuration(policy.MaxBackoff); err != nil || maxBackoff < initialBackoff {
+			return NewInvalidPropertyValue("max_backoff")
+		}
+	}
+	for _, statusCode := range policy.RetryableStatusCodes {
+		if statusCode < 100 || statusCode > 599 {
+			return NewInvalidPropertyValue("retryable_status_codes")
+		}
+	}
+	for _, retryableError := range policy.RetryableErrors {
+		if !models.IsValidRetryableError(retryableError) {
+			return NewInvalidPropertyValue("retryable_errors")
+		}
+	}
+	return nil
+}
+
+// Validates the branches of a BRANCH step. The next step name of a branch step is optional and is used as the default route.
+func validateBranchStep(step models.PipelineStepModel) error {
+	if step.IsTerminalStep {
+		return NewTerminalBranchStepError(step.StepName)
+	}
+	if len(step.Branches) == 0 {
+		return NewMissingRequiredFieldError("branches")
+	}
+	if len(step.NextStepNames) > 0 {
+		return NewInvalidPropertyValue("next_step_names")
+	}
+	for _, branch := range step.Branches {
+		if branch.Condition == "" {
+			return NewMissingRequiredFieldError("condition")
+		}
+		if branch.NextStepName == "" {
+			return NewMissingRequiredFieldError("next_step_name")
+		}
+		if _, err := helper.ParseExpression(branch.Condition); err != nil {
+			return NewInvalidBranchConditionError(step.StepName, branch.Condition, err)
+		}
+	}
+	return nil
+}
+
+// Validates the assertions on the response of an API step. Conditions with placeholders are only parsed when the step runs.
+func validateApiStep(step models.PipelineStepModel) error {
+	assertions, ok := step.Parameters["assertions"]
+	if !ok {
+		return nil
+	}
+	m, ok := assertions.(map[string]any)
+	if !ok {
+		return NewInvalidPropertyValue("assertions")
+	}
+	if status, ok := m["status"]; ok {
+		list, ok := status.([]any)
+		if !ok || len(list) == 0 {
+			return NewInvalidPropertyValue("assertions.status")
+		}
+		for _, elem := range list {
+			if _, err := helper.ParseStatusCodeRange(elem); err != nil {
+				return NewInvalidPropertyValue("assertions.status")
+			}
+		}
+	}
+	if headers, ok := m["headers"]; ok {
+		h, ok := headers.(map[string]any)
+		if !ok {
+			return NewInvalidPropertyValue("assertions.headers")
+		}
+		for _, v := range h {
+			if _, ok := v.(string); !ok {
+				return NewInvalidPropertyValue("assertions.headers")
+			}
+		}
+	}
+	if body, ok := m["body"]; ok {
+		conditions, ok := body.([]any)
+		if !ok {
+			return NewInvalidPropertyValue("assertions.body")
+		}
+		for _, elem := range conditions {
+			condition, ok := elem.(string)
+			if !ok {
+				return NewInvalidPropertyValue("assertions.body")
+			}
+			if strings.Contains(condition, "${") {
+				continue
+			}
+			if _, err := helper.ParseExpression(condition); err != nil {
+				return NewInvalidPropertyValue("assertions.body")
+			}
+		}
+	}
+	return nil
+}
+
+// Validates the parameters of a SCRIPT step. Values other than the command may contain placeholders, which are only
+// replaced when the step runs.
+func validateScriptStep(step models.PipelineStepModel) error {
+	command, ok := step.Parameters["command"].(string)
+	if !ok || command == "" {
+		return NewMissingRequiredFieldError("command")
+	}
+	// The command cannot be chosen by the form data, which would let requesters run any command
+	if placeholders, err := helper.GetPlaceholders(command); err != nil || len(placeholders) > 0 {
+		return NewInvalidPropertyValue("command")
+	}
+	if args, ok := step.Parameters["args"]; ok {
+		list, ok := args.([]any)
+		if !ok {
+			return NewInvalidPropertyValue("args")
+		}
+		for _, arg := range list {
+			if _, ok := arg.(string); !ok {
+				return NewInvalidPropertyValue("args")
+			}
 		}
 	}
+	if env, ok := step.Parameters["env"]; ok {
+		vars, ok := env.(map[string]any)
+		if !ok {
+			return NewInvalidPropertyValue("env")
+		}
+		for k, v := range vars {
+			if _, ok := v.(string); !ok || models.IsReservedScriptEnvName(k) {
+				return NewInvalidPropertyValue("env")
+			}
+		}
+	}
+	if cpuLimit, ok := step.Parameters["cpu_limit"]; ok {
+		if s, ok := cpuLimit.(string); !ok || !isValidTimeout(s) {
+			return NewInvalidPropertyValue("cpu_limit")
+		}
+	}
+	return nil
+}
 
+// Validates the approval policy and deadline of a WAIT_FOR_APPROVAL step. Parameters with placeholders are only
+// validated when the step runs.
+func validateApprovalStep(step models.PipelineStepModel) error {
+	parameters := map[string]any{}
+	hasPlaceholders := false
+	for _, key := range []string{"quorum", "approvers", "approver_roles", "deadline", "on_deadline", "escalation_approvers", "escalation_approver_roles", "escalation_deadline"} {
+		value, ok := step.Parameters[key]
+		if !ok {
+			continue
+		}
+		if placeholders, err := helper.GetPlaceholders(value); err == nil && len(placeholders) > 0 {
+			hasPlaceholders = true
+			continue
+		}
+		parameters[key] = value
+	}
+	_, err := models.GetApprovalPolicy(parameters)
+	if hasPlaceholders && (errors.Is(err, models.ErrQuorumNotReachable) || errors.Is(err, models.ErrMissingEscalationApprover)) {
+		// The approvers may be set by the parameters with placeholders
+		return nil
+	}
+	switch {
+	case errors.Is(err, models.ErrInvalidApprovalQuorum), errors.Is(err, models.ErrQuorumNotReachable):
+		return NewInvalidPropertyValue("quorum")
+	case errors.Is(err, models.ErrInvalidApprovers):
+		return NewInvalidPropertyValue("approvers")
+	case errors.Is(err, models.ErrInvalidApproverRoles):
+		return NewInvalidPropertyValue("approver_roles")
+	case errors.Is(err, models.ErrInvalidApprovalDeadline):
+		return NewInvalidPropertyValue("deadline")
+	case errors.Is(err, models.ErrInvalidDeadlineAction), errors.Is(err, models.ErrMissingEscalationApprover):
+		return NewInvalidPropertyValue("on_deadline")
+	case errors.Is(err, models.ErrInvalidEscalationApprovers):
+		return NewInvalidPropertyValue("escalation_approvers")
+	case errors.Is(err, models.ErrInvalidEscalationApproverRoles):
+		return NewInvalidPropertyValue("escalation_approver_roles")
+	case errors.Is(err, models.ErrInvalidEscalationDeadline):
+		return NewInvalidPropertyValue("escalation_deadline")
+	}
+	return err
+}
+
+// Validates the parameters of a PIPELINE step. Whether the pipeline exists is only checked when the step runs.
+func validatePipelineStep(step models.PipelineStepModel) error {
+	pipelineId, ok := step.Parameters["pipeline_id"].(string)
+	if !ok || pipelineId == "" {
+		return NewMissingRequiredFieldError("pipeline_id")
+	}
+	if formData, ok := step.Parameters["form_data"]; ok {
+		if _, ok := formData.(map[string]any); !ok {
+			return NewInvalidPropertyValue("form_data")
+		}
+		// The form data is saved with the child service request, so it cannot hold secrets
+		placeholders, err := helper.GetPlaceholders(formData)
+		if err != nil {
+			return NewInvalidPropertyValue("form_data")
+		}
+		for _, placeholder := range placeholders {
+			if helper.IsSecretPlaceholder(placeholder) {
+				return NewInvalidPropertyValue("form_data")
+			}
+		}
+	}
+	if environment, ok := step.Parameters["environment"]; ok {
+		if _, ok := environment.(string); !ok {
+			return NewInvalidPropertyValue("environment")
+		}
+	}
+	return nil
+}
+
+var variableNameRegex = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Validates the variables and environments of a pipeline. Environments can only override the variables of the
+// pipeline, so that every variable has a value in every environment. Variables are strings, numbers or booleans, as
+// only those can replace placeholders.
+func validateVariables(pipeline *models.PipelineModel) error {
+	for name, value := range pipeline.Variables {
+		if !variableNameRegex.MatchString(name) || !isValidVariableValue(value) || helper.ValidatePlaceholders(value) != nil {
+			return NewInvalidPropertyValue("variables")
+		}
+	}
+	for environment, env := range pipeline.Environments {
+		if strings.TrimSpace(environment) == "" {
+			return NewInvalidPropertyValue("environments")
+		}
+		for name, value := range env.Variables {
+			if _, ok := pipeline.Variables[name]; !ok || !isValidVariableValue(value) || helper.ValidatePlaceholders(value) != nil {
+				return NewInvalidPropertyValue(fmt.Sprintf("environments.%s.variables", environment))
+			}
+		}
+	}
+	if _, ok := pipeline.Environments[pipeline.DefaultEnvironment]; pipeline.DefaultEnvironment != "" && !ok {
+		return NewInvalidPropertyValue("default_environment")
+	}
+	return nil
+}
+
+func isValidVariableValue(value any) bool {
+	switch value.(type) {
+	case string, bool, int, int32, int64, float64:
+		return true
+	}
+	return false
+}
+
+// Validates the placeholders in the parameters of a step, and of its compensation. Expressions in placeholders must
+// parse, and variables they reference, e.g. ${vars.NAME}, must be variables of the pipeline.
+func validatePlaceholders(pipeline *models.PipelineModel, step models.PipelineStepModel) error {
+	parameters := []any{step.Parameters}
+	if step.Compensation != nil {
+		parameters = append(parameters, step.Compensation.Parameters)
+	}
+	for _, parameter := range parameters {
+		if err := helper.ValidatePlaceholders(parameter); err != nil {
+			return NewInvalidPlaceholderError(step.StepName, err)
+		}
+		placeholders, err := helper.GetPlaceholders(parameter)
+		if err != nil {
+			return NewInvalidPropertyValue("parameters")
+		}
+		for _, placeholder := range placeholders {
+			for _, identifier := range helper.PlaceholderIdentifiers(placeholder) {
+				name, ok := strings.CutPrefix(identifier, servicerequest.VariablesKey+".")
+				if !ok {
+					continue
+				}
+				if _, ok := pipeline.Variables[name]; !ok {
+					return NewInvalidPropertyValue("parameters")
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// Validates the compensation of a step, whose parameters are validated in the same way as those of a step of its type
+func validateCompensation(step models.PipelineStepModel) error {
+	if !models.IsValidCompensationStepType(step.Compensation.StepType) {
+		return NewInvalidStepTypeError(step.StepName, string(step.Compensation.StepType))
+	}
+	if step.Compensation.Timeout != "" && !isValidTimeout(step.Compensation.Timeout) {
+		return NewInvalidPropertyValue("timeout")
+	}
+	if step.Compensation.StepType == models.APIStep {
+		return validateApiStep(*step.GetCompensationStep())
+	}
+	if step.Compensation.StepType == models.ScriptStep {
+		return validateScriptStep(*step.GetCompensationStep())
+	}
+	return nil
+}
+
+// Validates a step which runs on a remote agent. Agents may run step types which the backend has no executor for, but
+// not those which complete within the backend. Agents do not retry steps, so steps with a retry policy cannot run on them.
+func validateStepAgent(step models.PipelineStepModel) error {
+	if !models.IsValidAgentStepType(step.StepType) {
+		return NewInvalidStepTypeError(step.StepName, string(step.StepType))
+	}
+	if step.Retry != nil {
+		return NewInvalidPropertyValue("retry")
+	}
+	for _, label := range step.Agent.Labels {
+		if strings.TrimSpace(label) == "" {
+			return NewInvalidPropertyValue("agent.labels")
+		}
+	}
+	return nil
+}
+
+// Validates the on_failure policy of a step. Whether the error handler step exists is checked with the other references.
+func validateOnFailure(step models.PipelineStepModel) error {
+	switch step.OnFailure.Action {
+	case models.FailOnFailure, models.ContinueOnFailure:
+		if step.OnFailure.StepName != "" {
+			return NewInvalidPropertyValue("on_failure.step_name")
+		}
+		// BRANCH steps continue to their default step as no branch was chosen
+		if step.OnFailure.Action == models.ContinueOnFailure && step.StepType == models.BranchStep && step.NextStepName == "" {
+			return NewInvalidPropertyValue("on_failure.action")
+		}
+	case models.RouteOnFailure:
+		if step.OnFailure.StepName == "" {
+			return NewMissingRequiredFieldError("on_failure.step_name")
+		}
+	default:
+		return NewInvalidPropertyValue("on_failure.action")
+	}
 	return nil
 }
 
@@ -68,6 +533,9 @@ func ValidateFormField(f models.FormField) error {
 	if f.Name == "" {
 		return NewMissingRequiredFieldError("name")
 	}
+	if slices.Contains(servicerequest.ReservedFormFieldNames, f.Name) {
+		return NewReservedFormFieldNameError(f.Name)
+	}
 	if f.Title == "" {
 		return NewMissingRequiredFieldError("title")
 	}
@@ -1,9 +1,11 @@
 package validation
 
 import (
+	"fmt"
 	"testing"
 
 	"github.com/joshtyf/flowforge/src/database/models"
+	"github.com/joshtyf/flowforge/src/helper"
 )
 
 func TestValidatePipeline(t *testing.T) {
@@ -209,6 +211,826 @@ func TestValidatePipeline(t *testing.T) {
 			},
 			NewCircularReferenceError("step1", "step3"),
 		},
+		{
+			"Valid pipeline with branch step",
+			&models.PipelineModel{
+				PipelineName: "test",
+				Steps: []models.PipelineStepModel{
+					{StepName: "step1", StepType: models.BranchStep, NextStepName: "step3", Branches: []models.PipelineStepBranch{
+						{Condition: `env == "prod"`, NextStepName: "step2"},
+					}},
+					{StepName: "step2", StepType: models.WaitForApprovalStep, PrevStepName: "step1", NextStepName: "step3"},
+					{StepName: "step3", StepType: models.APIStep, PrevStepName: "step1", IsTerminalStep: true},
+				},
+				FirstStepName: "step1",
+			},
+			nil,
+		},
+		{
+			"Branch step without branches",
+			&models.PipelineModel{
+				PipelineName: "test",
+				Steps: []models.PipelineStepModel{
+					{StepName: "step1", StepType: models.BranchStep, NextStepName: "step2"},
+					{StepName: "step2", StepType: models.APIStep, IsTerminalStep: true},
+				},
+				FirstStepName: "step1",
+			},
+			NewMissingRequiredFieldError("branches"),
+		},
+		{
+			"Terminal branch step",
+			&models.PipelineModel{
+				PipelineName: "test",
+				Steps: []models.PipelineStepModel{
+					{StepName: "step1", StepType: models.BranchStep, IsTerminalStep: true, Branches: []models.PipelineStepBranch{
+						{Condition: "flag", NextStepName: "step2"},
+					}},
+					{StepName: "step2", StepType: models.APIStep, IsTerminalStep: true},
+				},
+				FirstStepName: "step1",
+			},
+			NewTerminalBranchStepError("step1"),
+		},
+		{
+			"Branch with invalid condition",
+			&models.PipelineModel{
+				PipelineName: "test",
+				Steps: []models.PipelineStepModel{
+					{StepName: "step1", StepType: models.BranchStep, Branches: []models.PipelineStepBranch{
+						{Condition: "env ==", NextStepName: "step2"},
+					}},
+					{StepName: "step2", StepType: models.APIStep, IsTerminalStep: true},
+				},
+				FirstStepName: "step1",
+			},
+			NewInvalidBranchConditionError("step1", "env ==", fmt.Errorf("%w: unexpected end of expression", helper.ErrInvalidExpression)),
+		},
+		{
+			"Branch to unknown step",
+			&models.PipelineModel{
+				PipelineName: "test",
+				Steps: []models.PipelineStepModel{
+					{StepName: "step1", StepType: models.BranchStep, NextStepName: "step2", Branches: []models.PipelineStepBranch{
+						{Condition: "flag", NextStepName: "step3"},
+					}},
+					{StepName: "step2", StepType: models.APIStep, IsTerminalStep: true},
+				},
+				FirstStepName: "step1",
+			},
+			NewNoStepNameFoundError("next_step_name", "step3"),
+		},
+		{
+			"Circular reference through branch",
+			&models.PipelineModel{
+				PipelineName: "test",
+				Steps: []models.PipelineStepModel{
+					{StepName: "step1", StepType: models.APIStep, NextStepName: "step2"},
+					{StepName: "step2", StepType: models.BranchStep, NextStepName: "step3", Branches: []models.PipelineStepBranch{
+						{Condition: "retry", NextStepName: "step1"},
+					}},
+					{StepName: "step3", StepType: models.APIStep, IsTerminalStep: true},
+				},
+				FirstStepName: "step1",
+			},
+			NewCircularReferenceError("step1", "step2"),
+		},
+		{
+			"Valid pipeline with parallel steps",
+			&models.PipelineModel{
+				PipelineName: "test",
+				Steps: []models.PipelineStepModel{
+					{StepName: "step1", StepType: models.APIStep, NextStepNames: []string{"step2", "step3"}},
+					{StepName: "step2", StepType: models.APIStep, PrevStepName: "step1", NextStepName: "step4"},
+					{StepName: "step3", StepType: models.APIStep, PrevStepName: "step1", NextStepName: "step4"},
+					{StepName: "step4", StepType: models.APIStep, PrevStepNames: []string{"step2", "step3"}, IsTerminalStep: true},
+				},
+				FirstStepName: "step1",
+			},
+			nil,
+		},
+		{
+			"Join step with prev step not leading to it",
+			&models.PipelineModel{
+				PipelineName: "test",
+				Steps: []models.PipelineStepModel{
+					{StepName: "step1", StepType: models.APIStep, NextStepNames: []string{"step2", "step3"}},
+					{StepName: "step2", StepType: models.APIStep, NextStepName: "step4"},
+					{StepName: "step3", StepType: models.APIStep, IsTerminalStep: true},
+					{StepName: "step4", StepType: models.APIStep, PrevStepNames: []string{"step2", "step3"}, IsTerminalStep: true},
+				},
+				FirstStepName: "step1",
+			},
+			NewInvalidStepReferenceError("step3", "", "step4", "step3"),
+		},
+		{
+			"Circular reference through parallel steps",
+			&models.PipelineModel{
+				PipelineName: "test",
+				Steps: []models.PipelineStepModel{
+					{StepName: "step1", StepType: models.APIStep, NextStepName: "step2"},
+					{StepName: "step2", StepType: models.APIStep, NextStepNames: []string{"step3", "step4"}},
+					{StepName: "step3", StepType: models.APIStep, IsTerminalStep: true},
+					{StepName: "step4", StepType: models.APIStep, NextStepName: "step2"},
+				},
+				FirstStepName: "step1",
+			},
+			NewCircularReferenceError("step2", "step4"),
+		},
+		{
+			"Unreachable step",
+			&models.PipelineModel{
+				PipelineName: "test",
+				Steps: []models.PipelineStepModel{
+					{StepName: "step1", StepType: models.APIStep, NextStepName: "step2"},
+					{StepName: "step2", StepType: models.APIStep, IsTerminalStep: true},
+					{StepName: "step3", StepType: models.APIStep, NextStepName: "step2"},
+				},
+				FirstStepName: "step1",
+			},
+			NewUnreachableStepError("step3"),
+		},
+		{
+			"Valid pipeline with retry policy",
+			&models.PipelineModel{
+				PipelineName: "test",
+				Steps: []models.PipelineStepModel{
+					{StepName: "step1", StepType: models.APIStep, IsTerminalStep: true, Retry: &models.RetryPolicy{
+						MaxAttempts: 3, InitialBackoff: "1s", MaxBackoff: "10s", RetryableStatusCodes: []int{503}, RetryableErrors: []string{"network"},
+					}},
+				},
+				FirstStepName: "step1",
+			},
+			nil,
+		},
+		{
+			"Retry policy without attempts",
+			&models.PipelineModel{
+				PipelineName: "test",
+				Steps: []models.PipelineStepModel{
+					{StepName: "step1", StepType: models.APIStep, IsTerminalStep: true, Retry: &models.RetryPolicy{}},
+				},
+				FirstStepName: "step1",
+			},
+			NewInvalidPropertyValue("max_attempts"),
+		},
+		{
+			"Retry policy with max backoff less than initial backoff",
+			&models.PipelineModel{
+				PipelineName: "test",
+				Steps: []models.PipelineStepModel{
+					{StepName: "step1", StepType: models.APIStep, IsTerminalStep: true, Retry: &models.RetryPolicy{
+						MaxAttempts: 3, InitialBackoff: "10s", MaxBackoff: "1s",
+					}},
+				},
+				FirstStepName: "step1",
+			},
+			NewInvalidPropertyValue("max_backoff"),
+		},
+		{
+			"Retry policy with unknown retryable error",
+			&models.PipelineModel{
+				PipelineName: "test",
+				Steps: []models.PipelineStepModel{
+					{StepName: "step1", StepType: models.APIStep, IsTerminalStep: true, Retry: &models.RetryPolicy{
+						MaxAttempts: 3, RetryableErrors: []string{"dns"},
+					}},
+				},
+				FirstStepName: "step1",
+			},
+			NewInvalidPropertyValue("retryable_errors"),
+		},
+		{
+			"Valid pipeline with timeouts",
+			&models.PipelineModel{
+				PipelineName: "test",
+				Steps: []models.PipelineStepModel{
+					{StepName: "step1", StepType: models.APIStep, IsTerminalStep: true, Timeout: "30s"},
+				},
+				FirstStepName: "step1",
+				Timeout:       "1h",
+			},
+			nil,
+		},
+		{
+			"Invalid step timeout",
+			&models.PipelineModel{
+				PipelineName: "test",
+				Steps: []models.PipelineStepModel{
+					{StepName: "step1", StepType: models.APIStep, IsTerminalStep: true, Timeout: "30"},
+				},
+				FirstStepName: "step1",
+			},
+			NewInvalidPropertyValue("timeout"),
+		},
+		{
+			"Invalid pipeline timeout",
+			&models.PipelineModel{
+				PipelineName: "test",
+				Steps: []models.PipelineStepModel{
+					{StepName: "step1", StepType: models.APIStep, IsTerminalStep: true},
+				},
+				FirstStepName: "step1",
+				Timeout:       "-1h",
+			},
+			NewInvalidPropertyValue("timeout"),
+		},
+		{
+			"Valid script step",
+			&models.PipelineModel{
+				PipelineName: "test",
+				Steps: []models.PipelineStepModel{
+					{StepName: "step1", StepType: models.ScriptStep, IsTerminalStep: true, Parameters: map[string]any{
+						"command":   "python3",
+						"args":      []any{"-c", "print('${name}')"},
+						"env":       map[string]any{"NAME": "${name}"},
+						"cpu_limit": "10s",
+					}},
+				},
+				FirstStepName: "step1",
+			},
+			nil,
+		},
+		{
+			"Script step without command",
+			&models.PipelineModel{
+				PipelineName: "test",
+				Steps: []models.PipelineStepModel{
+					{StepName: "step1", StepType: models.ScriptStep, IsTerminalStep: true, Parameters: map[string]any{}},
+				},
+				FirstStepName: "step1",
+			},
+			NewMissingRequiredFieldError("command"),
+		},
+		{
+			"Script step with placeholder in command",
+			&models.PipelineModel{
+				PipelineName: "test",
+				Steps: []models.PipelineStepModel{
+					{StepName: "step1", StepType: models.ScriptStep, IsTerminalStep: true, Parameters: map[string]any{
+						"command": "${tool}",
+					}},
+				},
+				FirstStepName: "step1",
+			},
+			NewInvalidPropertyValue("command"),
+		},
+		{
+			"Script step with non-string args",
+			&models.PipelineModel{
+				PipelineName: "test",
+				Steps: []models.PipelineStepModel{
+					{StepName: "step1", StepType: models.ScriptStep, IsTerminalStep: true, Parameters: map[string]any{
+						"command": "echo", "args": []any{1},
+					}},
+				},
+				FirstStepName: "step1",
+			},
+			NewInvalidPropertyValue("args"),
+		},
+		{
+			"Script step with non-string env",
+			&models.PipelineModel{
+				PipelineName: "test",
+				Steps: []models.PipelineStepModel{
+					{StepName: "step1", StepType: models.ScriptStep, IsTerminalStep: true, Parameters: map[string]any{
+						"command": "echo", "env": map[string]any{"DEBUG": true},
+					}},
+				},
+				FirstStepName: "step1",
+			},
+			NewInvalidPropertyValue("env"),
+		},
+		{
+			"Script step with reserved env",
+			&models.PipelineModel{
+				PipelineName: "test",
+				Steps: []models.PipelineStepModel{
+					{StepName: "step1", StepType: models.ScriptStep, IsTerminalStep: true, Parameters: map[string]any{
+						"command": "echo", "env": map[string]any{"LD_PRELOAD": "/tmp/lib.so"},
+					}},
+				},
+				FirstStepName: "step1",
+			},
+			NewInvalidPropertyValue("env"),
+		},
+		{
+			"Script step with invalid cpu limit",
+			&models.PipelineModel{
+				PipelineName: "test",
+				Steps: []models.PipelineStepModel{
+					{StepName: "step1", StepType: models.ScriptStep, IsTerminalStep: true, Parameters: map[string]any{
+						"command": "echo", "cpu_limit": "10",
+					}},
+				},
+				FirstStepName: "step1",
+			},
+			NewInvalidPropertyValue("cpu_limit"),
+		},
+		{
+			"Valid API step assertions",
+			&models.PipelineModel{
+				PipelineName: "test",
+				Steps: []models.PipelineStepModel{
+					{StepName: "step1", StepType: models.APIStep, IsTerminalStep: true, Parameters: map[string]any{
+						"assertions": map[string]any{
+							"status":  []any{"200", "2xx", "200-204"},
+							"headers": map[string]any{"Content-Type": "application/json"},
+							"body":    []any{`$.status == "ok"`, `$.id == "${id}"`},
+						},
+					}},
+				},
+				FirstStepName: "step1",
+			},
+			nil,
+		},
+		{
+			"API step with numeric status assertion",
+			&models.PipelineModel{
+				PipelineName: "test",
+				Steps: []models.PipelineStepModel{
+					{StepName: "step1", StepType: models.APIStep, IsTerminalStep: true, Parameters: map[string]any{
+						"assertions": map[string]any{"status": []any{float64(201)}},
+					}},
+				},
+				FirstStepName: "step1",
+			},
+			nil,
+		},
+		{
+			"API step with invalid body assertion",
+			&models.PipelineModel{
+				PipelineName: "test",
+				Steps: []models.PipelineStepModel{
+					{StepName: "step1", StepType: models.APIStep, IsTerminalStep: true, Parameters: map[string]any{
+						"assertions": map[string]any{"body": []any{`$.status = "ok"`}},
+					}},
+				},
+				FirstStepName: "step1",
+			},
+			NewInvalidPropertyValue("assertions.body"),
+		},
+		{
+			"Valid approval step with quorum",
+			&models.PipelineModel{
+				PipelineName: "test",
+				Steps: []models.PipelineStepModel{
+					{StepName: "step1", StepType: models.WaitForApprovalStep, IsTerminalStep: true, Parameters: map[string]any{
+						"quorum":         "2",
+						"approvers":      []any{"user1", "${approver}"},
+						"approver_roles": []any{"Owner"},
+					}},
+				},
+				FirstStepName: "step1",
+			},
+			nil,
+		},
+		{
+			"Approval step with numeric quorum",
+			&models.PipelineModel{
+				PipelineName: "test",
+				Steps: []models.PipelineStepModel{
+					{StepName: "step1", StepType: models.WaitForApprovalStep, IsTerminalStep: true, Parameters: map[string]any{
+						"quorum":    float64(2),
+						"approvers": []any{"user1", "user2"},
+					}},
+				},
+				FirstStepName: "step1",
+			},
+			nil,
+		},
+		{
+			"Approval step with quorum greater than approvers",
+			&models.PipelineModel{
+				PipelineName: "test",
+				Steps: []models.PipelineStepModel{
+					{StepName: "step1", StepType: models.WaitForApprovalStep, IsTerminalStep: true, Parameters: map[string]any{
+						"quorum":    "3",
+						"approvers": []any{"user1", "user2"},
+					}},
+				},
+				FirstStepName: "step1",
+			},
+			NewInvalidPropertyValue("quorum"),
+		},
+		{
+			"Valid approval step with escalation",
+			&models.PipelineModel{
+				PipelineName: "test",
+				Steps: []models.PipelineStepModel{
+					{StepName: "step1", StepType: models.WaitForApprovalStep, IsTerminalStep: true, Parameters: map[string]any{
+						"deadline":             "24h",
+						"on_deadline":          "escalate",
+						"escalation_approvers": []any{"${manager}"},
+						"escalation_deadline":  "48h",
+					}},
+				},
+				FirstStepName: "step1",
+			},
+			nil,
+		},
+		{
+			"Approval step with invalid deadline",
+			&models.PipelineModel{
+				PipelineName: "test",
+				Steps: []models.PipelineStepModel{
+					{StepName: "step1", StepType: models.WaitForApprovalStep, IsTerminalStep: true, Parameters: map[string]any{
+						"deadline": "1 day",
+					}},
+				},
+				FirstStepName: "step1",
+			},
+			NewInvalidPropertyValue("deadline"),
+		},
+		{
+			"Approval step escalating without escalation approvers",
+			&models.PipelineModel{
+				PipelineName: "test",
+				Steps: []models.PipelineStepModel{
+					{StepName: "step1", StepType: models.WaitForApprovalStep, IsTerminalStep: true, Parameters: map[string]any{
+						"deadline":    "24h",
+						"on_deadline": "escalate",
+					}},
+				},
+				FirstStepName: "step1",
+			},
+			NewInvalidPropertyValue("on_deadline"),
+		},
+		{
+			"Approval step with invalid escalation deadline",
+			&models.PipelineModel{
+				PipelineName: "test",
+				Steps: []models.PipelineStepModel{
+					{StepName: "step1", StepType: models.WaitForApprovalStep, IsTerminalStep: true, Parameters: map[string]any{
+						"deadline":                  "24h",
+						"on_deadline":               "escalate",
+						"escalation_approver_roles": []any{"Owner"},
+						"escalation_deadline":       "0s",
+					}},
+				},
+				FirstStepName: "step1",
+			},
+			NewInvalidPropertyValue("escalation_deadline"),
+		},
+		{
+			"Approval step with invalid approver role",
+			&models.PipelineModel{
+				PipelineName: "test",
+				Steps: []models.PipelineStepModel{
+					{StepName: "step1", StepType: models.WaitForApprovalStep, IsTerminalStep: true, Parameters: map[string]any{
+						"approver_roles": []any{"Approver"},
+					}},
+				},
+				FirstStepName: "step1",
+			},
+			NewInvalidPropertyValue("approver_roles"),
+		},
+		{
+			"Valid pipeline step",
+			&models.PipelineModel{
+				PipelineName: "test",
+				Steps: []models.PipelineStepModel{
+					{StepName: "step1", StepType: models.PipelineStep, IsTerminalStep: true, Parameters: map[string]any{
+						"pipeline_id": "65e1f3c0a1b2c3d4e5f60718",
+						"form_data":   map[string]any{"name": "${name}"},
+					}},
+				},
+				FirstStepName: "step1",
+			},
+			nil,
+		},
+		{
+			"Pipeline step without pipeline id",
+			&models.PipelineModel{
+				PipelineName: "test",
+				Steps: []models.PipelineStepModel{
+					{StepName: "step1", StepType: models.PipelineStep, IsTerminalStep: true, Parameters: map[string]any{
+						"form_data": map[string]any{},
+					}},
+				},
+				FirstStepName: "step1",
+			},
+			NewMissingRequiredFieldError("pipeline_id"),
+		},
+		{
+			"Pipeline step with invalid form data",
+			&models.PipelineModel{
+				PipelineName: "test",
+				Steps: []models.PipelineStepModel{
+					{StepName: "step1", StepType: models.PipelineStep, IsTerminalStep: true, Parameters: map[string]any{
+						"pipeline_id": "65e1f3c0a1b2c3d4e5f60718", "form_data": "name",
+					}},
+				},
+				FirstStepName: "step1",
+			},
+			NewInvalidPropertyValue("form_data"),
+		},
+		{
+			"Pipeline step passing secrets to the child service request",
+			&models.PipelineModel{
+				PipelineName: "test",
+				Steps: []models.PipelineStepModel{
+					{StepName: "step1", StepType: models.PipelineStep, IsTerminalStep: true, Parameters: map[string]any{
+						"pipeline_id": "65e1f3c0a1b2c3d4e5f60718", "form_data": map[string]any{"token": "${secrets.API_TOKEN}"},
+					}},
+				},
+				FirstStepName: "step1",
+			},
+			NewInvalidPropertyValue("form_data"),
+		},
+		{
+			"Valid compensation",
+			&models.PipelineModel{
+				PipelineName: "test",
+				Steps: []models.PipelineStepModel{
+					{StepName: "step1", StepType: models.APIStep, IsTerminalStep: true, Compensation: &models.PipelineStepCompensation{
+						StepType:   models.APIStep,
+						Parameters: map[string]any{"method": "DELETE", "url": "http://localhost/vms/${steps.step1.body.id}"},
+						Timeout:    "30s",
+					}},
+				},
+				FirstStepName: "step1",
+			},
+			nil,
+		},
+		{
+			"Compensation with invalid step type",
+			&models.PipelineModel{
+				PipelineName: "test",
+				Steps: []models.PipelineStepModel{
+					{StepName: "step1", StepType: models.APIStep, IsTerminalStep: true, Compensation: &models.PipelineStepCompensation{
+						StepType: models.WaitForApprovalStep,
+					}},
+				},
+				FirstStepName: "step1",
+			},
+			NewInvalidStepTypeError("step1", string(models.WaitForApprovalStep)),
+		},
+		{
+			"Script compensation without command",
+			&models.PipelineModel{
+				PipelineName: "test",
+				Steps: []models.PipelineStepModel{
+					{StepName: "step1", StepType: models.APIStep, IsTerminalStep: true, Compensation: &models.PipelineStepCompensation{
+						StepType:   models.ScriptStep,
+						Parameters: map[string]any{},
+					}},
+				},
+				FirstStepName: "step1",
+			},
+			NewMissingRequiredFieldError("command"),
+		},
+		{
+			"Valid on_failure route",
+			&models.PipelineModel{
+				PipelineName: "test",
+				Steps: []models.PipelineStepModel{
+					{StepName: "step1", StepType: models.APIStep, NextStepName: "step2", OnFailure: &models.OnFailurePolicy{Action: models.RouteOnFailure, StepName: "handler"}},
+					{StepName: "step2", StepType: models.APIStep, PrevStepName: "step1", IsTerminalStep: true},
+					{StepName: "handler", StepType: models.APIStep, PrevStepName: "step1", IsTerminalStep: true},
+				},
+				FirstStepName: "step1",
+			},
+			nil,
+		},
+		{
+			"Valid on_failure continue",
+			&models.PipelineModel{
+				PipelineName: "test",
+				Steps: []models.PipelineStepModel{
+					{StepName: "step1", StepType: models.APIStep, NextStepName: "step2", OnFailure: &models.OnFailurePolicy{Action: models.ContinueOnFailure}},
+					{StepName: "step2", StepType: models.APIStep, PrevStepName: "step1", IsTerminalStep: true},
+				},
+				FirstStepName: "step1",
+			},
+			nil,
+		},
+		{
+			"Invalid on_failure action",
+			&models.PipelineModel{
+				PipelineName: "test",
+				Steps: []models.PipelineStepModel{
+					{StepName: "step1", StepType: models.APIStep, IsTerminalStep: true, OnFailure: &models.OnFailurePolicy{Action: "ignore"}},
+				},
+				FirstStepName: "step1",
+			},
+			NewInvalidPropertyValue("on_failure.action"),
+		},
+		{
+			"on_failure route without step name",
+			&models.PipelineModel{
+				PipelineName: "test",
+				Steps: []models.PipelineStepModel{
+					{StepName: "step1", StepType: models.APIStep, IsTerminalStep: true, OnFailure: &models.OnFailurePolicy{Action: models.RouteOnFailure}},
+				},
+				FirstStepName: "step1",
+			},
+			NewMissingRequiredFieldError("on_failure.step_name"),
+		},
+		{
+			"on_failure route to missing step",
+			&models.PipelineModel{
+				PipelineName: "test",
+				Steps: []models.PipelineStepModel{
+					{StepName: "step1", StepType: models.APIStep, IsTerminalStep: true, OnFailure: &models.OnFailurePolicy{Action: models.RouteOnFailure, StepName: "handler"}},
+				},
+				FirstStepName: "step1",
+			},
+			NewNoStepNameFoundError("on_failure.step_name", "handler"),
+		},
+		{
+			"on_failure route creating a cycle",
+			&models.PipelineModel{
+				PipelineName: "test",
+				Steps: []models.PipelineStepModel{
+					{StepName: "step1", StepType: models.APIStep, NextStepName: "step2"},
+					{StepName: "step2", StepType: models.APIStep, PrevStepName: "step1", IsTerminalStep: true, OnFailure: &models.OnFailurePolicy{Action: models.RouteOnFailure, StepName: "step1"}},
+				},
+				FirstStepName: "step1",
+			},
+			NewCircularReferenceError("step1", "step2"),
+		},
+		{
+			"on_failure continue on branch step without default",
+			&models.PipelineModel{
+				PipelineName: "test",
+				Steps: []models.PipelineStepModel{
+					{StepName: "step1", StepType: models.BranchStep, Branches: []models.PipelineStepBranch{{Condition: "true", NextStepName: "step2"}}, OnFailure: &models.OnFailurePolicy{Action: models.ContinueOnFailure}},
+					{StepName: "step2", StepType: models.APIStep, PrevStepName: "step1", IsTerminalStep: true},
+				},
+				FirstStepName: "step1",
+			},
+			NewInvalidPropertyValue("on_failure.action"),
+		},
+		{
+			"Step type without executor run by agent",
+			&models.PipelineModel{
+				PipelineName: "test",
+				Steps: []models.PipelineStepModel{
+					{StepName: "step1", StepType: "TERRAFORM", IsTerminalStep: true, Agent: &models.PipelineStepAgent{Labels: []string{"vpc-a"}}},
+				},
+				FirstStepName: "step1",
+			},
+			nil,
+		},
+		{
+			"Step type without executor not run by agent",
+			&models.PipelineModel{
+				PipelineName: "test",
+				Steps: []models.PipelineStepModel{
+					{StepName: "step1", StepType: "TERRAFORM", IsTerminalStep: true},
+				},
+				FirstStepName: "step1",
+			},
+			NewInvalidStepTypeError("step1", "TERRAFORM"),
+		},
+		{
+			"Approval step run by agent",
+			&models.PipelineModel{
+				PipelineName: "test",
+				Steps: []models.PipelineStepModel{
+					{StepName: "step1", StepType: models.WaitForApprovalStep, IsTerminalStep: true, Agent: &models.PipelineStepAgent{}},
+				},
+				FirstStepName: "step1",
+			},
+			NewInvalidStepTypeError("step1", string(models.WaitForApprovalStep)),
+		},
+		{
+			"Step run by agent with retry policy",
+			&models.PipelineModel{
+				PipelineName: "test",
+				Steps: []models.PipelineStepModel{
+					{StepName: "step1", StepType: "TERRAFORM", IsTerminalStep: true, Agent: &models.PipelineStepAgent{}, Retry: &models.RetryPolicy{MaxAttempts: 3}},
+				},
+				FirstStepName: "step1",
+			},
+			NewInvalidPropertyValue("retry"),
+		},
+		{
+			"Step run by agent with empty label",
+			&models.PipelineModel{
+				PipelineName: "test",
+				Steps: []models.PipelineStepModel{
+					{StepName: "step1", StepType: "TERRAFORM", IsTerminalStep: true, Agent: &models.PipelineStepAgent{Labels: []string{" "}}},
+				},
+				FirstStepName: "step1",
+			},
+			NewInvalidPropertyValue("agent.labels"),
+		},
+		{
+			"Pipeline with variables and environments",
+			&models.PipelineModel{
+				PipelineName: "test",
+				Steps: []models.PipelineStepModel{
+					{StepName: "step1", StepType: models.APIStep, IsTerminalStep: true, Parameters: map[string]any{"url": "${vars.base_url}/vms", "method": "GET"}},
+				},
+				FirstStepName:      "step1",
+				Variables:          map[string]any{"base_url": "https://staging.example.com", "replicas": float64(1)},
+				Environments:       map[string]models.PipelineEnvironment{"prod": {Variables: map[string]any{"base_url": "https://example.com"}}},
+				DefaultEnvironment: "prod",
+			},
+			nil,
+		},
+		{
+			"Variable with invalid name",
+			&models.PipelineModel{
+				PipelineName: "test",
+				Steps: []models.PipelineStepModel{
+					{StepName: "step1", StepType: models.APIStep, IsTerminalStep: true},
+				},
+				FirstStepName: "step1",
+				Variables:     map[string]any{"base-url": "https://example.com"},
+			},
+			NewInvalidPropertyValue("variables"),
+		},
+		{
+			"Variable with object value",
+			&models.PipelineModel{
+				PipelineName: "test",
+				Steps: []models.PipelineStepModel{
+					{StepName: "step1", StepType: models.APIStep, IsTerminalStep: true},
+				},
+				FirstStepName: "step1",
+				Variables:     map[string]any{"config": map[string]any{"replicas": 1}},
+			},
+			NewInvalidPropertyValue("variables"),
+		},
+		{
+			"Environment overriding undeclared variable",
+			&models.PipelineModel{
+				PipelineName: "test",
+				Steps: []models.PipelineStepModel{
+					{StepName: "step1", StepType: models.APIStep, IsTerminalStep: true},
+				},
+				FirstStepName: "step1",
+				Variables:     map[string]any{"base_url": "https://staging.example.com"},
+				Environments:  map[string]models.PipelineEnvironment{"prod": {Variables: map[string]any{"baseurl": "https://example.com"}}},
+			},
+			NewInvalidPropertyValue("environments.prod.variables"),
+		},
+		{
+			"Undefined default environment",
+			&models.PipelineModel{
+				PipelineName: "test",
+				Steps: []models.PipelineStepModel{
+					{StepName: "step1", StepType: models.APIStep, IsTerminalStep: true},
+				},
+				FirstStepName:      "step1",
+				Environments:       map[string]models.PipelineEnvironment{"prod": {}},
+				DefaultEnvironment: "staging",
+			},
+			NewInvalidPropertyValue("default_environment"),
+		},
+		{
+			"Step referencing undeclared variable",
+			&models.PipelineModel{
+				PipelineName: "test",
+				Steps: []models.PipelineStepModel{
+					{StepName: "step1", StepType: models.APIStep, IsTerminalStep: true, Parameters: map[string]any{"url": "${vars.base_url}/vms", "method": "GET"}},
+				},
+				FirstStepName: "step1",
+			},
+			NewInvalidPropertyValue("parameters"),
+		},
+		{
+			"Compensation referencing undeclared variable",
+			&models.PipelineModel{
+				PipelineName: "test",
+				Steps: []models.PipelineStepModel{
+					{
+						StepName:       "step1",
+						StepType:       models.APIStep,
+						IsTerminalStep: true,
+						Compensation:   &models.PipelineStepCompensation{StepType: models.APIStep, Parameters: map[string]any{"url": "${vars.base_url}/vms", "method": "DELETE"}},
+					},
+				},
+				FirstStepName: "step1",
+				Variables:     map[string]any{"url": "https://example.com"},
+			},
+			NewInvalidPropertyValue("parameters"),
+		},
+		{
+			"Step with valid placeholder expressions",
+			&models.PipelineModel{
+				PipelineName: "test",
+				Steps: []models.PipelineStepModel{
+					{StepName: "step1", StepType: models.APIStep, IsTerminalStep: true, Parameters: map[string]any{"url": "https://example.com/${region | default \"us-east-1\" | lower}", "method": "GET"}},
+				},
+				FirstStepName: "step1",
+			},
+			nil,
+		},
+		{
+			"Step with invalid placeholder expression",
+			&models.PipelineModel{
+				PipelineName: "test",
+				Steps: []models.PipelineStepModel{
+					{StepName: "step1", StepType: models.APIStep, IsTerminalStep: true, Parameters: map[string]any{"url": "https://example.com/${region | capitalize}", "method": "GET"}},
+				},
+				FirstStepName: "step1",
+			},
+			NewInvalidPlaceholderError("step1", fmt.Errorf("placeholder ${region | capitalize}: %w: unknown function 'capitalize' at position 9", helper.ErrInvalidExpression)),
+		},
 	}
 	for _, tc := range testCases {
 		t.Run(tc.testDescription, func(t *testing.T) {
@@ -324,6 +1146,34 @@ func TestValidateFormField(t *testing.T) {
 			},
 			NewInvalidPropertyValue("options"),
 		},
+		{
+			"Reserved name steps",
+			models.FormField{
+				Name: "steps", Title: "Steps", Type: models.InputField,
+			},
+			NewReservedFormFieldNameError("steps"),
+		},
+		{
+			"Reserved name form",
+			models.FormField{
+				Name: "form", Title: "Form", Type: models.InputField,
+			},
+			NewReservedFormFieldNameError("form"),
+		},
+		{
+			"Reserved name secrets",
+			models.FormField{
+				Name: "secrets", Title: "Secrets", Type: models.InputField,
+			},
+			NewReservedFormFieldNameError("secrets"),
+		},
+		{
+			"Reserved name vars",
+			models.FormField{
+				Name: "vars", Title: "Variables", Type: models.InputField,
+			},
+			NewReservedFormFieldNameError("vars"),
+		},
 	}
 	for _, tc := range testcases {
 		t.Run(tc.testDescription, func(t *testing.T) {